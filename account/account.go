@@ -1,6 +1,7 @@
 package account
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -8,17 +9,26 @@ import (
 	"github.com/billfort/binance-usdmfuture/pub"
 )
 
+// Client sends account requests with the settings and key of the wrapped pub.Client.
+type Client struct {
+	*pub.Client
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c}
+}
+
 // Get account balance (USER_DATA)
 // version: v2, v3
 // v3: https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Futures-Account-Balance-V3
 // v2: https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Futures-Account-Balance-V2
-func AccountBalance(key *pub.Key, version string) ([]accountBalance, error) {
-	resBody, err := pub.GetWithSign(key, fmt.Sprintf("/fapi/%v/balance", version), nil)
+func (c *Client) AccountBalance(ctx context.Context, version string) ([]Balance, error) {
+	resBody, err := c.GetWithSign(ctx, fmt.Sprintf("/fapi/%v/balance", version), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []accountBalance
+	var resp []Balance
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -31,13 +41,13 @@ func AccountBalance(key *pub.Key, version string) ([]accountBalance, error) {
 // version: v2, v3
 // v3: https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Account-Information-V3
 // v2: https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Account-Information-V2
-func AccountInfo(key *pub.Key, version string) (*accountInfo, error) {
-	resBody, err := pub.GetWithSign(key, fmt.Sprintf("/fapi/%v/account", version), nil)
+func (c *Client) AccountInfo(ctx context.Context, version string) (*Info, error) {
+	resBody, err := c.GetWithSign(ctx, fmt.Sprintf("/fapi/%v/account", version), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp accountInfo
+	var resp Info
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -48,8 +58,8 @@ func AccountInfo(key *pub.Key, version string) (*accountInfo, error) {
 
 // Get User Commission Rate
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/User-Commission-Rate
-func CommissionRate(key *pub.Key) (*commissionRate, error) {
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/commissionRate", nil)
+func (c *Client) CommissionRate(ctx context.Context) (*commissionRate, error) {
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/commissionRate", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -65,8 +75,8 @@ func CommissionRate(key *pub.Key) (*commissionRate, error) {
 
 // Query account configuration
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Account-Config
-func AccountConfiguration(key *pub.Key) (*accountConfiguration, error) {
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/accountConfiguration", nil)
+func (c *Client) AccountConfiguration(ctx context.Context) (*accountConfiguration, error) {
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/accountConfiguration", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -80,30 +90,31 @@ func AccountConfiguration(key *pub.Key) (*accountConfiguration, error) {
 	return &resp, nil
 }
 
-// Get current account symbol configuration.
+// Get current account symbol configuration, of all symbols if symbol is empty.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Symbol-Config
-func SymbolConfiguration(key *pub.Key, symbol string) (*symbolConfiguration, error) {
-	params := map[string]interface{}{
-		"symbol": symbol,
+func (c *Client) SymbolConfiguration(ctx context.Context, symbol string) ([]SymbolConfig, error) {
+	params := map[string]interface{}{}
+	if symbol != "" {
+		params["symbol"] = symbol
 	}
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/positionRisk", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/symbolConfig", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp symbolConfiguration
+	var resp []SymbolConfig
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
 	}
 
-	return &resp, nil
+	return resp, nil
 }
 
 // Query User Rate Limit
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Query-Rate-Limit
-func UserRateLimit(key *pub.Key) ([]rateLimitInfo, error) {
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/rateLimit/order", nil)
+func (c *Client) UserRateLimit(ctx context.Context) ([]rateLimitInfo, error) {
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/rateLimit/order", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -119,24 +130,24 @@ func UserRateLimit(key *pub.Key) ([]rateLimitInfo, error) {
 
 // Query user notional and leverage bracket on speicfic symbol
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Notional-and-Leverage-Brackets
-func LeverageBracket(key *pub.Key, symbol string) ([]leverageBracket, error) {
+func (c *Client) LeverageBracket(ctx context.Context, symbol string) ([]SymbolBracket, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/leverageBracket", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/leverageBracket", params)
 	if err != nil {
 		return nil, err
 	}
 
 	if symbol != "" {
-		var resp leverageBracket
+		var resp SymbolBracket
 		err = json.Unmarshal(resBody, &resp)
 		if err != nil {
 			return nil, err
 		}
-		return []leverageBracket{resp}, nil
+		return []SymbolBracket{resp}, nil
 	} else {
-		var resp []leverageBracket
+		var resp []SymbolBracket
 		err = json.Unmarshal(resBody, &resp)
 		if err != nil {
 			return nil, err
@@ -147,8 +158,8 @@ func LeverageBracket(key *pub.Key, symbol string) ([]leverageBracket, error) {
 
 // Get user's Multi-Assets mode (Multi-Assets Mode or Single-Asset Mode) on Every symbol
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Get-Current-Multi-Assets-Mode
-func MultiAssetsMargin(key *pub.Key) (bool, error) {
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/multiAssetsMargin", nil)
+func (c *Client) MultiAssetsMargin(ctx context.Context) (bool, error) {
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/multiAssetsMargin", nil)
 	if err != nil {
 		return false, err
 	}
@@ -166,8 +177,8 @@ func MultiAssetsMargin(key *pub.Key) (bool, error) {
 
 // Get user's position mode (Hedge Mode or One-way Mode ) on EVERY symbol
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Get-Current-Position-Mode
-func DualSidePosition(key *pub.Key) (bool, error) {
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/positionSide/dual", nil)
+func (c *Client) DualSidePosition(ctx context.Context) (bool, error) {
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/positionSide/dual", nil)
 	if err != nil {
 		return false, err
 	}
@@ -185,7 +196,7 @@ func DualSidePosition(key *pub.Key) (bool, error) {
 
 // Query income history
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Get-Income-History
-func IncomeHistory(key *pub.Key, symbol string, incomeType pub.IncomeType, startTime, endTime string, page, limit int) ([]income, error) {
+func (c *Client) IncomeHistory(ctx context.Context, symbol string, incomeType pub.IncomeType, startTime, endTime string, page, limit int) ([]income, error) {
 	params := map[string]interface{}{
 		"symbol":     symbol,
 		"incomeType": incomeType,
@@ -194,7 +205,7 @@ func IncomeHistory(key *pub.Key, symbol string, incomeType pub.IncomeType, start
 		"page":       page,
 		"limit":      limit,
 	}
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/income", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/income", params)
 	if err != nil {
 		return nil, err
 	}
@@ -210,11 +221,11 @@ func IncomeHistory(key *pub.Key, symbol string, incomeType pub.IncomeType, start
 
 // Futures trading quantitative rules indicators
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Futures-Trading-Quantitative-Rules-Indicators
-func QuantitativeIndicator(key *pub.Key, symbol string) (*indicators, error) {
+func (c *Client) QuantitativeIndicator(ctx context.Context, symbol string) (*indicators, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/apiTradingStatus", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/apiTradingStatus", params)
 	if err != nil {
 		return nil, err
 	}
@@ -231,12 +242,12 @@ func QuantitativeIndicator(key *pub.Key, symbol string) (*indicators, error) {
 // Get download id for futures transaction history
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Get-Download-Id-For-Futures-Transaction-History
 // downloadType: "income", "order", "trade"
-func GetDownloadId(key *pub.Key, downloadType string, startTime, endTime int64) (*downloadId, error) {
+func (c *Client) GetDownloadId(ctx context.Context, downloadType string, startTime, endTime int64) (*downloadId, error) {
 	params := map[string]interface{}{
 		"startTime": startTime,
 		"endTime":   endTime,
 	}
-	resBody, err := pub.GetWithSign(key, fmt.Sprintf("/fapi/v1/%v/asyn", downloadType), params)
+	resBody, err := c.GetWithSign(ctx, fmt.Sprintf("/fapi/v1/%v/asyn", downloadType), params)
 	if err != nil {
 		return nil, err
 	}
@@ -253,11 +264,11 @@ func GetDownloadId(key *pub.Key, downloadType string, startTime, endTime int64)
 // Get futures transaction history download link by Id
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Get-Futures-Transaction-History-Download-Link-by-Id
 // downloadType: "income", "order", "trade"
-func GetDownloadUrl(key *pub.Key, downloadType, downloadId string) (*downloadUrl, error) {
+func (c *Client) GetDownloadUrl(ctx context.Context, downloadType, downloadId string) (*downloadUrl, error) {
 	params := map[string]interface{}{
 		"downloadId": downloadId,
 	}
-	resBody, err := pub.GetWithSign(key, fmt.Sprintf("/fapi/v1/%v/asyn/id", downloadType), params)
+	resBody, err := c.GetWithSign(ctx, fmt.Sprintf("/fapi/v1/%v/asyn/id", downloadType), params)
 	if err != nil {
 		return nil, err
 	}
@@ -273,24 +284,21 @@ func GetDownloadUrl(key *pub.Key, downloadType, downloadId string) (*downloadUrl
 
 // Change user's BNB Fee Discount (Fee Discount On or Fee Discount Off ) on EVERY symbol
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Toggle-BNB-Burn-On-Futures-Trade
-func ToggleBNBFee(key *pub.Key, feeBurn bool) error {
+func (c *Client) ToggleBNBFee(ctx context.Context, feeBurn bool) error {
 	params := map[string]interface{}{
 		"feeBurn": feeBurn,
 	}
-	_, errMsg, err := pub.PostWithSign(key, "/fapi/v1/feeBurn", params)
+	_, err := c.PostWithSign(ctx, "/fapi/v1/feeBurn", params)
 	if err != nil {
 		return err
 	}
-	if errMsg.Code == 200 {
-		return nil
-	}
-	return fmt.Errorf("%+v", errMsg)
+	return nil // {"code": 200, "msg": "success"}
 }
 
 // Get user's BNB Fee Discount (Fee Discount On or Fee Discount Off )
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/account/rest-api/Get-BNB-Burn-Status
-func GetBNBFeeStatus(key *pub.Key) (bool, error) {
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/feeBurn", nil)
+func (c *Client) GetBNBFeeStatus(ctx context.Context) (bool, error) {
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/feeBurn", nil)
 	if err != nil {
 		return false, err
 	}
@@ -310,7 +318,7 @@ func GetBNBFeeStatus(key *pub.Key) (bool, error) {
 // https://developers.binance.com/docs/wallet/asset/query-user-universal-transfer
 // startTime: milliSecond, max 6 months
 // asset: "usdt", "btc", "eth", "bnb", "busd", "usdc", etc.
-func GetInternalTransferHist(key *pub.Key, asset string, startTime int64) (list []TfrRow, err error) {
+func (c *Client) GetInternalTransferHist(ctx context.Context, asset string, startTime int64) (list []TfrRow, err error) {
 	// params: {"startTime": milliSecond, (optional)"asset": "usdt", (optional)"endTime": milliSecond}
 	if startTime == 0 {
 		startTime = time.Now().UnixMilli() - 6*720*3600000 // 6个月以来
@@ -322,7 +330,7 @@ func GetInternalTransferHist(key *pub.Key, asset string, startTime int64) (list
 		"size":      100, // max 100, default 10
 	}
 
-	resBody, err := pub.SpotGetWithSign(key, "/sapi/v1/futures/transfer", params)
+	resBody, err := c.SpotGetWithSign(ctx, "/sapi/v1/futures/transfer", params)
 	if err != nil {
 		return nil, err
 	}
@@ -331,7 +339,7 @@ func GetInternalTransferHist(key *pub.Key, asset string, startTime int64) (list
 	if err != nil {
 		return nil, err
 	}
-	fmt.Printf("transfer total: %v\n", r.Total)
+	c.Logf("transfer total: %v\n", r.Total)
 	for i := 0; i < len(r.Rows); i++ {
 		switch r.Rows[i].Type {
 		case 1:
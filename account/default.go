@@ -0,0 +1,93 @@
+package account
+
+import (
+	"context"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+// The package level functions below keep the original API, they send requests by pub.DefaultClient.
+
+func newKeyClient(key *pub.Key) *Client {
+	return NewClient(pub.DefaultClient.WithKey(key))
+}
+
+// Get account balance (USER_DATA)
+func AccountBalance(key *pub.Key, version string) ([]Balance, error) {
+	return newKeyClient(key).AccountBalance(context.Background(), version)
+}
+
+// Get current account information. User in single-asset/ multi-assets mode will see different value
+func AccountInfo(key *pub.Key, version string) (*Info, error) {
+	return newKeyClient(key).AccountInfo(context.Background(), version)
+}
+
+// Get User Commission Rate
+func CommissionRate(key *pub.Key) (*commissionRate, error) {
+	return newKeyClient(key).CommissionRate(context.Background())
+}
+
+// Query account configuration
+func AccountConfiguration(key *pub.Key) (*accountConfiguration, error) {
+	return newKeyClient(key).AccountConfiguration(context.Background())
+}
+
+// Get current account symbol configuration.
+func SymbolConfiguration(key *pub.Key, symbol string) ([]SymbolConfig, error) {
+	return newKeyClient(key).SymbolConfiguration(context.Background(), symbol)
+}
+
+// Query User Rate Limit
+func UserRateLimit(key *pub.Key) ([]rateLimitInfo, error) {
+	return newKeyClient(key).UserRateLimit(context.Background())
+}
+
+// Query user notional and leverage bracket on speicfic symbol
+func LeverageBracket(key *pub.Key, symbol string) ([]SymbolBracket, error) {
+	return newKeyClient(key).LeverageBracket(context.Background(), symbol)
+}
+
+// Get user's Multi-Assets mode (Multi-Assets Mode or Single-Asset Mode) on Every symbol
+func MultiAssetsMargin(key *pub.Key) (bool, error) {
+	return newKeyClient(key).MultiAssetsMargin(context.Background())
+}
+
+// Get user's position mode (Hedge Mode or One-way Mode ) on EVERY symbol
+func DualSidePosition(key *pub.Key) (bool, error) {
+	return newKeyClient(key).DualSidePosition(context.Background())
+}
+
+// Query income history
+func IncomeHistory(key *pub.Key, symbol string, incomeType pub.IncomeType, startTime, endTime string, page, limit int) ([]income, error) {
+	return newKeyClient(key).IncomeHistory(context.Background(), symbol, incomeType, startTime, endTime, page, limit)
+}
+
+// Futures trading quantitative rules indicators
+func QuantitativeIndicator(key *pub.Key, symbol string) (*indicators, error) {
+	return newKeyClient(key).QuantitativeIndicator(context.Background(), symbol)
+}
+
+// Get download id for futures transaction history
+func GetDownloadId(key *pub.Key, downloadType string, startTime, endTime int64) (*downloadId, error) {
+	return newKeyClient(key).GetDownloadId(context.Background(), downloadType, startTime, endTime)
+}
+
+// Get futures transaction history download link by Id
+func GetDownloadUrl(key *pub.Key, downloadType, downloadId string) (*downloadUrl, error) {
+	return newKeyClient(key).GetDownloadUrl(context.Background(), downloadType, downloadId)
+}
+
+// Change user's BNB Fee Discount (Fee Discount On or Fee Discount Off ) on EVERY symbol
+func ToggleBNBFee(key *pub.Key, feeBurn bool) error {
+	return newKeyClient(key).ToggleBNBFee(context.Background(), feeBurn)
+}
+
+// Get user's BNB Fee Discount (Fee Discount On or Fee Discount Off )
+func GetBNBFeeStatus(key *pub.Key) (bool, error) {
+	return newKeyClient(key).GetBNBFeeStatus(context.Background())
+}
+
+// Get future asset transfer history (USER_DATA)
+func GetInternalTransferHist(key *pub.Key, asset string, startTime int64) (list []TfrRow, err error) {
+	return newKeyClient(key).GetInternalTransferHist(context.Background(), asset, startTime)
+}
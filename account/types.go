@@ -1,6 +1,8 @@
 package account
 
-type accountBalance struct {
+import "github.com/billfort/binance-usdmfuture/pub"
+
+type Balance struct {
 	AccountAlias       string `json:"accountAlias"`       // unique account code
 	Asset              string `json:"asset"`              // asset name
 	Balance            string `json:"balance"`            // wallet balance
@@ -43,7 +45,7 @@ type position struct {
 	Leverage         string `json:"leverage"`         // leverage
 }
 
-type accountInfo struct {
+type Info struct {
 	TotalInitialMargin          string     `json:"totalInitialMargin"`          // total initial margin required with current mark price (useless with isolated positions), only for USDT asset
 	TotalMaintMargin            string     `json:"totalMaintMargin"`            // total maintenance margin required, only for USDT asset
 	TotalWalletBalance          string     `json:"totalWalletBalance"`          // total wallet balance, only for USDT asset
@@ -76,7 +78,8 @@ type accountConfiguration struct {
 	TradeGroupId      int  `json:"tradeGroupId"`      // trade group id
 }
 
-type symbolConfiguration struct {
+// SymbolConfig is the margin type and leverage of a symbol.
+type SymbolConfig struct {
 	Symbol           string `json:"symbol"`           // symbol
 	MarginType       string `json:"marginType"`       // margin type
 	IsAutoAddMargin  string `json:"isAutoAddMargin"`  // is auto add margin
@@ -91,17 +94,20 @@ type rateLimitInfo struct {
 	Limit         int    `json:"limit"`         // limit
 }
 
-type leverageBracket struct {
-	Symbol       string `json:"symbol"`       // symbol
-	NotionalCoef string `json:"notionalCoef"` // user symbol bracket multiplier, only appears when user's symbol bracket is adjusted
-	Brackets     []struct {
-		Bracket          int     `json:"bracket"`          // Notional bracket
-		InitialLeverage  int     `json:"initialLeverage"`  // Max initial leverage for this bracket
-		NotionalCap      float64 `json:"notionalCap"`      // Cap notional of this bracket
-		NotionalFloor    float64 `json:"notionalFloor"`    // Notional threshold of this bracket
-		MaintMarginRatio float64 `json:"maintMarginRatio"` // Maintenance ratio for this bracket
-		Cum              int     `json:"cum"`              // Auxiliary number for quick calculation
-	} `json:"brackets"`
+// SymbolBracket is the notional and leverage brackets of a symbol.
+type SymbolBracket struct {
+	Symbol       string    `json:"symbol"`       // symbol
+	NotionalCoef float64   `json:"notionalCoef"` // user symbol bracket multiplier, only appears when user's symbol bracket is adjusted
+	Brackets     []Bracket `json:"brackets"`
+}
+
+type Bracket struct {
+	Bracket          int     `json:"bracket"`          // Notional bracket
+	InitialLeverage  int     `json:"initialLeverage"`  // Max initial leverage for this bracket
+	NotionalCap      float64 `json:"notionalCap"`      // Cap notional of this bracket
+	NotionalFloor    float64 `json:"notionalFloor"`    // Notional threshold of this bracket
+	MaintMarginRatio float64 `json:"maintMarginRatio"` // Maintenance ratio for this bracket
+	Cum              float64 `json:"cum"`              // Auxiliary number for quick calculation
 }
 
 type income struct {
@@ -156,3 +162,38 @@ type tfrHist struct {
 	Rows  []TfrRow `json:"rows"`
 	Total int      `json:"total"`
 }
+
+// Decimal accessors of the string numbers, such as PriceDec() for Price.
+
+func (b *Balance) BalanceDec() pub.Decimal            { return pub.D(b.Balance) }
+func (b *Balance) CrossWalletBalanceDec() pub.Decimal { return pub.D(b.CrossWalletBalance) }
+func (b *Balance) CrossUnPnlDec() pub.Decimal         { return pub.D(b.CrossUnPnl) }
+func (b *Balance) AvailableBalanceDec() pub.Decimal   { return pub.D(b.AvailableBalance) }
+func (b *Balance) MaxWithdrawAmountDec() pub.Decimal  { return pub.D(b.MaxWithdrawAmount) }
+
+func (a *asset) WalletBalanceDec() pub.Decimal     { return pub.D(a.WalletBalance) }
+func (a *asset) UnrealizedProfitDec() pub.Decimal  { return pub.D(a.UnrealizedProfit) }
+func (a *asset) MarginBalanceDec() pub.Decimal     { return pub.D(a.MarginBalance) }
+func (a *asset) MaintMarginDec() pub.Decimal       { return pub.D(a.MaintMargin) }
+func (a *asset) InitialMarginDec() pub.Decimal     { return pub.D(a.InitialMargin) }
+func (a *asset) AvailableBalanceDec() pub.Decimal  { return pub.D(a.AvailableBalance) }
+func (a *asset) MaxWithdrawAmountDec() pub.Decimal { return pub.D(a.MaxWithdrawAmount) }
+
+func (p *position) PositionAmtDec() pub.Decimal      { return pub.D(p.PositionAmt) }
+func (p *position) UnrealizedProfitDec() pub.Decimal { return pub.D(p.UnrealizedProfit) }
+func (p *position) IsolatedMarginDec() pub.Decimal   { return pub.D(p.IsolatedMargin) }
+func (p *position) NotionalDec() pub.Decimal         { return pub.D(p.Notional) }
+func (p *position) InitialMarginDec() pub.Decimal    { return pub.D(p.InitialMargin) }
+func (p *position) MaintMarginDec() pub.Decimal      { return pub.D(p.MaintMargin) }
+func (p *position) EntryPriceDec() pub.Decimal       { return pub.D(p.EntryPrice) }
+
+func (a *Info) TotalInitialMarginDec() pub.Decimal    { return pub.D(a.TotalInitialMargin) }
+func (a *Info) TotalMaintMarginDec() pub.Decimal      { return pub.D(a.TotalMaintMargin) }
+func (a *Info) TotalWalletBalanceDec() pub.Decimal    { return pub.D(a.TotalWalletBalance) }
+func (a *Info) TotalUnrealizedProfitDec() pub.Decimal { return pub.D(a.TotalUnrealizedProfit) }
+func (a *Info) TotalMarginBalanceDec() pub.Decimal    { return pub.D(a.TotalMarginBalance) }
+func (a *Info) AvailableBalanceDec() pub.Decimal      { return pub.D(a.AvailableBalance) }
+func (a *Info) MaxWithdrawAmountDec() pub.Decimal     { return pub.D(a.MaxWithdrawAmount) }
+
+func (c *commissionRate) MakerCommissionRateDec() pub.Decimal { return pub.D(c.MakerCommissionRate) }
+func (c *commissionRate) TakerCommissionRateDec() pub.Decimal { return pub.D(c.TakerCommissionRate) }
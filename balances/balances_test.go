@@ -0,0 +1,135 @@
+package balances
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/account"
+	"github.com/billfort/binance-usdmfuture/internal/mockapi"
+	"github.com/billfort/binance-usdmfuture/positions"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestLedger
+func TestLedger(t *testing.T) {
+	l := NewLedger(pub.NewClient(nil))
+	var drifted []Drift
+	l.OnDrift = func(d Drift) { drifted = append(drifted, d) }
+
+	require.Empty(t, l.Reconcile([]account.Balance{
+		{Asset: "USDT", Balance: "1000", CrossWalletBalance: "1000", AvailableBalance: "900", UpdateTime: 1},
+	}, time.UnixMilli(10)))
+	b, ok := l.Balance("USDT")
+	require.True(t, ok)
+	require.Equal(t, "900", b.AvailableBalance.String())
+
+	l.Apply(*mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":20,"T":20,"a":{"m":"FUNDING_FEE","B":[{"a":"USDT","wb":"999.5","cw":"999.5","bc":"0"}]}}`))
+	l.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":30,"T":30,"a":{"m":"DEPOSIT","B":[{"a":"USDT","wb":"1499.5","cw":"1499.5","bc":"500"}]}}`))
+	l.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":25,"T":25,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"1","cw":"1","bc":"0"}]}}`)) // older
+
+	l.MarkToMarket([]positions.Position{
+		{Symbol: "BTCUSDT", Side: pub.PS_Both, Amount: pub.D("0.01"), UnrealizedPnl: pub.D("-20"), MarginType: pub.MT_Cross},
+		{Symbol: "ETHUSDT", Side: pub.PS_Long, Amount: pub.D("1"), UnrealizedPnl: pub.D("5"), MarginType: pub.MT_Isolated},
+	})
+	b, _ = l.Balance("USDT")
+	require.Equal(t, "1499.5", b.WalletBalance.String())
+	require.Equal(t, "1484.5", b.MarginBalance().String())
+	require.Equal(t, "1379.5", b.AvailableBalance.String()) // 900 + 499.5 - 20
+
+	require.Len(t, l.History("USDT", 0, 0), 3)
+	require.Len(t, l.History("USDT", 20, 30), 1)
+	v, ok := l.BalanceAt("USDT", 25)
+	require.True(t, ok)
+	require.Equal(t, "999.5", v.String())
+	_, ok = l.BalanceAt("USDT", 5)
+	require.False(t, ok)
+	sum := l.Summary("USDT", 11, 0)
+	require.Equal(t, "-0.5", sum[pub.UR_FundingFee].String())
+	require.Equal(t, "500", sum[pub.UR_Deposit].String())
+
+	// a realized loss was missed
+	drifts := l.Reconcile([]account.Balance{
+		{Asset: "USDT", Balance: "1489.5", CrossWalletBalance: "1489.5", CrossUnPnl: "-20", AvailableBalance: "1370", UpdateTime: 35},
+	}, time.UnixMilli(40))
+	require.Len(t, drifts, 1)
+	require.Equal(t, "-10", drifts[0].Diff.String())
+	require.Equal(t, drifts, drifted)
+	require.Equal(t, drifts, l.Drifts())
+	b, _ = l.Balance("USDT")
+	require.Equal(t, "1489.5", b.WalletBalance.String())
+	require.Equal(t, "1370", b.AvailableBalance.String())
+	es := l.History("USDT", 40, 0)
+	require.Len(t, es, 1)
+	require.Equal(t, UR_Snapshot, es[0].Reason)
+
+	// the stream is newer than the snapshot
+	l.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":60,"T":60,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"1488","cw":"1488","bc":"0"}]}}`))
+	require.Empty(t, l.Reconcile([]account.Balance{{Asset: "USDT", Balance: "1489.5", UpdateTime: 35}}, time.UnixMilli(50)))
+	b, _ = l.Balance("USDT")
+	require.Equal(t, "1488", b.WalletBalance.String())
+
+	// the first event of an asset without snapshot is not a change of its reason
+	l.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":70,"T":70,"a":{"m":"ORDER","B":[{"a":"BNB","wb":"10","cw":"10","bc":"0"}]}}`))
+	l.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":80,"T":80,"a":{"m":"ORDER","B":[{"a":"BNB","wb":"9.9","cw":"9.9","bc":"0"}]}}`))
+	require.Equal(t, "-0.1", l.Summary("BNB", 0, 0)[pub.UR_Order].String())
+
+	// the sums of the day are kept for the day of the latest entry
+	sum = l.DaySummary(0)
+	require.Equal(t, "-1.6", sum[pub.UR_Order].String()) // 1488 - 1489.5 of USDT and 9.9 - 10 of BNB
+	require.Equal(t, "-0.5", sum[pub.UR_FundingFee].String())
+	l.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":86400001,"T":86400001,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"1487","cw":"1487","bc":"0"}]}}`))
+	l.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":90,"T":90,"a":{"m":"ORDER","B":[{"a":"BNB","wb":"9.8","cw":"9.8","bc":"0"}]}}`)) // of the day before
+	require.Empty(t, l.DaySummary(0))
+	require.Equal(t, map[pub.UpdateReason]pub.Decimal{pub.UR_Order: pub.D("-1")}, l.DaySummary(dayMs))
+
+	require.Equal(t, "USDC", quoteAsset("ETHUSDC"))
+	require.Equal(t, "USDT", quoteAsset("BTCUSDT_250627"))
+}
+
+// go test -v -run TestLedgerMaxEntries
+func TestLedgerMaxEntries(t *testing.T) {
+	l := NewLedger(pub.NewClient(nil))
+	l.MaxEntries = 3
+	for i := 1; i <= 100; i++ {
+		l.Apply(mockapi.AccountUpdate(t, fmt.Sprintf(`{"e":"ACCOUNT_UPDATE","T":%v,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"%v","cw":"%v","bc":"0"}]}}`, i, i, i)))
+	}
+	es := l.History("", 0, 0)
+	require.Len(t, es, 3)
+	require.Equal(t, int64(98), es[0].Time)
+	require.Equal(t, int64(100), es[2].Time)
+	require.LessOrEqual(t, cap(l.entries), 4*l.MaxEntries) // the dropped ones are released
+}
+
+// go test -v -run TestLedgerLoad
+func TestLedgerLoad(t *testing.T) {
+	serverNow := time.Now().Add(-time.Hour) // the local clock is ahead
+	pc := mockapi.NewWithClock(t, -time.Hour, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v3/balance":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"asset": "USDT", "balance": "100", "crossWalletBalance": "100", "crossUnPnl": "0", "availableBalance": "100", "updateTime": 1},
+				{"asset": "USDC", "balance": "50", "crossWalletBalance": "50", "crossUnPnl": "0", "availableBalance": "50", "updateTime": 1},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	require.NoError(t, pc.AdjustTime(context.Background()))
+	l := NewLedger(pc)
+
+	// an event just after the snapshot by the server clock arrives first
+	l.Apply(mockapi.AccountUpdate(t, fmt.Sprintf(`{"e":"ACCOUNT_UPDATE","T":%v,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"90","cw":"90","bc":"0"}]}}`,
+		serverNow.Add(10*time.Second).UnixMilli())))
+	drifts, err := l.Load(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+	b, _ := l.Balance("USDT")
+	require.Equal(t, "90", b.WalletBalance.String()) // kept
+	b, _ = l.Balance("USDC")
+	require.Equal(t, "50", b.WalletBalance.String())
+}
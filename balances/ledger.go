@@ -0,0 +1,368 @@
+// Package balances keeps a running ledger of the balances of the account by the ACCOUNT_UPDATE events of the
+// user data stream, and checks it against the REST snapshots.
+package balances
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/account"
+	"github.com/billfort/binance-usdmfuture/positions"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streamuserdata"
+)
+
+const (
+	defaultInterval   = 5 * time.Minute
+	defaultMaxEntries = 100000
+	dayMs             = 24 * 60 * 60 * 1000
+
+	// UR_Snapshot is the reason of the entries of the REST snapshots which correct the drift of the ledger.
+	UR_Snapshot pub.UpdateReason = "SNAPSHOT"
+)
+
+// Entry is a change of the balance of an asset.
+type Entry struct {
+	Time               int64 // transaction time, milliseconds
+	Asset              string
+	Reason             pub.UpdateReason
+	WalletBalance      pub.Decimal // after the change
+	CrossWalletBalance pub.Decimal // after the change
+	Change             pub.Decimal // of the wallet balance
+	BalanceChange      pub.Decimal // balance change except PnL and commission, reported by the event
+}
+
+// Balance is the running balance of an asset.
+type Balance struct {
+	Asset              string
+	WalletBalance      pub.Decimal
+	CrossWalletBalance pub.Decimal
+	UnrealizedPnl      pub.Decimal // of all positions of the margin asset, by MarkToMarket
+	CrossUnPnl         pub.Decimal // of the cross positions
+	AvailableBalance   pub.Decimal // the one of the last snapshot adjusted by the changes after it
+	UpdateTime         int64       // milliseconds
+}
+
+// MarginBalance returns the wallet balance plus the unrealized profit.
+func (b *Balance) MarginBalance() pub.Decimal {
+	return b.WalletBalance.Add(b.UnrealizedPnl)
+}
+
+// Drift is the difference between the ledger and a REST snapshot of an asset, Diff is Snapshot - Ledger.
+type Drift struct {
+	Asset    string
+	Ledger   pub.Decimal // wallet balance
+	Snapshot pub.Decimal
+	Diff     pub.Decimal
+	Time     time.Time
+}
+
+type state struct {
+	Balance
+	snapTime      int64 // of the last snapshot, zero if none
+	snapAvailable pub.Decimal
+	snapCross     pub.Decimal
+	snapCrossPnl  pub.Decimal
+}
+
+// available estimates the available balance by the last snapshot and the changes of the cross wallet and pnl after it.
+func (s *state) available() pub.Decimal {
+	if s.snapTime == 0 {
+		return s.CrossWalletBalance.Add(s.CrossUnPnl)
+	}
+	return s.snapAvailable.Add(s.CrossWalletBalance.Sub(s.snapCross)).Add(s.CrossUnPnl.Sub(s.snapCrossPnl))
+}
+
+// Ledger keeps the balances by asset and the history of their changes. It is safe for concurrent use.
+type Ledger struct {
+	Interval    time.Duration              // snapshot interval of Start, default 5 minutes
+	MaxEntries  int                        // the oldest entries are dropped over it, default 100000
+	Tolerance   pub.Decimal                // a larger difference to a snapshot is a drift, default zero
+	MarginAsset func(symbol string) string // margin asset of a symbol, default its quote asset
+	OnDrift     func(Drift)                // called on each drift, after the ledger is corrected
+
+	client *account.Client
+
+	mu       sync.RWMutex
+	balances map[string]*state
+	entries  []Entry
+	drifts   []Drift
+	day      int64                            // start of the UTC day of the latest entry, milliseconds
+	daySum   map[pub.UpdateReason]pub.Decimal // changes of all assets in day by reason
+}
+
+func NewLedger(c *pub.Client) *Ledger {
+	return &Ledger{
+		Interval:    defaultInterval,
+		MaxEntries:  defaultMaxEntries,
+		MarginAsset: quoteAsset,
+		client:      account.NewClient(c),
+		balances:    map[string]*state{},
+	}
+}
+
+// Apply applies the data of streamuserdata: AccountUpdate, and *streamuserdata.Reconciled as a snapshot.
+// The other data is ignored.
+func (l *Ledger) Apply(d interface{}) []Drift {
+	switch v := d.(type) {
+	case streamuserdata.AccountUpdate:
+		l.ApplyAccountUpdate(&v)
+	case *streamuserdata.AccountUpdate:
+		l.ApplyAccountUpdate(v)
+	case *streamuserdata.Reconciled:
+		return l.Reconcile(v.Balances, v.Time)
+	}
+	return nil
+}
+
+// ApplyAccountUpdate records the balances of the event with its reason, an event older than the balance is ignored.
+// The change of an asset which is neither seeded by a snapshot nor updated before is its BalanceChange, the whole
+// wallet balance is not a change of the reason.
+func (l *Ledger) ApplyAccountUpdate(u *streamuserdata.AccountUpdate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, b := range u.Data.Balances {
+		s := l.stateOf(b.Asset)
+		if u.TransactionTime < s.UpdateTime {
+			continue
+		}
+		wallet := pub.D(b.WalletBalance)
+		change := wallet.Sub(s.WalletBalance)
+		if s.snapTime == 0 && s.UpdateTime == 0 {
+			change = pub.D(b.BalanceChange)
+		}
+		l.record(Entry{
+			Time:               u.TransactionTime,
+			Asset:              b.Asset,
+			Reason:             pub.UpdateReason(u.Data.EventReasonType),
+			WalletBalance:      wallet,
+			CrossWalletBalance: pub.D(b.CrossWalletBalance),
+			Change:             change,
+			BalanceChange:      pub.D(b.BalanceChange),
+		})
+		s.WalletBalance = wallet
+		s.CrossWalletBalance = pub.D(b.CrossWalletBalance)
+		s.UpdateTime = u.TransactionTime
+		s.AvailableBalance = s.available()
+	}
+}
+
+// MarkToMarket sets the unrealized profit of the assets by the open positions, such as of positions.Book.
+func (l *Ledger) MarkToMarket(ps []positions.Position) {
+	pnl, cross := map[string]pub.Decimal{}, map[string]pub.Decimal{}
+	for i := range ps {
+		asset := l.MarginAsset(ps[i].Symbol)
+		pnl[asset] = pnl[asset].Add(ps[i].UnrealizedPnl)
+		if ps[i].MarginType != pub.MT_Isolated {
+			cross[asset] = cross[asset].Add(ps[i].UnrealizedPnl)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for asset := range pnl {
+		l.stateOf(asset)
+	}
+	for asset, s := range l.balances {
+		s.UnrealizedPnl = pnl[asset]
+		s.CrossUnPnl = cross[asset]
+		s.AvailableBalance = s.available()
+	}
+}
+
+// Load takes a REST snapshot of the balances, see Reconcile. The snapshot time is the server time before the request,
+// which is compared with the TransactionTime of the events, so the events during the request are kept.
+func (l *Ledger) Load(ctx context.Context) ([]Drift, error) {
+	at := l.client.Now(ctx)
+	bs, err := l.client.AccountBalance(ctx, "v3")
+	if err != nil {
+		return nil, err
+	}
+	return l.Reconcile(bs, at), nil
+}
+
+// Start takes a snapshot, then takes one every Interval until ctx is done, the errors and drifts are logged.
+func (l *Ledger) Start(ctx context.Context) error {
+	if _, err := l.Load(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(l.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := l.Load(ctx); err != nil {
+					l.client.Logf("balances Load err: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Reconcile compares the ledger with the REST balances taken at t, an asset updated by the stream after its
+// snapshot is skipped. The ledger takes the snapshot, and a difference over Tolerance is recorded as a drift
+// with an entry of UR_Snapshot. The drifts are returned.
+func (l *Ledger) Reconcile(bs []account.Balance, t time.Time) []Drift {
+	at := t.UnixMilli()
+	l.mu.Lock()
+	var drifts []Drift
+	for i := range bs {
+		b := &bs[i]
+		s := l.stateOf(b.Asset)
+		snapTime := b.UpdateTime
+		if snapTime < at {
+			snapTime = at
+		}
+		if s.UpdateTime > snapTime {
+			continue // the stream is newer
+		}
+		wallet := pub.D(b.Balance)
+		if diff := wallet.Sub(s.WalletBalance); diff.Abs().GreaterThan(l.Tolerance) {
+			if s.snapTime != 0 || s.UpdateTime != 0 {
+				drifts = append(drifts, Drift{Asset: b.Asset, Ledger: s.WalletBalance, Snapshot: wallet, Diff: diff, Time: t})
+			}
+			l.record(Entry{
+				Time: at, Asset: b.Asset, Reason: UR_Snapshot, WalletBalance: wallet,
+				CrossWalletBalance: pub.D(b.CrossWalletBalance), Change: diff,
+			})
+		}
+		s.WalletBalance = wallet
+		s.CrossWalletBalance = pub.D(b.CrossWalletBalance)
+		s.CrossUnPnl = pub.D(b.CrossUnPnl)
+		s.UpdateTime = snapTime
+		s.snapTime = snapTime
+		s.snapAvailable = pub.D(b.AvailableBalance)
+		s.snapCross = s.CrossWalletBalance
+		s.snapCrossPnl = s.CrossUnPnl
+		s.AvailableBalance = s.available()
+	}
+	l.drifts = append(l.drifts, drifts...)
+	l.mu.Unlock()
+
+	for _, d := range drifts {
+		l.client.Logf("balances drift %v: ledger %v, snapshot %v", d.Asset, d.Ledger, d.Snapshot)
+		if l.OnDrift != nil {
+			l.OnDrift(d)
+		}
+	}
+	return drifts
+}
+
+// stateOf returns the state of the asset, it is added if it is unknown. It is locked by the caller.
+func (l *Ledger) stateOf(asset string) *state {
+	s := l.balances[asset]
+	if s == nil {
+		s = &state{Balance: Balance{Asset: asset}}
+		l.balances[asset] = s
+	}
+	return s
+}
+
+// record appends the entry and adds it to the sum of its day, it is locked by the caller.
+func (l *Ledger) record(e Entry) {
+	if day := e.Time - e.Time%dayMs; day > l.day || l.daySum == nil {
+		l.day, l.daySum = day, map[pub.UpdateReason]pub.Decimal{}
+	}
+	if e.Time >= l.day {
+		l.daySum[e.Reason] = l.daySum[e.Reason].Add(e.Change)
+	}
+	l.entries = append(l.entries, e)
+	if l.MaxEntries > 0 && len(l.entries) > l.MaxEntries {
+		// reslicing drops the oldest without copying, append copies the kept entries to a new array
+		// only when the capacity left is used up, so each entry is copied once on average
+		l.entries = l.entries[len(l.entries)-l.MaxEntries:]
+	}
+}
+
+// Balance returns the balance of the asset.
+func (l *Ledger) Balance(asset string) (Balance, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if s := l.balances[asset]; s != nil {
+		return s.Balance, true
+	}
+	return Balance{}, false
+}
+
+// Balances returns the balances sorted by asset.
+func (l *Ledger) Balances() []Balance {
+	l.mu.RLock()
+	bs := make([]Balance, 0, len(l.balances))
+	for _, s := range l.balances {
+		bs = append(bs, s.Balance)
+	}
+	l.mu.RUnlock()
+	sort.Slice(bs, func(i, j int) bool { return bs[i].Asset < bs[j].Asset })
+	return bs
+}
+
+// History returns the entries of the asset in [startTime, endTime) milliseconds in time order, all assets if
+// asset is empty, no limit for a zero endTime.
+func (l *Ledger) History(asset string, startTime, endTime int64) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var es []Entry
+	for _, e := range l.entries {
+		if (asset == "" || e.Asset == asset) && e.Time >= startTime && (endTime == 0 || e.Time < endTime) {
+			es = append(es, e)
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool { return es[i].Time < es[j].Time })
+	return es
+}
+
+// BalanceAt returns the wallet balance of the asset at the time by the history, false if no entry is before it.
+func (l *Ledger) BalanceAt(asset string, t int64) (pub.Decimal, bool) {
+	es := l.History(asset, 0, t+1)
+	if len(es) == 0 {
+		return pub.Decimal{}, false
+	}
+	return es[len(es)-1].WalletBalance, true
+}
+
+// Summary returns the sum of the wallet balance changes of the asset by reason in [startTime, endTime).
+func (l *Ledger) Summary(asset string, startTime, endTime int64) map[pub.UpdateReason]pub.Decimal {
+	sum := map[pub.UpdateReason]pub.Decimal{}
+	for _, e := range l.History(asset, startTime, endTime) {
+		sum[e.Reason] = sum[e.Reason].Add(e.Change)
+	}
+	return sum
+}
+
+// DaySummary returns the sum of the wallet balance changes of all assets by reason in the UTC day starting at day
+// milliseconds. It is kept as the entries are recorded, for the day of the latest entry only, empty for other days.
+func (l *Ledger) DaySummary(day int64) map[pub.UpdateReason]pub.Decimal {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	sum := make(map[pub.UpdateReason]pub.Decimal, len(l.daySum))
+	if day == l.day {
+		for r, v := range l.daySum {
+			sum[r] = v
+		}
+	}
+	return sum
+}
+
+// Drifts returns the drifts found by the snapshots.
+func (l *Ledger) Drifts() []Drift {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]Drift(nil), l.drifts...)
+}
+
+// quoteAsset returns the quote asset of the symbol of USDⓈ-M futures, such as USDT of BTCUSDT or BTCUSDT_250627.
+func quoteAsset(symbol string) string {
+	symbol, _, _ = strings.Cut(symbol, "_")
+	for _, q := range []string{"USDT", "USDC", "FDUSD", "BTC"} {
+		if strings.HasSuffix(symbol, q) {
+			return q
+		}
+	}
+	return "USDT"
+}
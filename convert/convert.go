@@ -1,19 +1,29 @@
 package convert
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/billfort/binance-usdmfuture/pub"
 )
 
+// Client sends convert requests with the settings and key of the wrapped pub.Client.
+type Client struct {
+	*pub.Client
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c}
+}
+
 // Query for all convertible token pairs and the tokens’ respective upper/lower limits
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/convert
-func ListPairs(fromAsset, toAsset string) ([]convertPair, error) {
+func (c *Client) ListPairs(ctx context.Context, fromAsset, toAsset string) ([]convertPair, error) {
 	params := map[string]interface{}{
 		"fromAsset": fromAsset,
 		"toAsset":   toAsset,
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/convert/exchangeInfo", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/convert/exchangeInfo", params)
 	if err != nil {
 		return nil, err
 	}
@@ -29,7 +39,7 @@ func ListPairs(fromAsset, toAsset string) ([]convertPair, error) {
 // Request a quote for the requested token pairs
 // validTime: 10s, 30s, 1m, default 10s
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/convert/Send-quote-request
-func RequestQuote(key *pub.Key, fromAsset, toAsset, fromAssetAmount, toAmount, validTime string) (*quote, error) {
+func (c *Client) RequestQuote(ctx context.Context, fromAsset, toAsset, fromAssetAmount, toAmount, validTime string) (*quote, error) {
 	params := map[string]interface{}{
 		"fromAsset":       fromAsset,
 		"toAsset":         toAsset,
@@ -37,7 +47,7 @@ func RequestQuote(key *pub.Key, fromAsset, toAsset, fromAssetAmount, toAmount, v
 		"toAmount":        toAmount,
 		"validTime":       validTime,
 	}
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/convert/getQuote", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/convert/getQuote", params)
 	if err != nil {
 		return nil, err
 	}
@@ -52,11 +62,11 @@ func RequestQuote(key *pub.Key, fromAsset, toAsset, fromAssetAmount, toAmount, v
 
 // Accept the offered quote by quote ID.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/convert/Accept-Quote
-func AcceptQuote(key *pub.Key, quoteID string) (*acceptQuote, error) {
+func (c *Client) AcceptQuote(ctx context.Context, quoteID string) (*acceptQuote, error) {
 	params := map[string]interface{}{
 		"quoteId": quoteID,
 	}
-	resBody, _, err := pub.PostWithSign(key, "/fapi/v1/convert/confirm", params)
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/convert/confirm", params)
 	if err != nil {
 		return nil, err
 	}
@@ -71,11 +81,11 @@ func AcceptQuote(key *pub.Key, quoteID string) (*acceptQuote, error) {
 
 // Query order status by order ID.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/convert/Order-Status
-func QueryOrderStatus(key *pub.Key, orderID string) (*orderStatus, error) {
+func (c *Client) QueryOrderStatus(ctx context.Context, orderID string) (*orderStatus, error) {
 	params := map[string]interface{}{
 		"orderId": orderID,
 	}
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/convert/orderStatus", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/convert/orderStatus", params)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,37 @@
+package convert
+
+import (
+	"context"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+// The package level functions below keep the original API, they send requests by pub.DefaultClient.
+
+func newKeyClient(key *pub.Key) *Client {
+	return NewClient(pub.DefaultClient.WithKey(key))
+}
+
+func defaultClient() *Client {
+	return NewClient(pub.DefaultClient)
+}
+
+// Query for all convertible token pairs and the tokens’ respective upper/lower limits
+func ListPairs(fromAsset, toAsset string) ([]convertPair, error) {
+	return defaultClient().ListPairs(context.Background(), fromAsset, toAsset)
+}
+
+// Request a quote for the requested token pairs
+func RequestQuote(key *pub.Key, fromAsset, toAsset, fromAssetAmount, toAmount, validTime string) (*quote, error) {
+	return newKeyClient(key).RequestQuote(context.Background(), fromAsset, toAsset, fromAssetAmount, toAmount, validTime)
+}
+
+// Accept the offered quote by quote ID.
+func AcceptQuote(key *pub.Key, quoteID string) (*acceptQuote, error) {
+	return newKeyClient(key).AcceptQuote(context.Background(), quoteID)
+}
+
+// Query order status by order ID.
+func QueryOrderStatus(key *pub.Key, orderID string) (*orderStatus, error) {
+	return newKeyClient(key).QueryOrderStatus(context.Background(), orderID)
+}
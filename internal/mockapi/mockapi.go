@@ -0,0 +1,41 @@
+// Package mockapi serves a mock of the binance REST api for the tests of the packages.
+package mockapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streamuserdata"
+	"github.com/stretchr/testify/require"
+)
+
+// New serves the handler until the test is done, and returns a client of it with a test key.
+// The handler runs in the goroutine of the server, it reports failures by assert, not require.
+// /fapi/v1/time is served by the local clock.
+func New(t *testing.T, handler http.HandlerFunc) *pub.Client {
+	return NewWithClock(t, 0, handler)
+}
+
+// NewWithClock is New with the server clock ahead of the local clock by offset.
+func NewWithClock(t *testing.T, offset time.Duration, handler http.HandlerFunc) *pub.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fapi/v1/time" {
+			json.NewEncoder(w).Encode(map[string]int64{"serverTime": time.Now().Add(offset).UnixMilli()})
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "", ""), &pub.Key{ApiKey: "api", SecretKey: "secret"})
+}
+
+// AccountUpdate decodes an ACCOUNT_UPDATE event of the user data stream.
+func AccountUpdate(t *testing.T, s string) *streamuserdata.AccountUpdate {
+	var u streamuserdata.AccountUpdate
+	require.NoError(t, json.Unmarshal([]byte(s), &u))
+	return &u
+}
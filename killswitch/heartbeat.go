@@ -0,0 +1,182 @@
+// Package killswitch keeps the countdown auto-cancel of the active symbols as a dead man's switch, and provides
+// a kill switch which cancels all open orders, optionally flattens the positions, and blocks further orders.
+package killswitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+const (
+	defaultCountdown = time.Minute
+	defaultInterval  = 20 * time.Second
+)
+
+// Heartbeat refreshes the countdown auto-cancel of the active symbols every Interval, so their open orders are
+// canceled by binance in Countdown after the heartbeats stop, such as the process is down or disconnected.
+type Heartbeat struct {
+	Countdown time.Duration   // countdown of the auto-cancel, default 1 minute
+	Interval  time.Duration   // interval of the heartbeats, default 20 seconds, it must be less than Countdown
+	Active    func() []string // more active symbols, such as the symbols of the open orders of orders.Tracker
+
+	client *trade.Client
+
+	mu      sync.Mutex
+	symbols map[string]bool // added
+	armed   map[string]bool // the countdown is set
+}
+
+func NewHeartbeat(c *pub.Client) *Heartbeat {
+	return &Heartbeat{
+		Countdown: defaultCountdown,
+		Interval:  defaultInterval,
+		client:    trade.NewClient(c),
+		symbols:   map[string]bool{},
+		armed:     map[string]bool{},
+	}
+}
+
+// Add adds the symbol to the active symbols, it is armed by the next heartbeat.
+func (h *Heartbeat) Add(symbol string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.symbols[symbol] = true
+}
+
+// Remove removes the symbol from the active symbols, and cancels its countdown.
+func (h *Heartbeat) Remove(ctx context.Context, symbol string) error {
+	h.mu.Lock()
+	delete(h.symbols, symbol)
+	h.mu.Unlock()
+	return h.disarm(ctx, symbol)
+}
+
+// Symbols returns the sorted active symbols.
+func (h *Heartbeat) Symbols() []string {
+	h.mu.Lock()
+	set := make(map[string]bool, len(h.symbols))
+	for s := range h.symbols {
+		set[s] = true
+	}
+	h.mu.Unlock()
+	if h.Active != nil {
+		for _, s := range h.Active() {
+			set[s] = true
+		}
+	}
+	symbols := make([]string, 0, len(set))
+	for s := range set {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Armed returns the sorted symbols whose countdown is set.
+func (h *Heartbeat) Armed() []string {
+	h.mu.Lock()
+	symbols := make([]string, 0, len(h.armed))
+	for s := range h.armed {
+		symbols = append(symbols, s)
+	}
+	h.mu.Unlock()
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Beat refreshes the countdown of the active symbols, and cancels the countdown of the symbols which are not active
+// any more. The errors of all symbols are joined.
+func (h *Heartbeat) Beat(ctx context.Context) error {
+	active := h.Symbols()
+	countdown := h.Countdown.Milliseconds()
+	var errs []error
+	for _, s := range active {
+		if err := h.client.CountdownCancleAll(ctx, s, countdown); err != nil {
+			errs = append(errs, fmt.Errorf("killswitch: countdown %v: %w", s, err))
+			continue
+		}
+		h.mu.Lock()
+		h.armed[s] = true
+		h.mu.Unlock()
+	}
+
+	isActive := make(map[string]bool, len(active))
+	for _, s := range active {
+		isActive[s] = true
+	}
+	h.mu.Lock()
+	var stale []string
+	for s := range h.armed {
+		if !isActive[s] {
+			stale = append(stale, s)
+		}
+	}
+	h.mu.Unlock()
+	for _, s := range stale {
+		if err := h.disarm(ctx, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start sends a heartbeat, then sends one every Interval until ctx is done, the errors are logged.
+// The countdowns are kept after ctx is done, so the open orders are canceled after Countdown unless Disarm is called.
+func (h *Heartbeat) Start(ctx context.Context) error {
+	if h.Interval >= h.Countdown {
+		return fmt.Errorf("killswitch: heartbeat interval %v is not less than countdown %v", h.Interval, h.Countdown)
+	}
+	if err := h.Beat(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(h.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := h.Beat(ctx); err != nil {
+					h.client.Logf("killswitch Beat err: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Disarm cancels the countdowns of all armed symbols, such as before a graceful shutdown which keeps the orders.
+func (h *Heartbeat) Disarm(ctx context.Context) error {
+	var errs []error
+	for _, s := range h.Armed() {
+		if err := h.disarm(ctx, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// disarm cancels the countdown of the symbol by countdownTime 0.
+func (h *Heartbeat) disarm(ctx context.Context, symbol string) error {
+	h.mu.Lock()
+	armed := h.armed[symbol]
+	h.mu.Unlock()
+	if !armed {
+		return nil
+	}
+	if err := h.client.CountdownCancleAll(ctx, symbol, 0); err != nil {
+		return fmt.Errorf("killswitch: disarm %v: %w", symbol, err)
+	}
+	h.mu.Lock()
+	delete(h.armed, symbol)
+	h.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,283 @@
+package killswitch
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/risk"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+// R_KillSwitch is the name of the risk rule of KillSwitch.
+const R_KillSwitch = "killSwitch"
+
+var ErrKilled = errors.New("killswitch: order entry is blocked")
+
+// Status is the state of a KillSwitch.
+type Status struct {
+	Killed bool      `json:"killed"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time,omitempty"`
+	Err    string    `json:"error,omitempty"` // error of the last kill
+}
+
+// KillSwitch cancels all open orders of all symbols, flattens the positions if Flatten is true, and blocks the
+// orders after it is triggered, until Reset. It is triggered by Kill, a signal with NotifySignal, or a local
+// HTTP endpoint with ListenAndServe. It is safe for concurrent use.
+//
+// The orders are blocked where the kill switch is checked: by the clients guarded by Guard, which block
+// trade.NewOrder, trade.BatchOrders and wsapi.PlaceOrder, by a risk.Engine with Rule added, or by the caller with Check.
+type KillSwitch struct {
+	Flatten   bool                           // close the positions by reduce-only market orders
+	OnKill    func(reason string, err error) // called after each kill
+	Heartbeat *Heartbeat                     // its symbols are canceled if the open orders cannot be queried
+	Token     string                         // required by POST /kill in the X-Killswitch-Token header
+
+	client *trade.Client
+
+	killMu sync.Mutex // one kill at a time
+	mu     sync.RWMutex
+	status Status
+}
+
+func New(c *pub.Client) *KillSwitch {
+	return &KillSwitch{client: trade.NewClient(c)}
+}
+
+// Kill blocks the orders, cancels all open orders of all symbols, and flattens the positions if Flatten is true.
+// It can be called again to retry, the errors of all symbols are joined.
+func (k *KillSwitch) Kill(ctx context.Context, reason string) error {
+	k.mu.Lock()
+	k.status = Status{Killed: true, Reason: reason, Time: time.Now()}
+	k.mu.Unlock()
+	k.client.Logf("killswitch Kill: %v", reason)
+
+	k.killMu.Lock()
+	err := k.kill(ctx)
+	k.killMu.Unlock()
+
+	k.mu.Lock()
+	if err != nil {
+		k.status.Err = err.Error()
+	}
+	k.mu.Unlock()
+	if err != nil {
+		k.client.Logf("killswitch Kill err: %v", err)
+	}
+	if k.OnKill != nil {
+		k.OnKill(reason, err)
+	}
+	return err
+}
+
+// kill cancels the open orders and flattens the positions, it goes on after a failure and joins the errors.
+func (k *KillSwitch) kill(ctx context.Context) error {
+	var errs []error
+	set := map[string]bool{}
+	open, err := k.client.QueryOpenOrders(ctx, "")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("killswitch: query open orders: %w", err))
+		if k.Heartbeat != nil { // the known and active symbols
+			for _, s := range k.Heartbeat.Symbols() {
+				set[s] = true
+			}
+			for _, s := range k.Heartbeat.Armed() {
+				set[s] = true
+			}
+		}
+	}
+	for i := range open {
+		set[open[i].Symbol] = true
+	}
+	symbols := make([]string, 0, len(set))
+	for s := range set {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+
+	for _, s := range symbols {
+		if err := k.client.CancelAllOpenOrders(ctx, s); err != nil {
+			errs = append(errs, fmt.Errorf("killswitch: cancel %v: %w", s, err))
+		}
+	}
+	if k.Flatten {
+		errs = append(errs, k.flatten(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// flatten closes the positions by market orders, reduce-only in one-way mode, of the position side in hedge mode.
+func (k *KillSwitch) flatten(ctx context.Context) error {
+	ctx = context.WithValue(ctx, flattenKey{}, true)
+	ps, err := k.client.GetPositionInfoV3(ctx, "")
+	if err != nil {
+		return fmt.Errorf("killswitch: query positions: %w", err)
+	}
+	var errs []error
+	for i := range ps {
+		p := &ps[i]
+		amt := p.PositionAmtDec()
+		if amt.IsZero() {
+			continue
+		}
+		op := trade.OrderParam{Symbol: p.Symbol, Side: pub.OS_Sell, Type: pub.OT_Market, Quantity: amt.Abs().String()}
+		if amt.IsNegative() {
+			op.Side = pub.OS_Buy
+		}
+		if side := pub.PositionSide(p.PositionSide); side == pub.PS_Long || side == pub.PS_Short {
+			op.PositionSide = side // reduceOnly cannot be sent in hedge mode
+		} else {
+			op.ReduceOnly = pub.Bool(true)
+		}
+		if _, err := k.client.NewOrder(ctx, &op); err != nil {
+			errs = append(errs, fmt.Errorf("killswitch: flatten %v %v: %w", p.Symbol, p.PositionSide, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reset unblocks the orders.
+func (k *KillSwitch) Reset() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.status = Status{}
+	k.client.Logf("killswitch Reset")
+}
+
+// Killed reports whether the orders are blocked.
+func (k *KillSwitch) Killed() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.status.Killed
+}
+
+// Status returns the state of the kill switch.
+func (k *KillSwitch) Status() Status {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.status
+}
+
+// Check returns ErrKilled if the orders are blocked.
+func (k *KillSwitch) Check() error {
+	if st := k.Status(); st.Killed {
+		return fmt.Errorf("%w: %v", ErrKilled, st.Reason)
+	}
+	return nil
+}
+
+// flattenKey marks the context of the orders of flatten, which pass the gate of Guard.
+type flattenKey struct{}
+
+// Guard sets the OrderGate of the client to Check, so the new orders of the clients made from it by WithKey after it,
+// and of the trade and wsapi clients of them, are blocked after the kill switch is triggered. The orders closing
+// the positions by Flatten are not blocked.
+func (k *KillSwitch) Guard(c *pub.Client) {
+	c.OrderGate = func(ctx context.Context) error {
+		if ctx.Value(flattenKey{}) != nil {
+			return nil
+		}
+		return k.Check()
+	}
+}
+
+// Rule returns the risk rule which rejects all orders after the kill switch is triggered, add it to the risk.Engine
+// which sends the orders.
+func (k *KillSwitch) Rule() risk.Rule {
+	return risk.NewRule(R_KillSwitch, func(c *risk.Check) string {
+		if st := k.Status(); st.Killed {
+			return "kill switch is triggered: " + st.Reason
+		}
+		return ""
+	})
+}
+
+// NotifySignal triggers the kill switch when one of the signals is received, such as syscall.SIGUSR1,
+// until ctx is done.
+func (k *KillSwitch) NotifySignal(ctx context.Context, sigs ...os.Signal) error {
+	if len(sigs) == 0 {
+		return errors.New("killswitch: no signal")
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				k.Kill(ctx, "signal "+sig.String())
+			}
+		}
+	}()
+	return nil
+}
+
+// Handler returns the HTTP handler of the kill switch: POST /kill?reason=... with the X-Killswitch-Token header of
+// Token triggers it, GET /status returns its Status in JSON. The custom header cannot be sent cross-site by a web page
+// without a CORS preflight, which is not answered, so a page in a local browser cannot trigger it.
+func (k *KillSwitch) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kill", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get("X-Killswitch-Token")
+		if k.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(k.Token)) != 1 {
+			http.Error(w, "invalid token", http.StatusForbidden)
+			return
+		}
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "http " + r.RemoteAddr
+		}
+		k.Kill(context.WithoutCancel(r.Context()), reason) // not stopped by the client
+		writeStatus(w, k.Status())
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, k.Status())
+	})
+	return mux
+}
+
+func writeStatus(w http.ResponseWriter, st Status) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// ListenAndServe serves Handler on the loopback address, such as "127.0.0.1:8089", until ctx is done.
+// Token must be set.
+func (k *KillSwitch) ListenAndServe(ctx context.Context, addr string) error {
+	if k.Token == "" {
+		return errors.New("killswitch: no token of the http endpoint")
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("killswitch: %v is not a loopback address", addr)
+	}
+	srv := &http.Server{Addr: addr, Handler: k.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
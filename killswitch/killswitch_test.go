@@ -0,0 +1,205 @@
+package killswitch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/billfort/binance-usdmfuture/internal/mockapi"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/risk"
+	"github.com/billfort/binance-usdmfuture/trade"
+	"github.com/billfort/binance-usdmfuture/wsapi"
+	"github.com/stretchr/testify/require"
+)
+
+type mockApi struct {
+	mu         sync.Mutex
+	requests   []string // method, path and the params of the checked ones
+	openOrders bool     // the open orders cannot be queried if false
+}
+
+func newMockApi(t *testing.T) (*pub.Client, *mockApi) {
+	m := &mockApi{openOrders: true}
+	pc := mockapi.New(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		req := r.Method + " " + r.URL.Path
+		switch r.URL.Path {
+		case "/fapi/v1/countdownCancelAll":
+			req += " " + q.Get("symbol") + " " + q.Get("countdownTime")
+			json.NewEncoder(w).Encode(map[string]string{"symbol": q.Get("symbol"), "countdownTime": q.Get("countdownTime")})
+		case "/fapi/v1/openOrders":
+			m.mu.Lock()
+			ok := m.openOrders
+			m.mu.Unlock()
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-1022,"msg":"Signature for this request is not valid."}`))
+				return
+			}
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"orderId": 1, "symbol": "BTCUSDT"}, {"orderId": 2, "symbol": "ETHUSDT"}, {"orderId": 3, "symbol": "BTCUSDT"}})
+		case "/fapi/v1/allOpenOrders":
+			req += " " + q.Get("symbol")
+			w.Write([]byte(`{"code":200,"msg":"The operation of cancel all open order is done."}`))
+		case "/fapi/v3/positionRisk":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"symbol": "BTCUSDT", "positionSide": "BOTH", "positionAmt": "-0.01"},
+				{"symbol": "ETHUSDT", "positionSide": "LONG", "positionAmt": "1.5"},
+				{"symbol": "ETHUSDT", "positionSide": "SHORT", "positionAmt": "0"},
+			})
+		case "/fapi/v1/order":
+			req += " " + q.Get("symbol") + " " + q.Get("side") + " " + q.Get("quantity") + " " + q.Get("positionSide") + q.Get("reduceOnly")
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 9, "symbol": q.Get("symbol"), "status": "NEW"})
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		m.mu.Lock()
+		m.requests = append(m.requests, req)
+		m.mu.Unlock()
+	})
+	return pc, m
+}
+
+func (m *mockApi) take() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.requests
+	m.requests = nil
+	return r
+}
+
+// go test -v -run TestHeartbeat
+func TestHeartbeat(t *testing.T) {
+	pc, m := newMockApi(t)
+	ctx := context.Background()
+	h := NewHeartbeat(pc)
+	active := []string{"ETHUSDT"}
+	h.Active = func() []string { return active }
+	h.Add("BTCUSDT")
+
+	require.NoError(t, h.Beat(ctx))
+	require.Equal(t, []string{
+		"POST /fapi/v1/countdownCancelAll BTCUSDT 60000",
+		"POST /fapi/v1/countdownCancelAll ETHUSDT 60000",
+	}, m.take())
+
+	active = nil // ETHUSDT is not active any more
+	require.NoError(t, h.Beat(ctx))
+	require.Equal(t, []string{
+		"POST /fapi/v1/countdownCancelAll BTCUSDT 60000",
+		"POST /fapi/v1/countdownCancelAll ETHUSDT 0",
+	}, m.take())
+
+	require.NoError(t, h.Remove(ctx, "BTCUSDT"))
+	require.Equal(t, []string{"POST /fapi/v1/countdownCancelAll BTCUSDT 0"}, m.take())
+	require.Empty(t, h.Symbols())
+	require.NoError(t, h.Disarm(ctx))
+	require.Empty(t, m.take())
+
+	h.Interval = h.Countdown
+	require.Error(t, h.Start(ctx))
+}
+
+// go test -v -run TestKillSwitch
+func TestKillSwitch(t *testing.T) {
+	pc, m := newMockApi(t)
+	ctx := context.Background()
+	k := New(pc)
+	k.Flatten = true
+	k.Guard(pc)
+	var killed string
+	k.OnKill = func(reason string, err error) { killed = reason }
+
+	engine := risk.NewEngine(pc, nil)
+	engine.AddRule(k.Rule())
+	op := &trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Limit, TimeInForce: pub.TIF_GTC, Quantity: "0.01", Price: "60000"}
+	require.NoError(t, engine.Check(op))
+	require.NoError(t, k.Check())
+
+	require.NoError(t, k.Kill(ctx, "test"))
+	require.Equal(t, "test", killed)
+	require.Equal(t, []string{
+		"GET /fapi/v1/openOrders",
+		"DELETE /fapi/v1/allOpenOrders BTCUSDT",
+		"DELETE /fapi/v1/allOpenOrders ETHUSDT",
+		"GET /fapi/v3/positionRisk",
+		"POST /fapi/v1/order BTCUSDT BUY 0.01 true",
+		"POST /fapi/v1/order ETHUSDT SELL 1.5 LONG",
+	}, m.take())
+	require.ErrorIs(t, k.Check(), ErrKilled)
+	rs, ok := risk.AsRejections(engine.Check(op))
+	require.True(t, ok)
+	require.True(t, rs.Has(R_KillSwitch))
+
+	// the orders of the guarded client are not sent
+	tc := trade.NewClient(pc.WithKey(pc.Key))
+	_, err := tc.NewOrder(ctx, op)
+	require.ErrorIs(t, err, ErrKilled)
+	_, err = tc.BatchOrders(ctx, []trade.OrderParam{*op})
+	require.ErrorIs(t, err, ErrKilled)
+	_, err = wsapi.NewClient(pc).PlaceOrder(ctx, op)
+	require.ErrorIs(t, err, ErrKilled)
+	require.Empty(t, m.take())
+
+	k.Reset()
+	require.False(t, k.Killed())
+	require.NoError(t, engine.Check(op))
+	_, err = tc.NewOrder(ctx, op)
+	require.NoError(t, err)
+	require.Len(t, m.take(), 1)
+
+	// the symbols of the heartbeat are canceled and the positions are flattened if the open orders cannot be queried
+	m.mu.Lock()
+	m.openOrders = false
+	m.mu.Unlock()
+	k.Heartbeat = NewHeartbeat(pc)
+	k.Heartbeat.Add("XRPUSDT")
+	require.Error(t, k.Kill(ctx, "test"))
+	require.Equal(t, []string{
+		"DELETE /fapi/v1/allOpenOrders XRPUSDT",
+		"GET /fapi/v3/positionRisk",
+		"POST /fapi/v1/order BTCUSDT BUY 0.01 true",
+		"POST /fapi/v1/order ETHUSDT SELL 1.5 LONG",
+	}, m.take())
+	require.NotEmpty(t, k.Status().Err)
+	k.Reset()
+	k.Heartbeat = nil
+	m.mu.Lock()
+	m.openOrders = true
+	m.mu.Unlock()
+
+	// by the http endpoint
+	k.Flatten = false
+	srv := httptest.NewServer(k.Handler())
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/kill")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	res, err = http.Post(srv.URL+"/kill?reason=manual", "", nil) // no token, such as a cross-site request
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	require.False(t, k.Killed())
+	k.Token = "secret"
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/kill?reason=manual", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Killswitch-Token", "secret")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var st Status
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&st))
+	res.Body.Close()
+	require.True(t, st.Killed)
+	require.Equal(t, "manual", st.Reason)
+	require.Len(t, m.take(), 3)
+
+	require.Error(t, k.ListenAndServe(ctx, "0.0.0.0:0"))
+	k.Token = ""
+	require.Error(t, k.ListenAndServe(ctx, "127.0.0.1:0"))
+	require.Error(t, k.NotifySignal(ctx))
+}
@@ -0,0 +1,366 @@
+// Package margin calculates the margins, liquidation and bankruptcy prices of the positions by the notional
+// and leverage brackets, for isolated and cross positions in one-way or hedge mode.
+package margin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/billfort/binance-usdmfuture/account"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+// scale of the calculated prices and quantities, round them to the tick size or step size to use.
+const scale = 8
+
+var (
+	ErrNoBrackets      = errors.New("margin: no brackets of the symbol")
+	ErrInvalidLeverage = errors.New("margin: invalid leverage")
+)
+
+// Bracket is a notional bracket: a position of notional in [NotionalFloor, NotionalCap) can be opened with
+// InitialLeverage at most, its maintenance margin is notional * MaintMarginRatio - Cum.
+type Bracket struct {
+	Bracket          int
+	InitialLeverage  int
+	NotionalFloor    pub.Decimal
+	NotionalCap      pub.Decimal
+	MaintMarginRatio pub.Decimal
+	Cum              pub.Decimal
+}
+
+// Brackets are the brackets of a symbol sorted by NotionalFloor.
+type Brackets []Bracket
+
+// NewBrackets returns the brackets of account.LeverageBracket.
+func NewBrackets(b *account.SymbolBracket) Brackets {
+	bs := make(Brackets, 0, len(b.Brackets))
+	for _, r := range b.Brackets {
+		bs = append(bs, Bracket{
+			Bracket:          r.Bracket,
+			InitialLeverage:  r.InitialLeverage,
+			NotionalFloor:    pub.NewDecimalFromFloat(r.NotionalFloor),
+			NotionalCap:      pub.NewDecimalFromFloat(r.NotionalCap),
+			MaintMarginRatio: pub.NewDecimalFromFloat(r.MaintMarginRatio),
+			Cum:              pub.NewDecimalFromFloat(r.Cum),
+		})
+	}
+	return bs.sorted()
+}
+
+// ContractInfoBrackets returns the brackets of the !contractInfo event, nil if it has none.
+func ContractInfoBrackets(e *streammarket.ContractInfo) Brackets {
+	if len(e.Brackets) == 0 {
+		return nil
+	}
+	bs := make(Brackets, 0, len(e.Brackets))
+	for _, r := range e.Brackets {
+		bs = append(bs, Bracket{
+			Bracket:          r.Bracket,
+			InitialLeverage:  r.MaxLeverage,
+			NotionalFloor:    pub.NewDecimalFromInt(int64(r.BracketFloor)),
+			NotionalCap:      pub.NewDecimalFromInt(int64(r.BracketCeiling)),
+			MaintMarginRatio: pub.NewDecimalFromFloat(r.MaintenanceRatio),
+			Cum:              pub.NewDecimalFromFloat(r.CalculationField),
+		})
+	}
+	return bs.sorted()
+}
+
+func (bs Brackets) sorted() Brackets {
+	sort.Slice(bs, func(i, j int) bool { return bs[i].NotionalFloor.LessThan(bs[j].NotionalFloor) })
+	return bs
+}
+
+// Find returns the bracket of the notional, the last one if it is over all caps.
+func (bs Brackets) Find(notional pub.Decimal) Bracket {
+	notional = notional.Abs()
+	for _, b := range bs {
+		if notional.LessThan(b.NotionalCap) {
+			return b
+		}
+	}
+	if len(bs) == 0 {
+		return Bracket{}
+	}
+	return bs[len(bs)-1]
+}
+
+// MaintMargin returns the maintenance margin of the notional.
+func (bs Brackets) MaintMargin(notional pub.Decimal) pub.Decimal {
+	b := bs.Find(notional)
+	return notional.Abs().Mul(b.MaintMarginRatio).Sub(b.Cum)
+}
+
+// MaxLeverage returns the max initial leverage of the notional.
+func (bs Brackets) MaxLeverage(notional pub.Decimal) int {
+	return bs.Find(notional).InitialLeverage
+}
+
+// MaxNotional returns the max notional of a position of the leverage, zero if the leverage is over all brackets.
+func (bs Brackets) MaxNotional(leverage int) pub.Decimal {
+	var max pub.Decimal
+	for _, b := range bs {
+		if b.InitialLeverage >= leverage {
+			max = max.Max(b.NotionalCap)
+		}
+	}
+	return max
+}
+
+// Position is a position or a leg of a hedge position, Amount is negative for a short position.
+type Position struct {
+	Symbol         string
+	Side           pub.PositionSide
+	Amount         pub.Decimal
+	EntryPrice     pub.Decimal
+	MarkPrice      pub.Decimal
+	Leverage       int
+	MarginType     pub.MarginType
+	IsolatedWallet pub.Decimal // wallet balance of an isolated position
+}
+
+// FromPositionInfo returns the position of trade.GetPositionInfoV2.
+func FromPositionInfo(p *trade.PositionInfo) Position {
+	lev, _ := strconv.Atoi(p.Leverage)
+	mt := pub.MT_Cross
+	if p.MarginType == "isolated" || p.MarginType == string(pub.MT_Isolated) {
+		mt = pub.MT_Isolated
+	}
+	return Position{
+		Symbol:         p.Symbol,
+		Side:           pub.PositionSide(p.PositionSide),
+		Amount:         p.PositionAmtDec(),
+		EntryPrice:     p.EntryPriceDec(),
+		MarkPrice:      p.MarkPriceDec(),
+		Leverage:       lev,
+		MarginType:     mt,
+		IsolatedWallet: pub.D(p.IsolatedWallet),
+	}
+}
+
+// Notional returns the notional value by the mark price.
+func (p *Position) Notional() pub.Decimal {
+	return p.Amount.Abs().Mul(p.MarkPrice)
+}
+
+// UnrealizedPnl returns the unrealized profit by the mark price.
+func (p *Position) UnrealizedPnl() pub.Decimal {
+	return p.MarkPrice.Sub(p.EntryPrice).Mul(p.Amount)
+}
+
+// leg is a position of the symbol in the liquidation price.
+type leg struct {
+	amount pub.Decimal
+	entry  pub.Decimal
+	b      Bracket
+}
+
+// liquidationPrice solves the price where the margin balance equals the maintenance margin:
+//
+//	price = (wallet - otherMaint + otherPnl + Σ cum - Σ amount * entry) / (Σ |amount| * mmr - Σ amount)
+//
+// The bracket of each leg is of its notional at the solved price, it is searched from the one at the start price.
+// A zero price is returned if the positions cannot be liquidated.
+func liquidationPrice(bs Brackets, ps []Position, wallet, otherMaint, otherPnl, start pub.Decimal, bankruptcy bool) pub.Decimal {
+	legs := make([]leg, len(ps))
+	for i := range ps {
+		legs[i] = leg{amount: ps[i].Amount, entry: ps[i].EntryPrice}
+	}
+	if bankruptcy {
+		otherMaint = pub.Decimal{}
+	}
+	price := start
+	var lp pub.Decimal
+	for n := 0; n <= len(bs); n++ {
+		changed := false
+		num := wallet.Sub(otherMaint).Add(otherPnl)
+		var den pub.Decimal
+		for i := range legs {
+			l := &legs[i]
+			if !bankruptcy {
+				if b := bs.Find(l.amount.Mul(price)); n == 0 || b.Bracket != l.b.Bracket {
+					l.b, changed = b, true
+				}
+				num = num.Add(l.b.Cum)
+				den = den.Add(l.amount.Abs().Mul(l.b.MaintMarginRatio))
+			}
+			num = num.Sub(l.amount.Mul(l.entry))
+			den = den.Sub(l.amount)
+		}
+		if den.IsZero() {
+			return pub.Decimal{}
+		}
+		lp = num.Div(den, scale)
+		if !lp.IsPositive() {
+			return pub.Decimal{}
+		}
+		if !changed || bankruptcy {
+			break
+		}
+		price = lp
+	}
+	return lp
+}
+
+// Calculator keeps the brackets of the symbols. It is safe for concurrent use.
+type Calculator struct {
+	client *account.Client
+
+	mu       sync.RWMutex
+	brackets map[string]Brackets
+}
+
+func NewCalculator(c *pub.Client) *Calculator {
+	return &Calculator{client: account.NewClient(c), brackets: map[string]Brackets{}}
+}
+
+// Load loads the brackets of all symbols of the account by account.LeverageBracket.
+func (c *Calculator) Load(ctx context.Context) error {
+	sbs, err := c.client.LeverageBracket(ctx, "")
+	if err != nil {
+		return err
+	}
+	for i := range sbs {
+		c.Set(sbs[i].Symbol, NewBrackets(&sbs[i]))
+	}
+	return nil
+}
+
+// Set sets the brackets of the symbol.
+func (c *Calculator) Set(symbol string, bs Brackets) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.brackets[symbol] = bs
+}
+
+// ApplyContractInfo sets the brackets of the !contractInfo event if it has them.
+func (c *Calculator) ApplyContractInfo(e *streammarket.ContractInfo) {
+	if bs := ContractInfoBrackets(e); bs != nil {
+		c.Set(e.Symbol, bs)
+	}
+}
+
+// Brackets returns the brackets of the symbol, or ErrNoBrackets.
+func (c *Calculator) Brackets(symbol string) (Brackets, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	bs := c.brackets[symbol]
+	if len(bs) == 0 {
+		return nil, fmt.Errorf("%w %q", ErrNoBrackets, symbol)
+	}
+	return bs, nil
+}
+
+// InitialMargin returns the initial margin of the position, notional / leverage.
+func (c *Calculator) InitialMargin(p *Position) (pub.Decimal, error) {
+	if p.Leverage <= 0 {
+		return pub.Decimal{}, fmt.Errorf("%w %v of %v", ErrInvalidLeverage, p.Leverage, p.Symbol)
+	}
+	return p.Notional().Div(pub.NewDecimalFromInt(int64(p.Leverage)), scale), nil
+}
+
+// MaintMargin returns the maintenance margin of the position.
+func (c *Calculator) MaintMargin(p *Position) (pub.Decimal, error) {
+	bs, err := c.Brackets(p.Symbol)
+	if err != nil {
+		return pub.Decimal{}, err
+	}
+	return bs.MaintMargin(p.Notional()), nil
+}
+
+// IsolatedLiquidationPrice returns the liquidation price of an isolated position or a leg of a hedge position,
+// zero if it cannot be liquidated.
+func (c *Calculator) IsolatedLiquidationPrice(p *Position) (pub.Decimal, error) {
+	bs, err := c.Brackets(p.Symbol)
+	if err != nil {
+		return pub.Decimal{}, err
+	}
+	return liquidationPrice(bs, []Position{*p}, p.IsolatedWallet, pub.Decimal{}, pub.Decimal{}, startPrice(p), false), nil
+}
+
+// IsolatedBankruptcyPrice returns the price where the isolated wallet of the position is lost.
+func (c *Calculator) IsolatedBankruptcyPrice(p *Position) pub.Decimal {
+	return liquidationPrice(nil, []Position{*p}, p.IsolatedWallet, pub.Decimal{}, pub.Decimal{}, startPrice(p), true)
+}
+
+// CrossLiquidationPrice returns the liquidation price of the cross positions of the symbol, the one of BOTH in
+// one-way mode or the both legs in hedge mode. wallet is the cross wallet balance of the margin asset, ps are all
+// cross positions of the margin asset, the maintenance margin and unrealized profit of the other symbols are by
+// their mark prices. The isolated positions of ps are skipped.
+func (c *Calculator) CrossLiquidationPrice(symbol string, wallet pub.Decimal, ps []Position) (pub.Decimal, error) {
+	bs, legs, otherMaint, otherPnl, err := c.cross(symbol, ps)
+	if err != nil || len(legs) == 0 {
+		return pub.Decimal{}, err
+	}
+	return liquidationPrice(bs, legs, wallet, otherMaint, otherPnl, startPrice(&legs[0]), false), nil
+}
+
+// CrossBankruptcyPrice returns the price of the symbol where the cross margin balance is lost, see CrossLiquidationPrice.
+func (c *Calculator) CrossBankruptcyPrice(symbol string, wallet pub.Decimal, ps []Position) (pub.Decimal, error) {
+	bs, legs, _, otherPnl, err := c.cross(symbol, ps)
+	if err != nil || len(legs) == 0 {
+		return pub.Decimal{}, err
+	}
+	return liquidationPrice(bs, legs, wallet, pub.Decimal{}, otherPnl, startPrice(&legs[0]), true), nil
+}
+
+func (c *Calculator) cross(symbol string, ps []Position) (bs Brackets, legs []Position, otherMaint, otherPnl pub.Decimal, err error) {
+	for i := range ps {
+		p := &ps[i]
+		if p.MarginType == pub.MT_Isolated || p.Amount.IsZero() {
+			continue
+		}
+		if p.Symbol == symbol {
+			legs = append(legs, *p)
+			continue
+		}
+		mm, err := c.MaintMargin(p)
+		if err != nil {
+			return nil, nil, pub.Decimal{}, pub.Decimal{}, err
+		}
+		otherMaint = otherMaint.Add(mm)
+		otherPnl = otherPnl.Add(p.UnrealizedPnl())
+	}
+	if len(legs) == 0 {
+		return nil, nil, otherMaint, otherPnl, nil
+	}
+	bs, err = c.Brackets(symbol)
+	return bs, legs, otherMaint, otherPnl, err
+}
+
+// MaxOpenQty returns the max quantity which can be opened at the price with the leverage by the available balance,
+// within the max notional of the leverage after the current notional of the symbol. Round it down to the step size to use.
+func (c *Calculator) MaxOpenQty(symbol string, leverage int, price, available, current pub.Decimal) (pub.Decimal, error) {
+	bs, err := c.Brackets(symbol)
+	if err != nil {
+		return pub.Decimal{}, err
+	}
+	maxNotional := bs.MaxNotional(leverage)
+	if leverage <= 0 || maxNotional.IsZero() {
+		return pub.Decimal{}, fmt.Errorf("%w %v of %v", ErrInvalidLeverage, leverage, symbol)
+	}
+	if !price.IsPositive() || !available.IsPositive() {
+		return pub.Decimal{}, nil
+	}
+	qty := available.Mul(pub.NewDecimalFromInt(int64(leverage))).DivRound(price, scale, pub.RM_Down)
+	room := maxNotional.Sub(current.Abs())
+	if !room.IsPositive() {
+		return pub.Decimal{}, nil
+	}
+	return qty.Min(room.DivRound(price, scale, pub.RM_Down)), nil
+}
+
+// startPrice is the mark price, or the entry price if the mark price is not known.
+func startPrice(p *Position) pub.Decimal {
+	if p.MarkPrice.IsPositive() {
+		return p.MarkPrice
+	}
+	return p.EntryPrice
+}
@@ -0,0 +1,219 @@
+package margin
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/billfort/binance-usdmfuture/account"
+	"github.com/billfort/binance-usdmfuture/internal/mockapi"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+	"github.com/billfort/binance-usdmfuture/trade"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const leverageBrackets = `[
+{"symbol":"BTCUSDT","brackets":[
+	{"bracket":1,"initialLeverage":125,"notionalCap":50000,"notionalFloor":0,"maintMarginRatio":0.004,"cum":0.0},
+	{"bracket":2,"initialLeverage":100,"notionalCap":600000,"notionalFloor":50000,"maintMarginRatio":0.005,"cum":50.0},
+	{"bracket":3,"initialLeverage":75,"notionalCap":3000000,"notionalFloor":600000,"maintMarginRatio":0.01,"cum":3050.0}]},
+{"symbol":"ETHUSDT","brackets":[
+	{"bracket":1,"initialLeverage":100,"notionalCap":10000,"notionalFloor":0,"maintMarginRatio":0.005,"cum":0.0},
+	{"bracket":2,"initialLeverage":75,"notionalCap":100000,"notionalFloor":10000,"maintMarginRatio":0.0065,"cum":15.0}]}
+]`
+
+// liquidationTolerance is the relative difference allowed to the liquidation price of binance.
+var liquidationTolerance = pub.D("0.001")
+
+// record names the testdata file TestRecordPositionRisk writes.
+var record = flag.String("record", "", "record the positions of the testnet account to testdata/<name>.json")
+
+// recording is what binance sends for the positions of an account: the USDT entry of assets of /fapi/v2/account,
+// the /fapi/v1/leverageBracket entries and the /fapi/v2/positionRisk entries of the symbols with a position.
+type recording struct {
+	Asset           json.RawMessage   `json:"asset"`
+	LeverageBracket []json.RawMessage `json:"leverageBracket"`
+	PositionRisk    []json.RawMessage `json:"positionRisk"`
+}
+
+// go test -v -run TestRecordPositionRisk -record cross-hedge
+// open the positions on the testnet account of pub.TestKey first, e.g. an isolated long, an isolated short,
+// cross positions in one-way mode and both legs in hedge mode, one recording each.
+func TestRecordPositionRisk(t *testing.T) {
+	if *record == "" {
+		t.Skip("no -record name")
+	}
+	ctx := context.Background()
+	c := pub.NewEnvClient(pub.Testnet, pub.TestKey)
+	get := func(path string, v interface{}) {
+		resBody, err := c.GetWithSign(ctx, path, nil)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(resBody, v))
+	}
+
+	var rec recording
+	var positions []json.RawMessage
+	get("/fapi/v2/positionRisk", &positions)
+	symbols := map[string]bool{}
+	for _, raw := range positions {
+		var p trade.PositionInfo
+		require.NoError(t, json.Unmarshal(raw, &p))
+		if !p.PositionAmtDec().IsZero() {
+			rec.PositionRisk = append(rec.PositionRisk, raw)
+			symbols[p.Symbol] = true
+		}
+	}
+	require.NotEmpty(t, rec.PositionRisk, "no positions on the account")
+
+	var brackets []json.RawMessage
+	get("/fapi/v1/leverageBracket", &brackets)
+	for _, raw := range brackets {
+		var sb account.SymbolBracket
+		require.NoError(t, json.Unmarshal(raw, &sb))
+		if symbols[sb.Symbol] {
+			rec.LeverageBracket = append(rec.LeverageBracket, raw)
+		}
+	}
+
+	var info struct {
+		Assets []json.RawMessage `json:"assets"`
+	}
+	get("/fapi/v2/account", &info)
+	for _, raw := range info.Assets {
+		var a struct {
+			Asset string `json:"asset"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &a))
+		if a.Asset == "USDT" {
+			rec.Asset = raw
+		}
+	}
+	require.NotNil(t, rec.Asset, "no USDT asset")
+
+	b, err := json.MarshalIndent(&rec, "", "\t")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll("testdata", 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("testdata", *record+".json"), b, 0644))
+}
+
+func newCalculator(t *testing.T) *Calculator {
+	pc := mockapi.New(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/fapi/v1/leverageBracket", r.URL.Path)
+		w.Write([]byte(leverageBrackets))
+	})
+	c := NewCalculator(pc)
+	require.NoError(t, c.Load(context.Background()))
+	return c
+}
+
+// go test -v -run TestLiquidationPrice
+func TestLiquidationPrice(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	require.NoError(t, err)
+	if len(files) == 0 {
+		t.Skip("no recordings in testdata, see TestRecordPositionRisk")
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var rec recording
+		require.NoError(t, json.Unmarshal(b, &rec), file)
+
+		c := NewCalculator(nil)
+		for _, raw := range rec.LeverageBracket {
+			var sb account.SymbolBracket
+			require.NoError(t, json.Unmarshal(raw, &sb), file)
+			c.Set(sb.Symbol, NewBrackets(&sb))
+		}
+		var asset struct {
+			CrossWalletBalance string `json:"crossWalletBalance"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Asset, &asset), file)
+		infos := make([]trade.PositionInfo, len(rec.PositionRisk))
+		ps := make([]Position, len(rec.PositionRisk))
+		for i, raw := range rec.PositionRisk {
+			require.NoError(t, json.Unmarshal(raw, &infos[i]), file)
+			ps[i] = FromPositionInfo(&infos[i])
+		}
+
+		for i := range infos {
+			var lp pub.Decimal
+			if ps[i].MarginType == pub.MT_Isolated {
+				lp, err = c.IsolatedLiquidationPrice(&ps[i])
+			} else {
+				lp, err = c.CrossLiquidationPrice(ps[i].Symbol, pub.D(asset.CrossWalletBalance), ps)
+			}
+			require.NoError(t, err, file)
+			want := infos[i].LiquidationPriceDec()
+			if !want.IsPositive() {
+				require.False(t, lp.IsPositive(), "%v %v %v: %v, binance %v", file, infos[i].Symbol, infos[i].PositionSide, lp, want)
+				continue
+			}
+			require.True(t, lp.Sub(want).Abs().LessOrEqual(want.Mul(liquidationTolerance)),
+				"%v %v %v: %v, binance %v", file, infos[i].Symbol, infos[i].PositionSide, lp, want)
+		}
+	}
+}
+
+// go test -v -run TestMargin
+func TestMargin(t *testing.T) {
+	c := newCalculator(t)
+	p := Position{Symbol: "BTCUSDT", Side: pub.PS_Both, Amount: pub.D("1"), EntryPrice: pub.D("60000"), MarkPrice: pub.D("60000"),
+		Leverage: 20, MarginType: pub.MT_Isolated, IsolatedWallet: pub.D("3000")}
+	im, err := c.InitialMargin(&p)
+	require.NoError(t, err)
+	require.Equal(t, "3000", im.String())
+	mm, err := c.MaintMargin(&p)
+	require.NoError(t, err)
+	require.Equal(t, "250", mm.String()) // 60000 * 0.005 - 50
+	require.Equal(t, "57000", c.IsolatedBankruptcyPrice(&p).String())
+
+	p.Amount = pub.D("-1")
+	require.Equal(t, "63000", c.IsolatedBankruptcyPrice(&p).String())
+
+	bp, err := c.CrossBankruptcyPrice("BTCUSDT", pub.D("10000"), []Position{
+		{Symbol: "BTCUSDT", Amount: pub.D("2"), EntryPrice: pub.D("60000"), MarkPrice: pub.D("59000")},
+		{Symbol: "ETHUSDT", Amount: pub.D("-10"), EntryPrice: pub.D("3000"), MarkPrice: pub.D("3100")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "55500", bp.String()) // (10000 - 1000 - 120000) / -2
+
+	lp, err := c.CrossLiquidationPrice("BTCUSDT", pub.D("1000"), []Position{
+		{Symbol: "BTCUSDT", Side: pub.PS_Long, Amount: pub.D("1"), EntryPrice: pub.D("60000")},
+		{Symbol: "BTCUSDT", Side: pub.PS_Short, Amount: pub.D("-1"), EntryPrice: pub.D("60000")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "110000", lp.String()) // fully hedged, liquidated when 1000 + 2 * 50 = 2 * price * 0.005
+
+	qty, err := c.MaxOpenQty("BTCUSDT", 100, pub.D("60000"), pub.D("1000"), pub.Decimal{})
+	require.NoError(t, err)
+	require.Equal(t, "1.66666666", qty.String())
+	qty, err = c.MaxOpenQty("BTCUSDT", 125, pub.D("60000"), pub.D("1000"), pub.D("20000"))
+	require.NoError(t, err)
+	require.Equal(t, "0.5", qty.String()) // (50000 - 20000) / 60000
+	_, err = c.MaxOpenQty("BTCUSDT", 150, pub.D("60000"), pub.D("1000"), pub.Decimal{})
+	require.ErrorIs(t, err, ErrInvalidLeverage)
+	_, err = c.MaxOpenQty("XRPUSDT", 10, pub.D("1"), pub.D("1000"), pub.Decimal{})
+	require.ErrorIs(t, err, ErrNoBrackets)
+
+	bs, _ := c.Brackets("BTCUSDT")
+	require.Equal(t, 75, bs.MaxLeverage(pub.D("700000")))
+	require.Equal(t, 100, bs.MaxLeverage(pub.D("-50000")))
+	var sb account.SymbolBracket
+	require.NoError(t, json.Unmarshal([]byte(`{"symbol":"X","notionalCoef":1.5,"brackets":[{"bracket":1,"cum":8.25}]}`), &sb))
+	require.Equal(t, "8.25", NewBrackets(&sb)[0].Cum.String())
+
+	var ci streammarket.ContractInfo
+	require.NoError(t, json.Unmarshal([]byte(`{"e":"contractInfo","s":"X","bks":[{"bs":2,"bnf":5000,"bnc":25000,"mmr":0.01,"cf":7.5,"mi":21,"ma":50},{"bs":1,"bnf":0,"bnc":5000,"mmr":0.0065,"cf":0,"mi":51,"ma":75}]}`), &ci))
+	c.ApplyContractInfo(&ci)
+	bs, err = c.Brackets("X")
+	require.NoError(t, err)
+	require.Equal(t, "7.5", bs[1].Cum.String())
+	require.Equal(t, 75, bs.MaxLeverage(pub.D("1000")))
+}
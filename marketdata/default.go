@@ -0,0 +1,153 @@
+package marketdata
+
+import (
+	"context"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+// The package level functions below keep the original API, they send requests by pub.DefaultClient.
+
+func defaultClient() *Client {
+	return NewClient(pub.DefaultClient)
+}
+
+// Test connectivity to the Rest API.
+func Connectivity() error {
+	return defaultClient().Connectivity(context.Background())
+}
+
+// Test connectivity to the Rest API and get the current server time.
+func CheckServerTime() (int64, error) {
+	return defaultClient().CheckServerTime(context.Background())
+}
+
+// Current exchange trading rules and symbol information
+func ExchangeInfo() (*ExchInfo, error) {
+	return defaultClient().ExchangeInfo(context.Background())
+}
+
+// Query symbol orderbook
+func OrderBook(symbol string, limit int) (*orderBook, error) {
+	return defaultClient().OrderBook(context.Background(), symbol, limit)
+}
+
+// Get recent market trades filled in the order book. Only market trades will be returned,
+func RecentMarketTrades(symbol string, limit int) ([]marketTrade, error) {
+	return defaultClient().RecentMarketTrades(context.Background(), symbol, limit)
+}
+
+// Get older market historical trades.
+func HistoricalTrades(symbol string, fromId, limit int) ([]marketTrade, error) {
+	return defaultClient().HistoricalTrades(context.Background(), symbol, fromId, limit)
+}
+
+// Get compressed, aggregate market trades. Market trades that fill in 100ms with the same price
+func AggregatedTrades(symbol string, fromId, startTime, endTime, limit int) ([]aggTrade, error) {
+	return defaultClient().AggregatedTrades(context.Background(), symbol, fromId, startTime, endTime, limit)
+}
+
+// Kline/candlestick bars for a symbol. Klines are uniquely identified by their open time.
+func Klines(symbol string, interval pub.KlineInterval, startTime, endTime, limit int64) ([]kData, error) {
+	return defaultClient().Klines(context.Background(), symbol, interval, startTime, endTime, limit)
+}
+
+// Kline/candlestick bars for a specific contract type. Klines are uniquely identified by their open time.
+func ContinuousKlines(pair string, contractType pub.ContractType, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
+	return defaultClient().ContinuousKlines(context.Background(), pair, contractType, interval, startTime, endTime, limit)
+}
+
+// Kline/candlestick bars for the index price of a pair. Klines are uniquely identified by their open time.
+func IndexPriceKlines(pair string, contractType pub.ContractType, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
+	return defaultClient().IndexPriceKlines(context.Background(), pair, contractType, interval, startTime, endTime, limit)
+}
+
+// Kline/candlestick bars for the mark price of a symbol. Klines are uniquely identified by their open time.
+func MarkPriceKlines(symbol string, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
+	return defaultClient().MarkPriceKlines(context.Background(), symbol, interval, startTime, endTime, limit)
+}
+
+// Premium index kline bars of a symbol. Klines are uniquely identified by their open time.
+func PremiumIndexKlines(symbol string, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
+	return defaultClient().PremiumIndexKlines(context.Background(), symbol, interval, startTime, endTime, limit)
+}
+
+// Mark Price and Funding Rate
+func MarkPrice(symbol string) ([]markPrice, error) {
+	return defaultClient().MarkPrice(context.Background(), symbol)
+}
+
+// Get Funding Rate History
+func FundingRateHistory(symbol string, startTime, endTime, limit int) ([]fundingRate, error) {
+	return defaultClient().FundingRateHistory(context.Background(), symbol, startTime, endTime, limit)
+}
+
+// Query funding rate info for symbols that had FundingRateCap/ FundingRateFloor / fundingIntervalHours adjustment
+func FundingInfo() ([]fundingInfo, error) {
+	return defaultClient().FundingInfo(context.Background())
+}
+
+// 24 hour rolling window price change statistics.
+func TickerPriceStatistics24hr(symbol string) ([]ticker24hr, error) {
+	return defaultClient().TickerPriceStatistics24hr(context.Background(), symbol)
+}
+
+// Latest price for a symbol or symbols.
+func TickerPrice(symbol string, version string) ([]tickerPrice, error) {
+	return defaultClient().TickerPrice(context.Background(), symbol, version)
+}
+
+// Best price/qty on the order book for a symbol or symbols.
+func BookTicker(symbol string) ([]bookTicker, error) {
+	return defaultClient().BookTicker(context.Background(), symbol)
+}
+
+// DeliveryPrice
+func DeliveryPrice(pair string) ([]deliveryPrice, error) {
+	return defaultClient().DeliveryPrice(context.Background(), pair)
+}
+
+// Get present open interest of a specific symbol.
+func OpenInterest(symbol string) (*openInterest, error) {
+	return defaultClient().OpenInterest(context.Background(), symbol)
+}
+
+// Open Interest Statistics
+func OpenInterestHist(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]openInterestHist, error) {
+	return defaultClient().OpenInterestHist(context.Background(), symbol, period, startTime, endTime, limit)
+}
+
+// The proportion of net long and net short positions to total open positions of the top 20% users with the highest margin balance.
+func TopLongShortPositionRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
+	return defaultClient().TopLongShortPositionRatio(context.Background(), symbol, period, startTime, endTime, limit)
+}
+
+// The proportion of net long and net short accounts to total accounts of the top 20% users with the highest margin balance. Each account is counted once only.
+func TopLongShortAccountRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
+	return defaultClient().TopLongShortAccountRatio(context.Background(), symbol, period, startTime, endTime, limit)
+}
+
+// Query symbol Long/Short Ratio
+func GlobalLongShortAccountRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
+	return defaultClient().GlobalLongShortAccountRatio(context.Background(), symbol, period, startTime, endTime, limit)
+}
+
+// Taker Buy/Sell Volume
+func TakerLongShortRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]takerLongShortRatio, error) {
+	return defaultClient().TakerLongShortRatio(context.Background(), symbol, period, startTime, endTime, limit)
+}
+
+// Query composite index symbol information
+func CompositeIndexInfo(symbol string) ([]indexInfo, error) {
+	return defaultClient().CompositeIndexInfo(context.Background(), symbol)
+}
+
+// asset index for Multi-Assets mode
+func AssetIndex(symbol string) ([]assetIndex, error) {
+	return defaultClient().AssetIndex(context.Background(), symbol)
+}
+
+// Query index price constituents
+func IndexConstituents(symbol string) (*indexConstituents, error) {
+	return defaultClient().IndexConstituents(context.Background(), symbol)
+}
@@ -1,27 +1,36 @@
 package marketdata
 
 import (
+	"context"
 	"encoding/json"
-	"log"
 
 	"github.com/billfort/binance-usdmfuture/pub"
 )
 
+// Client sends marketdata requests with the settings and key of the wrapped pub.Client.
+type Client struct {
+	*pub.Client
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c}
+}
+
 // Test connectivity to the Rest API.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api
-func Connectivity() error {
-	resBody, err := pub.GetNoSign("/fapi/v1/ping", nil)
+func (c *Client) Connectivity(ctx context.Context) error {
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/ping", nil)
 	if err != nil {
 		return err
 	}
-	log.Println("TestConnectivity: ", string(resBody)) // "{}"
+	c.Logf("TestConnectivity: %v", string(resBody)) // "{}"
 	return nil
 }
 
 // Test connectivity to the Rest API and get the current server time.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Check-Server-Time
-func CheckServerTime() (int64, error) {
-	resBody, err := pub.GetNoSign("/fapi/v1/time", nil)
+func (c *Client) CheckServerTime(ctx context.Context) (int64, error) {
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/time", nil)
 	if err != nil {
 		return 0, err
 	}
@@ -38,10 +47,10 @@ func CheckServerTime() (int64, error) {
 	return s.ServerTime, nil
 }
 
-// Current exchange trading rules and symbol information
+// Current exchange trading rules and symbol information, the rate limits are applied to the client's Limiter.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Exchange-Information
-func ExchangeInfo() (*ExchInfo, error) {
-	resBody, err := pub.GetNoSign("/fapi/v1/exchangeInfo", nil)
+func (c *Client) ExchangeInfo(ctx context.Context) (*ExchInfo, error) {
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/exchangeInfo", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -50,21 +59,24 @@ func ExchangeInfo() (*ExchInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("market.GetExchInfo, rateLimits len %v, Assets len %v, Symbols len %v\n", len(ei.RateLimits), len(ei.Assets), len(ei.Symbols))
+	c.Logf("market.GetExchInfo, rateLimits len %v, Assets len %v, Symbols len %v\n", len(ei.RateLimits), len(ei.Assets), len(ei.Symbols))
+	if c.Limiter != nil && len(ei.RateLimits) > 0 {
+		c.Limiter.SetLimits(ei.RateLimits)
+	}
 
 	return &ei, nil
 }
 
 // Query symbol orderbook
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Order-Book
-func OrderBook(symbol string, limit int) (*orderBook, error) {
+func (c *Client) OrderBook(ctx context.Context, symbol string, limit int) (*orderBook, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/depth", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/depth", params)
 	if err != nil {
 		return nil, err
 	}
@@ -79,14 +91,14 @@ func OrderBook(symbol string, limit int) (*orderBook, error) {
 // Get recent market trades filled in the order book. Only market trades will be returned,
 // which means the insurance fund trades and ADL trades won't be returned.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Recent-Trades-List
-func RecentMarketTrades(symbol string, limit int) ([]marketTrade, error) {
+func (c *Client) RecentMarketTrades(ctx context.Context, symbol string, limit int) ([]marketTrade, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/trades", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/trades", params)
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +112,7 @@ func RecentMarketTrades(symbol string, limit int) ([]marketTrade, error) {
 
 // Get older market historical trades.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Old-Trades-Lookup
-func HistoricalTrades(symbol string, fromId, limit int) ([]marketTrade, error) {
+func (c *Client) HistoricalTrades(ctx context.Context, symbol string, fromId, limit int) ([]marketTrade, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
@@ -110,7 +122,7 @@ func HistoricalTrades(symbol string, fromId, limit int) ([]marketTrade, error) {
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/historicalTrades", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/historicalTrades", params)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +137,7 @@ func HistoricalTrades(symbol string, fromId, limit int) ([]marketTrade, error) {
 // Get compressed, aggregate market trades. Market trades that fill in 100ms with the same price
 // and the same taking side will have the quantity aggregated.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Compressed-Aggregate-Trades-List
-func AggregatedTrades(symbol string, fromId, startTime, endTime, limit int) ([]aggTrade, error) {
+func (c *Client) AggregatedTrades(ctx context.Context, symbol string, fromId, startTime, endTime, limit int) ([]aggTrade, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
@@ -141,7 +153,7 @@ func AggregatedTrades(symbol string, fromId, startTime, endTime, limit int) ([]a
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/aggTrades", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/aggTrades", params)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +187,7 @@ func sliceToKdata(arr [][]interface{}) []kData {
 
 // Kline/candlestick bars for a symbol. Klines are uniquely identified by their open time.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Kline-Candlestick-Data
-func Klines(symbol string, interval pub.KlineInterval, startTime, endTime, limit int64) ([]kData, error) {
+func (c *Client) Klines(ctx context.Context, symbol string, interval pub.KlineInterval, startTime, endTime, limit int64) ([]kData, error) {
 	params := map[string]interface{}{
 		"symbol":   symbol,
 		"interval": interval,
@@ -189,7 +201,7 @@ func Klines(symbol string, interval pub.KlineInterval, startTime, endTime, limit
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/klines", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/klines", params)
 	if err != nil {
 		return nil, err
 	}
@@ -208,8 +220,7 @@ func Klines(symbol string, interval pub.KlineInterval, startTime, endTime, limit
 
 // Kline/candlestick bars for a specific contract type. Klines are uniquely identified by their open time.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Continuous-Contract-Kline-Candlestick-Data
-func ContinuousKlines(pair string, contractType pub.ContractType, interval pub.KlineInterval,
-	startTime, endTime, limit int) ([]kData, error) {
+func (c *Client) ContinuousKlines(ctx context.Context, pair string, contractType pub.ContractType, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
 	params := map[string]interface{}{
 		"pair":         pair,
 		"contractType": contractType,
@@ -224,7 +235,7 @@ func ContinuousKlines(pair string, contractType pub.ContractType, interval pub.K
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/continuousKlines", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/continuousKlines", params)
 	if err != nil {
 		return nil, err
 	}
@@ -243,8 +254,7 @@ func ContinuousKlines(pair string, contractType pub.ContractType, interval pub.K
 
 // Kline/candlestick bars for the index price of a pair. Klines are uniquely identified by their open time.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Index-Price-Kline-Candlestick-Data
-func IndexPriceKlines(pair string, contractType pub.ContractType, interval pub.KlineInterval,
-	startTime, endTime, limit int) ([]kData, error) {
+func (c *Client) IndexPriceKlines(ctx context.Context, pair string, contractType pub.ContractType, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
 	params := map[string]interface{}{
 		"pair":         pair,
 		"contractType": contractType,
@@ -259,7 +269,7 @@ func IndexPriceKlines(pair string, contractType pub.ContractType, interval pub.K
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/indexPriceKlines", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/indexPriceKlines", params)
 	if err != nil {
 		return nil, err
 	}
@@ -278,7 +288,7 @@ func IndexPriceKlines(pair string, contractType pub.ContractType, interval pub.K
 
 // Kline/candlestick bars for the mark price of a symbol. Klines are uniquely identified by their open time.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Mark-Price-Kline-Candlestick-Data
-func MarkPriceKlines(symbol string, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
+func (c *Client) MarkPriceKlines(ctx context.Context, symbol string, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
 	params := map[string]interface{}{
 		"symbol":   symbol,
 		"interval": interval,
@@ -292,7 +302,7 @@ func MarkPriceKlines(symbol string, interval pub.KlineInterval, startTime, endTi
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/markPriceKlines", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/markPriceKlines", params)
 	if err != nil {
 		return nil, err
 	}
@@ -311,7 +321,7 @@ func MarkPriceKlines(symbol string, interval pub.KlineInterval, startTime, endTi
 
 // Premium index kline bars of a symbol. Klines are uniquely identified by their open time.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Premium-Index-Kline-Data
-func PremiumIndexKlines(symbol string, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
+func (c *Client) PremiumIndexKlines(ctx context.Context, symbol string, interval pub.KlineInterval, startTime, endTime, limit int) ([]kData, error) {
 	params := map[string]interface{}{
 		"symbol":   symbol,
 		"interval": interval,
@@ -325,7 +335,7 @@ func PremiumIndexKlines(symbol string, interval pub.KlineInterval, startTime, en
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/premiumIndexKlines", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/premiumIndexKlines", params)
 	if err != nil {
 		return nil, err
 	}
@@ -344,12 +354,12 @@ func PremiumIndexKlines(symbol string, interval pub.KlineInterval, startTime, en
 
 // Mark Price and Funding Rate
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Mark-Price
-func MarkPrice(symbol string) ([]markPrice, error) {
+func (c *Client) MarkPrice(ctx context.Context, symbol string) ([]markPrice, error) {
 	params := make(map[string]interface{})
 	if symbol != "" {
 		params["symbol"] = symbol
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/premiumIndex", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/premiumIndex", params)
 	if err != nil {
 		return nil, err
 	}
@@ -373,7 +383,7 @@ func MarkPrice(symbol string) ([]markPrice, error) {
 
 // Get Funding Rate History
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Get-Funding-Rate-History
-func FundingRateHistory(symbol string, startTime, endTime, limit int) ([]fundingRate, error) {
+func (c *Client) FundingRateHistory(ctx context.Context, symbol string, startTime, endTime, limit int) ([]fundingRate, error) {
 	params := make(map[string]interface{})
 	if symbol != "" {
 		params["symbol"] = symbol
@@ -387,7 +397,7 @@ func FundingRateHistory(symbol string, startTime, endTime, limit int) ([]funding
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/fundingRate", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/fundingRate", params)
 	if err != nil {
 		return nil, err
 	}
@@ -402,8 +412,8 @@ func FundingRateHistory(symbol string, startTime, endTime, limit int) ([]funding
 
 // Query funding rate info for symbols that had FundingRateCap/ FundingRateFloor / fundingIntervalHours adjustment
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Get-Funding-Rate-Info
-func FundingInfo() ([]fundingInfo, error) {
-	resBody, err := pub.GetNoSign("/fapi/v1/fundingInfo", nil)
+func (c *Client) FundingInfo(ctx context.Context) ([]fundingInfo, error) {
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/fundingInfo", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -419,12 +429,12 @@ func FundingInfo() ([]fundingInfo, error) {
 // 24 hour rolling window price change statistics.
 // Careful when accessing this with no symbol.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/24hr-Ticker-Price-Change-Statistics
-func TickerPriceStatistics24hr(symbol string) ([]ticker24hr, error) {
+func (c *Client) TickerPriceStatistics24hr(ctx context.Context, symbol string) ([]ticker24hr, error) {
 	params := make(map[string]interface{})
 	if symbol != "" {
 		params["symbol"] = symbol
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/ticker/24hr", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/ticker/24hr", params)
 	if err != nil {
 		return nil, err
 	}
@@ -449,12 +459,12 @@ func TickerPriceStatistics24hr(symbol string) ([]ticker24hr, error) {
 // Latest price for a symbol or symbols.
 // version: v1, v2
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Symbol-Price-Ticker
-func TickerPrice(symbol string, version string) ([]tickerPrice, error) {
+func (c *Client) TickerPrice(ctx context.Context, symbol string, version string) ([]tickerPrice, error) {
 	params := make(map[string]interface{})
 	if symbol != "" {
 		params["symbol"] = symbol
 	}
-	resBody, err := pub.GetNoSign("/fapi/"+version+"/ticker/price", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/"+version+"/ticker/price", params)
 	if err != nil {
 		return nil, err
 	}
@@ -478,12 +488,12 @@ func TickerPrice(symbol string, version string) ([]tickerPrice, error) {
 
 // Best price/qty on the order book for a symbol or symbols.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Symbol-Order-Book-Ticker
-func BookTicker(symbol string) ([]bookTicker, error) {
+func (c *Client) BookTicker(ctx context.Context, symbol string) ([]bookTicker, error) {
 	params := make(map[string]interface{})
 	if symbol != "" {
 		params["symbol"] = symbol
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/ticker/bookTicker", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/ticker/bookTicker", params)
 	if err != nil {
 		return nil, err
 	}
@@ -505,11 +515,11 @@ func BookTicker(symbol string) ([]bookTicker, error) {
 	}
 }
 
-func DeliveryPrice(pair string) ([]deliveryPrice, error) {
+func (c *Client) DeliveryPrice(ctx context.Context, pair string) ([]deliveryPrice, error) {
 	params := map[string]interface{}{
 		"pair": pair,
 	}
-	resBody, err := pub.GetNoSign("/futures/data/delivery-price", params)
+	resBody, err := c.GetNoSign(ctx, "/futures/data/delivery-price", params)
 	if err != nil {
 		return nil, err
 	}
@@ -524,11 +534,11 @@ func DeliveryPrice(pair string) ([]deliveryPrice, error) {
 
 // Get present open interest of a specific symbol.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Open-Interest
-func OpenInterest(symbol string) (*openInterest, error) {
+func (c *Client) OpenInterest(ctx context.Context, symbol string) (*openInterest, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/openInterest", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/openInterest", params)
 	if err != nil {
 		return nil, err
 	}
@@ -543,7 +553,7 @@ func OpenInterest(symbol string) (*openInterest, error) {
 
 // Open Interest Statistics
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Open-Interest-Statistics
-func OpenInterestHist(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]openInterestHist, error) {
+func (c *Client) OpenInterestHist(ctx context.Context, symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]openInterestHist, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 		"period": string(period),
@@ -557,7 +567,7 @@ func OpenInterestHist(symbol string, period pub.KlineInterval, startTime, endTim
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/futures/data/openInterestHist", params)
+	resBody, err := c.GetNoSign(ctx, "/futures/data/openInterestHist", params)
 	if err != nil {
 		return nil, err
 	}
@@ -575,7 +585,7 @@ func OpenInterestHist(symbol string, period pub.KlineInterval, startTime, endTim
 // Short Position % = Short positions of top traders / Total open positions of top traders
 // Long/Short Ratio (Positions) = Long Position % / Short Position %
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Top-Trader-Long-Short-Ratio
-func TopLongShortPositionRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
+func (c *Client) TopLongShortPositionRatio(ctx context.Context, symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 		"period": string(period),
@@ -589,7 +599,7 @@ func TopLongShortPositionRatio(symbol string, period pub.KlineInterval, startTim
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/futures/data/topLongShortPositionRatio", params)
+	resBody, err := c.GetNoSign(ctx, "/futures/data/topLongShortPositionRatio", params)
 	if err != nil {
 		return nil, err
 	}
@@ -607,7 +617,7 @@ func TopLongShortPositionRatio(symbol string, period pub.KlineInterval, startTim
 // Short Account % = Accounts of top traders with net short positions / Total accounts of top traders with open positions
 // Long/Short Ratio (Accounts) = Long Account % / Short Account %
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Top-Long-Short-Account-Ratio
-func TopLongShortAccountRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
+func (c *Client) TopLongShortAccountRatio(ctx context.Context, symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 		"period": string(period),
@@ -621,7 +631,7 @@ func TopLongShortAccountRatio(symbol string, period pub.KlineInterval, startTime
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/futures/data/topLongShortAccountRatio", params)
+	resBody, err := c.GetNoSign(ctx, "/futures/data/topLongShortAccountRatio", params)
 	if err != nil {
 		return nil, err
 	}
@@ -636,7 +646,7 @@ func TopLongShortAccountRatio(symbol string, period pub.KlineInterval, startTime
 
 // Query symbol Long/Short Ratio
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Long-Short-Ratio
-func GlobalLongShortAccountRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
+func (c *Client) GlobalLongShortAccountRatio(ctx context.Context, symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]longShortRatio, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 		"period": string(period),
@@ -650,7 +660,7 @@ func GlobalLongShortAccountRatio(symbol string, period pub.KlineInterval, startT
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/futures/data/globalLongShortAccountRatio", params)
+	resBody, err := c.GetNoSign(ctx, "/futures/data/globalLongShortAccountRatio", params)
 	if err != nil {
 		return nil, err
 	}
@@ -665,7 +675,7 @@ func GlobalLongShortAccountRatio(symbol string, period pub.KlineInterval, startT
 
 // Taker Buy/Sell Volume
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Taker-BuySell-Volume
-func TakerLongShortRatio(symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]takerLongShortRatio, error) {
+func (c *Client) TakerLongShortRatio(ctx context.Context, symbol string, period pub.KlineInterval, startTime, endTime, limit int) ([]takerLongShortRatio, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 		"period": string(period),
@@ -679,7 +689,7 @@ func TakerLongShortRatio(symbol string, period pub.KlineInterval, startTime, end
 	if limit > 0 {
 		params["limit"] = limit
 	}
-	resBody, err := pub.GetNoSign("/futures/data/takerlongshortRatio", params)
+	resBody, err := c.GetNoSign(ctx, "/futures/data/takerlongshortRatio", params)
 	if err != nil {
 		return nil, err
 	}
@@ -728,14 +738,14 @@ func TakerLongShortRatio(symbol string, period pub.KlineInterval, startTime, end
 
 // Query composite index symbol information
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Composite-Index-Symbol-Information
-func CompositeIndexInfo(symbol string) ([]indexInfo, error) {
+func (c *Client) CompositeIndexInfo(ctx context.Context, symbol string) ([]indexInfo, error) {
 	params := make(map[string]interface{})
 	if symbol != "" {
 		params["symbol"] = symbol
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/indexInfo", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/indexInfo", params)
 	if err != nil {
-		log.Println(err)
+		c.Logf("CompositeIndexInfo err: %v", err)
 		return nil, err
 	}
 	var arr []indexInfo
@@ -748,12 +758,12 @@ func CompositeIndexInfo(symbol string) ([]indexInfo, error) {
 
 // asset index for Multi-Assets mode
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Multi-Assets-Mode-Asset-Index
-func AssetIndex(symbol string) ([]assetIndex, error) {
+func (c *Client) AssetIndex(ctx context.Context, symbol string) ([]assetIndex, error) {
 	params := make(map[string]interface{})
 	if symbol != "" {
 		params["symbol"] = symbol
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/assetIndex", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/assetIndex", params)
 	if err != nil {
 		return nil, err
 	}
@@ -776,11 +786,11 @@ func AssetIndex(symbol string) ([]assetIndex, error) {
 
 // Query index price constituents
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/market-data/rest-api/Index-Constituents
-func IndexConstituents(symbol string) (*indexConstituents, error) {
+func (c *Client) IndexConstituents(ctx context.Context, symbol string) (*indexConstituents, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
-	resBody, err := pub.GetNoSign("/fapi/v1/constituents", params)
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/constituents", params)
 	if err != nil {
 		return nil, err
 	}
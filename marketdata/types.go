@@ -1,34 +1,32 @@
 package marketdata
 
-type rateLimit struct { // API访问的限制
-	Interval      string `json:"interval"`      // "MINUTE" 按照分钟计算
-	IntervalNum   int    `json:"intervalNum"`   // 1 按照1分钟计算
-	Limit         int    `json:"limit"`         // 2400 上限次数
-	RateLimitType string `json:"rateLimitType"` // "REQUEST_WEIGHT"按照访问权重来计算 "ORDERS" 按照订单数量来计算
-}
+import "github.com/billfort/binance-usdmfuture/pub"
 
-type asset struct { // 资产信息
+// Asset is the margin asset of ExchInfo.
+type Asset struct { // 资产信息
 	Asset             string `json:"asset"`             // "BUSD",
 	MarginAvailabel   bool   `json:"marginAvailable"`   // true 是否可用作保证金
 	AutoAssetExchange string `json:"autoAssetExchange"` // "0" 保证金资产自动兑换阈值
 }
 
-type filter struct {
-	FilterType        string `json:"filterType"`        // "PRICE_FILTER" 价格限制
-	MaxPrice          string `json:"maxPrice"`          // "300" 价格上限, 最大价格
-	MinPrice          string `json:"minPrice"`          // "0.0001" 价格下限, 最小价格
-	TickSize          string `json:"tickSize"`          // "0.0001" // 订单最小价格间隔
-	MaxQty            string `json:"maxQty"`            // "10000000" 数量上限, 最大数量
-	MinQty            string `json:"minQty"`            // "1" 数量下限, 最小数量
-	StepSize          string `json:"stepSize"`          // "1" // 订单最小数量间隔
-	Limit             int    `json:"limit"`             // 200
-	Notional          string `json:"notional"`          // "1",
-	MultiplierUp      string `json:"multiplierUp"`      // "1.1500" 价格上限百分比
-	MultiplierDown    string `json:"multiplierDown"`    // "0.8500" 价格下限百分比
-	MultiplierDecimal string `json:"multiplierDecimal"` // "4"
+// Filter is a trading rule of Symbol, the fields are set by FilterType.
+type Filter struct {
+	FilterType        pub.FilterType `json:"filterType"`        // "PRICE_FILTER" 价格限制
+	MaxPrice          string         `json:"maxPrice"`          // "300" 价格上限, 最大价格
+	MinPrice          string         `json:"minPrice"`          // "0.0001" 价格下限, 最小价格
+	TickSize          string         `json:"tickSize"`          // "0.0001" // 订单最小价格间隔
+	MaxQty            string         `json:"maxQty"`            // "10000000" 数量上限, 最大数量
+	MinQty            string         `json:"minQty"`            // "1" 数量下限, 最小数量
+	StepSize          string         `json:"stepSize"`          // "1" // 订单最小数量间隔
+	Limit             int            `json:"limit"`             // 200
+	Notional          string         `json:"notional"`          // "1",
+	MultiplierUp      string         `json:"multiplierUp"`      // "1.1500" 价格上限百分比
+	MultiplierDown    string         `json:"multiplierDown"`    // "0.8500" 价格下限百分比
+	MultiplierDecimal string         `json:"multiplierDecimal"` // "4"
 }
 
-type symbol struct { // 交易对信息
+// Symbol is the symbol information of ExchInfo.
+type Symbol struct { // 交易对信息
 	Symbol                string   `json:"symbol"`                // "BLZUSDT" 交易对
 	Pair                  string   `json:"pair"`                  // "BLZUSDT" 标的交易对
 	ContractType          string   `json:"contractType"`          // "PERPETUAL" 合约类型
@@ -48,8 +46,8 @@ type symbol struct { // 交易对信息
 	UnderlyingSubType     []string `json:"underlyingSubType"`     // ["STORAGE"],
 	SettlePlan            int      `json:"settlePlan"`            // 0,
 	TriggerProtect        string   `json:"triggerProtect"`        // "0.15" 开启"priceProtect"的条件订单的触发阈值
-	Filters               []filter `json:"filters"`
-	OrderType             []string `json:"OrderType"`       // 订单类型 "LIMIT",  "MARKET", "STOP", "STOP_MARKET", "TAKE_PROFIT", "TAKE_PROFIT_MARKET", "TRAILING_STOP_MARKET" // 跟踪止损市价单
+	Filters               []Filter `json:"filters"`
+	OrderType             []string `json:"orderTypes"`      // 订单类型 "LIMIT",  "MARKET", "STOP", "STOP_MARKET", "TAKE_PROFIT", "TAKE_PROFIT_MARKET", "TRAILING_STOP_MARKET" // 跟踪止损市价单
 	TimeInForce           []string `json:"timeInForce"`     // 有效方式 "GTC" 成交为止, 一直有效 "IOC" 无法立即成交(吃单)的部分就撤销 "FOK" 无法全部立即成交就撤销 "GTX" 无法成为挂单方就撤销
 	LiquidationFee        string   `json:"liquidationFee"`  // "0.010000", 强平费率
 	MarketTakeBound       string   `json:"marketTakeBound"` // "0.30", 市价吃单(相对于标记价格)允许可造成的最大价格偏离比例
@@ -57,11 +55,11 @@ type symbol struct { // 交易对信息
 
 type ExchInfo struct {
 	// "exchangeFilters": [],
-	RateLimits []rateLimit `json:"rateLimits"` // API访问的限制
-	ServerTime int64       `json:"serverTime"` // 1565613908500 请忽略。如果需要获取当前系统时间，请查询接口 “GET /fapi/v1/time”
-	Assets     []asset     `json:"assets"`
-	Symbols    []symbol    `json:"symbols"`  // 交易对信息
-	TimeZone   string      `json:"timezone"` // "UTC" // 服务器所用的时间区域
+	RateLimits []pub.RateLimit `json:"rateLimits"` // API访问的限制
+	ServerTime int64           `json:"serverTime"` // 1565613908500 请忽略。如果需要获取当前系统时间，请查询接口 “GET /fapi/v1/time”
+	Assets     []Asset         `json:"assets"`
+	Symbols    []Symbol        `json:"symbols"`  // 交易对信息
+	TimeZone   string          `json:"timezone"` // "UTC" // 服务器所用的时间区域
 }
 
 type orderBook struct {
@@ -237,3 +235,61 @@ type indexConstituents struct {
 	Time        int64         `json:"time"`         // 1697421272043,
 	Constiuents []constituent `json:"constituents"` //
 }
+
+// Decimal accessors of the string numbers, such as PriceDec() for Price.
+
+func (f *Filter) MaxPriceDec() pub.Decimal       { return pub.D(f.MaxPrice) }
+func (f *Filter) MinPriceDec() pub.Decimal       { return pub.D(f.MinPrice) }
+func (f *Filter) TickSizeDec() pub.Decimal       { return pub.D(f.TickSize) }
+func (f *Filter) MaxQtyDec() pub.Decimal         { return pub.D(f.MaxQty) }
+func (f *Filter) MinQtyDec() pub.Decimal         { return pub.D(f.MinQty) }
+func (f *Filter) StepSizeDec() pub.Decimal       { return pub.D(f.StepSize) }
+func (f *Filter) NotionalDec() pub.Decimal       { return pub.D(f.Notional) }
+func (f *Filter) MultiplierUpDec() pub.Decimal   { return pub.D(f.MultiplierUp) }
+func (f *Filter) MultiplierDownDec() pub.Decimal { return pub.D(f.MultiplierDown) }
+
+func (t *marketTrade) PriceDec() pub.Decimal    { return pub.D(t.Price) }
+func (t *marketTrade) QtyDec() pub.Decimal      { return pub.D(t.Qty) }
+func (t *marketTrade) QuoteQtyDec() pub.Decimal { return pub.D(t.QuoteQty) }
+
+func (t *aggTrade) PriceDec() pub.Decimal { return pub.D(t.Price) }
+func (t *aggTrade) QtyDec() pub.Decimal   { return pub.D(t.Qty) }
+
+func (k *kData) OpenDec() pub.Decimal             { return pub.D(k.Open) }
+func (k *kData) HighDec() pub.Decimal             { return pub.D(k.High) }
+func (k *kData) LowDec() pub.Decimal              { return pub.D(k.Low) }
+func (k *kData) CloseDec() pub.Decimal            { return pub.D(k.Close) }
+func (k *kData) VolumeDec() pub.Decimal           { return pub.D(k.Volume) }
+func (k *kData) QuoteAssetVolumeDec() pub.Decimal { return pub.D(k.QuoteAssetVolume) }
+
+func (m *markPrice) MarkPriceDec() pub.Decimal            { return pub.D(m.MarkPrice) }
+func (m *markPrice) IndexPriceDec() pub.Decimal           { return pub.D(m.IndexPrice) }
+func (m *markPrice) EstimatedSettlePriceDec() pub.Decimal { return pub.D(m.EstimatedSettlePrice) }
+func (m *markPrice) LastFundingRateDec() pub.Decimal      { return pub.D(m.LastFundingRate) }
+
+func (f *fundingRate) FundingRateDec() pub.Decimal { return pub.D(f.FundingRate) }
+func (f *fundingRate) MarkPriceDec() pub.Decimal   { return pub.D(f.MarkPrice) }
+
+func (t *ticker24hr) PriceChangeDec() pub.Decimal { return pub.D(t.PriceChange) }
+func (t *ticker24hr) LastPriceDec() pub.Decimal   { return pub.D(t.LastPrice) }
+func (t *ticker24hr) LastQtyDec() pub.Decimal     { return pub.D(t.LastQty) }
+func (t *ticker24hr) OpenPriceDec() pub.Decimal   { return pub.D(t.OpenPrice) }
+func (t *ticker24hr) HighPriceDec() pub.Decimal   { return pub.D(t.HighPrice) }
+func (t *ticker24hr) LowPriceDec() pub.Decimal    { return pub.D(t.LowPrice) }
+func (t *ticker24hr) VolumeDec() pub.Decimal      { return pub.D(t.Volume) }
+func (t *ticker24hr) QuoteVolumeDec() pub.Decimal { return pub.D(t.QuoteVolume) }
+
+func (t *tickerPrice) PriceDec() pub.Decimal { return pub.D(t.Price) }
+
+func (t *bookTicker) BidPriceDec() pub.Decimal { return pub.D(t.BidPrice) }
+func (t *bookTicker) BidQtyDec() pub.Decimal   { return pub.D(t.BidQty) }
+func (t *bookTicker) AskPriceDec() pub.Decimal { return pub.D(t.AskPrice) }
+func (t *bookTicker) AskQtyDec() pub.Decimal   { return pub.D(t.AskQty) }
+
+func (o *openInterest) OpenInterestDec() pub.Decimal { return pub.D(o.OpenInterest) }
+
+// BidLevels parses the bids to decimal price levels.
+func (o *orderBook) BidLevels() ([]pub.PriceLevel, error) { return pub.ParsePriceLevels(o.Bids) }
+
+// AskLevels parses the asks to decimal price levels.
+func (o *orderBook) AskLevels() ([]pub.PriceLevel, error) { return pub.ParsePriceLevels(o.Asks) }
@@ -0,0 +1,297 @@
+// Package orderbook maintains local order books from the diff depth stream and the REST snapshot,
+// by the procedure of binance:
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/websocket-market-streams/How-to-manage-a-local-order-book-correctly
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+)
+
+const (
+	maxBuffered = 10000 // diff events buffered before the snapshot, the oldest ones are dropped
+	vwapScale   = 12    // decimal places of VWAP
+)
+
+var (
+	ErrGap           = errors.New("orderbook: gap in depth updates, resync needed")
+	ErrNotSynced     = errors.New("orderbook: not synced")
+	ErrNotEnoughSize = errors.New("orderbook: not enough size in the book")
+)
+
+// Snapshot is the REST order book of /fapi/v1/depth.
+type Snapshot struct {
+	LastUpdateId int64
+	EventTime    int64
+	Bids         [][]string // [][price, qty]
+	Asks         [][]string // [][price, qty]
+}
+
+// Book is the local order book of a symbol. The diff events are buffered until the snapshot is applied,
+// then they are applied in order, a gap of the update ids makes the book not synced until the next snapshot.
+// It is safe for concurrent use.
+type Book struct {
+	symbol string
+
+	mu           sync.RWMutex
+	synced       bool
+	first        bool // the next event is the first one after the snapshot
+	lastUpdateId int64
+	eventTime    int64
+	bids         []pub.PriceLevel // price descending
+	asks         []pub.PriceLevel // price ascending
+	buffer       []*streammarket.DepthUpdate
+}
+
+func NewBook(symbol string) *Book {
+	return &Book{symbol: symbol}
+}
+
+func (b *Book) Symbol() string {
+	return b.symbol
+}
+
+// Synced reports whether the book is synced with the snapshot and the following events.
+func (b *Book) Synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.synced
+}
+
+// LastUpdateId returns the update id of the last applied snapshot or event.
+func (b *Book) LastUpdateId() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lastUpdateId
+}
+
+// EventTime returns the event time of the last applied event, milliseconds.
+func (b *Book) EventTime() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.eventTime
+}
+
+// Reset clears the book, it is not synced until the next snapshot.
+func (b *Book) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset()
+}
+
+func (b *Book) reset() {
+	b.synced, b.first = false, false
+	b.lastUpdateId, b.eventTime = 0, 0
+	b.bids, b.asks = nil, nil
+	b.buffer = nil
+}
+
+// ApplySnapshot sets the book to the snapshot, and applies the buffered events after it.
+// It returns ErrGap if the buffered events are not continuous with the snapshot, a newer snapshot is needed then.
+func (b *Book) ApplySnapshot(s *Snapshot) error {
+	bids, err := pub.ParsePriceLevels(s.Bids)
+	if err != nil {
+		return err
+	}
+	asks, err := pub.ParsePriceLevels(s.Asks)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	buffer := b.buffer
+	b.buffer = nil
+	b.bids, b.asks = nil, nil
+	for _, l := range bids {
+		b.bids = setLevel(b.bids, l, true)
+	}
+	for _, l := range asks {
+		b.asks = setLevel(b.asks, l, false)
+	}
+	b.lastUpdateId, b.eventTime = s.LastUpdateId, s.EventTime
+	b.synced, b.first = true, true
+
+	for i, u := range buffer {
+		if err := b.apply(u); err != nil {
+			b.reset()
+			if errors.Is(err, ErrGap) {
+				b.buffer = buffer[i:] // keep the events for the next snapshot
+			} else {
+				b.buffer = buffer[i+1:]
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyUpdate applies the diff event, or buffers it if the snapshot is not applied yet.
+// It returns ErrGap if the event is not continuous with the previous one, then the book is reset,
+// the event is buffered, and a new snapshot is needed. The book is reset for the other errors too.
+func (b *Book) ApplyUpdate(u *streammarket.DepthUpdate) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.synced {
+		b.buffer = append(b.buffer, u)
+		if len(b.buffer) > maxBuffered {
+			b.buffer = b.buffer[len(b.buffer)-maxBuffered:]
+		}
+		return nil
+	}
+	if err := b.apply(u); err != nil {
+		b.reset()
+		if errors.Is(err, ErrGap) {
+			b.buffer = append(b.buffer, u)
+		}
+		return err
+	}
+	return nil
+}
+
+// apply applies the event to the synced book, it is locked by the caller.
+func (b *Book) apply(u *streammarket.DepthUpdate) error {
+	if u.LastID < b.lastUpdateId { // older than the snapshot
+		return nil
+	}
+	if b.first { // the first event should have U <= lastUpdateId AND u >= lastUpdateId
+		if u.FirstID > b.lastUpdateId {
+			return fmt.Errorf("%w: %v first event U %v > snapshot lastUpdateId %v", ErrGap, b.symbol, u.FirstID, b.lastUpdateId)
+		}
+	} else if u.PrevLast != b.lastUpdateId { // pu should be the u of the previous event
+		return fmt.Errorf("%w: %v event pu %v != previous u %v", ErrGap, b.symbol, u.PrevLast, b.lastUpdateId)
+	}
+
+	bids, err := pub.ParsePriceLevels(u.Bids)
+	if err != nil {
+		return err
+	}
+	asks, err := pub.ParsePriceLevels(u.Asks)
+	if err != nil {
+		return err
+	}
+	for _, l := range bids {
+		b.bids = setLevel(b.bids, l, true)
+	}
+	for _, l := range asks {
+		b.asks = setLevel(b.asks, l, false)
+	}
+	b.first = false
+	b.lastUpdateId, b.eventTime = u.LastID, u.EventTime
+	return nil
+}
+
+// setLevel sets the quantity of the price level, removes it if the quantity is 0.
+func setLevel(levels []pub.PriceLevel, l pub.PriceLevel, desc bool) []pub.PriceLevel {
+	i := sort.Search(len(levels), func(i int) bool {
+		if desc {
+			return levels[i].Price.LessOrEqual(l.Price)
+		}
+		return levels[i].Price.GreaterOrEqual(l.Price)
+	})
+	found := i < len(levels) && levels[i].Price.Equal(l.Price)
+	switch {
+	case l.Qty.IsZero():
+		if found {
+			levels = append(levels[:i], levels[i+1:]...)
+		}
+	case found:
+		levels[i].Qty = l.Qty
+	default:
+		levels = append(levels, pub.PriceLevel{})
+		copy(levels[i+1:], levels[i:])
+		levels[i] = l
+	}
+	return levels
+}
+
+// BestBid returns the highest bid, false if there is no bid.
+func (b *Book) BestBid() (pub.PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.bids) == 0 {
+		return pub.PriceLevel{}, false
+	}
+	return b.bids[0], true
+}
+
+// BestAsk returns the lowest ask, false if there is no ask.
+func (b *Book) BestAsk() (pub.PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.asks) == 0 {
+		return pub.PriceLevel{}, false
+	}
+	return b.asks[0], true
+}
+
+// Bids returns the best n bids, all bids if n <= 0.
+func (b *Book) Bids(n int) []pub.PriceLevel {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return top(b.bids, n)
+}
+
+// Asks returns the best n asks, all asks if n <= 0.
+func (b *Book) Asks(n int) []pub.PriceLevel {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return top(b.asks, n)
+}
+
+func top(levels []pub.PriceLevel, n int) []pub.PriceLevel {
+	if n <= 0 || n > len(levels) {
+		n = len(levels)
+	}
+	return append([]pub.PriceLevel(nil), levels[:n]...)
+}
+
+// QtyWithin returns the total quantity of the levels at the price or better,
+// the bids at price or higher for OS_Sell, the asks at price or lower for OS_Buy.
+func (b *Book) QtyWithin(side pub.OrderSide, price pub.Decimal) pub.Decimal {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	total := pub.Decimal{}
+	for _, l := range b.levelsTaken(side) {
+		if (side == pub.OS_Buy && l.Price.GreaterThan(price)) || (side != pub.OS_Buy && l.Price.LessThan(price)) {
+			break
+		}
+		total = total.Add(l.Qty)
+	}
+	return total
+}
+
+// VWAP returns the volume weighted average price to fill the quantity by a market order of the side,
+// OS_Buy takes the asks and OS_Sell takes the bids. It returns ErrNotEnoughSize if the book has less quantity.
+func (b *Book) VWAP(side pub.OrderSide, qty pub.Decimal) (pub.Decimal, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.synced {
+		return pub.Decimal{}, ErrNotSynced
+	}
+	if !qty.IsPositive() {
+		return pub.Decimal{}, fmt.Errorf("orderbook: invalid quantity %v", qty)
+	}
+	left, notional := qty, pub.Decimal{}
+	for _, l := range b.levelsTaken(side) {
+		fill := l.Qty.Min(left)
+		notional = notional.Add(fill.Mul(l.Price))
+		left = left.Sub(fill)
+		if left.IsZero() {
+			return notional.Div(qty, vwapScale), nil
+		}
+	}
+	return pub.Decimal{}, fmt.Errorf("%w: %v %v of %v", ErrNotEnoughSize, side, qty, b.symbol)
+}
+
+func (b *Book) levelsTaken(side pub.OrderSide) []pub.PriceLevel {
+	if side == pub.OS_Buy {
+		return b.asks
+	}
+	return b.bids
+}
@@ -0,0 +1,249 @@
+package orderbook
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/marketdata"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+)
+
+const (
+	defaultLimit = 1000 // levels of the snapshot
+	defaultSpeed = 100 * time.Millisecond
+)
+
+// ChangeType is the type of Change.
+type ChangeType int
+
+const (
+	BC_Snapshot ChangeType = iota // the snapshot is applied, the book is synced
+	BC_Update                     // a diff event is applied
+	BC_Resync                     // a gap is found, the book is reset until the next snapshot
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case BC_Snapshot:
+		return "Snapshot"
+	case BC_Update:
+		return "Update"
+	case BC_Resync:
+		return "Resync"
+	}
+	return "Unknown"
+}
+
+// Change notifies the change of a book.
+type Change struct {
+	Symbol   string
+	Type     ChangeType
+	UpdateId int64 // last update id of the book
+	Err      error // reason of BC_Resync
+}
+
+// Manager maintains the books of the symbols by the diff depth streams of a streammarket.SubscriptionManager
+// and the REST snapshots. The book of a symbol is resynced by a new snapshot after a gap of the events.
+type Manager struct {
+	Limit    int           // levels of the snapshot, default 1000
+	Speed    time.Duration // update speed of the diff depth stream, 100ms, 250ms or 500ms, default 100ms
+	Snapshot func(ctx context.Context, symbol string, limit int) (*Snapshot, error)
+
+	client  *pub.Client
+	ctx     context.Context
+	subs    *streammarket.SubscriptionManager
+	backoff *pub.RetryPolicy
+	changes chan Change
+
+	mu      sync.Mutex
+	books   map[string]*Book
+	syncing map[string]bool
+	closed  bool
+}
+
+// NewManager returns a manager of the books, the streams are closed after ctx is done, then Changes() is closed.
+func NewManager(ctx context.Context, c *pub.Client) *Manager {
+	m := &Manager{
+		Limit:   defaultLimit,
+		Speed:   defaultSpeed,
+		client:  c,
+		ctx:     ctx,
+		subs:    streammarket.NewClient(c).NewSubscriptionManager(ctx),
+		backoff: pub.NewRetryPolicy(),
+		changes: make(chan Change, pub.WsChanLen),
+		books:   map[string]*Book{},
+		syncing: map[string]bool{},
+	}
+	m.Snapshot = m.restSnapshot
+	go m.watch()
+	return m
+}
+
+// Changes returns the channel of the changes of the books. The changes are dropped if the channel is full,
+// the books always have the latest state.
+func (m *Manager) Changes() <-chan Change {
+	return m.changes
+}
+
+// Add subscribes the diff depth stream of the symbol and syncs its book, the book is returned at once,
+// it is synced after the snapshot is applied.
+func (m *Manager) Add(ctx context.Context, symbol string) (*Book, error) {
+	symbol = strings.ToUpper(symbol)
+	m.mu.Lock()
+	if b := m.books[symbol]; b != nil {
+		m.mu.Unlock()
+		return b, nil
+	}
+	b := NewBook(symbol)
+	m.books[symbol] = b
+	m.mu.Unlock()
+
+	stream := streammarket.DepthStream(symbol, 0, m.Speed)
+	err := streammarket.Handle(ctx, m.subs, stream, func(u streammarket.DepthUpdate) {
+		m.onUpdate(b, &u)
+	})
+	if err != nil {
+		m.mu.Lock()
+		delete(m.books, symbol)
+		m.mu.Unlock()
+		return nil, err
+	}
+	m.resync(b)
+	return b, nil
+}
+
+// Remove unsubscribes the diff depth stream of the symbol and drops its book.
+func (m *Manager) Remove(ctx context.Context, symbol string) error {
+	symbol = strings.ToUpper(symbol)
+	m.mu.Lock()
+	delete(m.books, symbol)
+	m.mu.Unlock()
+	return m.subs.Unsubscribe(ctx, streammarket.DepthStream(symbol, 0, m.Speed).Name())
+}
+
+// Book returns the book of the symbol, nil if it is not added.
+func (m *Manager) Book(symbol string) *Book {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.books[strings.ToUpper(symbol)]
+}
+
+// Symbols returns the symbols of the books.
+func (m *Manager) Symbols() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	symbols := make([]string, 0, len(m.books))
+	for s := range m.books {
+		symbols = append(symbols, s)
+	}
+	return symbols
+}
+
+func (m *Manager) onUpdate(b *Book, u *streammarket.DepthUpdate) {
+	if err := b.ApplyUpdate(u); err != nil {
+		m.client.Logf("orderbook %v resync: %v", b.Symbol(), err)
+		m.notify(Change{Symbol: b.Symbol(), Type: BC_Resync, Err: err})
+		m.resync(b)
+		return
+	}
+	if b.Synced() {
+		m.notify(Change{Symbol: b.Symbol(), Type: BC_Update, UpdateId: b.LastUpdateId()})
+	}
+}
+
+// resync gets the snapshot and applies it until the book is synced, one goroutine for each book.
+func (m *Manager) resync(b *Book) {
+	symbol := b.Symbol()
+	m.mu.Lock()
+	if m.syncing[symbol] {
+		m.mu.Unlock()
+		return
+	}
+	m.syncing[symbol] = true
+	m.mu.Unlock()
+
+	go func() {
+		for attempt := 0; ; attempt++ {
+			m.mu.Lock()
+			if b.Synced() || m.books[symbol] != b || m.ctx.Err() != nil { // checked under m.mu, see onUpdate
+				delete(m.syncing, symbol)
+				m.mu.Unlock()
+				if b.Synced() {
+					m.notify(Change{Symbol: symbol, Type: BC_Snapshot, UpdateId: b.LastUpdateId()})
+				}
+				return
+			}
+			m.mu.Unlock()
+
+			if attempt > 0 {
+				if err := m.backoff.Wait(m.ctx, attempt-1); err != nil {
+					continue
+				}
+			}
+			s, err := m.Snapshot(m.ctx, symbol, m.Limit)
+			if err == nil {
+				err = b.ApplySnapshot(s)
+			}
+			if err != nil {
+				m.client.Logf("orderbook %v snapshot: %v", symbol, err)
+			}
+		}
+	}()
+}
+
+// watch resyncs the books after the gap of their connection, and closes Changes() after the streams are closed.
+func (m *Manager) watch() {
+	for d := range m.subs.Data() {
+		if e, ok := d.(pub.WsEvent); ok && e.Type == pub.WE_Gap {
+			m.onGap(e)
+		}
+	}
+	m.mu.Lock()
+	m.closed = true
+	close(m.changes)
+	m.mu.Unlock()
+}
+
+// onGap resets and resyncs the books of the streams of the gap, all books if the streams are unknown.
+func (m *Manager) onGap(e pub.WsEvent) {
+	streams := make(map[string]bool, len(e.Streams))
+	for _, s := range e.Streams {
+		streams[s] = true
+	}
+	m.mu.Lock()
+	books := make([]*Book, 0, len(m.books))
+	for symbol, b := range m.books {
+		if len(streams) == 0 || streams[streammarket.DepthStream(symbol, 0, m.Speed).Name()] {
+			books = append(books, b)
+		}
+	}
+	m.mu.Unlock()
+	for _, b := range books {
+		b.Reset()
+		m.notify(Change{Symbol: b.Symbol(), Type: BC_Resync, Err: ErrGap})
+		m.resync(b)
+	}
+}
+
+func (m *Manager) notify(c Change) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.changes <- c:
+	default:
+	}
+}
+
+func (m *Manager) restSnapshot(ctx context.Context, symbol string, limit int) (*Snapshot, error) {
+	ob, err := marketdata.NewClient(m.client).OrderBook(ctx, symbol, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{LastUpdateId: ob.LastUpdateId, EventTime: ob.E, Bids: ob.Bids, Asks: ob.Asks}, nil
+}
@@ -0,0 +1,252 @@
+package orderbook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// recorded messages of btcusdt@depth@100ms, the snapshot lastUpdateId is 110
+const recorded = `{"stream":"btcusdt@depth@100ms","data":{"e":"depthUpdate","E":1001,"T":1000,"s":"BTCUSDT","U":100,"u":105,"pu":99,"b":[["100.0","1"]],"a":[]}}
+{"stream":"btcusdt@depth@100ms","data":{"e":"depthUpdate","E":1002,"T":1001,"s":"BTCUSDT","U":106,"u":112,"pu":105,"b":[["100.0","2"],["99.5","3"]],"a":[["101.0","1.5"]]}}
+{"stream":"btcusdt@depth@100ms","data":{"e":"depthUpdate","E":1003,"T":1002,"s":"BTCUSDT","U":113,"u":115,"pu":112,"b":[["100.5","1"]],"a":[["101.0","0"],["101.5","2"]]}}
+{"stream":"btcusdt@depth@100ms","data":{"e":"depthUpdate","E":1004,"T":1003,"s":"BTCUSDT","U":116,"u":120,"pu":115,"b":[["99.0","4"]],"a":[["102.0","3"]]}}`
+
+// recorded messages after a gap, pu 122 is not the previous u 120
+const recordedGap = `{"stream":"btcusdt@depth@100ms","data":{"e":"depthUpdate","E":1005,"T":1004,"s":"BTCUSDT","U":125,"u":130,"pu":122,"b":[["100.0","0"],["99.0","2"]],"a":[]}}
+{"stream":"btcusdt@depth@100ms","data":{"e":"depthUpdate","E":1006,"T":1005,"s":"BTCUSDT","U":131,"u":133,"pu":130,"b":[],"a":[["101.0","0"],["100.8","1"]]}}`
+
+var (
+	snapshot110 = &Snapshot{LastUpdateId: 110, Bids: [][]string{{"100.0", "5"}, {"99.0", "1"}}, Asks: [][]string{{"101.0", "1"}, {"102.0", "1"}}}
+	snapshot118 = &Snapshot{LastUpdateId: 118, Bids: [][]string{{"100.0", "5"}}, Asks: [][]string{{"101.0", "1"}}}
+	snapshot127 = &Snapshot{LastUpdateId: 127, Bids: [][]string{{"100", "1"}}, Asks: [][]string{{"101", "1"}}}
+)
+
+func parseRecorded(t *testing.T, messages string) []*streammarket.DepthUpdate {
+	var updates []*streammarket.DepthUpdate
+	for _, line := range strings.Split(messages, "\n") {
+		var d struct {
+			Data streammarket.DepthUpdate `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &d))
+		updates = append(updates, &d.Data)
+	}
+	return updates
+}
+
+func levels(pls []pub.PriceLevel) [][]string {
+	var list [][]string
+	for _, l := range pls {
+		list = append(list, []string{l.Price.String(), l.Qty.String()})
+	}
+	return list
+}
+
+func requireSynced(t *testing.T, b *Book) {
+	require.True(t, b.Synced())
+	require.Equal(t, int64(120), b.LastUpdateId())
+	require.Equal(t, [][]string{{"100.5", "1"}, {"100", "2"}, {"99.5", "3"}, {"99", "4"}}, levels(b.Bids(0)))
+	require.Equal(t, [][]string{{"101.5", "2"}, {"102", "3"}}, levels(b.Asks(0)))
+}
+
+// go test -v -run TestBookSync
+func TestBookSync(t *testing.T) {
+	b := NewBook("BTCUSDT")
+	_, err := b.VWAP(pub.OS_Buy, pub.D("1"))
+	require.ErrorIs(t, err, ErrNotSynced)
+
+	updates := parseRecorded(t, recorded)
+	for _, u := range updates[:2] { // buffered before the snapshot
+		require.NoError(t, b.ApplyUpdate(u))
+	}
+	require.False(t, b.Synced())
+	require.NoError(t, b.ApplySnapshot(snapshot110))
+	for _, u := range updates[2:] {
+		require.NoError(t, b.ApplyUpdate(u))
+	}
+	requireSynced(t, b)
+	require.Equal(t, int64(1004), b.EventTime())
+
+	bid, ok := b.BestBid()
+	require.True(t, ok)
+	require.Equal(t, "100.5", bid.Price.String())
+	ask, ok := b.BestAsk()
+	require.True(t, ok)
+	require.Equal(t, "101.5", ask.Price.String())
+	require.Equal(t, [][]string{{"100.5", "1"}, {"100", "2"}}, levels(b.Bids(2)))
+	require.Equal(t, "6", b.QtyWithin(pub.OS_Sell, pub.D("99.5")).String())
+	require.Equal(t, "2", b.QtyWithin(pub.OS_Buy, pub.D("101.5")).String())
+
+	vwap, err := b.VWAP(pub.OS_Buy, pub.D("3"))
+	require.NoError(t, err)
+	require.Equal(t, "101.666666666667", vwap.String())
+	vwap, err = b.VWAP(pub.OS_Sell, pub.D("2"))
+	require.NoError(t, err)
+	require.Equal(t, "100.25", vwap.String())
+	_, err = b.VWAP(pub.OS_Buy, pub.D("6"))
+	require.ErrorIs(t, err, ErrNotEnoughSize)
+
+	// a gap resets the book, a snapshot older than the buffered events is not enough
+	gap := parseRecorded(t, recordedGap)
+	require.ErrorIs(t, b.ApplyUpdate(gap[0]), ErrGap)
+	require.False(t, b.Synced())
+	require.Empty(t, b.Bids(0))
+	require.NoError(t, b.ApplyUpdate(gap[1]))
+	require.ErrorIs(t, b.ApplySnapshot(snapshot118), ErrGap)
+	require.False(t, b.Synced())
+	require.NoError(t, b.ApplySnapshot(snapshot127))
+	require.True(t, b.Synced())
+	require.Equal(t, int64(133), b.LastUpdateId())
+	require.Equal(t, [][]string{{"99", "2"}}, levels(b.Bids(0)))
+	require.Equal(t, [][]string{{"100.8", "1"}}, levels(b.Asks(0)))
+}
+
+// go test -v -run TestBookDropStale
+func TestBookDropStale(t *testing.T) {
+	b := NewBook("BTCUSDT")
+	updates := parseRecorded(t, recorded)
+	require.NoError(t, b.ApplySnapshot(snapshot110))
+	for _, u := range updates { // the first one is older than the snapshot
+		require.NoError(t, b.ApplyUpdate(u))
+	}
+	requireSynced(t, b)
+
+	// the first event after the snapshot must cover lastUpdateId
+	b.Reset()
+	require.NoError(t, b.ApplyUpdate(updates[3]))
+	require.ErrorIs(t, b.ApplySnapshot(snapshot110), ErrGap)
+	require.False(t, b.Synced())
+}
+
+// mockDepthServer acks the requests, sends the recorded messages after the SUBSCRIBE, and the gap messages after gap is closed.
+func mockDepthServer(t *testing.T, gap chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var mu sync.Mutex // for the writes of the gap messages
+		ack := func() error {
+			var req struct {
+				Id int64 `json:"id"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return conn.WriteJSON(map[string]interface{}{"result": nil, "id": req.Id})
+		}
+		if ack() != nil { // SUBSCRIBE
+			return
+		}
+		for _, line := range strings.Split(recorded, "\n") {
+			conn.WriteMessage(websocket.TextMessage, []byte(line))
+		}
+		go func() {
+			<-gap
+			mu.Lock()
+			defer mu.Unlock()
+			for _, line := range strings.Split(recordedGap, "\n") {
+				conn.WriteMessage(websocket.TextMessage, []byte(line))
+			}
+		}()
+		for ack() == nil { // UNSUBSCRIBE
+		}
+	}))
+}
+
+// go test -v -run TestManager
+func TestManager(t *testing.T) {
+	gap := make(chan struct{})
+	srv := mockDepthServer(t, gap)
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, pc)
+	m.backoff = &pub.RetryPolicy{MaxRetries: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	var mu sync.Mutex
+	snapshots := []*Snapshot{snapshot110, snapshot118, snapshot127}
+	var requests []string
+	m.Snapshot = func(ctx context.Context, symbol string, limit int) (*Snapshot, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, fmt.Sprintf("%v %v", symbol, limit))
+		s := snapshots[0]
+		if len(snapshots) > 1 {
+			snapshots = snapshots[1:]
+		}
+		return s, nil
+	}
+
+	b, err := m.Add(ctx, "btcusdt")
+	require.NoError(t, err)
+	require.Equal(t, b, m.Book("BTCUSDT"))
+	waitUpdateId := func(id int64) map[ChangeType]int {
+		types := map[ChangeType]int{}
+		for b.LastUpdateId() != id || !b.Synced() {
+			select {
+			case c := <-m.Changes():
+				types[c.Type]++
+			case <-time.After(5 * time.Second):
+				t.Fatalf("wait update id %v, got %v", id, b.LastUpdateId())
+			}
+		}
+		return types
+	}
+	waitUpdateId(120)
+	requireSynced(t, b)
+
+	close(gap)
+	waitUpdateId(133)
+	require.Equal(t, [][]string{{"99", "2"}}, levels(b.Bids(0)))
+	require.Equal(t, [][]string{{"100.8", "1"}}, levels(b.Asks(0)))
+
+	mu.Lock()
+	require.Equal(t, []string{"BTCUSDT 1000", "BTCUSDT 1000", "BTCUSDT 1000"}, requests)
+	mu.Unlock()
+
+	require.NoError(t, m.Remove(ctx, "BTCUSDT"))
+	require.Nil(t, m.Book("BTCUSDT"))
+	cancel()
+	for range m.Changes() {
+	}
+}
+
+// go test -v -run TestManagerGap
+func TestManagerGap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, pub.NewClient(nil))
+	m.Snapshot = func(ctx context.Context, symbol string, limit int) (*Snapshot, error) {
+		return nil, errors.New("offline")
+	}
+	for _, symbol := range []string{"BTCUSDT", "ETHUSDT"} {
+		b := NewBook(symbol)
+		require.NoError(t, b.ApplySnapshot(snapshot110))
+		m.books[symbol] = b
+	}
+
+	// the gap of the connection of btcusdt only
+	m.onGap(pub.WsEvent{Type: pub.WE_Gap, Streams: []string{"btcusdt@depth@100ms"}})
+	require.Equal(t, int64(0), m.Book("BTCUSDT").LastUpdateId())
+	require.Equal(t, int64(110), m.Book("ETHUSDT").LastUpdateId())
+
+	m.onGap(pub.WsEvent{Type: pub.WE_Gap}) // unknown streams
+	require.Equal(t, int64(0), m.Book("ETHUSDT").LastUpdateId())
+}
@@ -0,0 +1,125 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/internal/mockapi"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streamuserdata"
+	"github.com/billfort/binance-usdmfuture/trade"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func orderUpdate(tt int64, id int64, client, x, status, filled, lastQty, lastPrice string, tradeId int64, fee string) *streamuserdata.OrderTradeUpdate {
+	u := &streamuserdata.OrderTradeUpdate{EventType: "ORDER_TRADE_UPDATE", EventTime: tt, TransactionTime: tt}
+	u.Order = streamuserdata.Order{
+		Symbol: "BTCUSDT", ClientOrderID: client, Side: "BUY", OrderType: "LIMIT", TimeInForce: "GTC", OriginalQuantity: "0.010",
+		OriginalPrice: "60000", ExecutionType: x, OrderStatus: status, OrderID: id, OrderFilled: filled,
+		OrderLastFilled: lastQty, LastFilledPrice: lastPrice, TradeID: tradeId, Commission: fee, CommissionAsset: "USDT",
+		OriginalOrderType: "LIMIT", PositionSide: "BOTH", RealizedProfit: "0",
+	}
+	return u
+}
+
+// go test -v -run TestTrackerLifecycle
+func TestTrackerLifecycle(t *testing.T) {
+	tr := NewTracker(pub.NewClient(nil))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan *Order)
+	go func() {
+		o, _ := tr.Wait(ctx, "c1") // before the order is known
+		done <- o
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	require.NoError(t, tr.ApplyUpdate(orderUpdate(1, 11, "c1", "NEW", "NEW", "0", "0", "0", 0, "0")))
+	require.NoError(t, tr.ApplyUpdate(orderUpdate(2, 11, "c1", "TRADE", "PARTIALLY_FILLED", "0.004", "0.004", "59990", 101, "0.0959")))
+	require.NoError(t, tr.ApplyUpdate(orderUpdate(2, 11, "c1", "TRADE", "PARTIALLY_FILLED", "0.004", "0.004", "59990", 101, "0.0959"))) // duplicated
+	require.NoError(t, tr.ApplyUpdate(orderUpdate(1, 11, "c1", "NEW", "NEW", "0", "0", "0", 0, "0")))                                   // older
+
+	o, ok := tr.Get(11)
+	require.True(t, ok)
+	require.Equal(t, pub.OS_PartiallyFilled, o.Status)
+	require.Len(t, o.Fills, 1)
+	require.Len(t, tr.Open("BTCUSDT"), 1)
+
+	require.NoError(t, tr.ApplyUpdate(orderUpdate(3, 11, "c1", "TRADE", "FILLED", "0.010", "0.006", "60000", 102, "0.144")))
+	o = <-done
+	require.NotNil(t, o)
+	require.Equal(t, int64(11), o.OrderId)
+	require.Equal(t, pub.OS_Filled, o.Status)
+	require.Equal(t, "0.01", o.ExecutedQty.String())
+	require.Len(t, o.Fills, 2)
+	require.Equal(t, "599.96", o.CumQuote.String()) // 0.004*59990 + 0.006*60000
+	require.Equal(t, "0.2399", o.Fees["USDT"].String())
+	require.Empty(t, tr.Open(""))
+
+	err := tr.ApplyUpdate(orderUpdate(4, 11, "c1", "CANCELED", "CANCELED", "0.010", "0", "0", 0, "0"))
+	require.ErrorIs(t, err, ErrInvalidTransition)
+	o, ok = tr.GetByClientOrderId("c1")
+	require.True(t, ok)
+	require.Equal(t, pub.OS_Filled, o.Status)
+
+	o, err = tr.Wait(ctx, "c1") // already final
+	require.NoError(t, err)
+	require.Equal(t, pub.OS_Filled, o.Status)
+
+	// the client order id is reused by a new order after c1 is closed
+	require.NoError(t, tr.ApplyUpdate(orderUpdate(5, 12, "c1", "NEW", "NEW", "0", "0", "0", 0, "0")))
+	o, ok = tr.GetByClientOrderId("c1")
+	require.True(t, ok)
+	require.Equal(t, int64(12), o.OrderId)
+	require.Equal(t, pub.OS_New, o.Status)
+	o, ok = tr.Get(11)
+	require.True(t, ok)
+	require.Equal(t, pub.OS_Filled, o.Status)
+	require.Len(t, o.Fills, 2)
+	require.Len(t, tr.Open("BTCUSDT"), 1)
+
+	require.True(t, ValidTransition("", pub.OS_Filled))
+	require.True(t, ValidTransition(pub.OS_New, pub.OS_ExpiredInMatch))
+	require.False(t, ValidTransition(pub.OS_Canceled, pub.OS_New))
+}
+
+// go test -v -run TestTrackerReconcile
+func TestTrackerReconcile(t *testing.T) {
+	pc := mockapi.New(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/openOrders":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"orderId": 12, "clientOrderId": "c2", "symbol": "BTCUSDT", "status": "PARTIALLY_FILLED", "executedQty": "0.002", "origQty": "0.01", "updateTime": 5},
+				{"orderId": 14, "clientOrderId": "c4", "symbol": "BTCUSDT", "status": "NEW", "executedQty": "0", "origQty": "0.01", "updateTime": 5},
+			})
+		case "/fapi/v1/order":
+			assert.Equal(t, "13", r.URL.Query().Get("orderId"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 13, "clientOrderId": "c3", "symbol": "BTCUSDT", "status": "CANCELED", "executedQty": "0", "updateTime": 6})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	tr := NewTracker(pc)
+	ctx := context.Background()
+
+	tr.Track(&trade.OrderResponse{OrderId: 12, ClientOrderId: "c2", Symbol: "BTCUSDT", Status: pub.OS_New, ExecutedQty: "0", UpdateTime: 1})
+	require.NoError(t, tr.ApplyUpdate(orderUpdate(1, 13, "c3", "NEW", "NEW", "0", "0", "0", 0, "0")))
+
+	// the stream was lost, c2 was filled partly, c3 was canceled and c4 was placed meanwhile
+	require.NoError(t, tr.Apply(ctx, pub.WsEvent{Type: pub.WE_Gap}))
+	require.NoError(t, tr.Reconcile(ctx))
+
+	o, _ := tr.Get(12)
+	require.Equal(t, pub.OS_PartiallyFilled, o.Status)
+	require.Equal(t, "0.002", o.ExecutedQty.String())
+	o, _ = tr.Get(13)
+	require.Equal(t, pub.OS_Canceled, o.Status)
+	o, _ = tr.GetByClientOrderId("c4")
+	require.Equal(t, int64(14), o.OrderId)
+	require.Len(t, tr.Open(""), 2)
+}
@@ -0,0 +1,385 @@
+// Package orders tracks the lifecycle of the orders by the ORDER_TRADE_UPDATE events of the user data stream,
+// and reconciles them by REST after gaps of the stream.
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streamuserdata"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+const defaultRetention = time.Hour
+
+var (
+	ErrInvalidTransition = errors.New("orders: invalid status transition")
+	ErrUnknownOrder      = errors.New("orders: unknown order")
+)
+
+// Fill is a trade of an order.
+type Fill struct {
+	TradeId     int64
+	Price       pub.Decimal
+	Qty         pub.Decimal
+	Fee         pub.Decimal
+	FeeAsset    string
+	RealizedPnl pub.Decimal
+	Maker       bool
+	Time        int64
+}
+
+// Order is the tracked state of an order.
+type Order struct {
+	Symbol        string
+	OrderId       int64
+	ClientOrderId string
+	Side          pub.OrderSide
+	PositionSide  pub.PositionSide
+	Type          pub.OrderType
+	TimeInForce   pub.TimeInForce
+	ReduceOnly    bool
+	Price         pub.Decimal
+	StopPrice     pub.Decimal
+	OrigQty       pub.Decimal
+	Status        pub.OrderStatus // empty until the order is known
+
+	ExecutedQty pub.Decimal // cumulative filled quantity
+	AvgPrice    pub.Decimal
+	CumQuote    pub.Decimal            // filled notional of the fills
+	Fees        map[string]pub.Decimal // commission by asset of the fills
+	RealizedPnl pub.Decimal            // of the fills
+	Fills       []Fill
+
+	UpdateTime int64 // transaction time of the last applied update, milliseconds
+}
+
+// IsFinal reports whether the order is closed.
+func (o *Order) IsFinal() bool {
+	return o.Status.IsFinal()
+}
+
+func (o *Order) clone() *Order {
+	c := *o
+	c.Fees = make(map[string]pub.Decimal, len(o.Fees))
+	for k, v := range o.Fees {
+		c.Fees[k] = v
+	}
+	c.Fills = append([]Fill(nil), o.Fills...)
+	return &c
+}
+
+// validTransitions are the statuses an order can change to, an order of empty status can change to any one.
+var validTransitions = map[pub.OrderStatus][]pub.OrderStatus{
+	pub.OS_New:             {pub.OS_New, pub.OS_PartiallyFilled, pub.OS_Filled, pub.OS_Canceled, pub.OS_Expired, pub.OS_ExpiredInMatch},
+	pub.OS_PartiallyFilled: {pub.OS_PartiallyFilled, pub.OS_Filled, pub.OS_Canceled, pub.OS_Expired, pub.OS_ExpiredInMatch},
+}
+
+// ValidTransition reports whether the status of an order can change from one to the other.
+func ValidTransition(from, to pub.OrderStatus) bool {
+	if from == "" {
+		return true
+	}
+	for _, s := range validTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+type entry struct {
+	order    *Order
+	tradeIds map[int64]bool
+	done     chan struct{} // closed when the order is final
+	created  time.Time
+	closedAt time.Time
+}
+
+// Tracker keeps the open orders and the orders closed in Retention, by orderId and clientOrderId.
+// It is safe for concurrent use.
+type Tracker struct {
+	Retention time.Duration // closed orders are dropped after Retention, default 1 hour
+
+	client *trade.Client
+
+	mu        sync.Mutex
+	byId      map[int64]*entry
+	byClient  map[string]*entry
+	lastSweep time.Time
+}
+
+func NewTracker(c *pub.Client) *Tracker {
+	return &Tracker{
+		Retention: defaultRetention,
+		client:    trade.NewClient(c),
+		byId:      map[int64]*entry{},
+		byClient:  map[string]*entry{},
+	}
+}
+
+// Apply applies the data of streamuserdata: OrderTradeUpdate, and *streamuserdata.Reconciled with the open orders
+// of REST after the connections of Supervisor. The other data is ignored.
+func (t *Tracker) Apply(ctx context.Context, d interface{}) error {
+	switch v := d.(type) {
+	case streamuserdata.OrderTradeUpdate:
+		return t.ApplyUpdate(&v)
+	case *streamuserdata.OrderTradeUpdate:
+		return t.ApplyUpdate(v)
+	case *streamuserdata.Reconciled:
+		return t.ReconcileWith(ctx, v.OpenOrders)
+	}
+	return nil
+}
+
+// entryOf returns the entry of the order, it is added if it is unknown. The entry of the client order id is the
+// order's only if either order id is unknown or they are the same, a client order id can be reused after the order
+// is closed.
+// It is locked by the caller.
+func (t *Tracker) entryOf(orderId int64, clientOrderId string) *entry {
+	e := t.byId[orderId]
+	if e == nil && clientOrderId != "" {
+		if c := t.byClient[clientOrderId]; c != nil && (orderId == 0 || c.order.OrderId == 0 || c.order.OrderId == orderId) {
+			e = c
+		}
+	}
+	if e == nil {
+		e = &entry{order: &Order{}, tradeIds: map[int64]bool{}, done: make(chan struct{}), created: time.Now()}
+	}
+	if orderId != 0 {
+		e.order.OrderId = orderId
+		t.byId[orderId] = e
+	}
+	if clientOrderId != "" {
+		e.order.ClientOrderId = clientOrderId
+		t.byClient[clientOrderId] = e
+	}
+	return e
+}
+
+// ApplyUpdate applies the execution report in sequence: a TRADE is counted once by its trade id, and the status is
+// not changed by a report older than the applied ones. It returns ErrInvalidTransition for a status change which
+// is not possible, such as FILLED to NEW, the status is not changed then.
+func (t *Tracker) ApplyUpdate(u *streamuserdata.OrderTradeUpdate) error {
+	r := &u.Order
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.sweep()
+	e := t.entryOf(r.OrderID, r.ClientOrderID)
+	o := e.order
+
+	if pub.ExecutionType(r.ExecutionType) == pub.ET_Trade && r.TradeID != 0 && !e.tradeIds[r.TradeID] {
+		e.tradeIds[r.TradeID] = true
+		f := Fill{
+			TradeId: r.TradeID, Price: r.LastFilledPriceDec(), Qty: r.OrderLastFilledDec(), Fee: r.CommissionDec(),
+			FeeAsset: r.CommissionAsset, RealizedPnl: r.RealizedProfitDec(), Maker: r.IsMaker, Time: r.OrderTradeTime,
+		}
+		o.Fills = append(o.Fills, f)
+		o.CumQuote = o.CumQuote.Add(f.Qty.Mul(f.Price))
+		o.RealizedPnl = o.RealizedPnl.Add(f.RealizedPnl)
+		if f.FeeAsset != "" {
+			if o.Fees == nil {
+				o.Fees = map[string]pub.Decimal{}
+			}
+			o.Fees[f.FeeAsset] = o.Fees[f.FeeAsset].Add(f.Fee)
+		}
+	}
+
+	status := pub.OrderStatus(r.OrderStatus)
+	filled := r.OrderFilledDec()
+	if u.TransactionTime < o.UpdateTime || filled.LessThan(o.ExecutedQty) || (o.IsFinal() && status == o.Status) {
+		return nil // older than the applied ones
+	}
+	if !ValidTransition(o.Status, status) {
+		return fmt.Errorf("%w: %v %v from %v to %v", ErrInvalidTransition, r.Symbol, r.OrderID, o.Status, status)
+	}
+	o.Symbol = r.Symbol
+	o.Side = pub.OrderSide(r.Side)
+	o.PositionSide = pub.PositionSide(r.PositionSide)
+	o.Type = pub.OrderType(r.OriginalOrderType)
+	if o.Type == "" {
+		o.Type = pub.OrderType(r.OrderType)
+	}
+	o.TimeInForce = pub.TimeInForce(r.TimeInForce)
+	o.ReduceOnly = r.IsReduceOnly
+	o.Price = r.OriginalPriceDec()
+	o.StopPrice = r.StopPriceDec()
+	o.OrigQty = r.OriginalQuantityDec()
+	o.ExecutedQty = filled
+	o.AvgPrice = r.AveragePriceDec()
+	o.UpdateTime = u.TransactionTime
+	t.setStatus(e, status)
+	return nil
+}
+
+// setStatus sets the status and releases the waiters of a final order, it is locked by the caller.
+func (t *Tracker) setStatus(e *entry, status pub.OrderStatus) {
+	e.order.Status = status
+	if status.IsFinal() && e.closedAt.IsZero() {
+		e.closedAt = time.Now()
+		close(e.done)
+	}
+}
+
+// Track adds the order by the response of placing it, so it can be waited before its events arrive.
+func (t *Tracker) Track(resp *trade.OrderResponse) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.applyResponse(resp)
+}
+
+// applyResponse applies the REST state of the order unless it is older than the applied one, it is locked by the caller.
+func (t *Tracker) applyResponse(resp *trade.OrderResponse) {
+	e := t.entryOf(resp.OrderId, resp.ClientOrderId)
+	o := e.order
+	executed := pub.D(resp.ExecutedQty)
+	if resp.UpdateTime < o.UpdateTime || executed.LessThan(o.ExecutedQty) || o.IsFinal() {
+		return
+	}
+	o.Symbol = resp.Symbol
+	o.Side = resp.Side
+	o.PositionSide = resp.PositionSide
+	o.Type = resp.OrigType
+	if o.Type == "" {
+		o.Type = resp.Type
+	}
+	o.TimeInForce = resp.TimeInForce
+	o.ReduceOnly = resp.ReduceOnly
+	o.Price = pub.D(resp.Price)
+	o.StopPrice = pub.D(resp.StopPrice)
+	o.OrigQty = pub.D(resp.OrigQty)
+	o.ExecutedQty = executed
+	o.AvgPrice = pub.D(resp.AvgPrice)
+	if len(o.Fills) == 0 { // the fills are not known by REST
+		o.CumQuote = pub.D(resp.CumQuote)
+	}
+	o.UpdateTime = resp.UpdateTime
+	t.setStatus(e, resp.Status)
+}
+
+// Reconcile queries the open orders by REST and reconciles with them, see ReconcileWith.
+func (t *Tracker) Reconcile(ctx context.Context) error {
+	open, err := t.client.QueryOpenOrders(ctx, "")
+	if err != nil {
+		return err
+	}
+	return t.ReconcileWith(ctx, open)
+}
+
+// ReconcileWith applies the open orders of REST, and queries the final state of the tracked open orders
+// which are not open any more, they were closed in a gap of the stream.
+func (t *Tracker) ReconcileWith(ctx context.Context, open []trade.OrderResponse) error {
+	t.mu.Lock()
+	isOpen := make(map[int64]bool, len(open))
+	for i := range open {
+		isOpen[open[i].OrderId] = true
+		t.applyResponse(&open[i])
+	}
+	var closed []*Order
+	for id, e := range t.byId {
+		if !isOpen[id] && e.order.Status != "" && !e.order.IsFinal() {
+			closed = append(closed, e.order.clone())
+		}
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, o := range closed {
+		resp, err := t.client.QueryOrder(ctx, o.Symbol, o.OrderId, "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("orders: query %v %v: %w", o.Symbol, o.OrderId, err))
+			continue
+		}
+		t.mu.Lock()
+		t.applyResponse(resp)
+		t.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Get returns a copy of the order by orderId.
+func (t *Tracker) Get(orderId int64) (*Order, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e := t.byId[orderId]; e != nil && e.order.Status != "" {
+		return e.order.clone(), true
+	}
+	return nil, false
+}
+
+// GetByClientOrderId returns a copy of the order by clientOrderId.
+func (t *Tracker) GetByClientOrderId(clientOrderId string) (*Order, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e := t.byClient[clientOrderId]; e != nil && e.order.Status != "" {
+		return e.order.clone(), true
+	}
+	return nil, false
+}
+
+// Open returns the copies of the open orders, of the symbol if it is not empty.
+func (t *Tracker) Open(symbol string) []*Order {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var orders []*Order
+	for _, e := range t.byId {
+		if e.order.Status != "" && !e.order.IsFinal() && (symbol == "" || e.order.Symbol == symbol) {
+			orders = append(orders, e.order.clone())
+		}
+	}
+	return orders
+}
+
+// Wait waits for the order of clientOrderId to be final, and returns it. The order may be unknown yet,
+// such as it is being placed.
+func (t *Tracker) Wait(ctx context.Context, clientOrderId string) (*Order, error) {
+	if clientOrderId == "" {
+		return nil, fmt.Errorf("%w: empty clientOrderId", ErrUnknownOrder)
+	}
+	t.mu.Lock()
+	e := t.entryOf(0, clientOrderId)
+	t.mu.Unlock()
+
+	select {
+	case <-e.done:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return e.order.clone(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// sweep drops the orders closed before Retention, and the unknown orders waited before Retention,
+// it runs at most every Retention/10. It is locked by the caller.
+func (t *Tracker) sweep() {
+	now := time.Now()
+	if now.Sub(t.lastSweep) < t.Retention/10 {
+		return
+	}
+	if t.lastSweep.IsZero() {
+		t.lastSweep = now
+		return
+	}
+	t.lastSweep = now
+	drop := func(e *entry) bool {
+		if e.order.Status == "" { // waited but never known
+			return now.Sub(e.created) > t.Retention
+		}
+		return !e.closedAt.IsZero() && now.Sub(e.closedAt) > t.Retention
+	}
+	for id, e := range t.byId {
+		if drop(e) {
+			delete(t.byId, id)
+		}
+	}
+	for id, e := range t.byClient {
+		if drop(e) {
+			delete(t.byClient, id)
+		}
+	}
+}
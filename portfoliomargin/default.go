@@ -0,0 +1,18 @@
+package portfoliomargin
+
+import (
+	"context"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+// The package level functions below keep the original API, they send requests by pub.DefaultClient.
+
+func newKeyClient(key *pub.Key) *Client {
+	return NewClient(pub.DefaultClient.WithKey(key))
+}
+
+// Get Classic Portfolio Margin current account information.
+func GetPmAccountInfo(key *pub.Key, asset string) (*accountInfo, error) {
+	return newKeyClient(key).GetPmAccountInfo(context.Background(), asset)
+}
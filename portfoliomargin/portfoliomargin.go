@@ -1,18 +1,28 @@
 package portfoliomargin
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/billfort/binance-usdmfuture/pub"
 )
 
+// Client sends portfoliomargin requests with the settings and key of the wrapped pub.Client.
+type Client struct {
+	*pub.Client
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c}
+}
+
 // Get Classic Portfolio Margin current account information.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/portfolio-margin-endpoints
-func GetPmAccountInfo(key *pub.Key, asset string) (*accountInfo, error) {
+func (c *Client) GetPmAccountInfo(ctx context.Context, asset string) (*accountInfo, error) {
 	params := map[string]interface{}{
 		"asset": asset,
 	}
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/pmAccountInfo", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/pmAccountInfo", params)
 	if err != nil {
 		return nil, err
 	}
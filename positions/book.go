@@ -0,0 +1,388 @@
+// Package positions keeps the live positions of the account, seeded by REST, updated by the ACCOUNT_UPDATE events
+// of the user data stream and marked to market by the mark price streams.
+package positions
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/account"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+	"github.com/billfort/binance-usdmfuture/streamuserdata"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+// ChangeType is the type of Change.
+type ChangeType int
+
+const (
+	PC_Snapshot ChangeType = iota // the position is seeded or reconciled by REST
+	PC_Update                     // the position is changed by ACCOUNT_UPDATE
+	PC_Mark                       // the mark price of the position is changed
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case PC_Snapshot:
+		return "Snapshot"
+	case PC_Update:
+		return "Update"
+	case PC_Mark:
+		return "Mark"
+	}
+	return "Unknown"
+}
+
+// Key identifies a position, Side is BOTH in one-way mode, LONG or SHORT in hedge mode.
+type Key struct {
+	Symbol string
+	Side   pub.PositionSide
+}
+
+// Position is the state of a position, Amount is negative for a short position.
+type Position struct {
+	Symbol              string
+	Side                pub.PositionSide
+	Amount              pub.Decimal
+	EntryPrice          pub.Decimal
+	BreakEvenPrice      pub.Decimal
+	MarkPrice           pub.Decimal // zero until a mark price is known
+	UnrealizedPnl       pub.Decimal // by MarkPrice, or as reported if the mark price is not known
+	AccumulatedRealized pub.Decimal // only reported by ACCOUNT_UPDATE
+	MarginType          pub.MarginType
+	IsolatedWallet      pub.Decimal
+
+	UpdateTime int64 // time of the last position update, milliseconds
+	MarkTime   int64 // time of MarkPrice, milliseconds
+}
+
+// Key returns the key of the position.
+func (p *Position) Key() Key {
+	return Key{Symbol: p.Symbol, Side: p.Side}
+}
+
+// IsOpen reports whether the amount is not zero.
+func (p *Position) IsOpen() bool {
+	return !p.Amount.IsZero()
+}
+
+// Notional returns the signed notional value by the mark price, or by the entry price if the mark price is not known.
+func (p *Position) Notional() pub.Decimal {
+	if p.MarkPrice.IsPositive() {
+		return p.Amount.Mul(p.MarkPrice)
+	}
+	return p.Amount.Mul(p.EntryPrice)
+}
+
+// mark sets the mark price and the unrealized profit by it.
+func (p *Position) mark(price pub.Decimal, t int64) {
+	p.MarkPrice = price
+	p.MarkTime = t
+	p.UnrealizedPnl = price.Sub(p.EntryPrice).Mul(p.Amount)
+}
+
+// Change notifies the change of a position, Position is a copy, its amount is zero after it is closed.
+type Change struct {
+	Type     ChangeType
+	Reason   string // event reason of ACCOUNT_UPDATE, such as ORDER or FUNDING_FEE
+	Position Position
+}
+
+type mark struct {
+	price pub.Decimal
+	time  int64
+}
+
+// Book keeps the positions by symbol and position side, it works in both one-way and hedge mode.
+// It is safe for concurrent use.
+type Book struct {
+	client  *trade.Client
+	changes chan Change
+
+	mu        sync.RWMutex
+	positions map[Key]*Position
+	marks     map[string]mark
+	leverages map[string]int
+}
+
+func NewBook(c *pub.Client) *Book {
+	return &Book{
+		client:    trade.NewClient(c),
+		changes:   make(chan Change, pub.WsChanLen),
+		positions: map[Key]*Position{},
+		marks:     map[string]mark{},
+		leverages: map[string]int{},
+	}
+}
+
+// Changes returns the channel of the changes of the positions, it is never closed. The changes are dropped
+// if the channel is full, the book always has the latest state.
+func (b *Book) Changes() <-chan Change {
+	return b.changes
+}
+
+// Load seeds the positions and the leverages of the symbols by REST.
+func (b *Book) Load(ctx context.Context) error {
+	at := b.client.Now(ctx)
+	ps, err := b.client.GetPositionInfoV3(ctx, "")
+	if err != nil {
+		return err
+	}
+	b.Seed(ps, at)
+	cs, err := account.NewClient(b.client.Client).SymbolConfiguration(ctx, "")
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	for i := range cs {
+		b.leverages[cs[i].Symbol] = cs[i].Leverage
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// Apply applies the data of streamuserdata and streammarket: AccountUpdate, AccountConfigUpdate,
+// *streamuserdata.Reconciled, and MarkPriceUpdate or []MarkPriceUpdate. The other data is ignored.
+func (b *Book) Apply(d interface{}) {
+	switch v := d.(type) {
+	case streamuserdata.AccountUpdate:
+		b.ApplyAccountUpdate(&v)
+	case *streamuserdata.AccountUpdate:
+		b.ApplyAccountUpdate(v)
+	case streamuserdata.AccountConfigUpdate:
+		b.SetLeverage(v.AccountLeverage.Symbol, v.AccountLeverage.Leverage)
+	case *streamuserdata.AccountConfigUpdate:
+		b.SetLeverage(v.AccountLeverage.Symbol, v.AccountLeverage.Leverage)
+	case *streamuserdata.Reconciled:
+		b.Seed(v.Positions, v.Time)
+	case streammarket.MarkPriceUpdate:
+		b.ApplyMarkPrice(v.Symbol, v.MarkPriceDec(), v.EventTime)
+	case *streammarket.MarkPriceUpdate:
+		b.ApplyMarkPrice(v.Symbol, v.MarkPriceDec(), v.EventTime)
+	case []streammarket.MarkPriceUpdate:
+		for i := range v {
+			b.ApplyMarkPrice(v[i].Symbol, v[i].MarkPriceDec(), v[i].EventTime)
+		}
+	}
+}
+
+// WatchMarkPrices subscribes !markPrice@arr@1s by the manager to mark the positions to market.
+func (b *Book) WatchMarkPrices(ctx context.Context, m *streammarket.SubscriptionManager) error {
+	return streammarket.Handle(ctx, m, streammarket.AllMarkPriceStream(time.Second), func(v []streammarket.MarkPriceUpdate) {
+		b.Apply(v)
+	})
+}
+
+// Seed replaces the positions by the REST state taken at t, the positions updated by the stream after it are kept.
+func (b *Book) Seed(ps []trade.PositionInfo, t time.Time) {
+	at := t.UnixMilli()
+	b.mu.Lock()
+	seen := make(map[Key]bool, len(ps))
+	var changes []Change
+	for i := range ps {
+		r := &ps[i]
+		k := Key{Symbol: r.Symbol, Side: positionSide(r.PositionSide)}
+		seen[k] = true
+		if old := b.positions[k]; old != nil && old.UpdateTime > r.UpdateTime && old.UpdateTime > at {
+			continue
+		}
+		p := &Position{
+			Symbol:         r.Symbol,
+			Side:           k.Side,
+			Amount:         r.PositionAmtDec(),
+			EntryPrice:     r.EntryPriceDec(),
+			BreakEvenPrice: r.BreakEvenPriceDec(),
+			UnrealizedPnl:  r.UnRealizedProfitDec(),
+			MarginType:     marginType(r.MarginType),
+			IsolatedWallet: pub.D(r.IsolatedWallet),
+			UpdateTime:     r.UpdateTime,
+		}
+		if old := b.positions[k]; old != nil {
+			p.AccumulatedRealized = old.AccumulatedRealized
+		}
+		if l, _ := strconv.Atoi(r.Leverage); l > 0 { // not in v3
+			b.leverages[r.Symbol] = l
+		}
+		if m, ok := b.marks[r.Symbol]; ok {
+			p.mark(m.price, m.time)
+		} else if mp := r.MarkPriceDec(); mp.IsPositive() {
+			p.MarkPrice = mp
+		}
+		changes = append(changes, b.set(p, PC_Snapshot, ""))
+	}
+	for k, p := range b.positions {
+		if !seen[k] && p.IsOpen() && p.UpdateTime <= at {
+			closed := *p
+			closed.Amount = pub.Decimal{}
+			closed.UnrealizedPnl = pub.Decimal{}
+			changes = append(changes, b.set(&closed, PC_Snapshot, ""))
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+// ApplyAccountUpdate applies the positions of the event, the positions not in it are not changed.
+// A position is not changed by an event older than its last update.
+func (b *Book) ApplyAccountUpdate(u *streamuserdata.AccountUpdate) {
+	b.mu.Lock()
+	var changes []Change
+	for _, r := range u.Data.Positions {
+		k := Key{Symbol: r.Symbol, Side: positionSide(r.PositionSide)}
+		old := b.positions[k]
+		if old != nil && u.TransactionTime < old.UpdateTime {
+			continue
+		}
+		p := &Position{
+			Symbol:              r.Symbol,
+			Side:                k.Side,
+			Amount:              pub.D(r.PositionAmount),
+			EntryPrice:          pub.D(r.EntryPrice),
+			BreakEvenPrice:      pub.D(r.BreakEvenPrice),
+			UnrealizedPnl:       pub.D(r.UnrealizedPnL),
+			AccumulatedRealized: pub.D(r.AccumulatedRealized),
+			MarginType:          marginType(r.MarginType),
+			IsolatedWallet:      pub.D(r.IsolatedWallet),
+			UpdateTime:          u.TransactionTime,
+		}
+		if m, ok := b.marks[r.Symbol]; ok {
+			p.mark(m.price, m.time)
+		}
+		changes = append(changes, b.set(p, PC_Update, u.Data.EventReasonType))
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+// ApplyMarkPrice marks the positions of the symbol to market, an older mark price is ignored.
+func (b *Book) ApplyMarkPrice(symbol string, price pub.Decimal, t int64) {
+	if !price.IsPositive() {
+		return
+	}
+	b.mu.Lock()
+	if m, ok := b.marks[symbol]; ok && t < m.time {
+		b.mu.Unlock()
+		return
+	}
+	b.marks[symbol] = mark{price: price, time: t}
+	var changes []Change
+	for _, side := range []pub.PositionSide{pub.PS_Both, pub.PS_Long, pub.PS_Short} {
+		if p := b.positions[Key{Symbol: symbol, Side: side}]; p != nil && p.IsOpen() {
+			p.mark(price, t)
+			changes = append(changes, Change{Type: PC_Mark, Position: *p})
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+// set stores the position, a closed position is kept with its update time so older events are still ignored.
+// It is locked by the caller.
+func (b *Book) set(p *Position, t ChangeType, reason string) Change {
+	b.positions[p.Key()] = p
+	return Change{Type: t, Reason: reason, Position: *p}
+}
+
+func (b *Book) notify(changes []Change) {
+	for _, c := range changes {
+		select {
+		case b.changes <- c:
+		default:
+		}
+	}
+}
+
+// Get returns a copy of the open position of the symbol and side, side is BOTH in one-way mode.
+func (b *Book) Get(symbol string, side pub.PositionSide) (Position, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if p := b.positions[Key{Symbol: symbol, Side: side}]; p != nil && p.IsOpen() {
+		return *p, true
+	}
+	return Position{}, false
+}
+
+// Positions returns the copies of the open positions sorted by symbol and side, of the symbol if it is not empty.
+func (b *Book) Positions(symbol string) []Position {
+	b.mu.RLock()
+	ps := make([]Position, 0, len(b.positions))
+	for _, p := range b.positions {
+		if p.IsOpen() && (symbol == "" || p.Symbol == symbol) {
+			ps = append(ps, *p)
+		}
+	}
+	b.mu.RUnlock()
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].Symbol != ps[j].Symbol {
+			return ps[i].Symbol < ps[j].Symbol
+		}
+		return ps[i].Side < ps[j].Side
+	})
+	return ps
+}
+
+// NetAmount returns the net amount of the symbol, the sum of its positions of both sides.
+func (b *Book) NetAmount(symbol string) pub.Decimal {
+	var amt pub.Decimal
+	for _, p := range b.Positions(symbol) {
+		amt = amt.Add(p.Amount)
+	}
+	return amt
+}
+
+// UnrealizedPnl returns the total unrealized profit of the open positions.
+func (b *Book) UnrealizedPnl() pub.Decimal {
+	var pnl pub.Decimal
+	for _, p := range b.Positions("") {
+		pnl = pnl.Add(p.UnrealizedPnl)
+	}
+	return pnl
+}
+
+// SetLeverage sets the leverage of the symbol, such as by ACCOUNT_CONFIG_UPDATE.
+func (b *Book) SetLeverage(symbol string, leverage int) {
+	if symbol == "" || leverage <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.leverages[symbol] = leverage
+}
+
+// Leverage returns the leverage of the symbol, 0 if it is not known.
+func (b *Book) Leverage(symbol string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.leverages[symbol]
+}
+
+// MarkPrice returns the last mark price of the symbol.
+func (b *Book) MarkPrice(symbol string) (pub.Decimal, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	m, ok := b.marks[symbol]
+	return m.price, ok
+}
+
+func positionSide(s string) pub.PositionSide {
+	if s == "" {
+		return pub.PS_Both
+	}
+	return pub.PositionSide(strings.ToUpper(s))
+}
+
+// marginType normalizes "cross" and "isolated" of the events and REST.
+func marginType(s string) pub.MarginType {
+	switch strings.ToUpper(s) {
+	case "CROSS", "CROSSED":
+		return pub.MT_Cross
+	case "ISOLATED":
+		return pub.MT_Isolated
+	}
+	return pub.MarginType(s)
+}
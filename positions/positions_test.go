@@ -0,0 +1,114 @@
+package positions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/internal/mockapi"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+	"github.com/billfort/binance-usdmfuture/streamuserdata"
+	"github.com/billfort/binance-usdmfuture/trade"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestBook
+func TestBook(t *testing.T) {
+	b := NewBook(pub.NewClient(nil))
+	b.Seed([]trade.PositionInfo{
+		{Symbol: "BTCUSDT", PositionSide: "BOTH", PositionAmt: "0.010", EntryPrice: "60000", BreakEvenPrice: "60030", MarkPrice: "60100", UnRealizedProfit: "1", MarginType: "cross", UpdateTime: 10},
+	}, time.UnixMilli(20))
+	p, ok := b.Get("BTCUSDT", pub.PS_Both)
+	require.True(t, ok)
+	require.Equal(t, pub.MT_Cross, p.MarginType)
+	require.Equal(t, "601", p.Notional().String())
+	require.Equal(t, PC_Snapshot, (<-b.Changes()).Type)
+
+	// hedge mode positions of ETHUSDT
+	b.Apply(*mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":30,"T":30,"a":{"m":"ORDER","P":[
+		{"s":"ETHUSDT","pa":"2","ep":"3000","bep":"3001.5","cr":"0","up":"0","mt":"isolated","iw":"600","ps":"LONG"},
+		{"s":"ETHUSDT","pa":"-1","ep":"3100","bep":"3098","cr":"0","up":"0","mt":"isolated","iw":"310","ps":"SHORT"}]}}`))
+	c := <-b.Changes()
+	require.Equal(t, PC_Update, c.Type)
+	require.Equal(t, "ORDER", c.Reason)
+	<-b.Changes()
+	require.Len(t, b.Positions("ETHUSDT"), 2)
+
+	b.Apply([]streammarket.MarkPriceUpdate{{Symbol: "ETHUSDT", MarkPrice: "3050", EventTime: 31}, {Symbol: "BTCUSDT", MarkPrice: "59000", EventTime: 31}})
+	p, _ = b.Get("ETHUSDT", pub.PS_Long)
+	require.Equal(t, "100", p.UnrealizedPnl.String())
+	p, _ = b.Get("ETHUSDT", pub.PS_Short)
+	require.Equal(t, "50", p.UnrealizedPnl.String())
+	require.Equal(t, "-3050", p.Notional().String())
+	require.Equal(t, "3001.5", b.Positions("ETHUSDT")[0].BreakEvenPrice.String())
+	require.Equal(t, "140", b.UnrealizedPnl().String()) // -10 + 100 + 50
+	require.Equal(t, "1", b.NetAmount("ETHUSDT").String())
+
+	b.ApplyMarkPrice("ETHUSDT", pub.D("2000"), 30) // older
+	mp, _ := b.MarkPrice("ETHUSDT")
+	require.Equal(t, "3050", mp.String())
+
+	// the long position is closed, the short one is not in the event, an older event is ignored
+	b.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":40,"T":40,"a":{"m":"ORDER","P":[
+		{"s":"ETHUSDT","pa":"0","ep":"0","bep":"0","cr":"100","up":"0","mt":"isolated","iw":"0","ps":"LONG"}]}}`))
+	b.Apply(mockapi.AccountUpdate(t, `{"e":"ACCOUNT_UPDATE","E":35,"T":35,"a":{"m":"ORDER","P":[
+		{"s":"ETHUSDT","pa":"3","ep":"3000","bep":"3000","cr":"0","up":"0","mt":"isolated","iw":"900","ps":"LONG"}]}}`))
+	_, ok = b.Get("ETHUSDT", pub.PS_Long)
+	require.False(t, ok)
+	require.Len(t, b.Positions(""), 2)
+
+	// reconciled: BTCUSDT was closed in a gap
+	b.Apply(&streamuserdata.Reconciled{Time: time.UnixMilli(50), Positions: []trade.PositionInfo{
+		{Symbol: "ETHUSDT", PositionSide: "SHORT", PositionAmt: "-1", EntryPrice: "3100", BreakEvenPrice: "3098", MarginType: "isolated", UpdateTime: 30},
+	}})
+	_, ok = b.Get("BTCUSDT", pub.PS_Both)
+	require.False(t, ok)
+	p, ok = b.Get("ETHUSDT", pub.PS_Short)
+	require.True(t, ok)
+	require.Equal(t, "3050", p.MarkPrice.String())
+}
+
+// go test -v -run TestBookLoad
+func TestBookLoad(t *testing.T) {
+	serverNow := time.Now().Add(-time.Hour) // the local clock is ahead
+	pc := mockapi.NewWithClock(t, -time.Hour, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v3/positionRisk":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"symbol": "BTCUSDT", "positionSide": "BOTH", "positionAmt": "-0.5", "entryPrice": "60000", "markPrice": "59000", "unRealizedProfit": "500", "updateTime": 1},
+			})
+		case "/fapi/v1/symbolConfig":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"symbol": "BTCUSDT", "marginType": "CROSSED", "isAutoAddMargin": "false", "leverage": 20, "maxNotionalValue": "5000000"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	require.NoError(t, pc.AdjustTime(context.Background()))
+	b := NewBook(pc)
+	// a position opened just after the snapshot by the server clock arrives first
+	b.Apply(mockapi.AccountUpdate(t, fmt.Sprintf(`{"e":"ACCOUNT_UPDATE","T":%v,"a":{"m":"ORDER","P":[{"s":"ETHUSDT","pa":"1","ep":"3000","ps":"BOTH"}]}}`,
+		serverNow.Add(10*time.Second).UnixMilli())))
+	require.NoError(t, b.Load(context.Background()))
+	p, ok := b.Get("ETHUSDT", pub.PS_Both)
+	require.True(t, ok)
+	require.Equal(t, "1", p.Amount.String()) // kept
+
+	p, ok = b.Get("BTCUSDT", pub.PS_Both)
+	require.True(t, ok)
+	require.Equal(t, "-0.5", p.Amount.String())
+	require.Equal(t, "500", p.UnrealizedPnl.String())
+	require.Equal(t, "-29500", p.Notional().String())
+
+	require.Equal(t, 20, b.Leverage("BTCUSDT"))
+	var u streamuserdata.AccountConfigUpdate
+	require.NoError(t, json.Unmarshal([]byte(`{"e":"ACCOUNT_CONFIG_UPDATE","E":2,"T":2,"ac":{"s":"BTCUSDT","l":25}}`), &u))
+	b.Apply(u)
+	require.Equal(t, 25, b.Leverage("BTCUSDT"))
+	require.Equal(t, 0, b.Leverage("ETHUSDT"))
+}
@@ -0,0 +1,78 @@
+package pub
+
+import (
+	"context"
+	"log"
+	"net/http"
+)
+
+// Client holds the settings of one account/environment: endpoints, http client, recvWindow, key and logger.
+// Several clients can be used in one process, each one talks to binance with its own settings.
+type Client struct {
+	Environment              // REST, spot SAPI and websocket urls
+	HttpClient  *http.Client // http client to send requests
+	RecvWindow  int64        // milliseconds, the request is valid in recvWindow after timestamp
+	Key         *Key         // api key for signed requests, can be nil for market data only
+	Logger      *log.Logger
+	Limiter     *RateLimiter // request weight limiter shared by the copies of WithKey, order counts by api key, nil for no limit
+	TimeSync    *TimeSync    // server clock offset for the timestamp of signed requests, shared by the copies of WithKey
+	Retry       *RetryPolicy // retry policy of transient errors, nil for no retry
+	// OrderGate is checked before the new orders of trade.NewOrder, trade.BatchOrders and wsapi.PlaceOrder are sent,
+	// they are not sent if it returns an error, such as a kill switch. It is copied by WithKey, set it before.
+	OrderGate func(ctx context.Context) error
+}
+
+// DefaultClient is used by the package level functions, such as GetWithSign, GetNoSign.
+var DefaultClient = NewClient(nil)
+
+// NewClient returns a client of binance mainnet with the key.
+func NewClient(key *Key) *Client {
+	return NewEnvClient(Mainnet, key)
+}
+
+// NewEnvClient returns a client of the environment with the key, such as Testnet or a CustomEnv.
+// Its TimeSync syncs with the server before the first signed request, call TimeSync.Start to sync periodically in background.
+func NewEnvClient(env Environment, key *Key) *Client {
+	c := &Client{
+		Environment: env,
+		HttpClient:  http.DefaultClient,
+		RecvWindow:  defaultRecvWindow,
+		Key:         key,
+		Logger:      log.Default(),
+		Limiter:     NewRateLimiter(),
+		Retry:       NewRetryPolicy(),
+	}
+	c.TimeSync = NewTimeSync(c.serverTime)
+	return c
+}
+
+// WithKey returns a copy of the client which uses the key for signed requests.
+func (c *Client) WithKey(key *Key) *Client {
+	cc := *c
+	cc.Key = key
+	return &cc
+}
+
+// CheckOrderGate returns the error of OrderGate, nil if there is no gate.
+func (c *Client) CheckOrderGate(ctx context.Context) error {
+	if c.OrderGate == nil {
+		return nil
+	}
+	return c.OrderGate(ctx)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HttpClient != nil {
+		return c.HttpClient
+	}
+	return http.DefaultClient
+}
+
+// Logf writes log by the client's logger, or the standard logger if it is nil.
+func (c *Client) Logf(format string, v ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
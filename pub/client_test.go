@@ -0,0 +1,81 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestClientGetWithSign
+func TestClientGetWithSign(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serveTime(w, r) {
+			return
+		}
+		assert.Equal(t, "/fapi/v1/test", r.URL.Path)
+		assert.Equal(t, "api-key", r.Header.Get("X-MBX-APIKEY"))
+		assert.Equal(t, "3000", r.URL.Query().Get("recvWindow"))
+		assert.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		assert.NotEmpty(t, r.URL.Query().Get("signature"))
+		w.Write([]byte(`{"symbol":"BTCUSDT"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(&Key{ApiKey: "api-key", SecretKey: "secret"})
+	c.BaseUrl = srv.URL
+	c.RecvWindow = 3000
+	res, err := c.GetWithSign(context.Background(), "/fapi/v1/test", ParamData{"symbol": "BTCUSDT"})
+	require.Nil(t, err)
+	require.Equal(t, `{"symbol":"BTCUSDT"}`, string(res))
+
+	_, err = c.WithKey(nil).GetWithSign(context.Background(), "/fapi/v1/test", nil)
+	require.NotNil(t, err)
+}
+
+// go test -v -run TestEnvClient
+func TestEnvClient(t *testing.T) {
+	c := NewEnvClient(Testnet, nil)
+	require.Equal(t, "https://testnet.binancefuture.com", c.BaseUrl)
+	require.Equal(t, "wss://fstream.binancefuture.com", c.WssUrl)
+
+	env := CustomEnv("mock", "http://127.0.0.1:8080/", "http://127.0.0.1:8081/", "ws://127.0.0.1:8082/", "ws://127.0.0.1:8083/ws-fapi/v1/")
+	c = NewEnvClient(env, nil)
+	require.Equal(t, "http://127.0.0.1:8080", c.BaseUrl)
+	require.Equal(t, "http://127.0.0.1:8081", c.SpotBaseUrl)
+	require.Equal(t, "ws://127.0.0.1:8082", c.WssUrl)
+	require.Equal(t, "ws://127.0.0.1:8083/ws-fapi/v1", c.WsApiUrl)
+}
+
+// go test -v -run TestClientContextTimeout
+func TestClientContextTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(3 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	c := NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "", ""), &Key{ApiKey: "api-key", SecretKey: "secret"})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetNoSign(ctx, "/fapi/v1/time", nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+// serveTime serves /fapi/v1/time by the local clock for the mock servers, the clients sync before the first signed request.
+func serveTime(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Path != "/fapi/v1/time" {
+		return false
+	}
+	fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+	return true
+}
@@ -1,12 +1,18 @@
 package pub
 
 const (
-	futureBaseUrl = "https://fapi.binance.com"
-	spotBaseUrl   = "https://api.binance.com" // api1...., api2...., api3..., api4....
-	futureWssUrl  = "wss://fstream.binance.com"
-
-	recvWindow = "5000"
-	WsChanLen  = 128 // chan lengh for websocket message
+	futureBaseUrl  = "https://fapi.binance.com"
+	spotBaseUrl    = "https://api.binance.com" // api1...., api2...., api3..., api4....
+	futureWssUrl   = "wss://fstream.binance.com"
+	futureWsApiUrl = "wss://ws-fapi.binance.com/ws-fapi/v1"
+
+	testnetFutureBaseUrl  = "https://testnet.binancefuture.com"
+	testnetSpotBaseUrl    = "https://testnet.binance.vision"
+	testnetFutureWssUrl   = "wss://fstream.binancefuture.com"
+	testnetFutureWsApiUrl = "wss://testnet.binancefuture.com/ws-fapi/v1"
+
+	defaultRecvWindow = 5000 // milliseconds
+	WsChanLen         = 128  // chan lengh for websocket message
 )
 
 var TestKey = &Key{
@@ -39,6 +45,19 @@ const (
 	CS_Close          ContractStatus = "CLOSE"
 )
 
+// FilterType is the type of the symbol filters of exchange info.
+type FilterType string
+
+const (
+	FT_Price            FilterType = "PRICE_FILTER"
+	FT_LotSize          FilterType = "LOT_SIZE"
+	FT_MarketLotSize    FilterType = "MARKET_LOT_SIZE"
+	FT_MaxNumOrders     FilterType = "MAX_NUM_ORDERS"
+	FT_MaxNumAlgoOrders FilterType = "MAX_NUM_ALGO_ORDERS"
+	FT_MinNotional      FilterType = "MIN_NOTIONAL"
+	FT_PercentPrice     FilterType = "PERCENT_PRICE"
+)
+
 type OrderStatus string
 
 const (
@@ -48,6 +67,28 @@ const (
 	OS_Canceled        OrderStatus = "CANCELED"
 	OS_Rejected        OrderStatus = "REJECTED"
 	OS_Expired         OrderStatus = "EXPIRED"
+	OS_ExpiredInMatch  OrderStatus = "EXPIRED_IN_MATCH" // expired by self-trade prevention
+)
+
+// IsFinal reports whether the order is closed, it does not change any more.
+func (s OrderStatus) IsFinal() bool {
+	switch s {
+	case OS_Filled, OS_Canceled, OS_Rejected, OS_Expired, OS_ExpiredInMatch:
+		return true
+	}
+	return false
+}
+
+// ExecutionType is the execution type of ORDER_TRADE_UPDATE.
+type ExecutionType string
+
+const (
+	ET_New        ExecutionType = "NEW"
+	ET_Canceled   ExecutionType = "CANCELED"
+	ET_Calculated ExecutionType = "CALCULATED" // liquidation execution
+	ET_Expired    ExecutionType = "EXPIRED"
+	ET_Trade      ExecutionType = "TRADE"
+	ET_Amendment  ExecutionType = "AMENDMENT" // order modified
 )
 
 type OrderType string
@@ -173,3 +214,26 @@ const (
 	IT_CoinSwapWithdraw         IncomeType = "COIN_SWAP_WITHDRAW"
 	IT_PositionLimitIncreaseFee IncomeType = "POSITION_LIMIT_INCREASE_FEE"
 )
+
+// UpdateReason is the event reason type of ACCOUNT_UPDATE.
+type UpdateReason string
+
+const (
+	UR_Deposit             UpdateReason = "DEPOSIT"
+	UR_Withdraw            UpdateReason = "WITHDRAW"
+	UR_Order               UpdateReason = "ORDER"
+	UR_FundingFee          UpdateReason = "FUNDING_FEE"
+	UR_WithdrawReject      UpdateReason = "WITHDRAW_REJECT"
+	UR_Adjustment          UpdateReason = "ADJUSTMENT"
+	UR_InsuranceClear      UpdateReason = "INSURANCE_CLEAR"
+	UR_AdminDeposit        UpdateReason = "ADMIN_DEPOSIT"
+	UR_AdminWithdraw       UpdateReason = "ADMIN_WITHDRAW"
+	UR_MarginTransfer      UpdateReason = "MARGIN_TRANSFER"
+	UR_MarginTypeChange    UpdateReason = "MARGIN_TYPE_CHANGE"
+	UR_AssetTransfer       UpdateReason = "ASSET_TRANSFER"
+	UR_OptionsPremiumFee   UpdateReason = "OPTIONS_PREMIUM_FEE"
+	UR_OptionsSettleProfit UpdateReason = "OPTIONS_SETTLE_PROFIT"
+	UR_AutoExchange        UpdateReason = "AUTO_EXCHANGE"
+	UR_CoinSwapDeposit     UpdateReason = "COIN_SWAP_DEPOSIT"
+	UR_CoinSwapWithdraw    UpdateReason = "COIN_SWAP_WITHDRAW"
+)
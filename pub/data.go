@@ -3,7 +3,9 @@ package pub
 type Key struct {
 	UserId    int64 // any id to identify this user key paire
 	ApiKey    string
-	SecretKey string
+	SecretKey string  // HMAC secret key, or PEM of the RSA/Ed25519 private key
+	KeyType   KeyType // KT_HMAC if empty
+	Signer    Signer  // signs the requests if not nil, such as a signer whose private key is kept in an HSM
 }
 
 type ErrMsg struct {
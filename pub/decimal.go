@@ -0,0 +1,410 @@
+package pub
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is a fixed-point decimal number for prices, quantities and amounts: value = unscaled * 10^-scale.
+// It is parsed from the string numbers of binance without float rounding, the zero value is 0.
+// Decimal is immutable, the methods return new values.
+type Decimal struct {
+	unscaled *big.Int // nil is 0
+	scale    int32    // digits after the decimal point, >= 0
+}
+
+// RoundingMode is the rounding of Decimal to a scale or a step.
+type RoundingMode int
+
+const (
+	RM_Down   RoundingMode = iota // toward zero, such as quantities which must not exceed the balance
+	RM_Up                         // away from zero
+	RM_Floor                      // toward negative infinity, such as buy prices
+	RM_Ceil                       // toward positive infinity, such as sell prices
+	RM_HalfUp                     // to nearest, half away from zero
+)
+
+var bigTen = big.NewInt(10)
+
+// maxExponent bounds the exponent of ParseDecimal, a huge one like "1e9999999" takes seconds and lots of memory.
+const maxExponent = 1000
+
+// NewDecimal returns unscaled * 10^-scale.
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	if scale < 0 {
+		return Decimal{unscaled: new(big.Int).Mul(big.NewInt(unscaled), pow10(-scale))}
+	}
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// NewDecimalFromInt returns the integer i.
+func NewDecimalFromInt(i int64) Decimal {
+	return NewDecimal(i, 0)
+}
+
+// NewDecimalFromFloat returns the shortest decimal which converts back to f, NaN and Inf are 0.
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+// ParseDecimal parses a decimal string like "-123.4500", "1e-8", an empty string is 0.
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return Decimal{}, nil
+	}
+
+	var exp int64
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(str[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("ParseDecimal: invalid exponent %q", s)
+		}
+		if e > maxExponent || e < -maxExponent {
+			return Decimal{}, fmt.Errorf("ParseDecimal: exponent out of range %q", s)
+		}
+		exp = e
+		str = str[:i]
+	}
+
+	digits := str
+	var scale int64
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		digits = str[:i] + str[i+1:]
+		scale = int64(len(str) - i - 1)
+	}
+	if digits == "" || digits == "-" || digits == "+" || strings.ContainsAny(digits[1:], "+-") {
+		return Decimal{}, fmt.Errorf("ParseDecimal: invalid decimal %q", s)
+	}
+	unscaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("ParseDecimal: invalid decimal %q", s)
+	}
+
+	scale -= exp
+	if scale > math.MaxInt32 {
+		return Decimal{}, fmt.Errorf("ParseDecimal: scale out of range %q", s)
+	}
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(int32(-scale)))
+		scale = 0
+	}
+	return Decimal{unscaled: unscaled, scale: int32(scale)}, nil
+}
+
+// MustDecimal parses s and panics if s is invalid, for constants.
+func MustDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// D parses s and returns 0 if s is invalid, for the string numbers of binance responses.
+func D(s string) Decimal {
+	d, _ := ParseDecimal(s)
+	return d
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// rescale returns the unscaled value at the scale, which must not be less than d.scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.int()
+	}
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+func align(a, b Decimal) (x, y *big.Int, scale int32) {
+	scale = a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return a.rescale(scale), b.rescale(scale), scale
+}
+
+// Scale returns the digits after the decimal point.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+func (d Decimal) Add(d2 Decimal) Decimal {
+	x, y, scale := align(d, d2)
+	return Decimal{unscaled: new(big.Int).Add(x, y), scale: scale}
+}
+
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	x, y, scale := align(d, d2)
+	return Decimal{unscaled: new(big.Int).Sub(x, y), scale: scale}
+}
+
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), d2.int()), scale: d.scale + d2.scale}
+}
+
+// Div returns d / d2 rounded to the scale by RM_HalfUp, it panics if d2 is 0.
+func (d Decimal) Div(d2 Decimal, scale int32) Decimal {
+	return d.DivRound(d2, scale, RM_HalfUp)
+}
+
+// DivRound returns d / d2 rounded to the scale by the mode, it panics if d2 is 0.
+func (d Decimal) DivRound(d2 Decimal, scale int32, mode RoundingMode) Decimal {
+	if d2.IsZero() {
+		panic("Decimal: division by zero")
+	}
+	// d / d2 = (a * 10^-sa) / (b * 10^-sb) = a * 10^(scale-sa+sb) / b * 10^-scale
+	num := d.int()
+	den := d2.int()
+	if shift := scale - d.scale + d2.scale; shift >= 0 {
+		num = new(big.Int).Mul(num, pow10(shift))
+	} else {
+		den = new(big.Int).Mul(den, pow10(-shift))
+	}
+	if scale < 0 {
+		q := divRound(num, den, mode)
+		return Decimal{unscaled: q.Mul(q, pow10(-scale))}
+	}
+	return Decimal{unscaled: divRound(num, den, mode), scale: scale}
+}
+
+// divRound returns num / den rounded by the mode.
+func divRound(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	// the sign of the exact quotient
+	positive := (num.Sign() > 0) == (den.Sign() > 0)
+	awayFromZero := false
+	switch mode {
+	case RM_Up:
+		awayFromZero = true
+	case RM_Floor:
+		awayFromZero = !positive
+	case RM_Ceil:
+		awayFromZero = positive
+	case RM_HalfUp:
+		r2 := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2))
+		awayFromZero = r2.Cmp(new(big.Int).Abs(den)) >= 0
+	}
+	if awayFromZero {
+		if positive {
+			q.Add(q, big.NewInt(1))
+		} else {
+			q.Sub(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{unscaled: new(big.Int).Abs(d.int()), scale: d.scale}
+}
+
+// Cmp returns -1, 0, 1 if d < d2, d == d2, d > d2.
+func (d Decimal) Cmp(d2 Decimal) int {
+	x, y, _ := align(d, d2)
+	return x.Cmp(y)
+}
+
+// Sign returns -1, 0, 1 if d < 0, d == 0, d > 0.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+func (d Decimal) IsZero() bool                   { return d.Sign() == 0 }
+func (d Decimal) IsPositive() bool               { return d.Sign() > 0 }
+func (d Decimal) IsNegative() bool               { return d.Sign() < 0 }
+func (d Decimal) Equal(d2 Decimal) bool          { return d.Cmp(d2) == 0 }
+func (d Decimal) LessThan(d2 Decimal) bool       { return d.Cmp(d2) < 0 }
+func (d Decimal) LessOrEqual(d2 Decimal) bool    { return d.Cmp(d2) <= 0 }
+func (d Decimal) GreaterThan(d2 Decimal) bool    { return d.Cmp(d2) > 0 }
+func (d Decimal) GreaterOrEqual(d2 Decimal) bool { return d.Cmp(d2) >= 0 }
+
+// Min returns the smaller one of d and d2.
+func (d Decimal) Min(d2 Decimal) Decimal {
+	if d.Cmp(d2) <= 0 {
+		return d
+	}
+	return d2
+}
+
+// Max returns the larger one of d and d2.
+func (d Decimal) Max(d2 Decimal) Decimal {
+	if d.Cmp(d2) >= 0 {
+		return d
+	}
+	return d2
+}
+
+// Round rounds d to the scale by the mode, a negative scale rounds to tens, hundreds and so on, such as -2 to 1200.
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return d
+	}
+	q := divRound(d.int(), pow10(d.scale-scale), mode)
+	if scale < 0 { // the scale is kept >= 0
+		return Decimal{unscaled: q.Mul(q, pow10(-scale))}
+	}
+	return Decimal{unscaled: q, scale: scale}
+}
+
+// Truncate rounds d toward zero to the scale.
+func (d Decimal) Truncate(scale int32) Decimal {
+	return d.Round(scale, RM_Down)
+}
+
+// RoundToStep rounds d to a multiple of step by the mode, such as tickSize of price and stepSize of quantity.
+// d is returned if step is not positive.
+func (d Decimal) RoundToStep(step Decimal, mode RoundingMode) Decimal {
+	if step.Sign() <= 0 {
+		return d
+	}
+	x, y, scale := align(d, step)
+	q := divRound(x, y, mode)
+	return Decimal{unscaled: q.Mul(q, y), scale: scale}
+}
+
+// IsMultipleOf reports whether d is a multiple of step, true if step is not positive.
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	if step.Sign() <= 0 {
+		return true
+	}
+	x, y, _ := align(d, step)
+	return new(big.Int).Rem(x, y).Sign() == 0
+}
+
+// Float64 returns the nearest float64 of d.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// IntPart returns the integer part of d, truncated toward zero.
+func (d Decimal) IntPart() int64 {
+	return d.Truncate(0).int().Int64()
+}
+
+// String returns d without exponent and trailing zeros, such as "0.01", "-3".
+func (d Decimal) String() string {
+	s := d.StringFixed(d.scale)
+	if d.scale > 0 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// StringFixed returns d rounded by RM_HalfUp with scale digits after the decimal point, such as "0.0100".
+func (d Decimal) StringFixed(scale int32) string {
+	if scale < 0 {
+		scale = 0
+	}
+	r := d.Round(scale, RM_HalfUp)
+	abs := new(big.Int).Abs(r.int()).String()
+	n := int(r.scale)
+	if len(abs) <= n {
+		abs = strings.Repeat("0", n-len(abs)+1) + abs
+	}
+	s := abs
+	if n > 0 {
+		s = abs[:len(abs)-n] + "." + abs[len(abs)-n:]
+	}
+	if pad := int(scale - r.scale); pad > 0 {
+		if n == 0 {
+			s += "."
+		}
+		s += strings.Repeat("0", pad)
+	}
+	if r.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalJSON encodes d to a JSON string like binance, such as "0.01".
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON decodes a JSON string or number, null and "" are 0.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		*d = Decimal{}
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalText(b []byte) error {
+	v, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// PriceLevel is a price and quantity of the order book.
+type PriceLevel struct {
+	Price Decimal
+	Qty   Decimal
+}
+
+// ParsePriceLevels parses the [][price, qty] levels of order book and depth updates.
+func ParsePriceLevels(levels [][]string) ([]PriceLevel, error) {
+	pls := make([]PriceLevel, len(levels))
+	for i, level := range levels {
+		if len(level) < 2 {
+			return nil, fmt.Errorf("ParsePriceLevels: invalid level %v", level)
+		}
+		price, err := ParseDecimal(level[0])
+		if err != nil {
+			return nil, err
+		}
+		qty, err := ParseDecimal(level[1])
+		if err != nil {
+			return nil, err
+		}
+		pls[i] = PriceLevel{Price: price, Qty: qty}
+	}
+	return pls, nil
+}
@@ -0,0 +1,142 @@
+package pub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestParseDecimal
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0", "0"},
+		{"", "0"},
+		{"0.00000000", "0"},
+		{"-0.0", "0"},
+		{"123.4500", "123.45"},
+		{"-0.001", "-0.001"},
+		{".5", "0.5"},
+		{"+7", "7"},
+		{"1e-8", "0.00000001"},
+		{"1.5E3", "1500"},
+		{"12345678901234567890.123456789", "12345678901234567890.123456789"},
+	}
+	for _, tt := range tests {
+		d, err := ParseDecimal(tt.in)
+		require.NoError(t, err, tt.in)
+		require.Equal(t, tt.want, d.String(), tt.in)
+	}
+
+	for _, in := range []string{"abc", ".", "-", "1.2.3", "1-2", "1e", "0x10", "1 2", "1e9999999", "1.5e-2147483647", "1e-1001"} {
+		_, err := ParseDecimal(in)
+		require.Error(t, err, in)
+	}
+	require.True(t, D("bad").IsZero())
+}
+
+// go test -v -run TestDecimalArithmetic
+func TestDecimalArithmetic(t *testing.T) {
+	a, b := MustDecimal("0.1"), MustDecimal("0.2")
+	require.Equal(t, "0.3", a.Add(b).String()) // 0.1 + 0.2 != 0.3 in float64
+	require.Equal(t, "-0.1", a.Sub(b).String())
+	require.Equal(t, "0.02", a.Mul(b).String())
+	require.Equal(t, "0.5", a.Div(b, 8).String())
+	require.Equal(t, "0.33333333", MustDecimal("1").Div(MustDecimal("3"), 8).String())
+	require.Equal(t, "0.66666667", MustDecimal("2").Div(MustDecimal("3"), 8).String())
+	require.Equal(t, "-0.66666666", MustDecimal("-2").DivRound(MustDecimal("3"), 8, RM_Down).String())
+	require.Equal(t, "1500", MustDecimal("15").Div(MustDecimal("0.01"), 0).String())
+	require.Panics(t, func() { a.Div(Decimal{}, 2) })
+
+	require.True(t, a.LessThan(b))
+	require.True(t, b.GreaterThan(a))
+	require.True(t, MustDecimal("1.10").Equal(MustDecimal("1.1")))
+	require.Equal(t, 0, Decimal{}.Cmp(MustDecimal("0.000")))
+	require.Equal(t, "0.1", a.Min(b).String())
+	require.Equal(t, "0.2", a.Max(b).String())
+	require.Equal(t, "0.1", a.Neg().Abs().String())
+	require.Equal(t, int64(-12), MustDecimal("-12.9").IntPart())
+	require.Equal(t, 0.3, a.Add(b).Float64())
+	require.Equal(t, "0.3", NewDecimalFromFloat(0.3).String())
+	require.Equal(t, "1.23", NewDecimal(123, 2).String())
+	require.Equal(t, "12300", NewDecimal(123, -2).String())
+}
+
+// go test -v -run TestDecimalRound
+func TestDecimalRound(t *testing.T) {
+	tests := []struct {
+		in, step string
+		mode     RoundingMode
+		want     string
+	}{
+		{"30000.17", "0.1", RM_Down, "30000.1"},
+		{"30000.17", "0.1", RM_Up, "30000.2"},
+		{"30000.15", "0.1", RM_HalfUp, "30000.2"},
+		{"30000.14", "0.1", RM_HalfUp, "30000.1"},
+		{"-1.25", "0.1", RM_Floor, "-1.3"},
+		{"-1.25", "0.1", RM_Ceil, "-1.2"},
+		{"-1.25", "0.1", RM_Down, "-1.2"},
+		{"-1.25", "0.1", RM_HalfUp, "-1.3"},
+		{"0.0123456", "0.001", RM_Down, "0.012"},
+		{"7.3", "0.5", RM_Floor, "7"},
+		{"7.3", "0.5", RM_Ceil, "7.5"},
+		{"1234", "10", RM_Down, "1230"},
+		{"0.01", "0.001", RM_Down, "0.01"},
+		{"5", "0", RM_Down, "5"},
+	}
+	for _, tt := range tests {
+		got := MustDecimal(tt.in).RoundToStep(MustDecimal(tt.step), tt.mode)
+		require.Equal(t, tt.want, got.String(), "%v %v %v", tt.in, tt.step, tt.mode)
+		require.True(t, got.IsMultipleOf(MustDecimal(tt.step)))
+	}
+	require.False(t, MustDecimal("0.0125").IsMultipleOf(MustDecimal("0.001")))
+
+	d := MustDecimal("2.345")
+	require.Equal(t, "2.35", d.Round(2, RM_HalfUp).String())
+	require.Equal(t, "2.34", d.Truncate(2).String())
+	r := MustDecimal("1250.5").Round(-2, RM_HalfUp)
+	require.Equal(t, "1300", r.String())
+	require.Equal(t, "1300.00", r.StringFixed(2))
+	require.True(t, r.Equal(MustDecimal("1300")))
+	require.Equal(t, "-1200", MustDecimal("-1250").Round(-2, RM_Down).String())
+	require.Equal(t, "300", MustDecimal("1000").DivRound(MustDecimal("3"), -2, RM_HalfUp).String())
+	require.Equal(t, "2.3450", d.StringFixed(4))
+	require.Equal(t, "2.35", d.StringFixed(2))
+	require.Equal(t, "2", d.StringFixed(0))
+	require.Equal(t, "-0.050", MustDecimal("-0.05").StringFixed(3))
+	require.Equal(t, "3.00", NewDecimalFromInt(3).StringFixed(2))
+}
+
+// go test -v -run TestDecimalJSON
+func TestDecimalJSON(t *testing.T) {
+	var v struct {
+		Price  Decimal  `json:"price"`
+		Qty    Decimal  `json:"qty"`
+		Empty  Decimal  `json:"empty"`
+		Null   Decimal  `json:"null"`
+		Option *Decimal `json:"option,omitempty"`
+	}
+	err := json.Unmarshal([]byte(`{"price":"30000.10","qty":0.001,"empty":"","null":null}`), &v)
+	require.NoError(t, err)
+	require.Equal(t, "30000.1", v.Price.String())
+	require.Equal(t, "0.001", v.Qty.String())
+	require.True(t, v.Empty.IsZero())
+	require.True(t, v.Null.IsZero())
+
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, `{"price":"30000.1","qty":"0.001","empty":"0","null":"0"}`, string(b))
+
+	require.Error(t, json.Unmarshal([]byte(`{"price":"abc"}`), &v))
+
+	type param struct {
+		Price Decimal `json:"price,omitempty"`
+		Qty   Decimal `json:"quantity"`
+	}
+	query, err := EncodeParamsQuery(&param{Price: MustDecimal("0.10"), Qty: MustDecimal("1e-3")})
+	require.NoError(t, err)
+	require.Equal(t, "price=0.1&quantity=0.001", query)
+}
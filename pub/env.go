@@ -0,0 +1,50 @@
+package pub
+
+import "strings"
+
+// Environment is the set of endpoints of one binance deployment.
+// REST, spot SAPI and websocket urls always come from the same environment.
+type Environment struct {
+	Name        string // "mainnet", "testnet" or any name of a custom environment
+	BaseUrl     string // future REST base url, "https://fapi.binance.com"
+	SpotBaseUrl string // spot SAPI base url, "https://api.binance.com"
+	WssUrl      string // future websocket base url, "wss://fstream.binance.com"
+	WsApiUrl    string // future websocket api url, "wss://ws-fapi.binance.com/ws-fapi/v1"
+}
+
+var Mainnet = Environment{
+	Name:        "mainnet",
+	BaseUrl:     futureBaseUrl,
+	SpotBaseUrl: spotBaseUrl,
+	WssUrl:      futureWssUrl,
+	WsApiUrl:    futureWsApiUrl,
+}
+
+// Testnet is the usd-margined future testnet, https://testnet.binancefuture.com
+var Testnet = Environment{
+	Name:        "testnet",
+	BaseUrl:     testnetFutureBaseUrl,
+	SpotBaseUrl: testnetSpotBaseUrl,
+	WssUrl:      testnetFutureWssUrl,
+	WsApiUrl:    testnetFutureWsApiUrl,
+}
+
+// CustomEnv returns an environment of regional endpoints, proxies or local mock servers.
+// The trailing "/" of the urls are removed. wsApiUrl is the full websocket api url,
+// such as wss://ws-fapi.binance.com/ws-fapi/v1, empty if the websocket api is not used.
+func CustomEnv(name, baseUrl, spotBaseUrl, wssUrl, wsApiUrl string) Environment {
+	return Environment{
+		Name:        name,
+		BaseUrl:     strings.TrimRight(baseUrl, "/"),
+		SpotBaseUrl: strings.TrimRight(spotBaseUrl, "/"),
+		WssUrl:      strings.TrimRight(wssUrl, "/"),
+		WsApiUrl:    strings.TrimRight(wsApiUrl, "/"),
+	}
+}
+
+// SetEnvironment switches DefaultClient, which is used by all package level functions, to the environment.
+// It is not synchronized with the requests: call it once at startup, before any request or connection,
+// and use NewEnvClient for the clients of other environments.
+func SetEnvironment(env Environment) {
+	DefaultClient.Environment = env
+}
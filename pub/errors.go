@@ -0,0 +1,278 @@
+package pub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned by all REST calls when binance responds an error code or a http error status.
+// Use errors.As to get it, or the helpers IsRetryable, IsRateLimited, IsInsufficientMargin.
+type APIError struct {
+	StatusCode int         // http status code, 400, 418, 429, 5xx, ...
+	Code       int         // binance error code, -2019, -1021, ..., 0 if the body is not a binance error message
+	Msg        string      // binance error message, or the beginning of the body if it is not a binance error message
+	Method     string      // http method
+	Endpoint   string      // request path without query string, "/fapi/v1/order"
+	Header     http.Header // response headers, such as Retry-After, X-MBX-USED-WEIGHT-1M
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("binance api error: %v %v, http status %v, code %v, msg: %v", e.Method, e.Endpoint, e.StatusCode, e.Code, e.Msg)
+}
+
+// ErrMsg returns the binance code and message of the error.
+func (e *APIError) ErrMsg() ErrMsg {
+	return ErrMsg{Code: e.Code, Msg: e.Msg}
+}
+
+// Binance future error codes
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/error-code
+const (
+	EC_Unknown                         = -1000 // An unknown error occurred while processing the request.
+	EC_Disconnected                    = -1001 // Internal error; unable to process your request. Please try again.
+	EC_Unauthorized                    = -1002 // You are not authorized to execute this request.
+	EC_TooManyRequests                 = -1003 // Too many requests; current limit is %s requests per minute.
+	EC_DuplicateIp                     = -1004 // This IP is already on the white list
+	EC_NoSuchIp                        = -1005 // No such IP has been white listed
+	EC_UnexpectedResp                  = -1006 // An unexpected response was received from the message bus. Execution status unknown.
+	EC_Timeout                         = -1007 // Timeout waiting for response from backend server. Send status unknown; execution status unknown.
+	EC_ServerBusy                      = -1008 // Server is currently overloaded with other requests. Please try again in a few minutes.
+	EC_TooManyOrders                   = -1015 // Too many new orders; current limit is %s orders per %s.
+	EC_ServiceShuttingDown             = -1016 // This service is no longer available.
+	EC_UnsupportedOperation            = -1020 // This operation is not supported.
+	EC_InvalidTimestamp                = -1021 // Timestamp for this request is outside of the recvWindow.
+	EC_InvalidSignature                = -1022 // Signature for this request is not valid.
+	EC_IllegalChars                    = -1100 // Illegal characters found in a parameter.
+	EC_TooManyParameters               = -1101 // Too many parameters sent for this endpoint.
+	EC_MandatoryParamMissing           = -1102 // A mandatory parameter was not sent, was empty/null, or malformed.
+	EC_UnknownParam                    = -1103 // An unknown parameter was sent.
+	EC_UnreadParameters                = -1104 // Not all sent parameters were read.
+	EC_ParamEmpty                      = -1105 // A parameter was empty.
+	EC_ParamNotRequired                = -1106 // A parameter was sent when not required.
+	EC_BadPrecision                    = -1111 // Precision is over the maximum defined for this asset.
+	EC_InvalidTif                      = -1115 // Invalid timeInForce.
+	EC_InvalidOrderType                = -1116 // Invalid orderType.
+	EC_InvalidSide                     = -1117 // Invalid side.
+	EC_BadSymbol                       = -1121 // Invalid symbol.
+	EC_InvalidListenKey                = -1125 // This listenKey does not exist.
+	EC_InvalidParameter                = -1130 // Data sent for parameter is not valid.
+	EC_NewOrderRejected                = -2010 // New order rejected.
+	EC_CancelRejected                  = -2011 // Cancel rejected.
+	EC_NoSuchOrder                     = -2013 // Order does not exist.
+	EC_BadApiKeyFmt                    = -2014 // API-key format invalid.
+	EC_RejectedMbxKey                  = -2015 // Invalid API-key, IP, or permissions for action.
+	EC_NoTradingWindow                 = -2016 // No trading window could be found for the symbol.
+	EC_BalanceNotSufficient            = -2018 // Balance is insufficient.
+	EC_MarginNotSufficient             = -2019 // Margin is insufficient.
+	EC_UnableToFill                    = -2020 // Unable to fill.
+	EC_OrderWouldImmediatelyTrigger    = -2021 // Order would immediately trigger.
+	EC_ReduceOnlyReject                = -2022 // ReduceOnly Order is rejected.
+	EC_UserInLiquidation               = -2023 // User in liquidation mode now.
+	EC_PositionNotSufficient           = -2024 // Position is not sufficient.
+	EC_MaxOpenOrderExceeded            = -2025 // Reach max open order limit.
+	EC_ReduceOnlyOrderTypeNotSupported = -2026 // This OrderType is not supported when reduceOnly.
+	EC_MaxLeverageRatio                = -2027 // Exceeded the maximum allowable position at current leverage.
+	EC_MinLeverageRatio                = -2028 // Leverage is smaller than permitted: insufficient margin balance.
+	EC_InvalidOrderStatus              = -4000 // Invalid order status.
+	EC_PriceLessThanZero               = -4001 // Price less than 0.
+	EC_PriceGreaterThanMaxPrice        = -4002 // Price greater than max price.
+	EC_QtyLessThanZero                 = -4003 // Quantity less than zero.
+	EC_QtyLessThanMinQty               = -4004 // Quantity less than min quantity.
+	EC_QtyGreaterThanMaxQty            = -4005 // Quantity greater than max quantity.
+	EC_PriceLessThanMinPrice           = -4013 // Price less than min price.
+	EC_InvalidTickSize                 = -4014 // Price not increased by tick size.
+	EC_InvalidStepSize                 = -4023 // Qty not increased by step size.
+	EC_NoNeedToChangeMarginType        = -4046 // No need to change margin type.
+	EC_NoNeedToChangePositionSide      = -4059 // No need to change position side.
+	EC_PositionSideNotMatch            = -4061 // Order's position side does not match user's setting.
+	EC_PriceHigherThanMultiplierUp     = -4016 // Price is higher than mark price multiplier cap.
+	EC_PriceLowerThanMultiplierDown    = -4024 // Price is lower than mark price multiplier floor.
+	EC_DuplicateClientOrderId          = -4116 // ClientOrderId is duplicated.
+	EC_MarketOrderReject               = -4131 // The counterparty's best price does not meet the PERCENT_PRICE filter limit.
+	EC_MinNotional                     = -4164 // Order's notional must be no smaller than the min notional.
+	EC_FokOrderReject                  = -5021 // Due to the order could not be filled immediately, the FOK order has been rejected.
+	EC_GtxOrderReject                  = -5022 // Due to the order could not be executed as maker, the Post Only order will be rejected.
+)
+
+// ErrorCodeName returns the name of known binance error code, such as "MARGIN_NOT_SUFFICIENT", or "" if unknown.
+func ErrorCodeName(code int) string {
+	return errorCodeNames[code]
+}
+
+var errorCodeNames = map[int]string{
+	EC_Unknown:                         "UNKNOWN",
+	EC_Disconnected:                    "DISCONNECTED",
+	EC_Unauthorized:                    "UNAUTHORIZED",
+	EC_TooManyRequests:                 "TOO_MANY_REQUESTS",
+	EC_DuplicateIp:                     "DUPLICATE_IP",
+	EC_NoSuchIp:                        "NO_SUCH_IP",
+	EC_UnexpectedResp:                  "UNEXPECTED_RESP",
+	EC_Timeout:                         "TIMEOUT",
+	EC_ServerBusy:                      "SERVER_BUSY",
+	EC_TooManyOrders:                   "TOO_MANY_ORDERS",
+	EC_ServiceShuttingDown:             "SERVICE_SHUTTING_DOWN",
+	EC_UnsupportedOperation:            "UNSUPPORTED_OPERATION",
+	EC_InvalidTimestamp:                "INVALID_TIMESTAMP",
+	EC_InvalidSignature:                "INVALID_SIGNATURE",
+	EC_IllegalChars:                    "ILLEGAL_CHARS",
+	EC_TooManyParameters:               "TOO_MANY_PARAMETERS",
+	EC_MandatoryParamMissing:           "MANDATORY_PARAM_EMPTY_OR_MALFORMED",
+	EC_UnknownParam:                    "UNKNOWN_PARAM",
+	EC_UnreadParameters:                "UNREAD_PARAMETERS",
+	EC_ParamEmpty:                      "PARAM_EMPTY",
+	EC_ParamNotRequired:                "PARAM_NOT_REQUIRED",
+	EC_BadPrecision:                    "BAD_PRECISION",
+	EC_InvalidTif:                      "INVALID_TIF",
+	EC_InvalidOrderType:                "INVALID_ORDER_TYPE",
+	EC_InvalidSide:                     "INVALID_SIDE",
+	EC_BadSymbol:                       "BAD_SYMBOL",
+	EC_InvalidListenKey:                "INVALID_LISTEN_KEY",
+	EC_InvalidParameter:                "INVALID_PARAMETER",
+	EC_NewOrderRejected:                "NEW_ORDER_REJECTED",
+	EC_CancelRejected:                  "CANCEL_REJECTED",
+	EC_NoSuchOrder:                     "NO_SUCH_ORDER",
+	EC_BadApiKeyFmt:                    "BAD_API_KEY_FMT",
+	EC_RejectedMbxKey:                  "REJECTED_MBX_KEY",
+	EC_NoTradingWindow:                 "NO_TRADING_WINDOW",
+	EC_BalanceNotSufficient:            "BALANCE_NOT_SUFFICIENT",
+	EC_MarginNotSufficient:             "MARGIN_NOT_SUFFICIENT",
+	EC_UnableToFill:                    "UNABLE_TO_FILL",
+	EC_OrderWouldImmediatelyTrigger:    "ORDER_WOULD_IMMEDIATELY_TRIGGER",
+	EC_ReduceOnlyReject:                "REDUCE_ONLY_REJECT",
+	EC_UserInLiquidation:               "USER_IN_LIQUIDATION",
+	EC_PositionNotSufficient:           "POSITION_NOT_SUFFICIENT",
+	EC_MaxOpenOrderExceeded:            "MAX_OPEN_ORDER_EXCEEDED",
+	EC_ReduceOnlyOrderTypeNotSupported: "REDUCE_ONLY_ORDER_TYPE_NOT_SUPPORTED",
+	EC_MaxLeverageRatio:                "MAX_LEVERAGE_RATIO",
+	EC_MinLeverageRatio:                "MIN_LEVERAGE_RATIO",
+	EC_InvalidOrderStatus:              "INVALID_ORDER_STATUS",
+	EC_PriceLessThanZero:               "PRICE_LESS_THAN_ZERO",
+	EC_PriceGreaterThanMaxPrice:        "PRICE_GREATER_THAN_MAX_PRICE",
+	EC_QtyLessThanZero:                 "QTY_LESS_THAN_ZERO",
+	EC_QtyLessThanMinQty:               "QTY_LESS_THAN_MIN_QTY",
+	EC_QtyGreaterThanMaxQty:            "QTY_GREATER_THAN_MAX_QTY",
+	EC_PriceLessThanMinPrice:           "PRICE_LESS_THAN_MIN_PRICE",
+	EC_InvalidTickSize:                 "PRICE_NOT_INCREASED_BY_TICK_SIZE",
+	EC_InvalidStepSize:                 "QTY_NOT_INCREASED_BY_STEP_SIZE",
+	EC_NoNeedToChangeMarginType:        "NO_NEED_TO_CHANGE_MARGIN_TYPE",
+	EC_NoNeedToChangePositionSide:      "NO_NEED_TO_CHANGE_POSITION_SIDE",
+	EC_PositionSideNotMatch:            "POSITION_SIDE_NOT_MATCH",
+	EC_PriceHigherThanMultiplierUp:     "PRICE_HIGHTER_THAN_MULTIPLIER_UP",
+	EC_PriceLowerThanMultiplierDown:    "PRICE_LOWER_THAN_MULTIPLIER_DOWN",
+	EC_DuplicateClientOrderId:          "DUPLICATE_CLIENT_ORDER_ID",
+	EC_MarketOrderReject:               "MARKET_ORDER_REJECT",
+	EC_MinNotional:                     "MIN_NOTIONAL",
+	EC_FokOrderReject:                  "FOK_ORDER_REJECT",
+	EC_GtxOrderReject:                  "GTX_ORDER_REJECT",
+}
+
+// AsAPIError returns the *APIError in the err chain.
+func AsAPIError(err error) (*APIError, bool) {
+	var e *APIError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// IsRetryable reports whether the request failed at binance side and may succeed if it is sent again,
+// such as 5xx http status, -1001 disconnected, -1006/-1007 unknown status, -1008 server busy.
+// Order creating requests with unknown status must be checked before retry, the order may have been accepted.
+func IsRetryable(err error) bool {
+	e, ok := AsAPIError(err)
+	if !ok {
+		return false
+	}
+	switch e.Code {
+	case EC_Disconnected, EC_UnexpectedResp, EC_Timeout, EC_ServerBusy:
+		return true
+	}
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+// IsUnknownStatus reports whether the execution status of the request is unknown, -1006 or -1007.
+func IsUnknownStatus(err error) bool {
+	e, ok := AsAPIError(err)
+	return ok && (e.Code == EC_UnexpectedResp || e.Code == EC_Timeout)
+}
+
+// IsRateLimited reports whether the request is rejected by the request weight or order count limits,
+// http 429, 418 (ip banned), -1003, -1015, or by the client side RateLimiter.
+func IsRateLimited(err error) bool {
+	var rlErr *RateLimitError
+	if errors.As(err, &rlErr) {
+		return true
+	}
+	e, ok := AsAPIError(err)
+	if !ok {
+		return false
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusTeapot ||
+		e.Code == EC_TooManyRequests || e.Code == EC_TooManyOrders
+}
+
+// IsIpBanned reports whether the ip is banned by binance, http 418.
+func IsIpBanned(err error) bool {
+	e, ok := AsAPIError(err)
+	return ok && e.StatusCode == http.StatusTeapot
+}
+
+// IsInsufficientMargin reports whether the order is rejected because of the margin or balance, -2019 or -2018.
+func IsInsufficientMargin(err error) bool {
+	e, ok := AsAPIError(err)
+	return ok && (e.Code == EC_MarginNotSufficient || e.Code == EC_BalanceNotSufficient)
+}
+
+// IsTimestampError reports whether the timestamp of the request is outside of the recvWindow, -1021.
+func IsTimestampError(err error) bool {
+	e, ok := AsAPIError(err)
+	return ok && e.Code == EC_InvalidTimestamp
+}
+
+// IsNoSuchOrder reports whether the order does not exist, -2013.
+func IsNoSuchOrder(err error) bool {
+	e, ok := AsAPIError(err)
+	return ok && e.Code == EC_NoSuchOrder
+}
+
+// IsDuplicateOrder reports whether the order is rejected because its clientOrderId is used by another order, -4116.
+func IsDuplicateOrder(err error) bool {
+	e, ok := AsAPIError(err)
+	return ok && e.Code == EC_DuplicateClientOrderId
+}
+
+// IsInvalidListenKey reports whether the listen key does not exist or is expired, -1125.
+func IsInvalidListenKey(err error) bool {
+	e, ok := AsAPIError(err)
+	return ok && e.Code == EC_InvalidListenKey
+}
+
+// checkResponse returns an *APIError if the response has an error http status or a negative binance code.
+// Binance returns positive codes for some successful requests, such as {"code": 200, "msg": "success"}.
+func checkResponse(res *http.Response, resBody []byte) error {
+	var errMsg ErrMsg
+	json.Unmarshal(resBody, &errMsg)
+	if errMsg.Code >= 0 && res.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	e := &APIError{
+		StatusCode: res.StatusCode,
+		Code:       errMsg.Code,
+		Msg:        errMsg.Msg,
+		Header:     res.Header,
+	}
+	if res.Request != nil {
+		e.Method = res.Request.Method
+		e.Endpoint = res.Request.URL.Path
+	}
+	if e.Code == 0 && e.Msg == "" {
+		e.Msg = string(resBody)
+		if len(e.Msg) > 200 {
+			e.Msg = e.Msg[:200]
+		}
+	}
+	return e
+}
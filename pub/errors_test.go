@@ -0,0 +1,69 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestAPIError
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/margin":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-2019,"msg":"Margin is insufficient."}`))
+		case "/limit":
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"code":-1003,"msg":"Too many requests."}`))
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<html>Service Unavailable</html>`))
+		case "/timeout":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"code":-1007,"msg":"Timeout waiting for response from backend server."}`))
+		case "/success":
+			w.Write([]byte(`{"code":200,"msg":"success"}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "", ""), &Key{ApiKey: "api-key", SecretKey: "secret"})
+	c.Limiter = nil // no back off after 429
+	c.Retry = nil   // no retry of 5xx
+	ctx := context.Background()
+
+	_, err := c.PostWithSign(ctx, "/margin", nil)
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.Equal(t, EC_MarginNotSufficient, apiErr.Code)
+	require.Equal(t, "/margin", apiErr.Endpoint)
+	require.Equal(t, http.MethodPost, apiErr.Method)
+	require.True(t, IsInsufficientMargin(err))
+	require.False(t, IsRetryable(err))
+	require.Equal(t, "MARGIN_NOT_SUFFICIENT", ErrorCodeName(apiErr.Code))
+
+	_, err = c.GetNoSign(ctx, "/limit", nil)
+	require.True(t, IsRateLimited(err))
+	apiErr, _ = AsAPIError(err)
+	require.Equal(t, "3", apiErr.Header.Get("Retry-After"))
+
+	_, err = c.GetWithSign(ctx, "/busy", nil)
+	require.True(t, IsRetryable(err))
+	apiErr, _ = AsAPIError(err)
+	require.Equal(t, 0, apiErr.Code)
+	require.Equal(t, "<html>Service Unavailable</html>", apiErr.Msg)
+
+	_, err = c.DeleteWithSign(ctx, "/timeout", nil)
+	require.True(t, IsRetryable(err))
+	require.True(t, IsUnknownStatus(err))
+
+	_, err = c.PostWithSign(ctx, "/success", nil)
+	require.Nil(t, err)
+}
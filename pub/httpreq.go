@@ -2,13 +2,12 @@ package pub
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
-	"time"
 )
 
 // 所有时间、时间戳均为UNIX时间，单位为毫秒。
@@ -30,263 +29,150 @@ import (
 // request data
 type ParamData = map[string]interface{}
 
-var serverTimeAhead = 0
-
-// func init() {
-// 	AdjustTime()
-// }
-
+// AdjustTime syncs the clock offset of DefaultClient to binance server time.
 func AdjustTime() {
-	// totalSa := int64(0)
-	// for i := 0; i < 5; i++ {
-	// 	_, sa := ServerTime()
-	// 	totalSa += sa
-	// 	time.Sleep(200 * time.Millisecond)
-	// }
-	// avgSa := totalSa / 5
-	// serverTimeAhead = int(avgSa)
-	// log.Printf("serverTimeAhead %v", serverTimeAhead)
+	if err := DefaultClient.AdjustTime(context.Background()); err != nil {
+		DefaultClient.Logf("AdjustTime err: %v", err)
+		return
+	}
+	DefaultClient.Logf("AdjustTime offset %v, uncertainty %v", DefaultClient.TimeSync.Offset(), DefaultClient.TimeSync.Uncertainty())
 }
 
 // 发送需要签名的GET请求
-func GetWithSign(key *Key, path string, data ParamData) (resBody []byte, err error) {
-	return getWithSign(futureBaseUrl, key, path, data)
+func (c *Client) GetWithSign(ctx context.Context, path string, data ParamData) (resBody []byte, err error) {
+	return c.signedRequest(ctx, http.MethodGet, c.BaseUrl, path, data)
 }
 
-func getWithSign(baseUrl string, key *Key, path string, data ParamData) (resBody []byte, err error) {
-	// 添加recvWindow
-	if data == nil {
-		data = ParamData{"recvWindow": recvWindow}
-	} else {
-		data["recvWindow"] = recvWindow
-	}
-
-	// 参与计算签名的参数
-	signData := make(map[string]interface{})
-	// 请求所有参数都参与签名计算
-	for k, v := range data {
-		signData[k] = v
-	}
-
-	// 取币安的服务器时间
-	timestamp := time.Now().UnixMilli() + int64(serverTimeAhead) // ServerTime()
-	signData["timestamp"] = fmt.Sprintf("%v", timestamp)
-
-	sign := NewSign(key.ApiKey, key.SecretKey)
-	str, s := sign.BinanceGetSign(signData)
-
-	var req *http.Request
-	path += "?" + str + "&" + url.QueryEscape("signature") + "=" + url.QueryEscape(s)
-	req, err = http.NewRequest("GET", baseUrl+path, nil)
-
-	if err != nil {
-		return
-	}
-
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
-	req.Header.Add("Accept-Language", "en-US,en,zh-cn")
-	req.Header.Add("X-MBX-APIKEY", sign.ApiKey)
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return
-	}
-
-	resBody, err = io.ReadAll(res.Body)
-	if err != nil {
-		return
-	}
-
-	var errMsg ErrMsg
-	json.Unmarshal(resBody, &errMsg)
-	if errMsg.Code != 0 {
-		err = fmt.Errorf("httpreq.GetWithSign error %v", errMsg)
-		switch errMsg.Code {
-		case -1021: // -1021 Timestamp for this request was 1000ms ahead of the server's time.
-			AdjustTime()
-		}
-	}
-	return
+// 发送需要签名的现货GET请求, such as /sapi/v1/futures/transfer
+func (c *Client) SpotGetWithSign(ctx context.Context, path string, data ParamData) (resBody []byte, err error) {
+	return c.signedRequest(ctx, http.MethodGet, c.SpotBaseUrl, path, data)
 }
 
 // / 发送需要签名的POST请求
-func PostWithSign(key *Key, path string, data ParamData) (resBody []byte, errMsg ErrMsg, err error) {
-	// 添加recvWindow
-	if data == nil {
-		data = ParamData{"recvWindow": recvWindow}
-	} else {
-		data["recvWindow"] = recvWindow
-	}
-
-	signData := make(map[string]interface{})
-	// GET 请求所有参数都参与签名计算，POST 请求业务参数不参与签名计算
-	for k, v := range data {
-		signData[k] = v
-	}
-
-	timestamp := time.Now().UnixMilli() + int64(serverTimeAhead) // ServerTime()
-	signData["timestamp"] = fmt.Sprintf("%v", timestamp)
-	sign := NewSign(key.ApiKey, key.SecretKey)
-	str, s := sign.BinanceGetSign(signData)
-
-	path += "?" + str + "&" + url.QueryEscape("signature") + "=" + url.QueryEscape(s)
+func (c *Client) PostWithSign(ctx context.Context, path string, data ParamData) (resBody []byte, err error) {
+	return c.signedRequest(ctx, http.MethodPost, c.BaseUrl, path, data)
+}
 
-	var req *http.Request
-	req, err = http.NewRequest("POST", futureBaseUrl+path, nil)
-	if err != nil {
-		return
-	}
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
-	req.Header.Add("Accept-Language", "zh-cn")
-	req.Header.Add("X-MBX-APIKEY", sign.ApiKey)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+// 发送需要签名的Put请求
+func (c *Client) PutWithSign(ctx context.Context, path string, data ParamData) (resBody []byte, err error) {
+	return c.signedRequest(ctx, http.MethodPut, c.BaseUrl, path, data)
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return
-	}
-	resBody, err = io.ReadAll(res.Body)
-	if err != nil {
-		return
-	}
+// 发送需要签名的Delete请求
+func (c *Client) DeleteWithSign(ctx context.Context, path string, data ParamData) (resBody []byte, err error) {
+	return c.signedRequest(ctx, http.MethodDelete, c.BaseUrl, path, data)
+}
 
-	json.Unmarshal(resBody, &errMsg)
-	if errMsg.Code != 0 {
-		err = fmt.Errorf("httpreq.PostWithSign resp err %v", errMsg)
-		switch errMsg.Code {
-		case -1021: // -1021 Timestamp for this request was 1000ms ahead of the server's time.
-			AdjustTime()
-		}
-	}
-	return
+// signedRequest adds recvWindow, timestamp and signature to the query string and sends the request,
+// GET requests are retried by c.Retry with new timestamp.
+func (c *Client) signedRequest(ctx context.Context, method, baseUrl, path string, data ParamData) (resBody []byte, err error) {
+	return c.withRetry(ctx, method, path, func() ([]byte, error) {
+		return c.signedRequestOnce(ctx, method, baseUrl, path, data)
+	})
 }
 
-// 发送需要签名的Put请求
-func PutWithSign(key *Key, path string, data ParamData) (resBody []byte, err error) {
-	// 添加recvWindow
-	if data == nil {
-		data = ParamData{"recvWindow": recvWindow}
-	} else {
-		data["recvWindow"] = recvWindow
+func (c *Client) signedRequestOnce(ctx context.Context, method, baseUrl, path string, data ParamData) (resBody []byte, err error) {
+	if c.Key == nil {
+		return nil, fmt.Errorf("httpreq.%v %v: key is nil", method, path)
 	}
 
-	// 参与计算签名的参数
-	signData := make(map[string]interface{})
-
-	// 请求所有参数都参与签名计算
+	// 参与计算签名的参数, 请求所有参数都参与签名计算
+	signData := make(map[string]interface{}, len(data)+2)
 	for k, v := range data {
 		signData[k] = v
 	}
+	// 添加recvWindow, 请求参数中有recvWindow时使用参数的
+	if _, ok := signData["recvWindow"]; !ok {
+		signData["recvWindow"] = fmt.Sprintf("%v", c.RecvWindow)
+	}
 
 	// 取币安的服务器时间
-	timestamp := time.Now().UnixMilli() + int64(serverTimeAhead) // ServerTime()
-	signData["timestamp"] = fmt.Sprintf("%v", timestamp)
-
-	sign := NewSign(key.ApiKey, key.SecretKey)
-	str, s := sign.BinanceGetSign(signData)
+	signData["timestamp"] = fmt.Sprintf("%v", c.Timestamp(ctx))
 
-	var req *http.Request
-	path += "?" + str + "&" + url.QueryEscape("signature") + "=" + url.QueryEscape(s)
-	req, err = http.NewRequest("PUT", futureBaseUrl+path, nil)
+	cost := EndpointCost(method, path, data)
+	str, s, err := c.Key.SignParams(signData, true)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("httpreq.%v %v: %w", method, path, err)
 	}
+	path += "?" + str + "&" + url.QueryEscape("signature") + "=" + url.QueryEscape(s)
 
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
-	req.Header.Add("Accept-Language", "zh-cn")
-	req.Header.Add("X-MBX-APIKEY", sign.ApiKey)
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	resBody, err = io.ReadAll(res.Body)
+	req, err := http.NewRequestWithContext(ctx, method, baseUrl+path, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var errMsg ErrMsg
-	json.Unmarshal(resBody, &errMsg)
-	if errMsg.Code != 0 {
-		err = fmt.Errorf("httpreq.GetWithSign resp err %v", errMsg)
-		switch errMsg.Code {
-		case -1021: // -1021 Timestamp for this request was 1000ms ahead of the server's time.
-			AdjustTime()
-		}
-	}
-
-	return
-}
-
-// 发送需要签名的Delete请求
-func DeleteWithSign(key *Key, path string, data ParamData) (resBody []byte, err error) {
-	// 添加recvWindow
-	if data == nil {
-		data = ParamData{"recvWindow": recvWindow}
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
+	req.Header.Add("Accept-Language", "en-US,en,zh-cn")
+	req.Header.Add("X-MBX-APIKEY", c.Key.ApiKey)
+	if method == http.MethodPost {
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	} else {
-		data["recvWindow"] = recvWindow
+		req.Header.Add("Content-Type", "application/json")
 	}
 
-	// 参与计算签名的参数
-	signData := make(map[string]interface{})
+	return c.do(req, cost)
+}
 
-	// 请求所有参数都参与签名计算
-	for k, v := range data {
-		signData[k] = v
+// do waits for the rate limiter, sends the request and returns the response body,
+// or an *APIError if binance responds an error.
+func (c *Client) do(req *http.Request, cost RequestCost) (resBody []byte, err error) {
+	account := req.Header.Get("X-MBX-APIKEY") // the orders are counted by account
+	if c.Limiter != nil {
+		if err = c.Limiter.AccountWait(req.Context(), account, cost); err != nil {
+			return nil, err
+		}
 	}
 
-	// 取币安的服务器时间
-	timestamp := time.Now().UnixMilli() + int64(serverTimeAhead) // ServerTime()
-	signData["timestamp"] = fmt.Sprintf("%v", timestamp)
-
-	sign := NewSign(key.ApiKey, key.SecretKey)
-	str, s := sign.BinanceGetSign(signData)
-
-	var req *http.Request
-	path += "?" + str + "&" + url.QueryEscape("signature") + "=" + url.QueryEscape(s)
-	req, err = http.NewRequest(http.MethodDelete, futureBaseUrl+path, nil)
+	res, err := c.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
-	req.Header.Add("Accept-Language", "zh-cn")
-	req.Header.Add("X-MBX-APIKEY", sign.ApiKey)
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
 	resBody, err = io.ReadAll(res.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	var errMsg ErrMsg
-	json.Unmarshal(resBody, &errMsg)
-	if errMsg.Code < 0 {
-		err = fmt.Errorf("httpreq.GetWithSign resp err %v", errMsg)
-		switch errMsg.Code {
-		case -1021: // -1021 Timestamp for this request was 1000ms ahead of the server's time.
-			AdjustTime()
+	err = checkResponse(res, resBody)
+	if c.Limiter != nil {
+		c.Limiter.AccountUpdate(account, res.Header)
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusTeapot {
+			wait := retryAfter(res.Header)
+			c.Logf("httpreq %v %v got http status %v, back off %v", req.Method, req.URL.Path, res.StatusCode, wait)
+			if e, ok := AsAPIError(err); ok && e.Code == EC_TooManyOrders {
+				c.Limiter.AccountBackoff(account, wait)
+			} else {
+				c.Limiter.Backoff(wait)
+			}
 		}
 	}
 
-	return
+	if err != nil {
+		if IsTimestampError(err) && c.TimeSync != nil { // -1021 Timestamp for this request was 1000ms ahead of the server's time.
+			c.TimeSync.Trigger()
+		}
+		return resBody, err
+	}
+	return resBody, nil
 }
 
 // / 发送原始请求，不需要签名
-func GetNoSign(path string, params ParamData) (resBody []byte, err error) {
-	url := futureBaseUrl + path
+func (c *Client) GetNoSign(ctx context.Context, path string, params ParamData) (resBody []byte, err error) {
+	return c.withRetry(ctx, http.MethodGet, path, func() ([]byte, error) {
+		return c.getNoSign(ctx, path, params)
+	})
+}
+
+func (c *Client) getNoSign(ctx context.Context, path string, params ParamData) (resBody []byte, err error) {
+	cost := EndpointCost(http.MethodGet, path, params)
+	url := c.BaseUrl + path
 	if params != nil {
-		url = url + "?" + EncodeQueryString(params, false)
+		url = url + "?" + EncodeQueryString(params, true)
 	}
 
 	var req *http.Request
-	req, err = http.NewRequest("GET", url, nil)
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -295,33 +181,24 @@ func GetNoSign(path string, params ParamData) (resBody []byte, err error) {
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("upgrade-insecure-requests", "1")
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	// log.Println("httpreq.GetNoSign res.StatusCode", res.StatusCode)
-
-	resBody, err = io.ReadAll(res.Body)
+	resBody, err = c.do(req, cost)
 	if err != nil {
+		if _, ok := AsAPIError(err); !ok {
+			c.Logf("httpreq.GetNoSign %v err: %v", path, err)
+		}
 		return nil, err
 	}
-
-	var errMsg ErrMsg
-	json.Unmarshal(resBody, &errMsg)
-	if errMsg.Code != 0 {
-		return nil, fmt.Errorf("httpreq.GetNoSign: %+v", errMsg)
-	}
-	return
+	return resBody, nil
 }
 
 // / 发送原始请求
-func PostNoSign(path string, data ParamData) (resBody []byte, err error) {
+func (c *Client) PostNoSign(ctx context.Context, path string, data ParamData) (resBody []byte, err error) {
 	var body *bytes.Buffer
 	if data == nil {
 		data = ParamData{}
 	}
-	path += "?" + EncodeQueryString(data, false)
+	cost := EndpointCost(http.MethodPost, path, data)
+	path += "?" + EncodeQueryString(data, true)
 
 	// POST 请求 JSON
 	if b, err := json.Marshal(data); err != nil {
@@ -330,10 +207,7 @@ func PostNoSign(path string, data ParamData) (resBody []byte, err error) {
 		body = bytes.NewBuffer(b)
 	}
 
-	var req *http.Request
-	if body != nil {
-		req, err = http.NewRequest("POST", futureBaseUrl+path, body)
-	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseUrl+path, body)
 	if err != nil {
 		return
 	}
@@ -341,24 +215,51 @@ func PostNoSign(path string, data ParamData) (resBody []byte, err error) {
 	req.Header.Add("Accept-Language", "zh-cn")
 	req.Header.Add("Content-Type", "application/json")
 
-	res, err := http.DefaultClient.Do(req)
+	resBody, err = c.do(req, cost)
 	if err != nil {
-		return
-	}
-	resBody, err = io.ReadAll(res.Body)
-	if err != nil {
-		return
+		return nil, err
 	}
+	return resBody, nil
+}
 
-	var errMsg ErrMsg
-	err = json.Unmarshal(resBody, &errMsg)
-	if err == nil {
-		return nil, fmt.Errorf("httpreq.GetWithSign: %+v", errMsg)
-	}
+// The package level functions below send requests by DefaultClient.
 
+// 发送需要签名的GET请求
+func GetWithSign(key *Key, path string, data ParamData) (resBody []byte, err error) {
+	return DefaultClient.WithKey(key).GetWithSign(context.Background(), path, data)
+}
+
+// / 发送需要签名的POST请求
+// errMsg is the binance code and message of the response, such as {Code: 200, Msg: "success"}, or of the *APIError.
+func PostWithSign(key *Key, path string, data ParamData) (resBody []byte, errMsg ErrMsg, err error) {
+	resBody, err = DefaultClient.WithKey(key).PostWithSign(context.Background(), path, data)
+	if e, ok := AsAPIError(err); ok {
+		return resBody, e.ErrMsg(), err
+	}
+	json.Unmarshal(resBody, &errMsg)
 	return
 }
 
+// 发送需要签名的Put请求
+func PutWithSign(key *Key, path string, data ParamData) (resBody []byte, err error) {
+	return DefaultClient.WithKey(key).PutWithSign(context.Background(), path, data)
+}
+
+// 发送需要签名的Delete请求
+func DeleteWithSign(key *Key, path string, data ParamData) (resBody []byte, err error) {
+	return DefaultClient.WithKey(key).DeleteWithSign(context.Background(), path, data)
+}
+
+// / 发送原始请求，不需要签名
+func GetNoSign(path string, params ParamData) (resBody []byte, err error) {
+	return DefaultClient.GetNoSign(context.Background(), path, params)
+}
+
+// / 发送原始请求
+func PostNoSign(path string, data ParamData) (resBody []byte, err error) {
+	return DefaultClient.PostNoSign(context.Background(), path, data)
+}
+
 func SpotGetWithSign(key *Key, path string, data ParamData) (resBody []byte, err error) {
-	return getWithSign(spotBaseUrl, key, path, data)
+	return DefaultClient.WithKey(key).SpotGetWithSign(context.Background(), path, data)
 }
@@ -0,0 +1,122 @@
+package pub
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EncodeParams converts the fields of a request struct to ParamData, the values are formatted to strings.
+// The name of the parameter is taken from the url tag, or the json tag if there is no url tag, or the field name.
+// Fields tagged "-" are skipped, fields with omitempty are skipped if they are zero values,
+// nil pointers are always skipped, so a pointer is used for the optional parameters whose zero value is meaningful, such as *bool.
+// Slices, maps and structs are encoded to JSON, such as orderIdList=[1,2].
+func EncodeParams(obj interface{}) (ParamData, error) {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ParamData{}, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("EncodeParams: %T is not a struct", obj)
+	}
+
+	params := ParamData{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, omitEmpty := paramTag(field)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		} else if omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		s, err := formatParam(fv)
+		if err != nil {
+			return nil, fmt.Errorf("EncodeParams: field %v: %w", field.Name, err)
+		}
+		params[name] = s
+	}
+	return params, nil
+}
+
+// EncodeParamsQuery encodes the request struct to query string, the parameters are sorted by name.
+func EncodeParamsQuery(obj interface{}) (string, error) {
+	params, err := EncodeParams(obj)
+	if err != nil {
+		return "", err
+	}
+	return EncodeQueryString(params, true), nil
+}
+
+func paramTag(field reflect.StructField) (name string, omitEmpty bool) {
+	tag, ok := field.Tag.Lookup("url")
+	if !ok {
+		tag, ok = field.Tag.Lookup("json")
+	}
+	if !ok {
+		return field.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty
+}
+
+func formatParam(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String(), nil
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Bool returns the pointer of b, for the optional bool parameters.
+func Bool(b bool) *bool {
+	return &b
+}
+
+// Int64 returns the pointer of i, for the optional number parameters.
+func Int64(i int64) *int64 {
+	return &i
+}
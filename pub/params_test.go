@@ -0,0 +1,64 @@
+package pub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestEncodeParams
+func TestEncodeParams(t *testing.T) {
+	type param struct {
+		Symbol     string    `json:"symbol"`
+		Side       OrderSide `json:"side,omitempty"`
+		Price      string    `json:"price,omitempty"`
+		Limit      int       `url:"limit" json:"size,omitempty"`
+		Rate       float64   `json:"rate,omitempty"`
+		ReduceOnly *bool     `json:"reduceOnly,omitempty"`
+		StartTime  *int64    `json:"startTime,omitempty"`
+		OrderIds   []int64   `json:"orderIdList,omitempty"`
+		Ignored    string    `json:"-"`
+		NoTag      bool
+		private    string
+	}
+
+	tests := []struct {
+		name  string
+		param *param
+		want  string
+	}{
+		{
+			"zero",
+			&param{},
+			"NoTag=false&limit=0&symbol=",
+		},
+		{
+			"omitempty",
+			&param{Symbol: "BTCUSDT", Side: OS_Buy, Price: "0.1", Limit: 5, Rate: 0.25, Ignored: "x", NoTag: true, private: "y"},
+			"NoTag=true&limit=5&price=0.1&rate=0.25&side=BUY&symbol=BTCUSDT",
+		},
+		{
+			"pointer",
+			&param{Symbol: "ETHUSDT", ReduceOnly: Bool(false), StartTime: Int64(0)},
+			"NoTag=false&limit=0&reduceOnly=false&startTime=0&symbol=ETHUSDT",
+		},
+		{
+			"slice",
+			&param{Symbol: "ETHUSDT", OrderIds: []int64{1, 22}},
+			"NoTag=false&limit=0&orderIdList=%5B1%2C22%5D&symbol=ETHUSDT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeParamsQuery(tt.param)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := EncodeParams("not a struct")
+	require.Error(t, err)
+	params, err := EncodeParams((*param)(nil))
+	require.NoError(t, err)
+	require.Empty(t, params)
+}
@@ -0,0 +1,508 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is one of the limits in exchange info, such as {"rateLimitType": "REQUEST_WEIGHT", "interval": "MINUTE", "intervalNum": 1, "limit": 2400}
+type RateLimit struct { // API访问的限制
+	Interval      string `json:"interval"`      // "MINUTE" 按照分钟计算, "SECOND", "DAY"
+	IntervalNum   int    `json:"intervalNum"`   // 1 按照1分钟计算
+	Limit         int    `json:"limit"`         // 2400 上限次数
+	RateLimitType string `json:"rateLimitType"` // "REQUEST_WEIGHT"按照访问权重来计算 "ORDERS" 按照订单数量来计算
+}
+
+const (
+	RLT_RequestWeight = "REQUEST_WEIGHT"
+	RLT_Orders        = "ORDERS"
+)
+
+// Duration returns the length of the limit window.
+func (r RateLimit) Duration() time.Duration {
+	var unit time.Duration
+	switch r.Interval {
+	case "SECOND":
+		unit = time.Second
+	case "MINUTE":
+		unit = time.Minute
+	case "HOUR":
+		unit = time.Hour
+	case "DAY":
+		unit = 24 * time.Hour
+	default:
+		return 0
+	}
+	return time.Duration(r.IntervalNum) * unit
+}
+
+// default limits of usd-margined future before exchange info is loaded
+var DefaultRateLimits = []RateLimit{
+	{Interval: "MINUTE", IntervalNum: 1, Limit: 2400, RateLimitType: RLT_RequestWeight},
+	{Interval: "SECOND", IntervalNum: 10, Limit: 300, RateLimitType: RLT_Orders},
+	{Interval: "MINUTE", IntervalNum: 1, Limit: 1200, RateLimitType: RLT_Orders},
+}
+
+// RequestCost is what a request consumes of the limits.
+// A batch is charged more on the short order windows than on the windows of a minute or longer.
+type RequestCost struct {
+	Weight       int // request weight, counted by ip
+	Orders       int // order count, counted by account
+	MinuteOrders int // order count of the windows of a minute or longer, Orders if 0
+}
+
+// RateLimitError is returned by a fail-fast RateLimiter instead of waiting.
+type RateLimitError struct {
+	RateLimitType string        // "REQUEST_WEIGHT", "ORDERS", or "BACKOFF" after 429/418
+	Limit         int           // the limit which will be exceeded
+	Wait          time.Duration // time to wait until the request can be sent
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit %v %v will be exceeded, retry after %v", e.RateLimitType, e.Limit, e.Wait)
+}
+
+type rateWindow struct {
+	limit RateLimit
+	dur   time.Duration
+	start time.Time
+	used  int
+}
+
+// RateLimiter counts request weight and orders of the fixed limit windows, it blocks or fails fast
+// before a request exceeds the limits. It is updated by the X-MBX-USED-WEIGHT-* and X-MBX-ORDER-COUNT-*
+// response headers, and backs off after 429/418 responses until Retry-After.
+// The request weight is counted by ip, so one limiter is shared by the clients of WithKey, and the orders are counted
+// by account, the api key, each one has its own order windows. It is safe for concurrent use.
+type RateLimiter struct {
+	FailFast bool // return *RateLimitError instead of waiting
+
+	mu          sync.Mutex
+	windows     []*rateWindow            // the request weight windows
+	orderLimits []RateLimit              // the limits of the order windows of each account
+	accounts    map[string]*orderWindows // by api key, "" for the requests without key
+	backoffTill time.Time
+	now         func() time.Time
+}
+
+// orderWindows is the order count windows of an account.
+type orderWindows struct {
+	windows     []*rateWindow
+	backoffTill time.Time // after -1015
+}
+
+// NewRateLimiter returns a limiter of DefaultRateLimits.
+func NewRateLimiter() *RateLimiter {
+	l := &RateLimiter{now: time.Now, accounts: map[string]*orderWindows{}}
+	l.SetLimits(DefaultRateLimits)
+	return l
+}
+
+// SetLimits replaces the limits, such as ExchInfo.RateLimits. Used counts of the same windows are kept.
+func (l *RateLimiter) SetLimits(limits []RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var orderLimits []RateLimit
+	windows := make([]*rateWindow, 0, len(limits))
+	for _, rl := range limits {
+		dur := rl.Duration()
+		if dur <= 0 || rl.Limit <= 0 {
+			continue
+		}
+		if rl.RateLimitType == RLT_Orders {
+			orderLimits = append(orderLimits, rl)
+			continue
+		}
+		windows = append(windows, newRateWindow(rl, findWindow(l.windows, rl.RateLimitType, dur)))
+	}
+	l.windows = windows
+	l.orderLimits = orderLimits
+	for _, a := range l.accounts {
+		a.windows = newOrderWindows(orderLimits, a.windows)
+	}
+}
+
+// newRateWindow returns the window of the limit, with the used count of old if it is not nil.
+func newRateWindow(rl RateLimit, old *rateWindow) *rateWindow {
+	w := &rateWindow{limit: rl, dur: rl.Duration()}
+	if old != nil {
+		w.start, w.used = old.start, old.used
+	}
+	return w
+}
+
+func newOrderWindows(limits []RateLimit, old []*rateWindow) []*rateWindow {
+	windows := make([]*rateWindow, len(limits))
+	for i, rl := range limits {
+		windows[i] = newRateWindow(rl, findWindow(old, rl.RateLimitType, rl.Duration()))
+	}
+	return windows
+}
+
+// Limits returns the current limits.
+func (l *RateLimiter) Limits() []RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limits := make([]RateLimit, 0, len(l.windows)+len(l.orderLimits))
+	for _, w := range l.windows {
+		limits = append(limits, w.limit)
+	}
+	return append(limits, l.orderLimits...)
+}
+
+// Used returns the used count of the limit window, rateLimitType is "REQUEST_WEIGHT" or "ORDERS".
+// The orders are of the requests without api key, see AccountUsed.
+func (l *RateLimiter) Used(rateLimitType string, dur time.Duration) int {
+	return l.AccountUsed("", rateLimitType, dur)
+}
+
+// AccountUsed returns the used count of the limit window of the account, the api key.
+func (l *RateLimiter) AccountUsed(account, rateLimitType string, dur time.Duration) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.window(account, rateLimitType, dur)
+	if w == nil {
+		return 0
+	}
+	w.roll(l.now())
+	return w.used
+}
+
+// window returns the request weight window, or the order window of the account. It is locked by the caller.
+func (l *RateLimiter) window(account, rateLimitType string, dur time.Duration) *rateWindow {
+	if rateLimitType == RLT_Orders {
+		return findWindow(l.account(account).windows, rateLimitType, dur)
+	}
+	return findWindow(l.windows, rateLimitType, dur)
+}
+
+// account returns the order windows of the account, it is locked by the caller.
+func (l *RateLimiter) account(account string) *orderWindows {
+	a := l.accounts[account]
+	if a == nil {
+		a = &orderWindows{windows: newOrderWindows(l.orderLimits, nil)}
+		l.accounts[account] = a
+	}
+	return a
+}
+
+func findWindow(windows []*rateWindow, rateLimitType string, dur time.Duration) *rateWindow {
+	for _, w := range windows {
+		if w.limit.RateLimitType == rateLimitType && w.dur == dur {
+			return w
+		}
+	}
+	return nil
+}
+
+func (w *rateWindow) roll(now time.Time) {
+	start := now.Truncate(w.dur)
+	if !start.Equal(w.start) {
+		w.start = start
+		w.used = 0
+	}
+}
+
+func (w *rateWindow) cost(c RequestCost) int {
+	switch w.limit.RateLimitType {
+	case RLT_RequestWeight:
+		return c.Weight
+	case RLT_Orders:
+		if c.MinuteOrders > 0 && w.dur >= time.Minute {
+			return c.MinuteOrders
+		}
+		return c.Orders
+	}
+	return 0
+}
+
+// reserve takes the cost if all the windows of the account allow it, or returns how long to wait.
+func (l *RateLimiter) reserve(account string, c RequestCost) (time.Duration, *RateLimitError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	a := l.account(account)
+	if now.Before(l.backoffTill) || c.Orders > 0 && now.Before(a.backoffTill) {
+		till := l.backoffTill
+		if c.Orders > 0 && a.backoffTill.After(till) {
+			till = a.backoffTill
+		}
+		wait := till.Sub(now)
+		return wait, &RateLimitError{RateLimitType: "BACKOFF", Wait: wait}
+	}
+
+	windows := append(append([]*rateWindow(nil), l.windows...), a.windows...)
+	for _, w := range windows {
+		w.roll(now)
+		cost := w.cost(c)
+		if cost > 0 && w.used+cost > w.limit.Limit {
+			wait := w.start.Add(w.dur).Sub(now)
+			return wait, &RateLimitError{RateLimitType: w.limit.RateLimitType, Limit: w.limit.Limit, Wait: wait}
+		}
+	}
+	for _, w := range windows {
+		w.used += w.cost(c)
+	}
+	return 0, nil
+}
+
+// Wait blocks until the request of the cost can be sent without exceeding the limits,
+// or returns *RateLimitError immediately if FailFast is set. The orders are of the requests without api key.
+func (l *RateLimiter) Wait(ctx context.Context, c RequestCost) error {
+	return l.AccountWait(ctx, "", c)
+}
+
+// AccountWait is Wait of the request of the account, the api key.
+func (l *RateLimiter) AccountWait(ctx context.Context, account string, c RequestCost) error {
+	for {
+		wait, rlErr := l.reserve(account, c)
+		if rlErr == nil {
+			return nil
+		}
+		if l.FailFast {
+			return rlErr
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Update sets the used counts from the response headers, such as X-MBX-USED-WEIGHT-1M: 120, X-MBX-ORDER-COUNT-10S: 3.
+// The orders are of the requests without api key.
+func (l *RateLimiter) Update(header http.Header) {
+	l.AccountUpdate("", header)
+}
+
+// AccountUpdate is Update of the response of the account, the api key.
+func (l *RateLimiter) AccountUpdate(account string, header http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for k, v := range header {
+		if len(v) == 0 {
+			continue
+		}
+		name := strings.ToLower(k)
+		var rateLimitType, interval string
+		if strings.HasPrefix(name, "x-mbx-used-weight-") {
+			rateLimitType, interval = RLT_RequestWeight, strings.TrimPrefix(name, "x-mbx-used-weight-")
+		} else if strings.HasPrefix(name, "x-mbx-order-count-") {
+			rateLimitType, interval = RLT_Orders, strings.TrimPrefix(name, "x-mbx-order-count-")
+		} else {
+			continue
+		}
+		dur := parseHeaderInterval(interval)
+		used, err := strconv.Atoi(v[0])
+		if dur <= 0 || err != nil {
+			continue
+		}
+		if w := l.window(account, rateLimitType, dur); w != nil {
+			w.roll(now)
+			w.used = used
+		}
+	}
+}
+
+// Backoff blocks all requests for retryAfter, it is called after 429 and 418 responses.
+func (l *RateLimiter) Backoff(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if till := l.now().Add(retryAfter); till.After(l.backoffTill) {
+		l.backoffTill = till
+	}
+}
+
+// AccountBackoff blocks the orders of the account for retryAfter, it is called after -1015 too many orders.
+func (l *RateLimiter) AccountBackoff(account string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a := l.account(account)
+	if till := l.now().Add(retryAfter); till.After(a.backoffTill) {
+		a.backoffTill = till
+	}
+}
+
+// interval of the headers: "10s", "1m", "1h", "1d"
+func parseHeaderInterval(s string) time.Duration {
+	if len(s) < 2 {
+		return 0
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0
+	}
+	switch s[len(s)-1] {
+	case 's':
+		return time.Duration(n) * time.Second
+	case 'm':
+		return time.Duration(n) * time.Minute
+	case 'h':
+		return time.Duration(n) * time.Hour
+	case 'd':
+		return time.Duration(n) * 24 * time.Hour
+	}
+	return 0
+}
+
+// retryAfter returns the Retry-After header of 429/418 responses, 60 seconds if it is missing.
+func retryAfter(header http.Header) time.Duration {
+	if sec, err := strconv.Atoi(header.Get("Retry-After")); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return time.Minute
+}
+
+// endpoint weights of https://developers.binance.com/docs/derivatives/usds-margined-futures
+// key: "METHOD path", the weights depending on parameters are in EndpointCost.
+var endpointCosts = map[string]RequestCost{
+	"GET /fapi/v1/ping":                   {Weight: 1},
+	"GET /fapi/v1/time":                   {Weight: 1},
+	"GET /fapi/v1/exchangeInfo":           {Weight: 1},
+	"GET /fapi/v1/trades":                 {Weight: 5},
+	"GET /fapi/v1/historicalTrades":       {Weight: 20},
+	"GET /fapi/v1/aggTrades":              {Weight: 20},
+	"GET /fapi/v1/premiumIndex":           {Weight: 1},
+	"GET /fapi/v1/fundingRate":            {Weight: 1},
+	"GET /fapi/v1/fundingInfo":            {Weight: 1},
+	"GET /fapi/v1/openInterest":           {Weight: 1},
+	"GET /fapi/v1/indexInfo":              {Weight: 1},
+	"GET /fapi/v1/constituents":           {Weight: 2},
+	"GET /futures/data/delivery-price":    {Weight: 0},
+	"POST /fapi/v1/order":                 {Weight: 0, Orders: 1},
+	"POST /fapi/v1/order/test":            {Weight: 1},
+	"POST /fapi/v1/batchOrders":           {Weight: 5, Orders: 5, MinuteOrders: 1},
+	"PUT /fapi/v1/order":                  {Weight: 1, Orders: 1},
+	"PUT /fapi/v1/batchOrders":            {Weight: 5, Orders: 5, MinuteOrders: 1},
+	"DELETE /fapi/v1/order":               {Weight: 1},
+	"DELETE /fapi/v1/batchOrders":         {Weight: 1},
+	"DELETE /fapi/v1/allOpenOrders":       {Weight: 1},
+	"POST /fapi/v1/countdownCancelAll":    {Weight: 10},
+	"GET /fapi/v1/order":                  {Weight: 1},
+	"GET /fapi/v1/allOrders":              {Weight: 5},
+	"GET /fapi/v1/openOrder":              {Weight: 1},
+	"GET /fapi/v1/userTrades":             {Weight: 5},
+	"POST /fapi/v1/marginType":            {Weight: 1},
+	"POST /fapi/v1/positionSide/dual":     {Weight: 1},
+	"POST /fapi/v1/leverage":              {Weight: 1},
+	"POST /fapi/v1/multiAssetsMargin":     {Weight: 1},
+	"POST /fapi/v1/positionMargin":        {Weight: 1},
+	"GET /fapi/v2/positionRisk":           {Weight: 5},
+	"GET /fapi/v3/positionRisk":           {Weight: 5},
+	"GET /fapi/v1/adlQuantile":            {Weight: 5},
+	"GET /fapi/v1/positionMargin/history": {Weight: 1},
+	"GET /fapi/v2/balance":                {Weight: 5},
+	"GET /fapi/v3/balance":                {Weight: 5},
+	"GET /fapi/v2/account":                {Weight: 5},
+	"GET /fapi/v3/account":                {Weight: 5},
+	"GET /fapi/v1/commissionRate":         {Weight: 20},
+	"GET /fapi/v1/accountConfiguration":   {Weight: 5},
+	"GET /fapi/v1/symbolConfig":           {Weight: 5},
+	"GET /fapi/v1/positionRisk":           {Weight: 5},
+	"GET /fapi/v1/rateLimit/order":        {Weight: 1},
+	"GET /fapi/v1/leverageBracket":        {Weight: 1},
+	"GET /fapi/v1/multiAssetsMargin":      {Weight: 30},
+	"GET /fapi/v1/positionSide/dual":      {Weight: 30},
+	"GET /fapi/v1/income":                 {Weight: 30},
+	"GET /fapi/v1/income/asyn":            {Weight: 1000},
+	"GET /fapi/v1/order/asyn":             {Weight: 1000},
+	"GET /fapi/v1/trade/asyn":             {Weight: 1000},
+	"GET /fapi/v1/income/asyn/id":         {Weight: 10},
+	"GET /fapi/v1/order/asyn/id":          {Weight: 10},
+	"GET /fapi/v1/trade/asyn/id":          {Weight: 10},
+	"POST /fapi/v1/feeBurn":               {Weight: 1},
+	"GET /fapi/v1/feeBurn":                {Weight: 30},
+	"POST /fapi/v1/listenKey":             {Weight: 1},
+	"PUT /fapi/v1/listenKey":              {Weight: 1},
+	"DELETE /fapi/v1/listenKey":           {Weight: 1},
+	"GET /fapi/v1/convert/exchangeInfo":   {Weight: 20},
+	"GET /fapi/v1/convert/getQuote":       {Weight: 50},
+	"POST /fapi/v1/convert/confirm":       {Weight: 5},
+	"GET /fapi/v1/convert/orderStatus":    {Weight: 50},
+	"GET /fapi/v1/pmAccountInfo":          {Weight: 5},
+	"GET /sapi/v1/futures/transfer":       {Weight: 10},
+}
+
+// EndpointCost returns the request weight and order count of the endpoint with the parameters,
+// weight 1 for unknown endpoints.
+func EndpointCost(method, path string, params ParamData) RequestCost {
+	_, hasSymbol := params["symbol"]
+	switch path {
+	case "/fapi/v1/depth": // limit 5, 10, 20, 50: 2; 100: 5; 500: 10; 1000: 20
+		limit := paramInt(params, "limit", 500)
+		switch {
+		case limit <= 50:
+			return RequestCost{Weight: 2}
+		case limit <= 100:
+			return RequestCost{Weight: 5}
+		case limit <= 500:
+			return RequestCost{Weight: 10}
+		}
+		return RequestCost{Weight: 20}
+	case "/fapi/v1/klines", "/fapi/v1/continuousKlines", "/fapi/v1/indexPriceKlines",
+		"/fapi/v1/markPriceKlines", "/fapi/v1/premiumIndexKlines": // limit [1,100): 1; [100, 500): 2; [500, 1000]: 5; > 1000: 10
+		limit := paramInt(params, "limit", 500)
+		switch {
+		case limit < 100:
+			return RequestCost{Weight: 1}
+		case limit < 500:
+			return RequestCost{Weight: 2}
+		case limit <= 1000:
+			return RequestCost{Weight: 5}
+		}
+		return RequestCost{Weight: 10}
+	case "/fapi/v1/ticker/24hr":
+		return RequestCost{Weight: weightBySymbol(hasSymbol, 1, 40)}
+	case "/fapi/v1/ticker/price", "/fapi/v2/ticker/price":
+		return RequestCost{Weight: weightBySymbol(hasSymbol, 1, 2)}
+	case "/fapi/v1/ticker/bookTicker":
+		return RequestCost{Weight: weightBySymbol(hasSymbol, 2, 5)}
+	case "/fapi/v1/assetIndex":
+		return RequestCost{Weight: weightBySymbol(hasSymbol, 1, 10)}
+	case "/fapi/v1/apiTradingStatus":
+		return RequestCost{Weight: weightBySymbol(hasSymbol, 1, 10)}
+	case "/fapi/v1/forceOrders":
+		return RequestCost{Weight: weightBySymbol(hasSymbol, 20, 50)}
+	case "/fapi/v1/openOrders":
+		return RequestCost{Weight: weightBySymbol(hasSymbol, 1, 40)}
+	}
+	if strings.HasPrefix(path, "/futures/data/") {
+		return RequestCost{Weight: 0} // limited by 1000 requests/5min of ip, not by weight
+	}
+
+	if c, ok := endpointCosts[method+" "+path]; ok {
+		return c
+	}
+	return RequestCost{Weight: 1}
+}
+
+func weightBySymbol(hasSymbol bool, withSymbol, withoutSymbol int) int {
+	if hasSymbol {
+		return withSymbol
+	}
+	return withoutSymbol
+}
+
+func paramInt(params ParamData, name string, def int) int {
+	v, ok := params[name]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(fmt.Sprintf("%v", v))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
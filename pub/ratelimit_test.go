@@ -0,0 +1,148 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestRateLimiterWait
+func TestRateLimiterWait(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+	l := NewRateLimiter()
+	l.now = func() time.Time { return now }
+	l.FailFast = true
+	l.SetLimits([]RateLimit{
+		{Interval: "MINUTE", IntervalNum: 1, Limit: 10, RateLimitType: RLT_RequestWeight},
+		{Interval: "SECOND", IntervalNum: 10, Limit: 2, RateLimitType: RLT_Orders},
+	})
+
+	ctx := context.Background()
+	require.Nil(t, l.Wait(ctx, RequestCost{Weight: 5}))
+	require.Nil(t, l.Wait(ctx, RequestCost{Weight: 5}))
+	err := l.Wait(ctx, RequestCost{Weight: 1})
+	require.True(t, IsRateLimited(err))
+	require.Equal(t, 50*time.Second, err.(*RateLimitError).Wait)
+
+	require.Nil(t, l.Wait(ctx, RequestCost{Orders: 2}))
+	require.NotNil(t, l.Wait(ctx, RequestCost{Orders: 1}))
+
+	now = now.Add(time.Minute) // new windows
+	require.Nil(t, l.Wait(ctx, RequestCost{Weight: 1, Orders: 1}))
+	require.Equal(t, 1, l.Used(RLT_RequestWeight, time.Minute))
+
+	header := http.Header{}
+	header.Set("X-MBX-USED-WEIGHT-1M", "9")
+	header.Set("X-MBX-ORDER-COUNT-10S", "2")
+	l.Update(header)
+	require.Equal(t, 9, l.Used(RLT_RequestWeight, time.Minute))
+	require.Equal(t, 2, l.Used(RLT_Orders, 10*time.Second))
+	require.NotNil(t, l.Wait(ctx, RequestCost{Weight: 2}))
+}
+
+// go test -v -run TestRateLimiterBatchOrders
+func TestRateLimiterBatchOrders(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+	l := NewRateLimiter()
+	l.now = func() time.Time { return now }
+	l.FailFast = true
+
+	ctx := context.Background()
+	cost := EndpointCost("POST", "/fapi/v1/batchOrders", nil)
+	require.Nil(t, l.Wait(ctx, cost))
+	require.Nil(t, l.Wait(ctx, RequestCost{Orders: 1}))
+	require.Equal(t, 6, l.Used(RLT_Orders, 10*time.Second))
+	require.Equal(t, 2, l.Used(RLT_Orders, time.Minute))
+	require.Equal(t, 5, l.Used(RLT_RequestWeight, time.Minute))
+}
+
+// go test -v -run TestRateLimiterAccounts
+func TestRateLimiterAccounts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serveTime(w, r) {
+			return
+		}
+		if r.Method == http.MethodPost && r.Header.Get("X-MBX-APIKEY") == "c" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"code":-1015,"msg":"Too many new orders."}`))
+			return
+		}
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "10")
+		w.Header().Set("X-MBX-ORDER-COUNT-10S", "2")
+		w.Write([]byte(`{"orderId":1}`))
+	}))
+	defer srv.Close()
+
+	c := NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "", ""), &Key{ApiKey: "a", SecretKey: "secret"})
+	c.Limiter.FailFast = true
+	c.Limiter.SetLimits([]RateLimit{
+		{Interval: "MINUTE", IntervalNum: 1, Limit: 100, RateLimitType: RLT_RequestWeight},
+		{Interval: "SECOND", IntervalNum: 10, Limit: 2, RateLimitType: RLT_Orders},
+	})
+	b := c.WithKey(&Key{ApiKey: "b", SecretKey: "secret"})
+	ctx := context.Background()
+
+	_, err := c.PostWithSign(ctx, "/fapi/v1/order", nil)
+	require.NoError(t, err)
+	_, err = b.PostWithSign(ctx, "/fapi/v1/order", nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.Limiter.AccountUsed("a", RLT_Orders, 10*time.Second))
+	require.Equal(t, 2, c.Limiter.AccountUsed("b", RLT_Orders, 10*time.Second))
+	require.Equal(t, 0, c.Limiter.Used(RLT_Orders, 10*time.Second))
+	require.Equal(t, 10, c.Limiter.Used(RLT_RequestWeight, time.Minute)) // shared by ip
+
+	// the order count of a does not limit c
+	_, err = c.PostWithSign(ctx, "/fapi/v1/order", nil)
+	require.Equal(t, RLT_Orders, err.(*RateLimitError).RateLimitType)
+	c.Limiter.SetLimits([]RateLimit{{Interval: "SECOND", IntervalNum: 10, Limit: 5, RateLimitType: RLT_Orders}})
+	require.Equal(t, 2, c.Limiter.AccountUsed("a", RLT_Orders, 10*time.Second)) // kept
+	cc := c.WithKey(&Key{ApiKey: "c", SecretKey: "secret"})
+	_, err = cc.PostWithSign(ctx, "/fapi/v1/order", nil)
+	require.True(t, IsRateLimited(err)) // -1015 of the server backs off the orders of c only
+	_, err = cc.PostWithSign(ctx, "/fapi/v1/order", nil)
+	require.Equal(t, "BACKOFF", err.(*RateLimitError).RateLimitType)
+	_, err = cc.GetWithSign(ctx, "/fapi/v1/order", nil) // not an order
+	require.NoError(t, err)
+	_, err = c.PostWithSign(ctx, "/fapi/v1/order", nil)
+	require.NoError(t, err)
+}
+
+// go test -v -run TestRateLimiterBackoff
+func TestRateLimiterBackoff(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"code":-1003,"msg":"Too many requests."}`))
+	}))
+	defer srv.Close()
+
+	c := NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "", ""), nil)
+	c.Limiter.FailFast = true
+	_, err := c.GetNoSign(context.Background(), "/fapi/v1/time", nil)
+	require.True(t, IsRateLimited(err))
+
+	_, err = c.GetNoSign(context.Background(), "/fapi/v1/time", nil)
+	rlErr, ok := err.(*RateLimitError)
+	require.True(t, ok)
+	require.Equal(t, "BACKOFF", rlErr.RateLimitType)
+	require.Greater(t, rlErr.Wait, 25*time.Second)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+// go test -v -run TestEndpointCost
+func TestEndpointCost(t *testing.T) {
+	require.Equal(t, RequestCost{Weight: 2}, EndpointCost("GET", "/fapi/v1/depth", ParamData{"limit": 5}))
+	require.Equal(t, RequestCost{Weight: 20}, EndpointCost("GET", "/fapi/v1/depth", ParamData{"limit": 1000}))
+	require.Equal(t, RequestCost{Weight: 5}, EndpointCost("GET", "/fapi/v1/klines", nil))
+	require.Equal(t, RequestCost{Weight: 40}, EndpointCost("GET", "/fapi/v1/ticker/24hr", nil))
+	require.Equal(t, RequestCost{Weight: 1}, EndpointCost("GET", "/fapi/v1/ticker/24hr", ParamData{"symbol": "BTCUSDT"}))
+	require.Equal(t, RequestCost{Weight: 0, Orders: 1}, EndpointCost("POST", "/fapi/v1/order", nil))
+	require.Equal(t, RequestCost{Weight: 1}, EndpointCost("GET", "/fapi/v1/unknown", nil))
+}
@@ -0,0 +1,110 @@
+package pub
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy is the exponential backoff with jitter of retrying transient errors.
+// The client retries GET requests only, other requests may have been executed by binance,
+// such as new orders, they are reconciled by the caller before retry, see trade.Client.NewOrder.
+type RetryPolicy struct {
+	MaxRetries int           // retries after the first attempt
+	BaseDelay  time.Duration // delay before the first retry, doubled for each retry
+	MaxDelay   time.Duration // max delay of each retry
+	Jitter     float64       // 0 - 1, the delay is randomly reduced by up to Jitter * delay
+}
+
+// NewRetryPolicy returns the default policy: 3 retries from 200ms to 5s with 50% jitter.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  200 * time.Millisecond,
+		MaxDelay:   5 * time.Second,
+		Jitter:     0.5,
+	}
+}
+
+// Delay returns the backoff before the retry, attempt starts from 0.
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 && d > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// Wait sleeps the backoff of the attempt, or returns the error of ctx.
+func (p *RetryPolicy) Wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(p.Delay(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ShouldRetry reports whether the attempt can be retried for the err.
+func (p *RetryPolicy) ShouldRetry(ctx context.Context, err error, attempt int) bool {
+	return p != nil && attempt < p.MaxRetries && ctx.Err() == nil && IsTransient(err)
+}
+
+// IsTransient reports whether the error is temporary and the request may succeed if it is sent again:
+// the errors of IsRetryable, connection reset, connection refused, unexpected EOF and network timeout.
+// Rate limit errors are not transient, they should wait for the limiter.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if IsRetryable(err) {
+		return true
+	}
+	if _, ok := AsAPIError(err); ok {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// withRetry calls send, and calls it again for transient errors of GET requests by c.Retry.
+func (c *Client) withRetry(ctx context.Context, method, path string, send func() ([]byte, error)) (resBody []byte, err error) {
+	for attempt := 0; ; attempt++ {
+		resBody, err = send()
+		if method != http.MethodGet || !c.Retry.ShouldRetry(ctx, err, attempt) {
+			return resBody, err
+		}
+		c.Logf("httpreq.%v %v retry %v, err: %v", method, path, attempt+1, err)
+		if c.Retry.Wait(ctx, attempt) != nil {
+			return resBody, err
+		}
+	}
+}
+
+// NewClientOrderId returns a random client order id, which is used to query the order if its status is unknown.
+func NewClientOrderId() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(crand.Reader, b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestRetryPolicy
+func TestRetryPolicy(t *testing.T) {
+	p := &RetryPolicy{MaxRetries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	require.Equal(t, 100*time.Millisecond, p.Delay(0))
+	require.Equal(t, 400*time.Millisecond, p.Delay(2))
+	require.Equal(t, time.Second, p.Delay(10))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Delay(1)
+		require.True(t, d > 100*time.Millisecond && d <= 200*time.Millisecond, d)
+	}
+
+	ctx := context.Background()
+	require.True(t, p.ShouldRetry(ctx, &APIError{StatusCode: 503}, 0))
+	require.True(t, p.ShouldRetry(ctx, &APIError{StatusCode: 200, Code: EC_Timeout}, 0))
+	require.False(t, p.ShouldRetry(ctx, &APIError{StatusCode: 503}, 5))
+	require.False(t, p.ShouldRetry(ctx, &APIError{StatusCode: 400, Code: EC_MarginNotSufficient}, 0))
+	require.False(t, p.ShouldRetry(ctx, &APIError{StatusCode: 429, Code: EC_TooManyRequests}, 0))
+	require.False(t, p.ShouldRetry(ctx, context.DeadlineExceeded, 0))
+	require.False(t, (*RetryPolicy)(nil).ShouldRetry(ctx, &APIError{StatusCode: 503}, 0))
+}
+
+// go test -v -run TestClientRetry
+func TestClientRetry(t *testing.T) {
+	var gets, posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serveTime(w, r) {
+			return
+		}
+		if r.Method == http.MethodPost {
+			posts++
+		} else {
+			gets++
+			if gets > 2 {
+				w.Write([]byte(`{}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"code":-1001,"msg":"Internal error; unable to process your request. Please try again."}`))
+	}))
+	defer srv.Close()
+
+	c := NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "", ""), &Key{ApiKey: "api-key", SecretKey: "secret"})
+	c.Retry = &RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}
+	ctx := context.Background()
+
+	_, err := c.GetWithSign(ctx, "/fapi/v1/openOrders", nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, gets)
+
+	gets = 0
+	_, err = c.GetNoSign(ctx, "/fapi/v1/ticker/price", nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, gets)
+
+	_, err = c.PostWithSign(ctx, "/fapi/v1/order", nil) // not retried
+	require.True(t, IsRetryable(err))
+	require.Equal(t, 1, posts)
+}
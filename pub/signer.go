@@ -0,0 +1,187 @@
+package pub
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+// KeyType is the type of binance api key.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/general-info#signed-trade-and-user_data-endpoint-security
+type KeyType string
+
+const (
+	KT_HMAC    KeyType = "HMAC"
+	KT_RSA     KeyType = "RSA"
+	KT_Ed25519 KeyType = "ED25519"
+)
+
+// Signer signs the payload of requests, the returned signature is sent as the "signature" parameter.
+// The private key can be kept out of the process by implementing Signer, or by NewCryptoSigner of a crypto.Signer.
+type Signer interface {
+	Sign(payload string) (signature string, err error)
+}
+
+// HmacSigner signs by HMAC SHA256, the signature is hex encoded.
+type HmacSigner struct {
+	SecretKey string
+}
+
+func NewHmacSigner(secretKey string) *HmacSigner {
+	return &HmacSigner{SecretKey: secretKey}
+}
+
+func (s *HmacSigner) Sign(payload string) (string, error) {
+	return BinanceHmac256(payload, s.SecretKey), nil
+}
+
+// RsaSigner signs by RSASSA-PKCS1-v1_5 with SHA256, the signature is base64 encoded.
+type RsaSigner struct {
+	PrivateKey *rsa.PrivateKey
+}
+
+// NewRsaSigner loads the RSA private key from PEM, PKCS#1 "RSA PRIVATE KEY" or PKCS#8 "PRIVATE KEY".
+func NewRsaSigner(pemData []byte) (*RsaSigner, error) {
+	pk, err := parsePrivateKeyPem(pemData)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := pk.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("NewRsaSigner: private key is %T, not RSA", pk)
+	}
+	return &RsaSigner{PrivateKey: rsaKey}, nil
+}
+
+func (s *RsaSigner) Sign(payload string) (string, error) {
+	hashed := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.PrivateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Ed25519Signer signs by Ed25519, the signature is base64 encoded.
+type Ed25519Signer struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+// NewEd25519Signer loads the Ed25519 private key from PEM, PKCS#8 "PRIVATE KEY".
+func NewEd25519Signer(pemData []byte) (*Ed25519Signer, error) {
+	pk, err := parsePrivateKeyPem(pemData)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := pk.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("NewEd25519Signer: private key is %T, not Ed25519", pk)
+	}
+	return &Ed25519Signer{PrivateKey: edKey}, nil
+}
+
+func (s *Ed25519Signer) Sign(payload string) (string, error) {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.PrivateKey, []byte(payload))), nil
+}
+
+// CryptoSigner signs by a crypto.Signer of RSA or Ed25519 key, such as a key in HSM or KMS.
+type CryptoSigner struct {
+	signer crypto.Signer
+	opts   crypto.SignerOpts
+	hashed bool
+}
+
+func NewCryptoSigner(signer crypto.Signer) (*CryptoSigner, error) {
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return &CryptoSigner{signer: signer, opts: crypto.SHA256, hashed: true}, nil
+	case ed25519.PublicKey:
+		return &CryptoSigner{signer: signer, opts: crypto.Hash(0)}, nil
+	default:
+		return nil, fmt.Errorf("NewCryptoSigner: unsupported public key %T", pub)
+	}
+}
+
+func (s *CryptoSigner) Sign(payload string) (string, error) {
+	digest := []byte(payload)
+	if s.hashed {
+		hashed := sha256.Sum256(digest)
+		digest = hashed[:]
+	}
+	sig, err := s.signer.Sign(rand.Reader, digest, s.opts)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func parsePrivateKeyPem(pemData []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("parsePrivateKeyPem: no PEM block found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("parsePrivateKeyPem: unsupported PEM type %v", block.Type)
+	}
+}
+
+// NewRsaKey returns a key of RSA type, the private key is loaded from PEM.
+func NewRsaKey(apiKey string, pemData []byte) (*Key, error) {
+	signer, err := NewRsaSigner(pemData)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ApiKey: apiKey, KeyType: KT_RSA, Signer: signer}, nil
+}
+
+// NewEd25519Key returns a key of Ed25519 type, the private key is loaded from PEM.
+func NewEd25519Key(apiKey string, pemData []byte) (*Key, error) {
+	signer, err := NewEd25519Signer(pemData)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ApiKey: apiKey, KeyType: KT_Ed25519, Signer: signer}, nil
+}
+
+// GetSigner returns the Signer of the key, or makes one by KeyType and SecretKey.
+func (k *Key) GetSigner() (Signer, error) {
+	if k.Signer != nil {
+		return k.Signer, nil
+	}
+	switch k.KeyType {
+	case "", KT_HMAC:
+		if k.SecretKey == "" {
+			return nil, fmt.Errorf("Key.GetSigner: secret key is empty")
+		}
+		return NewHmacSigner(k.SecretKey), nil
+	case KT_RSA:
+		return NewRsaSigner([]byte(k.SecretKey))
+	case KT_Ed25519:
+		return NewEd25519Signer([]byte(k.SecretKey))
+	default:
+		return nil, fmt.Errorf("Key.GetSigner: unknown key type %v", k.KeyType)
+	}
+}
+
+// SignParams encodes the params to query string and signs it by the key.
+// The params are sorted by name when sorted is true, which is required by the websocket api.
+func (k *Key) SignParams(params map[string]interface{}, sorted bool) (query string, signature string, err error) {
+	signer, err := k.GetSigner()
+	if err != nil {
+		return "", "", err
+	}
+	query = EncodeQueryString(params, sorted)
+	signature, err = signer.Sign(query)
+	return query, signature, err
+}
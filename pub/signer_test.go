@@ -0,0 +1,129 @@
+package pub
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestHmacSigner
+func TestHmacSigner(t *testing.T) {
+	// the example of binance api document
+	key := &Key{ApiKey: "api-key", SecretKey: "NhqPtmdSJYdKjVHjA7PZj4Mge3R5YNiP1e3UZjInClVN65XAbvqqM6A7H5fATj0j"}
+	signer, err := key.GetSigner()
+	require.NoError(t, err)
+	sig, err := signer.Sign("symbol=LTCBTC&side=BUY&type=LIMIT&timeInForce=GTC&quantity=1&price=0.1&recvWindow=5000&timestamp=1499827319559")
+	require.NoError(t, err)
+	require.Equal(t, "c8db56825ae71d6d79447849e617115f4a920fa2acdcab2b053c4b2838bd6b71", sig)
+}
+
+// go test -v -run TestRsaSigner
+func TestRsaSigner(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	payload := "symbol=BTCUSDT&side=SELL&type=LIMIT&quantity=1&price=0.2&timestamp=1668481559918"
+
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)})
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(pk)
+	require.NoError(t, err)
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes})
+
+	for _, pemData := range [][]byte{pkcs1, pkcs8} {
+		key := &Key{ApiKey: "api-key", SecretKey: string(pemData), KeyType: KT_RSA}
+		_, sig, err := key.SignParams(map[string]interface{}{"symbol": "BTCUSDT"}, true)
+		require.NoError(t, err)
+		require.NoError(t, verifyRsa(&pk.PublicKey, "symbol=BTCUSDT", sig))
+
+		key, err = NewRsaKey("api-key", pemData)
+		require.NoError(t, err)
+		sig, err = key.Signer.Sign(payload)
+		require.NoError(t, err)
+		require.NoError(t, verifyRsa(&pk.PublicKey, payload, sig))
+	}
+
+	cs, err := NewCryptoSigner(pk)
+	require.NoError(t, err)
+	sig, err := cs.Sign(payload)
+	require.NoError(t, err)
+	require.NoError(t, verifyRsa(&pk.PublicKey, payload, sig))
+
+	_, err = NewEd25519Signer(pkcs8)
+	require.Error(t, err)
+}
+
+func verifyRsa(pub *rsa.PublicKey, payload, sig string) error {
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(payload))
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sigBytes)
+}
+
+// go test -v -run TestEd25519Signer
+func TestEd25519Signer(t *testing.T) {
+	pub, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(pk)
+	require.NoError(t, err)
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes})
+	payload := "apiKey=api-key&timestamp=1698707807000"
+
+	key, err := NewEd25519Key("api-key", pemData)
+	require.NoError(t, err)
+	require.Equal(t, KT_Ed25519, key.KeyType)
+	sig, err := key.Signer.Sign(payload)
+	require.NoError(t, err)
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(pub, []byte(payload), sigBytes))
+
+	cs, err := NewCryptoSigner(pk)
+	require.NoError(t, err)
+	sig2, err := cs.Sign(payload)
+	require.NoError(t, err)
+	require.Equal(t, sig, sig2) // ed25519 signature is deterministic
+
+	_, err = NewRsaSigner(pemData)
+	require.Error(t, err)
+	_, err = (&Key{KeyType: KT_Ed25519, SecretKey: "not a pem"}).GetSigner()
+	require.Error(t, err)
+}
+
+// go test -v -run TestSignedRequestEd25519
+func TestSignedRequestEd25519(t *testing.T) {
+	pub, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serveTime(w, r) {
+			return
+		}
+		assert.Equal(t, "api-key", r.Header.Get("X-MBX-APIKEY"))
+		query := r.URL.RawQuery
+		i := strings.Index(query, "&signature=")
+		sigBytes, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("signature"))
+		if assert.True(t, i > 0) && assert.NoError(t, err) {
+			assert.True(t, ed25519.Verify(pub, []byte(query[:i]), sigBytes))
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "", ""), &Key{ApiKey: "api-key", KeyType: KT_Ed25519, Signer: &Ed25519Signer{PrivateKey: pk}})
+	_, err = c.GetWithSign(context.Background(), "/fapi/v3/account", ParamData{"symbol": "BTCUSDT"})
+	require.NoError(t, err)
+}
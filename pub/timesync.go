@@ -0,0 +1,214 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TimeSync estimates the offset of binance server clock to the local clock, which is added to the timestamp of signed requests.
+// Each sync samples the server time several times, and takes the sample of the shortest round trip,
+// the server time is assumed to be taken in the middle of the round trip, so the uncertainty is half of the round trip.
+// The client syncs before its first use, and again in background when the last sync is older than Interval,
+// so Start is not required. It is safe for concurrent use.
+type TimeSync struct {
+	Samples    int                                      // samples of each sync, default 5
+	Interval   time.Duration                            // interval of the background sync, default 10 minutes
+	ServerTime func(ctx context.Context) (int64, error) // returns binance server time in milliseconds, the same as marketdata.CheckServerTime
+
+	mu          sync.RWMutex
+	offset      time.Duration // server time - local time
+	uncertainty time.Duration
+	lastSync    time.Time
+	lastAttempt time.Time  // of Sync, successful or not
+	firstMu     sync.Mutex // the first sync is done once by the concurrent callers
+	syncing     int32
+}
+
+// NewTimeSync returns a TimeSync which gets the server time by serverTime.
+func NewTimeSync(serverTime func(ctx context.Context) (int64, error)) *TimeSync {
+	return &TimeSync{
+		Samples:    5,
+		Interval:   10 * time.Minute,
+		ServerTime: serverTime,
+	}
+}
+
+// Offset returns server time - local time.
+func (t *TimeSync) Offset() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.offset
+}
+
+// Uncertainty returns the maximum error of the offset, half of the round trip of the best sample.
+func (t *TimeSync) Uncertainty() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.uncertainty
+}
+
+// LastSync returns the local time of the last successful sync, zero if never synced.
+func (t *TimeSync) LastSync() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.lastSync
+}
+
+// Now returns the estimated server time.
+func (t *TimeSync) Now() time.Time {
+	return time.Now().Add(t.Offset())
+}
+
+// Sync samples the server time and updates the offset.
+func (t *TimeSync) Sync(ctx context.Context) error {
+	samples := t.Samples
+	if samples <= 0 {
+		samples = 1
+	}
+
+	defer func() {
+		t.mu.Lock()
+		t.lastAttempt = time.Now()
+		t.mu.Unlock()
+	}()
+
+	var bestRtt, bestOffset time.Duration
+	var got int
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		t0 := time.Now()
+		serverMs, err := t.ServerTime(ctx)
+		t1 := time.Now()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rtt := t1.Sub(t0)
+		offset := time.UnixMilli(serverMs).Sub(t0.Add(rtt / 2))
+		if got == 0 || rtt < bestRtt {
+			bestRtt, bestOffset = rtt, offset
+		}
+		got++
+	}
+	if got == 0 {
+		return fmt.Errorf("TimeSync.Sync no sample, last err: %w", lastErr)
+	}
+
+	t.mu.Lock()
+	t.offset = bestOffset
+	t.uncertainty = bestRtt/2 + time.Millisecond // server time is in milliseconds
+	t.lastSync = time.Now()
+	t.mu.Unlock()
+	return nil
+}
+
+// Trigger starts a sync in background if there is no sync running, such as after -1021 errors.
+func (t *TimeSync) Trigger() {
+	if !atomic.CompareAndSwapInt32(&t.syncing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&t.syncing, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		t.Sync(ctx)
+	}()
+}
+
+// ensure syncs at once if it has never synced, and in background if the last sync is older than Interval.
+// A failed sync is not tried again in Interval.
+func (t *TimeSync) ensure(ctx context.Context) error {
+	t.mu.RLock()
+	last := t.lastAttempt
+	t.mu.RUnlock()
+	if !last.IsZero() {
+		if time.Since(last) > t.interval() {
+			t.Trigger()
+		}
+		return nil
+	}
+
+	t.firstMu.Lock()
+	defer t.firstMu.Unlock()
+	t.mu.RLock()
+	last = t.lastAttempt
+	t.mu.RUnlock()
+	if !last.IsZero() { // synced by another caller
+		return nil
+	}
+	return t.Sync(ctx)
+}
+
+func (t *TimeSync) interval() time.Duration {
+	if t.Interval <= 0 {
+		return 10 * time.Minute
+	}
+	return t.Interval
+}
+
+// Start syncs at once and then every Interval until ctx is done.
+func (t *TimeSync) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(t.interval())
+		defer ticker.Stop()
+		for {
+			if atomic.CompareAndSwapInt32(&t.syncing, 0, 1) {
+				t.Sync(ctx)
+				atomic.StoreInt32(&t.syncing, 0)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// serverTime gets the server time by /fapi/v1/time of the client's environment.
+func (c *Client) serverTime(ctx context.Context) (int64, error) {
+	resBody, err := c.GetNoSign(ctx, "/fapi/v1/time", nil)
+	if err != nil {
+		return 0, err
+	}
+	var st struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	if err := json.Unmarshal(resBody, &st); err != nil {
+		return 0, err
+	}
+	return st.ServerTime, nil
+}
+
+// AdjustTime syncs the clock offset of the client.
+func (c *Client) AdjustTime(ctx context.Context) error {
+	if c.TimeSync == nil {
+		return fmt.Errorf("AdjustTime: client has no TimeSync")
+	}
+	return c.TimeSync.Sync(ctx)
+}
+
+// Now returns the estimated server time by TimeSync, or the local time if the client has no TimeSync.
+// Compare it with the times of binance, such as the TransactionTime of the events.
+// The first call syncs with the server within ctx, the local time is used if it fails.
+func (c *Client) Now(ctx context.Context) time.Time {
+	if c.TimeSync == nil {
+		return time.Now()
+	}
+	if err := c.TimeSync.ensure(ctx); err != nil {
+		c.Logf("TimeSync err: %v", err)
+	}
+	return c.TimeSync.Now()
+}
+
+// Timestamp returns the timestamp of signed requests in milliseconds, by the server clock offset of TimeSync.
+func (c *Client) Timestamp(ctx context.Context) int64 {
+	return c.Now(ctx).UnixMilli()
+}
@@ -0,0 +1,92 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// go test -v -run TestTimeSync
+func TestTimeSync(t *testing.T) {
+	ahead := 2 * time.Second
+	var calls int
+	ts := NewTimeSync(func(ctx context.Context) (int64, error) {
+		calls++
+		time.Sleep(time.Duration(calls) * time.Millisecond) // the first sample has the shortest round trip
+		return time.Now().Add(ahead).UnixMilli(), nil
+	})
+	require.Zero(t, ts.Offset())
+	require.True(t, ts.LastSync().IsZero())
+
+	require.NoError(t, ts.Sync(context.Background()))
+	require.Equal(t, 5, calls)
+	require.InDelta(t, float64(ahead), float64(ts.Offset()), float64(10*time.Millisecond))
+	require.Less(t, ts.Uncertainty(), 5*time.Millisecond)
+	require.False(t, ts.LastSync().IsZero())
+
+	ts.ServerTime = func(ctx context.Context) (int64, error) { return 0, fmt.Errorf("network error") }
+	require.Error(t, ts.Sync(context.Background()))
+	require.InDelta(t, float64(ahead), float64(ts.Offset()), float64(10*time.Millisecond)) // keep the last offset
+
+	// the first use syncs once, a failed sync is not tried again in Interval
+	calls = 0
+	ts = NewTimeSync(func(ctx context.Context) (int64, error) {
+		calls++
+		return 0, fmt.Errorf("network error")
+	})
+	require.Error(t, ts.ensure(context.Background()))
+	require.NoError(t, ts.ensure(context.Background()))
+	require.Equal(t, 5, calls)
+	require.Zero(t, ts.Offset())
+}
+
+// go test -v -run TestTimeSyncOnTimestampError
+func TestTimeSyncOnTimestampError(t *testing.T) {
+	var ahead int64 = int64(5 * time.Second) // of the server clock
+	var lastTimestamp int64
+	serverNow := func() time.Time { return time.Now().Add(time.Duration(atomic.LoadInt64(&ahead))) }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/time":
+			fmt.Fprintf(w, `{"serverTime":%d}`, serverNow().UnixMilli())
+		case "/fapi/v1/order":
+			timestamp, _ := strconv.ParseInt(r.URL.Query().Get("timestamp"), 10, 64)
+			atomic.StoreInt64(&lastTimestamp, timestamp)
+			if serverNow().UnixMilli()-timestamp > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-1021,"msg":"Timestamp for this request is outside of the recvWindow."}`))
+				return
+			}
+			w.Write([]byte(`{"orderId":1}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "", ""), &Key{ApiKey: "api-key", SecretKey: "secret"})
+	ctx := context.Background()
+
+	// synced before the first signed request
+	_, err := c.GetWithSign(ctx, "/fapi/v1/order", nil)
+	require.NoError(t, err)
+	require.InDelta(t, float64(5*time.Second), float64(c.TimeSync.Offset()), float64(100*time.Millisecond))
+	lastSync := c.TimeSync.LastSync()
+
+	// the server clock jumps
+	atomic.StoreInt64(&ahead, int64(10*time.Second))
+	_, err = c.GetWithSign(ctx, "/fapi/v1/order", nil)
+	require.True(t, IsTimestampError(err))
+
+	require.Eventually(t, func() bool { return c.TimeSync.LastSync().After(lastSync) }, 5*time.Second, 10*time.Millisecond)
+	require.InDelta(t, float64(10*time.Second), float64(c.TimeSync.Offset()), float64(100*time.Millisecond))
+
+	_, err = c.GetWithSign(ctx, "/fapi/v1/order", nil)
+	require.NoError(t, err)
+	require.InDelta(t, serverNow().UnixMilli(), atomic.LoadInt64(&lastTimestamp), 1000)
+}
@@ -30,6 +30,7 @@ func IsEmpty(obj interface{}) bool {
 	return false
 }
 
+// StructToMap converts the non-empty fields to map by the field names, request structs are encoded by EncodeParams.
 func StructToMap(obj interface{}) map[string]interface{} {
 	objVal := reflect.ValueOf(obj).Elem()
 	objType := objVal.Type()
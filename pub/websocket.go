@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/gorilla/websocket"
@@ -15,17 +14,24 @@ type WsMessage struct {
 	Message []byte
 }
 
+// WsConnect connects to the websocket of DefaultClient's environment.
 func WsConnect(ctx context.Context, urlPath string) (*websocket.Conn, chan *WsMessage, error) {
-	url := futureWssUrl + urlPath
+	return DefaultClient.WsConnect(ctx, urlPath)
+}
+
+// WsConnect connects to urlPath of the client's websocket url, such as "/ws/btcusdt@aggTrade".
+// The channel is closed when the connection is lost, use NewWsConn for a connection which reconnects automatically.
+func (c *Client) WsConnect(ctx context.Context, urlPath string) (*websocket.Conn, chan *WsMessage, error) {
+	url := c.WssUrl + urlPath
 	fmt.Println("WsConnect url:", url)
 
 	if ctx.Err() != nil {
-		log.Printf("WsConnect context err: %v", ctx.Err())
+		c.Logf("WsConnect context err: %v", ctx.Err())
 		return nil, nil, ctx.Err()
 	}
 	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
 	if err != nil {
-		log.Printf("WsConnect websocket dial %s err: %v", url, err)
+		c.Logf("WsConnect websocket dial %s err: %v", url, err)
 		return nil, nil, err
 	}
 
@@ -33,7 +39,10 @@ func WsConnect(ctx context.Context, urlPath string) (*websocket.Conn, chan *WsMe
 
 	go func() { // read message loop
 		defer func() {
-			rawDataChan <- &WsMessage{MsgType: websocket.CloseMessage, Message: nil}
+			select { // don't block if the channel is full and nobody reads it
+			case rawDataChan <- &WsMessage{MsgType: websocket.CloseMessage, Message: nil}:
+			default:
+			}
 			conn.Close()
 			close(rawDataChan)
 			fmt.Printf("WsConnect read message loop exit now.\n")
@@ -41,14 +50,14 @@ func WsConnect(ctx context.Context, urlPath string) (*websocket.Conn, chan *WsMe
 
 		for {
 			if ctx.Err() != nil {
-				log.Printf("OpenWebsocketConn break read loop now because of context err 1: %v", ctx.Err())
+				c.Logf("OpenWebsocketConn break read loop now because of context err 1: %v", ctx.Err())
 				return
 			}
 
 			msgType, message, err := conn.ReadMessage()
 			if err != nil {
 				if !strings.Contains(err.Error(), "normal") { // websocket: close 1000 (normal): Bye
-					log.Printf("OpenWebsocketConn ReadMessage websocket err: %v, exit now.", err)
+					c.Logf("OpenWebsocketConn ReadMessage websocket err: %v, exit now.", err)
 				}
 				return
 			}
@@ -61,19 +70,19 @@ func WsConnect(ctx context.Context, urlPath string) (*websocket.Conn, chan *WsMe
 			var errmsg ErrMsg
 			err = json.Unmarshal(message, &errmsg)
 			if err != nil {
-				log.Printf("OpenWebsocketConn json.Unmarshal err %v, msg:%v", err, message)
+				c.Logf("OpenWebsocketConn json.Unmarshal err %v, msg:%v", err, message)
 				continue
 			}
 
 			if errmsg.Code < 0 { // error happen {code: -xxxx, message: ... }
-				log.Printf("OpenWebsocketConn websocket got err message: %+v", errmsg)
+				c.Logf("OpenWebsocketConn websocket got err message: %+v", errmsg)
 				return
 			}
 
 			select {
 			case rawDataChan <- &WsMessage{MsgType: msgType, Message: message}:
 			case <-ctx.Done():
-				log.Printf("OpenWebsocketConn break read loop now because of context err 2: %v", ctx.Err())
+				c.Logf("OpenWebsocketConn break read loop now because of context err 2: %v", ctx.Err())
 				return
 			}
 		}
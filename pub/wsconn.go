@@ -0,0 +1,526 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WsEventType is the lifecycle event of WsConn.
+type WsEventType int
+
+const (
+	WE_Connected    WsEventType = iota + 1 // connected, or rotated to a new connection
+	WE_Disconnected                        // connection lost or dial failed, it will reconnect after backoff
+	WE_Resubscribed                        // active subscriptions are sent again on the new connection
+	WE_Gap                                 // messages between GapStart and GapEnd may be missing
+	WE_Closed                              // closed by the context, no more messages
+)
+
+func (t WsEventType) String() string {
+	switch t {
+	case WE_Connected:
+		return "CONNECTED"
+	case WE_Disconnected:
+		return "DISCONNECTED"
+	case WE_Resubscribed:
+		return "RESUBSCRIBED"
+	case WE_Gap:
+		return "GAP"
+	case WE_Closed:
+		return "CLOSED"
+	}
+	return fmt.Sprintf("WsEventType(%d)", int(t))
+}
+
+// WsEvent is sent to WsConn.Events.
+type WsEvent struct {
+	Type     WsEventType
+	Time     time.Time
+	Err      error     // reason of WE_Disconnected
+	Attempt  int       // reconnect attempt of WE_Disconnected, 0 for the first failure
+	Rotated  bool      // WE_Connected by the proactive rotation, no messages are missing
+	Streams  []string  // streams of WE_Resubscribed, and of WE_Gap by streammarket.SubscriptionManager
+	GapStart time.Time // time of the last message before WE_Gap
+	GapEnd   time.Time // time of reconnection
+}
+
+const (
+	defaultWsLifetime    = 23*time.Hour + 30*time.Minute // binance disconnects a connection after 24 hours
+	defaultWsMsgInterval = 110 * time.Millisecond        // binance limits 10 incoming messages per second of each connection
+	wsEventChanLen       = 32
+)
+
+// ErrWsConnChanged is returned by WsConn.RequestOn when the connection of the generation is not active any more.
+var ErrWsConnChanged = errors.New("websocket connection changed")
+
+// WsResponse is the response of the requests like SUBSCRIBE, LIST_SUBSCRIPTIONS.
+type WsResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *WsError        `json:"error"`
+	Id     int64           `json:"id"`
+	Status int             `json:"status"` // http status like code of the websocket api, 0 for market streams
+}
+
+// WsError is the error response of websocket requests, such as {"code": 2, "msg": "Invalid request: unknown variant"}.
+type WsError struct {
+	Code   int    `json:"code"`
+	Msg    string `json:"msg"`
+	Status int    `json:"-"` // Status of the WsResponse
+}
+
+func (e *WsError) Error() string {
+	return fmt.Sprintf("websocket request error: code %v, msg: %v", e.Code, e.Msg)
+}
+
+// WsConn is a managed websocket connection which reconnects with backoff after errors,
+// subscribes the active streams again on the new connection, and rotates to a new connection before binance's 24 hours disconnect.
+// The connection is rotated by connecting the new one before closing the old one, so messages may be duplicated but not missing around rotation.
+// The lifecycle events are sent to Events, including WE_Gap after reconnection, so consumers know data may be missing,
+// such as to fetch the order book snapshot again.
+type WsConn struct {
+	Backoff  *RetryPolicy  // backoff of reconnection, MaxRetries is not used, it reconnects until the context is done
+	Lifetime time.Duration // rotate the connection after Lifetime, default 23.5 hours
+	// min interval of the messages sent, 110ms by default for binance's limit of 10 incoming messages per second
+	MsgInterval time.Duration
+
+	client  *Client
+	baseUrl string
+	urlPath string
+	msgs    chan *WsMessage
+	events  chan WsEvent
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	subs      map[string]bool            // active subscriptions by Subscribe
+	pending   map[int64]chan *WsResponse // requests waiting for response by id
+	writeMu   sync.Mutex
+	lastWrite time.Time
+
+	readers sync.WaitGroup
+	gen     int64 // generation of the active connection, messages of old connections are dropped
+	lastMsg int64 // unix nano of the last message
+	nextId  int64
+	started int32
+}
+
+// NewWsConn returns a managed connection to urlPath of the client's websocket url, such as "/ws/btcusdt@aggTrade" or "/stream",
+// call Start to connect.
+func (c *Client) NewWsConn(urlPath string) *WsConn {
+	return &WsConn{
+		Backoff:     &RetryPolicy{BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second, Jitter: 0.5},
+		Lifetime:    defaultWsLifetime,
+		MsgInterval: defaultWsMsgInterval,
+		client:      c,
+		baseUrl:     c.WssUrl,
+		urlPath:     urlPath,
+		msgs:        make(chan *WsMessage, WsChanLen),
+		events:      make(chan WsEvent, wsEventChanLen),
+		subs:        map[string]bool{},
+		pending:     map[int64]chan *WsResponse{},
+	}
+}
+
+// NewWsApiConn returns a managed connection to the websocket api url of the client, for the requests like order.place,
+// the messages are not throttled by MsgInterval, which is the limit of market streams.
+func (c *Client) NewWsApiConn() *WsConn {
+	w := c.NewWsConn("")
+	w.baseUrl = c.WsApiUrl
+	w.MsgInterval = 0
+	return w
+}
+
+// Messages returns the channel of messages, it is closed after the context is done.
+func (w *WsConn) Messages() <-chan *WsMessage {
+	return w.msgs
+}
+
+// Events returns the channel of lifecycle events, it is closed after WE_Closed.
+// Events are dropped if the channel is full.
+func (w *WsConn) Events() <-chan WsEvent {
+	return w.events
+}
+
+// Start connects and keeps the connection until ctx is done.
+// It returns the error of the first connection, and does not reconnect in that case.
+func (w *WsConn) Start(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&w.started, 0, 1) {
+		return fmt.Errorf("WsConn %v already started", w.urlPath)
+	}
+	conn, err := w.connect(ctx)
+	if err != nil {
+		close(w.msgs)
+		close(w.events)
+		return err
+	}
+	gen := w.activate(conn) // requests can be sent after Start returns
+	go w.run(ctx, conn, gen)
+	return nil
+}
+
+// Subscribe subscribes the streams, they are subscribed again after reconnection.
+// The streams subscribed before Start are sent after connected.
+func (w *WsConn) Subscribe(streams ...string) error {
+	w.mu.Lock()
+	for _, s := range streams {
+		w.subs[s] = true
+	}
+	conn := w.conn
+	w.mu.Unlock()
+	if conn == nil { // sent after connected
+		return nil
+	}
+	_, err := w.writeRequest(conn, "SUBSCRIBE", streams)
+	return err
+}
+
+// Unsubscribe unsubscribes the streams.
+func (w *WsConn) Unsubscribe(streams ...string) error {
+	w.mu.Lock()
+	for _, s := range streams {
+		delete(w.subs, s)
+	}
+	conn := w.conn
+	w.mu.Unlock()
+	if conn == nil { // sent after connected
+		return nil
+	}
+	_, err := w.writeRequest(conn, "UNSUBSCRIBE", streams)
+	return err
+}
+
+// Subscriptions returns the active streams subscribed by Subscribe, sorted by name.
+func (w *WsConn) Subscriptions() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	streams := make([]string, 0, len(w.subs))
+	for s := range w.subs {
+		streams = append(streams, s)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// WriteRequest sends a request like {"method":"SUBSCRIBE","params":["btcusdt@aggTrade"],"id":1} and returns its id,
+// the response is sent to Messages.
+func (w *WsConn) WriteRequest(method string, params interface{}) (int64, error) {
+	w.mu.Lock()
+	conn := w.conn
+	w.mu.Unlock()
+	if conn == nil {
+		return 0, fmt.Errorf("WsConn %v is not connected", w.urlPath)
+	}
+	return w.writeRequest(conn, method, params)
+}
+
+// Generation returns the generation of the active connection, it is changed by each new connection including
+// the rotated one, so the state of a connection, such as the logon of the websocket api, can be tied to it.
+func (w *WsConn) Generation() int64 {
+	return atomic.LoadInt64(&w.gen)
+}
+
+// Request sends a request and waits for its response until ctx is done, the result is returned, or the *WsError.
+func (w *WsConn) Request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	return w.RequestOn(ctx, 0, method, params)
+}
+
+// RequestOn is Request on the connection of the generation, it fails with ErrWsConnChanged if the active
+// connection is another one. Any connection is used if gen is 0.
+func (w *WsConn) RequestOn(ctx context.Context, gen int64, method string, params interface{}) (json.RawMessage, error) {
+	w.mu.Lock()
+	conn := w.conn
+	changed := gen != 0 && gen != atomic.LoadInt64(&w.gen)
+	w.mu.Unlock()
+	if conn == nil {
+		return nil, fmt.Errorf("WsConn %v is not connected", w.urlPath)
+	}
+	if changed {
+		return nil, fmt.Errorf("WsConn %v %v: %w", w.urlPath, method, ErrWsConnChanged)
+	}
+
+	id := atomic.AddInt64(&w.nextId, 1)
+	ch := make(chan *WsResponse, 1)
+	w.mu.Lock()
+	w.pending[id] = ch
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.pending, id)
+		w.mu.Unlock()
+	}()
+
+	if err := w.write(ctx, conn, id, method, params); err != nil {
+		return nil, err
+	}
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("WsConn %v %v no response: connection lost", w.urlPath, method)
+		}
+		if resp.Error != nil {
+			resp.Error.Status = resp.Status
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("WsConn %v %v no response: %w", w.urlPath, method, ctx.Err())
+	}
+}
+
+// SubscribeWait subscribes the streams and waits for the response, the streams are not kept if it fails.
+func (w *WsConn) SubscribeWait(ctx context.Context, streams ...string) error {
+	w.mu.Lock()
+	added := make([]string, 0, len(streams))
+	for _, s := range streams {
+		if !w.subs[s] {
+			w.subs[s] = true
+			added = append(added, s)
+		}
+	}
+	w.mu.Unlock()
+
+	_, err := w.Request(ctx, "SUBSCRIBE", streams)
+	if err != nil {
+		w.mu.Lock()
+		for _, s := range added {
+			delete(w.subs, s)
+		}
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// UnsubscribeWait unsubscribes the streams and waits for the response.
+func (w *WsConn) UnsubscribeWait(ctx context.Context, streams ...string) error {
+	_, err := w.Request(ctx, "UNSUBSCRIBE", streams)
+	if err == nil {
+		w.mu.Lock()
+		for _, s := range streams {
+			delete(w.subs, s)
+		}
+		w.mu.Unlock()
+	}
+	return err
+}
+
+func (w *WsConn) writeRequest(conn *websocket.Conn, method string, params interface{}) (int64, error) {
+	id := atomic.AddInt64(&w.nextId, 1)
+	return id, w.write(context.Background(), conn, id, method, params)
+}
+
+// write sends the request, the messages are sent one by one with MsgInterval.
+func (w *WsConn) write(ctx context.Context, conn *websocket.Conn, id int64, method string, params interface{}) error {
+	req := map[string]interface{}{"method": method, "id": id}
+	if params != nil {
+		req["params"] = params
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	if wait := time.Until(w.lastWrite.Add(w.MsgInterval)); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	w.lastWrite = time.Now()
+	return conn.WriteMessage(websocket.TextMessage, b)
+}
+
+// dispatchResponse sends the response to the waiting Request, it returns false if the message is not a response of Request.
+func (w *WsConn) dispatchResponse(message []byte) bool {
+	m := bytes.TrimLeft(message, " \t\r\n")
+	if !bytes.HasPrefix(m, []byte(`{"result"`)) && !bytes.HasPrefix(m, []byte(`{"error"`)) && !bytes.HasPrefix(m, []byte(`{"id"`)) {
+		return false
+	}
+	var resp WsResponse
+	if err := json.Unmarshal(message, &resp); err != nil {
+		return false
+	}
+	w.mu.Lock()
+	ch, ok := w.pending[resp.Id]
+	delete(w.pending, resp.Id)
+	w.mu.Unlock()
+	if ok {
+		ch <- &resp
+	}
+	return ok
+}
+
+// LastMessageTime returns the time of the last message, zero if no message.
+func (w *WsConn) LastMessageTime() time.Time {
+	ns := atomic.LoadInt64(&w.lastMsg)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+func (w *WsConn) emit(e WsEvent) {
+	e.Time = time.Now()
+	select {
+	case w.events <- e:
+	default:
+		w.client.Logf("WsConn %v events chan is full, drop %v", w.urlPath, e.Type)
+	}
+}
+
+// connect dials and subscribes the active streams.
+func (w *WsConn) connect(ctx context.Context) (*websocket.Conn, error) {
+	url := w.baseUrl + w.urlPath
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("WsConn dial %v err: %w", url, err)
+	}
+
+	streams := w.Subscriptions()
+	if len(streams) > 0 {
+		if _, err := w.writeRequest(conn, "SUBSCRIBE", streams); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("WsConn %v resubscribe err: %w", url, err)
+		}
+		w.emit(WsEvent{Type: WE_Resubscribed, Streams: streams})
+	}
+	return conn, nil
+}
+
+func (w *WsConn) run(ctx context.Context, conn *websocket.Conn, gen int64) {
+	defer func() {
+		w.readers.Wait() // no more sending to msgs
+		w.emit(WsEvent{Type: WE_Closed, Err: ctx.Err()})
+		close(w.msgs)
+		close(w.events)
+	}()
+
+	for attempt := 0; ; {
+		w.emit(WsEvent{Type: WE_Connected})
+		err := w.serve(ctx, conn, gen)
+		lastMsg := w.LastMessageTime()
+		w.client.Logf("WsConn %v disconnected: %v", w.urlPath, err)
+		if ctx.Err() != nil {
+			return
+		}
+		w.emit(WsEvent{Type: WE_Disconnected, Err: err})
+
+		for conn = nil; conn == nil; attempt++ {
+			if w.Backoff.Wait(ctx, attempt) != nil {
+				return
+			}
+			if conn, err = w.connect(ctx); err != nil {
+				w.emit(WsEvent{Type: WE_Disconnected, Err: err, Attempt: attempt + 1})
+			}
+		}
+		attempt = 0
+		gen = w.activate(conn) // before WE_Connected, so requests can be sent on the event
+		w.emit(WsEvent{Type: WE_Gap, GapStart: lastMsg, GapEnd: time.Now()})
+	}
+}
+
+// serve reads the connection and rotates it by Lifetime, until read error or ctx is done.
+func (w *WsConn) serve(ctx context.Context, conn *websocket.Conn, gen int64) error {
+	lifetime := w.Lifetime
+	if lifetime <= 0 {
+		lifetime = defaultWsLifetime
+	}
+	rotateTimer := time.NewTimer(lifetime)
+	defer rotateTimer.Stop()
+
+	readErr, stop := w.startReader(ctx, conn, gen)
+	defer func() {
+		close(stop)
+		w.mu.Lock()
+		if w.conn == conn {
+			w.conn = nil
+		}
+		for id, ch := range w.pending { // the responses are lost with the connection
+			close(ch)
+			delete(w.pending, id)
+		}
+		w.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.writeMu.Lock()
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			w.writeMu.Unlock()
+			return ctx.Err()
+
+		case err := <-readErr:
+			return err
+
+		case <-rotateTimer.C:
+			newConn, err := w.connect(ctx)
+			if err != nil { // keep the old one and try again later
+				w.client.Logf("WsConn %v rotate err: %v", w.urlPath, err)
+				rotateTimer.Reset(time.Minute)
+				continue
+			}
+			gen = w.activate(newConn)
+			close(stop)
+			conn.Close()
+			conn = newConn
+			readErr, stop = w.startReader(ctx, conn, gen)
+			rotateTimer.Reset(lifetime)
+			w.emit(WsEvent{Type: WE_Connected, Rotated: true})
+		}
+	}
+}
+
+// activate makes conn the active connection of a new generation, and returns the generation.
+func (w *WsConn) activate(conn *websocket.Conn) int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn = conn
+	return atomic.AddInt64(&w.gen, 1)
+}
+
+// startReader reads conn of the generation in a goroutine, until read error or stop is closed.
+func (w *WsConn) startReader(ctx context.Context, conn *websocket.Conn, gen int64) (<-chan error, chan struct{}) {
+
+	readErr := make(chan error, 1)
+	stop := make(chan struct{})
+	w.readers.Add(1)
+	go func() {
+		defer w.readers.Done()
+		for {
+			msgType, message, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			if atomic.LoadInt64(&w.gen) != gen { // rotated
+				return
+			}
+			atomic.StoreInt64(&w.lastMsg, time.Now().UnixNano())
+			if w.dispatchResponse(message) {
+				continue
+			}
+			select {
+			case w.msgs <- &WsMessage{MsgType: msgType, Message: message}:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return readErr, stop
+}
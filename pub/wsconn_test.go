@@ -0,0 +1,176 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// mockWsServer sends "msg" every 10ms and closes the first connection after 3 messages.
+type mockWsServer struct {
+	mu    sync.Mutex
+	conns int
+	reqs  []string // requests received
+}
+
+func (m *mockWsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	m.mu.Lock()
+	m.conns++
+	n := m.conns
+	m.mu.Unlock()
+
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			m.mu.Lock()
+			m.reqs = append(m.reqs, string(msg))
+			m.mu.Unlock()
+		}
+	}()
+	for i := 0; ; i++ {
+		if n == 1 && i == 3 {
+			return // lost connection
+		}
+		b, _ := json.Marshal(map[string]interface{}{"e": "test", "conn": n, "i": i})
+		if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newMockWsClient(srv *httptest.Server) *Client {
+	return NewEnvClient(CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), nil)
+}
+
+func waitWsEvent(t *testing.T, w *WsConn, typ WsEventType) WsEvent {
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case e := <-w.Events():
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no event %v", typ)
+		}
+	}
+}
+
+// go test -v -run TestWsConnReconnect
+func TestWsConnReconnect(t *testing.T) {
+	mock := &mockWsServer{}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := newMockWsClient(srv).NewWsConn("/stream")
+	w.Backoff = &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	require.NoError(t, w.Subscribe("btcusdt@aggTrade"))
+	require.NoError(t, w.Start(ctx))
+	require.Error(t, w.Start(ctx))
+
+	go func() { // consume messages
+		for range w.Messages() {
+		}
+	}()
+
+	require.Equal(t, []string{"btcusdt@aggTrade"}, waitWsEvent(t, w, WE_Resubscribed).Streams)
+	waitWsEvent(t, w, WE_Connected)
+	require.Error(t, waitWsEvent(t, w, WE_Disconnected).Err)
+	require.Equal(t, []string{"btcusdt@aggTrade"}, waitWsEvent(t, w, WE_Resubscribed).Streams)
+	gap := waitWsEvent(t, w, WE_Gap)
+	require.False(t, gap.GapStart.IsZero())
+	require.True(t, gap.GapEnd.After(gap.GapStart))
+	waitWsEvent(t, w, WE_Connected)
+
+	require.NoError(t, w.Subscribe("ethusdt@aggTrade"))
+	require.NoError(t, w.Unsubscribe("btcusdt@aggTrade"))
+	require.Equal(t, []string{"ethusdt@aggTrade"}, w.Subscriptions())
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	waitWsEvent(t, w, WE_Closed)
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	require.Equal(t, 2, mock.conns)
+	require.Len(t, mock.reqs, 4) // subscribe on each connection, subscribe, unsubscribe
+	require.Contains(t, mock.reqs[0], `"method":"SUBSCRIBE"`)
+	require.Contains(t, mock.reqs[3], `"method":"UNSUBSCRIBE"`)
+}
+
+// go test -v -run TestWsConnRotate
+func TestWsConnRotate(t *testing.T) {
+	mock := &mockWsServer{conns: 1} // no lost connection
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := newMockWsClient(srv).NewWsConn("/ws/btcusdt@aggTrade")
+	w.Lifetime = 100 * time.Millisecond
+	require.NoError(t, w.Start(ctx))
+
+	waitWsEvent(t, w, WE_Connected)
+	e := waitWsEvent(t, w, WE_Connected)
+	require.True(t, e.Rotated)
+
+	// messages of the new connection are received, no gap
+	var last map[string]interface{}
+	for msg := range w.Messages() {
+		require.NoError(t, json.Unmarshal(msg.Message, &last))
+		if last["conn"].(float64) >= 3 {
+			break
+		}
+	}
+	cancel()
+	for range w.Messages() {
+	}
+	for e := range w.Events() {
+		require.NotEqual(t, WE_Gap, e.Type)
+		require.NotEqual(t, WE_Disconnected, e.Type)
+	}
+}
+
+// go test -v -run TestWsConnDialErr
+func TestWsConnDialErr(t *testing.T) {
+	c := NewEnvClient(CustomEnv("mock", "", "", "ws://127.0.0.1:1", ""), nil)
+	w := c.NewWsConn("/ws/btcusdt@aggTrade")
+	require.Error(t, w.Start(context.Background()))
+	_, ok := <-w.Messages()
+	require.False(t, ok)
+}
+
+// go test -v -run TestWsConnRequestLost
+func TestWsConnRequestLost(t *testing.T) {
+	srv := httptest.NewServer(&mockWsServer{}) // the first connection is lost without the response
+	defer srv.Close()
+	w := newMockWsClient(srv).NewWsConn("/ws")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, w.Start(ctx))
+
+	start := time.Now()
+	rctx, rcancel := context.WithTimeout(ctx, 3*time.Second)
+	defer rcancel()
+	_, err := w.Request(rctx, "LIST_SUBSCRIPTIONS", nil)
+	require.ErrorContains(t, err, "connection lost")
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,125 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+// Limits are the limits of a symbol, the zero values are not checked.
+type Limits struct {
+	MaxOrderNotional    pub.Decimal `json:"maxOrderNotional"`    // notional of an order
+	MaxPositionNotional pub.Decimal `json:"maxPositionNotional"` // absolute notional of the position after an order
+	MaxPositionQty      pub.Decimal `json:"maxPositionQty"`      // absolute amount of the position after an order
+	MaxOpenOrders       int         `json:"maxOpenOrders"`       // open orders of the symbol
+	MaxPriceDeviation   pub.Decimal `json:"maxPriceDeviation"`   // deviation of the order price from the mark price, such as 0.05 for 5%
+	MaxLeverage         int         `json:"maxLeverage"`
+}
+
+// merge returns the limits with the non-zero fields of o.
+func (l Limits) merge(o Limits) Limits {
+	if !o.MaxOrderNotional.IsZero() {
+		l.MaxOrderNotional = o.MaxOrderNotional
+	}
+	if !o.MaxPositionNotional.IsZero() {
+		l.MaxPositionNotional = o.MaxPositionNotional
+	}
+	if !o.MaxPositionQty.IsZero() {
+		l.MaxPositionQty = o.MaxPositionQty
+	}
+	if o.MaxOpenOrders != 0 {
+		l.MaxOpenOrders = o.MaxOpenOrders
+	}
+	if !o.MaxPriceDeviation.IsZero() {
+		l.MaxPriceDeviation = o.MaxPriceDeviation
+	}
+	if o.MaxLeverage != 0 {
+		l.MaxLeverage = o.MaxLeverage
+	}
+	return l
+}
+
+// Config is the configuration of the risk rules, it can be loaded from a JSON file, such as
+//
+//	{"maxOrderNotional": "10000", "maxLeverage": 20, "symbols": {"BTCUSDT": {"maxOrderNotional": "50000"}},
+//	 "allowedSymbols": ["BTCUSDT", "ETHUSDT"], "dailyLossLimit": "1000", "maxOrdersPerSecond": 5}
+type Config struct {
+	Limits                               // the default limits of all symbols
+	Symbols            map[string]Limits `json:"symbols"`            // the limits of the symbols override the non-zero defaults
+	AllowedSymbols     []string          `json:"allowedSymbols"`     // empty allows all symbols
+	DailyLossLimit     pub.Decimal       `json:"dailyLossLimit"`     // positive amount, the orders are rejected after the loss of the day reaches it
+	MaxOrdersPerSecond int               `json:"maxOrdersPerSecond"` // accepted orders
+	MaxOrdersPerMinute int               `json:"maxOrdersPerMinute"`
+	Disabled           []string          `json:"disabled"` // names of the rules which are not checked
+}
+
+// LoadConfig reads the config from the JSON file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("risk: config %v: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("risk: config %v: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks the values of the config.
+func (c *Config) Validate() error {
+	check := func(name string, l Limits) error {
+		if l.MaxOrderNotional.IsNegative() || l.MaxPositionNotional.IsNegative() || l.MaxPositionQty.IsNegative() ||
+			l.MaxPriceDeviation.IsNegative() || l.MaxOpenOrders < 0 || l.MaxLeverage < 0 {
+			return fmt.Errorf("negative limit of %v", name)
+		}
+		return nil
+	}
+	if err := check("default", c.Limits); err != nil {
+		return err
+	}
+	for s, l := range c.Symbols {
+		if err := check(s, l); err != nil {
+			return err
+		}
+	}
+	if c.DailyLossLimit.IsNegative() || c.MaxOrdersPerSecond < 0 || c.MaxOrdersPerMinute < 0 {
+		return fmt.Errorf("negative limit")
+	}
+	return nil
+}
+
+// For returns the limits of the symbol.
+func (c *Config) For(symbol string) Limits {
+	if l, ok := c.Symbols[symbol]; ok {
+		return c.Limits.merge(l)
+	}
+	return c.Limits
+}
+
+// Allowed reports whether the symbol is in AllowedSymbols, or AllowedSymbols is empty.
+func (c *Config) Allowed(symbol string) bool {
+	if len(c.AllowedSymbols) == 0 {
+		return true
+	}
+	for _, s := range c.AllowedSymbols {
+		if s == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) disabled(rule string) bool {
+	for _, r := range c.Disabled {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
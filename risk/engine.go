@@ -0,0 +1,419 @@
+// Package risk checks the orders by configurable pre-trade risk rules before they are sent, such as the max
+// notional of an order, the max position of a symbol and the daily loss limit. The config can be hot-reloaded.
+package risk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/balances"
+	"github.com/billfort/binance-usdmfuture/orders"
+	"github.com/billfort/binance-usdmfuture/positions"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+// pnlReasons are the reasons of the balance changes which are the profit or loss of trading.
+var pnlReasons = map[pub.UpdateReason]bool{
+	pub.UR_Order:               true,
+	pub.UR_FundingFee:          true,
+	pub.UR_InsuranceClear:      true,
+	pub.UR_OptionsPremiumFee:   true,
+	pub.UR_OptionsSettleProfit: true,
+}
+
+// Engine checks the orders by the rules of its config, then sends the accepted ones. The state of the checks is
+// got by the functions, a nil one skips the checks which need it. It is safe for concurrent use.
+//
+// The orders being sent by NewOrder and BatchOrders are counted in the positions and open orders of the checks
+// until their responses arrive, so concurrent orders cannot pass the limits together.
+type Engine struct {
+	MarkPrice  func(symbol string) (pub.Decimal, bool)
+	Position   func(symbol string, side pub.PositionSide) pub.Decimal // signed amount of the side, BOTH is the net amount
+	OpenOrders func(symbol string) int
+	Leverage   func(symbol string) int
+	DailyPnl   func() pub.Decimal // profit of the day, negative for a loss
+
+	client *trade.Client
+	cfg    atomic.Pointer[Config]
+
+	mu          sync.Mutex
+	rules       []Rule
+	accepted    []time.Time            // of the last minute, for the order rate
+	sendingQty  map[posKey]pub.Decimal // signed quantities of the orders being sent
+	sendingOpen map[string]int         // orders being sent by symbol
+
+	baseMu     sync.Mutex
+	unrealized func() pub.Decimal // of the book of Use
+	baseDay    int64              // start of the UTC day of base, milliseconds
+	base       pub.Decimal        // unrealized profit the profit of baseDay counts from
+	baseTime   time.Time          // when base is taken
+}
+
+// posKey is the position of an order, Side is BOTH for one-way mode.
+type posKey struct {
+	symbol string
+	side   pub.PositionSide
+}
+
+func orderPosKey(op *trade.OrderParam) posKey {
+	if op.PositionSide == pub.PS_Long || op.PositionSide == pub.PS_Short {
+		return posKey{symbol: op.Symbol, side: op.PositionSide}
+	}
+	return posKey{symbol: op.Symbol, side: pub.PS_Both}
+}
+
+// NewEngine returns an engine of the default rules and the config, nil for no limits.
+func NewEngine(c *pub.Client, cfg *Config) *Engine {
+	e := &Engine{
+		client:      trade.NewClient(c),
+		rules:       DefaultRules(),
+		sendingQty:  map[posKey]pub.Decimal{},
+		sendingOpen: map[string]int{},
+	}
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	e.cfg.Store(cfg)
+	return e
+}
+
+// Use gets the state of the checks from the components, the nil ones are not used: the mark prices, positions and
+// leverages from the book, the open orders from the tracker, and the profit of the day since 00:00 UTC from the
+// realized profit, fees and funding fees of the ledger plus the change of the unrealized profit of the book. The
+// unrealized profit is counted from its baseline, taken now and at each 00:00 UTC by Start, so the positions carried
+// over from the previous days are not counted by their losses before it. Without Start, the baseline of a new day
+// is taken at its first check, see UnrealizedBase.
+func (e *Engine) Use(book *positions.Book, tracker *orders.Tracker, ledger *balances.Ledger) {
+	if book != nil {
+		e.MarkPrice = book.MarkPrice
+		e.Position = func(symbol string, side pub.PositionSide) pub.Decimal {
+			if side == pub.PS_Long || side == pub.PS_Short {
+				p, _ := book.Get(symbol, side)
+				return p.Amount
+			}
+			return book.NetAmount(symbol)
+		}
+		e.Leverage = book.Leverage
+	}
+	if tracker != nil {
+		e.OpenOrders = func(symbol string) int { return len(tracker.Open(symbol)) }
+	}
+	if ledger != nil {
+		if book != nil {
+			e.baseMu.Lock()
+			e.unrealized = book.UnrealizedPnl
+			e.baseMu.Unlock()
+			e.takeBase(time.Now())
+		}
+		e.DailyPnl = func() pub.Decimal {
+			now := time.Now()
+			var pnl pub.Decimal
+			for r, v := range ledger.DaySummary(dayStart(now)) {
+				if pnlReasons[r] {
+					pnl = pnl.Add(v)
+				}
+			}
+			return pnl.Add(e.unrealizedChange(now))
+		}
+	}
+}
+
+func dayStart(t time.Time) int64 {
+	return t.UTC().Truncate(24 * time.Hour).UnixMilli()
+}
+
+// takeBase takes the unrealized profit of the book as the baseline of the day of now.
+func (e *Engine) takeBase(now time.Time) {
+	e.baseMu.Lock()
+	defer e.baseMu.Unlock()
+	if e.unrealized != nil {
+		e.baseDay, e.base, e.baseTime = dayStart(now), e.unrealized(), now
+	}
+}
+
+// unrealizedChange returns the change of the unrealized profit since the baseline, which is taken now if it is not
+// of the day of now.
+func (e *Engine) unrealizedChange(now time.Time) pub.Decimal {
+	e.baseMu.Lock()
+	defer e.baseMu.Unlock()
+	if e.unrealized == nil {
+		return pub.Decimal{}
+	}
+	u := e.unrealized()
+	if day := dayStart(now); e.baseDay != day {
+		e.baseDay, e.base, e.baseTime = day, u, now
+	}
+	return u.Sub(e.base)
+}
+
+// UnrealizedBase returns the unrealized profit the profit of the day counts from, and when it was taken,
+// zero if Use has no book.
+func (e *Engine) UnrealizedBase() (pub.Decimal, time.Time) {
+	e.baseMu.Lock()
+	defer e.baseMu.Unlock()
+	return e.base, e.baseTime
+}
+
+// Start takes the baseline of the unrealized profit at each 00:00 UTC until ctx is done.
+func (e *Engine) Start(ctx context.Context) {
+	go func() {
+		for {
+			next := time.UnixMilli(dayStart(time.Now())).Add(24 * time.Hour)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			e.takeBase(time.Now())
+		}
+	}()
+}
+
+// Config returns the current config, it must not be modified.
+func (e *Engine) Config() *Config {
+	return e.cfg.Load()
+}
+
+// SetConfig validates and replaces the config, the checks after it use the new one.
+func (e *Engine) SetConfig(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("risk: config: %w", err)
+	}
+	e.cfg.Store(cfg)
+	return nil
+}
+
+// AddRule adds a custom rule, it is checked after the built-in ones.
+func (e *Engine) AddRule(r Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = append(e.rules, r)
+}
+
+// WatchConfig loads the config from the JSON file, then reloads it when the file is modified, checked every
+// interval until ctx is done. An invalid file is logged and the previous config is kept.
+func (e *Engine) WatchConfig(ctx context.Context, path string, interval time.Duration) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	e.cfg.Store(cfg)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	modTime := fi.ModTime()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			fi, err := os.Stat(path)
+			if err != nil || fi.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = fi.ModTime()
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				e.client.Logf("risk WatchConfig err: %v", err)
+				continue
+			}
+			e.cfg.Store(cfg)
+			e.client.Logf("risk config %v reloaded", path)
+		}
+	}()
+	return nil
+}
+
+// Check checks the order by the rules without sending it, it returns Rejections if it is rejected.
+func (e *Engine) Check(op *trade.OrderParam) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.check([]trade.OrderParam{*op}, time.Now(), false)
+	return err
+}
+
+// NewOrder sends the order by trade.NewOrder if it is accepted by the rules, or returns Rejections.
+func (e *Engine) NewOrder(ctx context.Context, op *trade.OrderParam) (*trade.OrderResponse, error) {
+	e.mu.Lock()
+	s, err := e.check([]trade.OrderParam{*op}, time.Now(), true)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer e.release(s)
+	return e.client.NewOrder(ctx, op)
+}
+
+// BatchOrders sends the orders by trade.BatchOrders if all of them are accepted by the rules, the orders are checked
+// in turn as the previous ones of the batch are open and filled. It returns Rejections of all rejected orders.
+func (e *Engine) BatchOrders(ctx context.Context, ops []trade.OrderParam) ([]trade.OrderResponse, error) {
+	e.mu.Lock()
+	s, err := e.check(ops, time.Now(), true)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer e.release(s)
+	return e.client.BatchOrders(ctx, ops)
+}
+
+// SetLeverage sets the leverage of the symbol by trade.SetLeverage if it is not over the max leverage of the config.
+func (e *Engine) SetLeverage(ctx context.Context, symbol string, leverage int) error {
+	if max := e.Config().For(symbol).MaxLeverage; max > 0 && leverage > max {
+		return Rejections{{Rule: R_Leverage, Symbol: symbol, Reason: fmt.Sprintf("leverage %v is over %v", leverage, max)}}
+	}
+	_, err := e.client.SetLeverage(ctx, symbol, leverage)
+	return err
+}
+
+// sending is the orders of a NewOrder or BatchOrders call which are being sent.
+type sending struct {
+	qty  map[posKey]pub.Decimal
+	open map[string]int
+}
+
+// check checks the orders, the previous orders of the batch and the orders being sent are counted in the position
+// and open orders. If all are accepted and record is true, they are counted for the order rate and as being sent
+// until release. It is locked by the caller.
+func (e *Engine) check(ops []trade.OrderParam, now time.Time, record bool) (*sending, error) {
+	cfg := e.Config()
+	var rs Rejections
+	var pnl pub.Decimal
+	if e.DailyPnl != nil {
+		pnl = e.DailyPnl()
+	}
+	pending := map[posKey]pub.Decimal{} // signed quantities of the previous orders of the batch
+	opened := map[string]int{}
+	for i := range ops {
+		op := &ops[i]
+		k := orderPosKey(op)
+		c := e.newCheck(cfg, op, pnl)
+		c.Position = c.Position.Add(e.sendingQty[k]).Add(pending[k])
+		c.OpenOrders += e.sendingOpen[op.Symbol] + opened[op.Symbol]
+		pending[k] = pending[k].Add(c.signedQty())
+		opened[op.Symbol]++
+
+		if c.Qty.IsNegative() || !c.Reduce && c.Qty.IsZero() {
+			rs = append(rs, &Rejection{Rule: R_Order, Symbol: op.Symbol, Reason: fmt.Sprintf("invalid quantity %q", op.Quantity)})
+			continue
+		}
+		if !c.Price.IsPositive() && (!c.Limits.MaxOrderNotional.IsZero() || !c.Limits.MaxPositionNotional.IsZero()) {
+			rs = append(rs, &Rejection{Rule: R_Order, Symbol: op.Symbol, Reason: "unknown price for the notional, no mark price"})
+		}
+		for _, r := range e.rules {
+			if cfg.disabled(r.Name()) {
+				continue
+			}
+			if reason := r.Check(c); reason != "" {
+				rs = append(rs, &Rejection{Rule: r.Name(), Symbol: op.Symbol, Reason: reason})
+			}
+		}
+	}
+	if reason := e.checkRate(cfg, now, len(ops)); reason != "" && !cfg.disabled(R_OrderRate) {
+		for i := range ops {
+			rs = append(rs, &Rejection{Rule: R_OrderRate, Symbol: ops[i].Symbol, Reason: reason})
+		}
+	}
+	if len(rs) > 0 {
+		return nil, rs
+	}
+	if !record {
+		return nil, nil
+	}
+	for range ops {
+		e.accepted = append(e.accepted, now)
+	}
+	for k, qty := range pending {
+		e.sendingQty[k] = e.sendingQty[k].Add(qty)
+	}
+	for symbol, n := range opened {
+		e.sendingOpen[symbol] += n
+	}
+	return &sending{qty: pending, open: opened}, nil
+}
+
+// release removes the orders from the orders being sent after their responses arrive or fail.
+func (e *Engine) release(s *sending) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for k, qty := range s.qty {
+		if left := e.sendingQty[k].Sub(qty); left.IsZero() {
+			delete(e.sendingQty, k)
+		} else {
+			e.sendingQty[k] = left
+		}
+	}
+	for symbol, n := range s.open {
+		if e.sendingOpen[symbol] -= n; e.sendingOpen[symbol] <= 0 {
+			delete(e.sendingOpen, symbol)
+		}
+	}
+}
+
+// newCheck returns the check of the order by the state functions.
+func (e *Engine) newCheck(cfg *Config, op *trade.OrderParam, pnl pub.Decimal) *Check {
+	c := &Check{Order: op, Config: cfg, Limits: cfg.For(op.Symbol), DailyPnl: pnl}
+	if e.MarkPrice != nil {
+		c.MarkPrice, _ = e.MarkPrice(op.Symbol)
+	}
+	if e.Position != nil {
+		c.Position = e.Position(op.Symbol, orderPosKey(op).side)
+	}
+	if e.OpenOrders != nil {
+		c.OpenOrders = e.OpenOrders(op.Symbol)
+	}
+	if e.Leverage != nil {
+		c.Leverage = e.Leverage(op.Symbol)
+	}
+
+	closePosition := op.ClosePosition != nil && *op.ClosePosition
+	c.Reduce = closePosition || op.ReduceOnly != nil && *op.ReduceOnly ||
+		op.PositionSide == pub.PS_Long && op.Side == pub.OS_Sell || op.PositionSide == pub.PS_Short && op.Side == pub.OS_Buy
+	if closePosition {
+		c.Qty = c.Position.Abs()
+	} else {
+		c.Qty = pub.D(op.Quantity)
+	}
+	c.Price = pub.D(op.Price)
+	if !c.Price.IsPositive() {
+		c.Price = c.MarkPrice
+	}
+	c.Notional = c.Qty.Abs().Mul(c.Price)
+	return c
+}
+
+// checkRate returns the reason if n more orders are over the order rate, it is locked by the caller.
+func (e *Engine) checkRate(cfg *Config, now time.Time, n int) string {
+	i := 0
+	for i < len(e.accepted) && now.Sub(e.accepted[i]) >= time.Minute {
+		i++
+	}
+	e.accepted = e.accepted[i:]
+	if max := cfg.MaxOrdersPerMinute; max > 0 && len(e.accepted)+n > max {
+		return fmt.Sprintf("over %v orders per minute", max)
+	}
+	if max := cfg.MaxOrdersPerSecond; max > 0 {
+		count := 0
+		for _, t := range e.accepted {
+			if now.Sub(t) < time.Second {
+				count++
+			}
+		}
+		if count+n > max {
+			return fmt.Sprintf("over %v orders per second", max)
+		}
+	}
+	return ""
+}
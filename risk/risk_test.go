@@ -0,0 +1,215 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/balances"
+	"github.com/billfort/binance-usdmfuture/internal/mockapi"
+	"github.com/billfort/binance-usdmfuture/positions"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+	"github.com/stretchr/testify/require"
+)
+
+const config = `{"maxOrderNotional": "10000", "maxPositionQty": "0.5", "maxOpenOrders": 3, "maxPriceDeviation": "0.05", "maxLeverage": 20,
+	"symbols": {"BTCUSDT": {"maxOrderNotional": "30000"}, "ETHUSDT": {"maxPositionQty": "10"}}, "allowedSymbols": ["BTCUSDT", "ETHUSDT"],
+	"dailyLossLimit": "1000", "maxOrdersPerSecond": 3, "disabled": ["openOrders"]}`
+
+// newEngine returns an engine of the config, the new orders wait for the gate if it is not nil.
+func newEngine(t *testing.T, gate chan struct{}) (*Engine, *int32) {
+	var sent int32
+	pc := mockapi.New(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		switch r.URL.Path {
+		case "/fapi/v1/order":
+			if gate != nil {
+				<-gate
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 1, "symbol": r.URL.Query().Get("symbol"), "status": "NEW"})
+		case "/fapi/v1/batchOrders":
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"orderId": 2, "status": "NEW"}, {"orderId": 3, "status": "NEW"}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	var cfg Config
+	require.NoError(t, json.Unmarshal([]byte(config), &cfg))
+	e := NewEngine(pc, &cfg)
+	e.MarkPrice = func(symbol string) (pub.Decimal, bool) {
+		return map[string]pub.Decimal{"BTCUSDT": pub.D("60000"), "ETHUSDT": pub.D("3000")}[symbol], true
+	}
+	e.Position = func(symbol string, side pub.PositionSide) pub.Decimal {
+		if symbol == "BTCUSDT" && side == pub.PS_Both {
+			return pub.D("0.3")
+		}
+		return pub.Decimal{}
+	}
+	e.Leverage = func(symbol string) int { return 10 }
+	return e, &sent
+}
+
+func rejectedBy(t *testing.T, err error) []string {
+	rs, ok := AsRejections(err)
+	require.True(t, ok, "%v", err)
+	var rules []string
+	for _, r := range rs {
+		rules = append(rules, r.Rule)
+	}
+	return rules
+}
+
+// go test -v -run TestEngine
+func TestEngine(t *testing.T) {
+	e, sent := newEngine(t, nil)
+	ctx := context.Background()
+	order := func(symbol string, side pub.OrderSide, qty, price string) *trade.OrderParam {
+		op := &trade.OrderParam{Symbol: symbol, Side: side, Type: pub.OT_Market, Quantity: qty}
+		if price != "" {
+			op.Type, op.TimeInForce, op.Price = pub.OT_Limit, pub.TIF_GTC, price
+		}
+		return op
+	}
+
+	resp, err := e.NewOrder(ctx, order("BTCUSDT", pub.OS_Buy, "0.1", "59000"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), resp.OrderId)
+
+	require.Equal(t, []string{R_Order, R_Symbol}, rejectedBy(t, e.Check(order("XRPUSDT", pub.OS_Buy, "0.1", "")))) // no mark price
+	require.Equal(t, []string{R_OrderNotional}, rejectedBy(t, e.Check(order("ETHUSDT", pub.OS_Buy, "4", ""))))     // 12000 > 10000
+	require.NoError(t, e.Check(order("BTCUSDT", pub.OS_Sell, "0.4", "")))                                          // 24000 < 30000 of BTCUSDT
+	require.Equal(t, []string{R_Position}, rejectedBy(t, e.Check(order("BTCUSDT", pub.OS_Buy, "0.3", ""))))        // 0.6 > 0.5
+	require.NoError(t, e.Check(order("BTCUSDT", pub.OS_Sell, "0.5", "")))                                          // 0.2 short, reduced
+	require.Equal(t, []string{R_PriceBand}, rejectedBy(t, e.Check(order("BTCUSDT", pub.OS_Sell, "0.1", "64000"))))
+	require.Equal(t, []string{R_Order}, rejectedBy(t, e.Check(order("BTCUSDT", pub.OS_Buy, "x", ""))))
+
+	e.Leverage = func(symbol string) int { return 25 }
+	require.Equal(t, []string{R_Leverage}, rejectedBy(t, e.Check(order("BTCUSDT", pub.OS_Buy, "0.1", ""))))
+	require.Equal(t, []string{R_Leverage}, rejectedBy(t, e.SetLeverage(ctx, "BTCUSDT", 50)))
+	e.Leverage = nil
+
+	e.DailyPnl = func() pub.Decimal { return pub.D("-1200") }
+	require.Equal(t, []string{R_DailyLoss}, rejectedBy(t, e.Check(order("ETHUSDT", pub.OS_Buy, "1", ""))))
+	reduce := order("BTCUSDT", pub.OS_Sell, "0.3", "")
+	reduce.ReduceOnly = pub.Bool(true)
+	require.NoError(t, e.Check(reduce))
+	e.DailyPnl = nil
+
+	e.AddRule(NewRule("noEth", func(c *Check) string {
+		if c.Order.Symbol == "ETHUSDT" {
+			return "no ETHUSDT today"
+		}
+		return ""
+	}))
+	require.Equal(t, []string{"noEth"}, rejectedBy(t, e.Check(order("ETHUSDT", pub.OS_Buy, "1", ""))))
+
+	// the batch is checked as a whole: 0.3 + 0.1 + 0.2 > 0.5, and 1 + 2 orders are over 3 per second
+	_, err = e.BatchOrders(ctx, []trade.OrderParam{*order("BTCUSDT", pub.OS_Buy, "0.1", ""), *order("BTCUSDT", pub.OS_Buy, "0.2", "")})
+	require.Equal(t, []string{R_Position}, rejectedBy(t, err))
+	rs, err := e.BatchOrders(ctx, []trade.OrderParam{*order("BTCUSDT", pub.OS_Buy, "0.1", ""), *order("BTCUSDT", pub.OS_Sell, "0.1", "")})
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+	_, err = e.NewOrder(ctx, order("BTCUSDT", pub.OS_Buy, "0.1", ""))
+	require.Equal(t, []string{R_OrderRate}, rejectedBy(t, err))
+	require.Equal(t, int32(2), atomic.LoadInt32(sent))
+}
+
+// go test -v -run TestEngineState
+func TestEngineState(t *testing.T) {
+	gate := make(chan struct{})
+	e, _ := newEngine(t, gate)
+	ctx := context.Background()
+	btc := func(side pub.OrderSide, ps pub.PositionSide, qty string) *trade.OrderParam {
+		return &trade.OrderParam{Symbol: "BTCUSDT", Side: side, PositionSide: ps, Type: pub.OT_Market, Quantity: qty}
+	}
+
+	// the order being sent is counted in the position: 0.3 + 0.1 + 0.15 > 0.5
+	done := make(chan error)
+	go func() {
+		_, err := e.NewOrder(ctx, btc(pub.OS_Buy, "", "0.1"))
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return e.Check(btc(pub.OS_Buy, "", "0.15")) != nil }, time.Second, time.Millisecond)
+	require.Equal(t, []string{R_Position}, rejectedBy(t, e.Check(btc(pub.OS_Buy, "", "0.15"))))
+	close(gate)
+	require.NoError(t, <-done)
+	require.NoError(t, e.Check(btc(pub.OS_Buy, "", "0.15")))
+
+	// hedge mode: the position of the side is checked, not the net amount
+	e.Position = func(symbol string, side pub.PositionSide) pub.Decimal {
+		return map[pub.PositionSide]pub.Decimal{pub.PS_Long: pub.D("0.3"), pub.PS_Short: pub.D("-0.3")}[side]
+	}
+	require.NoError(t, e.Check(btc(pub.OS_Sell, "", "0.5")))                                              // net 0
+	require.Equal(t, []string{R_Position}, rejectedBy(t, e.Check(btc(pub.OS_Sell, pub.PS_Short, "0.3")))) // short 0.6
+	require.NoError(t, e.Check(btc(pub.OS_Buy, pub.PS_Short, "0.3")))                                     // closes the short
+	require.Equal(t, []string{R_Position}, rejectedBy(t, e.Check(btc(pub.OS_Buy, pub.PS_Long, "0.3"))))   // long 0.6
+
+	// the leverage and the loss of the day from the book, the loss carried over is not counted
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", "http://127.0.0.1:0", "", "", ""), nil)
+	book := positions.NewBook(pc)
+	book.Seed([]trade.PositionInfo{{Symbol: "BTCUSDT", PositionSide: "BOTH", PositionAmt: "0.3", EntryPrice: "70000", UnRealizedProfit: "-3000"}}, time.Now())
+	book.ApplyMarkPrice("BTCUSDT", pub.D("60000"), time.Now().UnixMilli())
+	book.SetLeverage("BTCUSDT", 25)
+	ledger := balances.NewLedger(pc)
+	e.Use(book, nil, ledger)
+	base, at := e.UnrealizedBase()
+	require.Equal(t, "-3000", base.String()) // taken by Use
+	require.False(t, at.IsZero())
+	require.Equal(t, []string{R_Leverage}, rejectedBy(t, e.Check(btc(pub.OS_Buy, "", "0.1"))))
+	book.SetLeverage("BTCUSDT", 10)
+	require.NoError(t, e.Check(btc(pub.OS_Buy, "", "0.1")))
+	require.Equal(t, "0", e.DailyPnl().String())
+	book.ApplyMarkPrice("BTCUSDT", pub.D("56000"), time.Now().UnixMilli()) // 1200 lost today
+	require.Equal(t, []string{R_DailyLoss}, rejectedBy(t, e.Check(btc(pub.OS_Buy, "", "0.1"))))
+
+	// the realized loss of the day from the ledger
+	now := time.Now().UnixMilli()
+	ledger.Apply(mockapi.AccountUpdate(t, fmt.Sprintf(`{"e":"ACCOUNT_UPDATE","T":%v,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"1000"}]}}`, now)))
+	ledger.Apply(mockapi.AccountUpdate(t, fmt.Sprintf(`{"e":"ACCOUNT_UPDATE","T":%v,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"700"}]}}`, now+1)))
+	require.Equal(t, "-1500", e.DailyPnl().String())
+
+	// a new day counts from the unrealized profit at its start
+	e.takeBase(time.Now())
+	require.Equal(t, "-300", e.DailyPnl().String())
+	e.baseMu.Lock()
+	e.baseDay-- // Start missed the rollover, taken by the first check
+	e.baseMu.Unlock()
+	book.ApplyMarkPrice("BTCUSDT", pub.D("50000"), time.Now().UnixMilli())
+	require.Equal(t, "-300", e.DailyPnl().String())
+	base, _ = e.UnrealizedBase()
+	require.Equal(t, "-6000", base.String())
+}
+
+// go test -v -run TestWatchConfig
+func TestWatchConfig(t *testing.T) {
+	e, _ := newEngine(t, nil)
+	path := filepath.Join(t.TempDir(), "risk.json")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o644))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, e.WatchConfig(ctx, path, 10*time.Millisecond))
+	op := &trade.OrderParam{Symbol: "ETHUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "0.4"}
+	require.NoError(t, e.Check(op))
+
+	write := func(s string, mod time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(s), 0o644))
+		require.NoError(t, os.Chtimes(path, mod, mod))
+	}
+	write(`{"maxOrderNotional": "1000"}`, time.Now().Add(time.Second))
+	require.Eventually(t, func() bool { return e.Check(op) != nil }, 2*time.Second, 10*time.Millisecond)
+
+	write(`{"maxOrderNotional": "-1"}`, time.Now().Add(2*time.Second)) // invalid, kept
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, "1000", e.Config().MaxOrderNotional.String())
+
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "none.json"))
+	require.Error(t, err)
+	require.Error(t, e.SetConfig(&Config{MaxOrdersPerSecond: -1}))
+}
@@ -0,0 +1,204 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+// Names of the built-in rules.
+const (
+	R_Order         = "order" // the quantity or the price of the order cannot be known
+	R_Symbol        = "symbol"
+	R_OrderNotional = "orderNotional"
+	R_Position      = "position"
+	R_OpenOrders    = "openOrders"
+	R_PriceBand     = "priceBand"
+	R_Leverage      = "leverage"
+	R_DailyLoss     = "dailyLoss"
+	R_OrderRate     = "orderRate"
+)
+
+// Rejection is the reason an order is rejected by a rule.
+type Rejection struct {
+	Rule   string
+	Symbol string
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("risk: %v order rejected by %v: %v", r.Symbol, r.Rule, r.Reason)
+}
+
+// Rejections are all reasons an order is rejected.
+type Rejections []*Rejection
+
+func (rs Rejections) Error() string {
+	msgs := make([]string, len(rs))
+	for i, r := range rs {
+		msgs[i] = r.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Has reports whether the order is rejected by the rule.
+func (rs Rejections) Has(rule string) bool {
+	for _, r := range rs {
+		if r.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// AsRejections returns the Rejections in the err chain.
+func AsRejections(err error) (Rejections, bool) {
+	var rs Rejections
+	if errors.As(err, &rs) {
+		return rs, true
+	}
+	return nil, false
+}
+
+// Check is an order and the state to check it, the state values are zero if they are not known.
+type Check struct {
+	Order  *trade.OrderParam
+	Config *Config
+	Limits Limits // of the symbol
+
+	Price    pub.Decimal // of the order, or the mark price for the orders without price
+	Qty      pub.Decimal
+	Notional pub.Decimal // Price * Qty
+	Reduce   bool        // reduceOnly or closePosition, such orders do not increase the risk
+
+	MarkPrice  pub.Decimal
+	Position   pub.Decimal // signed amount before the order, of the position side in hedge mode, or the net amount
+	OpenOrders int
+	Leverage   int
+	DailyPnl   pub.Decimal // profit of the day, negative for a loss
+}
+
+// signedQty returns the quantity of the order, negative for SELL.
+func (c *Check) signedQty() pub.Decimal {
+	if c.Order.Side == pub.OS_Sell {
+		return c.Qty.Neg()
+	}
+	return c.Qty
+}
+
+// Rule checks an order, Check returns the reason to reject it, or "" to pass.
+type Rule interface {
+	Name() string
+	Check(c *Check) string
+}
+
+type ruleFunc struct {
+	name  string
+	check func(c *Check) string
+}
+
+func (r *ruleFunc) Name() string          { return r.name }
+func (r *ruleFunc) Check(c *Check) string { return r.check(c) }
+
+// NewRule returns a rule of the function.
+func NewRule(name string, check func(c *Check) string) Rule {
+	return &ruleFunc{name: name, check: check}
+}
+
+// DefaultRules returns the built-in rules except the order rate, which is kept by the Engine.
+func DefaultRules() []Rule {
+	return []Rule{
+		NewRule(R_Symbol, checkSymbol),
+		NewRule(R_OrderNotional, checkOrderNotional),
+		NewRule(R_Position, checkPosition),
+		NewRule(R_OpenOrders, checkOpenOrders),
+		NewRule(R_PriceBand, checkPriceBand),
+		NewRule(R_Leverage, checkLeverage),
+		NewRule(R_DailyLoss, checkDailyLoss),
+	}
+}
+
+func checkSymbol(c *Check) string {
+	if !c.Config.Allowed(c.Order.Symbol) {
+		return "symbol is not allowed"
+	}
+	return ""
+}
+
+func checkOrderNotional(c *Check) string {
+	max := c.Limits.MaxOrderNotional
+	if max.IsZero() || c.Order.ClosePosition != nil && *c.Order.ClosePosition {
+		return ""
+	}
+	if c.Notional.GreaterThan(max) {
+		return fmt.Sprintf("notional %v is over %v", c.Notional, max)
+	}
+	return ""
+}
+
+// checkPosition checks the position after the order is filled, an order which does not increase the absolute
+// position is allowed. In hedge mode the position is the LONG or SHORT one of the order, not the net amount.
+func checkPosition(c *Check) string {
+	if c.Reduce || c.Limits.MaxPositionQty.IsZero() && c.Limits.MaxPositionNotional.IsZero() {
+		return ""
+	}
+	after := c.Position.Add(c.signedQty())
+	if after.Abs().LessOrEqual(c.Position.Abs()) {
+		return ""
+	}
+	if max := c.Limits.MaxPositionQty; !max.IsZero() && after.Abs().GreaterThan(max) {
+		return fmt.Sprintf("position %v is over %v", after, max)
+	}
+	if max := c.Limits.MaxPositionNotional; !max.IsZero() && after.Abs().Mul(c.Price).GreaterThan(max) {
+		return fmt.Sprintf("position notional %v is over %v", after.Abs().Mul(c.Price), max)
+	}
+	return ""
+}
+
+func checkOpenOrders(c *Check) string {
+	if max := c.Limits.MaxOpenOrders; max > 0 && c.OpenOrders >= max {
+		return fmt.Sprintf("%v open orders, max %v", c.OpenOrders, max)
+	}
+	return ""
+}
+
+// checkPriceBand checks the price or the stop price of the order against the mark price.
+func checkPriceBand(c *Check) string {
+	max := c.Limits.MaxPriceDeviation
+	if max.IsZero() || !c.MarkPrice.IsPositive() {
+		return ""
+	}
+	price := pub.D(c.Order.Price)
+	if price.IsZero() {
+		price = pub.D(c.Order.StopPrice)
+	}
+	if price.IsZero() {
+		return ""
+	}
+	if dev := price.Sub(c.MarkPrice).Abs().Div(c.MarkPrice, 8); dev.GreaterThan(max) {
+		return fmt.Sprintf("price %v deviates %v from mark price %v, max %v", price, dev, c.MarkPrice, max)
+	}
+	return ""
+}
+
+func checkLeverage(c *Check) string {
+	if max := c.Limits.MaxLeverage; max > 0 && !c.Reduce && c.Leverage > max {
+		return fmt.Sprintf("leverage %v is over %v", c.Leverage, max)
+	}
+	return ""
+}
+
+// checkDailyLoss rejects the orders but the reducing ones after the loss of the day reaches the limit.
+func checkDailyLoss(c *Check) string {
+	limit := c.Config.DailyLossLimit
+	if limit.IsZero() || c.Reduce {
+		return ""
+	}
+	if loss := c.DailyPnl.Neg(); loss.GreaterOrEqual(limit) {
+		return fmt.Sprintf("loss of the day %v reaches %v", loss, limit)
+	}
+	return ""
+}
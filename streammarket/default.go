@@ -0,0 +1,19 @@
+package streammarket
+
+import (
+	"context"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/gorilla/websocket"
+)
+
+// The package level functions below keep the original API, they connect by pub.DefaultClient.
+
+// Deprecated: use StartManagedSubscribe.
+func StartSubscribe(ctx context.Context, streams []string) (*websocket.Conn, chan interface{}, error) {
+	return NewClient(pub.DefaultClient).StartSubscribe(ctx, streams)
+}
+
+func StartManagedSubscribe(ctx context.Context, streams []string) (*pub.WsConn, chan interface{}, error) {
+	return NewClient(pub.DefaultClient).StartManagedSubscribe(ctx, streams)
+}
@@ -0,0 +1,504 @@
+package streammarket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+const (
+	MaxStreamsPerConn   = 1024 // a connection can listen to 1024 streams at most
+	maxStreamsOfRequest = 200  // streams in one SUBSCRIBE request
+	defaultAckTimeout   = 10 * time.Second
+)
+
+// SubscriptionManager subscribes and unsubscribes streams at runtime, and waits for the response of each request.
+// The streams are sharded to managed connections, each one has MaxStreams streams at most,
+// a new connection is made when all connections are full, and a connection without streams is closed.
+// The requests of each connection are sent under the 10 messages per second limit by pub.WsConn,
+// the requests to different connections are not blocked by each other.
+// The data of all connections, and the pub.WsEvent of the connections, are sent to Data(),
+// except the streams consumed by Handle or Chan. The data is dropped when Data() is full, counted by Dropped,
+// so a slow consumer does not stall the connections and the responses of the requests.
+type SubscriptionManager struct {
+	MaxStreams int           // streams of each connection, default MaxStreamsPerConn
+	AckTimeout time.Duration // time to wait for the response of each request
+
+	client *Client
+	ctx    context.Context
+	data   chan interface{}
+
+	mu       sync.Mutex
+	shards   []*shard
+	streams  map[string]*shard       // subscribed stream -> connection
+	pending  map[string]*subscribing // streams being subscribed
+	hmu      sync.Mutex              // handlers are called by the connections, not under m.mu
+	handlers map[string]*streamHandler
+	closed   bool
+	wg       sync.WaitGroup
+	dropped  int64 // data dropped as Data() is full
+}
+
+// shard is a connection of the manager. m.mu is not locked while it is started or waiting for the responses,
+// the streams are reserved in count before the request.
+type shard struct {
+	conn   *pub.WsConn
+	cancel context.CancelFunc
+	ready  chan struct{} // closed after Start returns
+	err    error         // of Start, read after ready
+	count  int           // streams subscribed and being subscribed
+}
+
+// wait waits for the connection started, it returns the error of Start.
+func (sh *shard) wait(ctx context.Context) error {
+	select {
+	case <-sh.ready:
+		return sh.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// subscribing is a SUBSCRIBE request in flight, other Subscribe calls of its streams wait for it.
+type subscribing struct {
+	done chan struct{}
+	err  error
+}
+
+// streamHandler consumes the data of a stream by Handle or Chan.
+type streamHandler struct {
+	handle func(data json.RawMessage)
+	close  func() // called after the stream is unsubscribed or the manager is closed, can be nil
+}
+
+// NewSubscriptionManager returns a manager, the connections are closed after ctx is done, then Data() is closed.
+func (c *Client) NewSubscriptionManager(ctx context.Context) *SubscriptionManager {
+	m := &SubscriptionManager{
+		MaxStreams: MaxStreamsPerConn,
+		AckTimeout: defaultAckTimeout,
+		client:     c,
+		ctx:        ctx,
+		data:       make(chan interface{}, pub.WsChanLen),
+		streams:    map[string]*shard{},
+		pending:    map[string]*subscribing{},
+		handlers:   map[string]*streamHandler{},
+	}
+	m.wg.Add(1) // released after ctx is done, so Data() is not closed before any connection
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		m.closed = true
+		m.mu.Unlock()
+		m.wg.Done()
+		m.wg.Wait()
+		m.hmu.Lock()
+		handlers := m.handlers
+		m.handlers = map[string]*streamHandler{}
+		m.hmu.Unlock()
+		for _, h := range handlers {
+			if h.close != nil {
+				h.close()
+			}
+		}
+		close(m.data)
+	}()
+	return m
+}
+
+// Data returns the channel of stream data and pub.WsEvent.
+func (m *SubscriptionManager) Data() <-chan interface{} {
+	return m.data
+}
+
+// Dropped returns the count of the data dropped as Data() is full.
+func (m *SubscriptionManager) Dropped() int64 {
+	return atomic.LoadInt64(&m.dropped)
+}
+
+// Subscribe subscribes the streams which are not subscribed yet, and waits for the responses.
+// It also waits for the streams being subscribed by other calls.
+func (m *SubscriptionManager) Subscribe(ctx context.Context, streams ...string) error {
+	type job struct {
+		sh      *shard
+		streams []string
+		sub     *subscribing
+	}
+	var jobs []job
+	var others []*subscribing
+	var firstErr error
+	m.mu.Lock()
+	var todo []string
+	seen := map[string]bool{}
+	for _, s := range streams {
+		if seen[s] || m.streams[s] != nil {
+			continue
+		}
+		seen[s] = true
+		if sub := m.pending[s]; sub != nil {
+			others = append(others, sub)
+		} else {
+			todo = append(todo, s)
+		}
+	}
+	for len(todo) > 0 {
+		sh, free, err := m.shardWithSpace()
+		if err != nil {
+			firstErr = err // the reserved jobs are released below
+			break
+		}
+		n := min(free, len(todo), maxStreamsOfRequest)
+		sub := &subscribing{done: make(chan struct{})}
+		for _, s := range todo[:n] {
+			m.pending[s] = sub
+		}
+		sh.count += n
+		jobs = append(jobs, job{sh, todo[:n], sub})
+		todo = todo[n:]
+	}
+	m.mu.Unlock()
+
+	for _, j := range jobs {
+		err := firstErr // the rest are not sent after an error
+		if err == nil {
+			err = m.subscribe(ctx, j.sh, j.streams)
+		}
+		m.mu.Lock()
+		for _, s := range j.streams {
+			delete(m.pending, s)
+			if err == nil {
+				m.streams[s] = j.sh
+			}
+		}
+		if err != nil {
+			j.sh.count -= len(j.streams)
+			m.closeIfEmpty(j.sh)
+		}
+		m.mu.Unlock()
+		j.sub.err = err
+		close(j.sub.done)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	for _, sub := range others {
+		select {
+		case <-sub.done:
+			if sub.err != nil {
+				return sub.err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// subscribe waits for the connection started and subscribes the streams.
+func (m *SubscriptionManager) subscribe(ctx context.Context, sh *shard, streams []string) error {
+	if err := sh.wait(ctx); err != nil {
+		return err
+	}
+	return m.request(ctx, sh.conn, "SUBSCRIBE", streams)
+}
+
+// Unsubscribe unsubscribes the streams, and waits for the responses.
+func (m *SubscriptionManager) Unsubscribe(ctx context.Context, streams ...string) error {
+	m.mu.Lock()
+	byShard := map[*shard][]string{}
+	for _, s := range streams {
+		if sh := m.streams[s]; sh != nil && !slices.Contains(byShard[sh], s) {
+			byShard[sh] = append(byShard[sh], s)
+		}
+	}
+	shards := append([]*shard(nil), m.shards...) // in order of shards
+	m.mu.Unlock()
+
+	for _, sh := range shards {
+		list := byShard[sh]
+		for len(list) > 0 {
+			n := min(len(list), maxStreamsOfRequest)
+			if err := m.request(ctx, sh.conn, "UNSUBSCRIBE", list[:n]); err != nil {
+				return err
+			}
+			m.mu.Lock()
+			for _, s := range list[:n] {
+				if m.streams[s] == sh {
+					delete(m.streams, s)
+					sh.count--
+				}
+			}
+			m.closeIfEmpty(sh)
+			m.mu.Unlock()
+			for _, s := range list[:n] {
+				m.removeHandler(s)
+			}
+			list = list[n:]
+		}
+	}
+	return nil
+}
+
+// SymbolStreams returns the streams of the symbols, such as SymbolStreams([]string{"BTCUSDT"}, "aggTrade", "depth@100ms")
+// returns ["btcusdt@aggTrade", "btcusdt@depth@100ms"], to subscribe or unsubscribe symbols at runtime.
+func SymbolStreams(symbols []string, streamTypes ...string) []string {
+	streams := make([]string, 0, len(symbols)*len(streamTypes))
+	for _, symbol := range symbols {
+		for _, t := range streamTypes {
+			streams = append(streams, strings.ToLower(symbol)+"@"+t)
+		}
+	}
+	return streams
+}
+
+// Streams returns the subscribed streams, sorted by name.
+func (m *SubscriptionManager) Streams() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	streams := make([]string, 0, len(m.streams))
+	for s := range m.streams {
+		streams = append(streams, s)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// Connections returns the number of connections.
+func (m *SubscriptionManager) Connections() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.shards)
+}
+
+// ListSubscriptions queries the subscriptions of all connections from binance by LIST_SUBSCRIPTIONS.
+func (m *SubscriptionManager) ListSubscriptions(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	shards := append([]*shard(nil), m.shards...)
+	m.mu.Unlock()
+
+	var all []string
+	for _, sh := range shards {
+		result, err := m.requestResult(ctx, sh, "LIST_SUBSCRIPTIONS", nil)
+		if err != nil {
+			return nil, err
+		}
+		var streams []string
+		if err := json.Unmarshal(result, &streams); err != nil {
+			return nil, fmt.Errorf("ListSubscriptions unmarshal %s err: %w", result, err)
+		}
+		all = append(all, streams...)
+	}
+	sort.Strings(all)
+	return all, nil
+}
+
+// SetProperty sets the property of all connections, such as "combined".
+func (m *SubscriptionManager) SetProperty(ctx context.Context, name string, value interface{}) error {
+	m.mu.Lock()
+	shards := append([]*shard(nil), m.shards...)
+	m.mu.Unlock()
+
+	for _, sh := range shards {
+		if _, err := m.requestResult(ctx, sh, "SET_PROPERTY", []interface{}{name, value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetProperty gets the property of the first connection, such as "combined".
+func (m *SubscriptionManager) GetProperty(ctx context.Context, name string) (json.RawMessage, error) {
+	m.mu.Lock()
+	if len(m.shards) == 0 {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("GetProperty: no connection")
+	}
+	sh := m.shards[0]
+	m.mu.Unlock()
+	return m.requestResult(ctx, sh, "GET_PROPERTY", []string{name})
+}
+
+// request subscribes or unsubscribes the streams of the connection and checks the response.
+func (m *SubscriptionManager) request(ctx context.Context, w *pub.WsConn, method string, streams []string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.AckTimeout)
+	defer cancel()
+	var err error
+	if method == "SUBSCRIBE" {
+		err = w.SubscribeWait(ctx, streams...)
+	} else {
+		err = w.UnsubscribeWait(ctx, streams...)
+	}
+	if err != nil {
+		return fmt.Errorf("%v %v err: %w", method, streams, err)
+	}
+	return nil
+}
+
+func (m *SubscriptionManager) requestResult(ctx context.Context, sh *shard, method string, params interface{}) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.AckTimeout)
+	defer cancel()
+	if err := sh.wait(ctx); err != nil {
+		return nil, fmt.Errorf("%v err: %w", method, err)
+	}
+	result, err := sh.conn.Request(ctx, method, params)
+	if err != nil {
+		return nil, fmt.Errorf("%v err: %w", method, err)
+	}
+	return result, nil
+}
+
+// shardWithSpace returns a connection which has space for more streams, a new connection is made if all are full.
+// It is called with m.mu locked, the new connection is started in a goroutine.
+func (m *SubscriptionManager) shardWithSpace() (*shard, int, error) {
+	maxStreams := m.MaxStreams
+	if maxStreams <= 0 || maxStreams > MaxStreamsPerConn {
+		maxStreams = MaxStreamsPerConn
+	}
+	for _, sh := range m.shards {
+		if free := maxStreams - sh.count; free > 0 {
+			return sh, free, nil
+		}
+	}
+
+	if m.closed {
+		return nil, 0, fmt.Errorf("SubscriptionManager is closed: %w", m.ctx.Err())
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	sh := &shard{conn: m.client.NewWsConn("/stream"), cancel: cancel, ready: make(chan struct{})}
+	m.shards = append(m.shards, sh)
+	m.wg.Add(1) // m.mu is locked, so it is added before the Done of ctx
+	go m.forward(sh.conn)
+	go func() {
+		sh.err = sh.conn.Start(ctx)
+		if sh.err != nil {
+			m.mu.Lock()
+			m.removeShard(sh)
+			m.mu.Unlock()
+		}
+		close(sh.ready)
+	}()
+	return sh, maxStreams, nil
+}
+
+// closeIfEmpty closes the connection if it has no stream, called with m.mu locked.
+func (m *SubscriptionManager) closeIfEmpty(sh *shard) {
+	if sh.count == 0 {
+		m.removeShard(sh)
+	}
+}
+
+// removeShard removes and closes the connection, called with m.mu locked.
+func (m *SubscriptionManager) removeShard(sh *shard) {
+	if i := slices.Index(m.shards, sh); i >= 0 {
+		m.shards = slices.Delete(m.shards, i, i+1)
+	}
+	sh.cancel()
+}
+
+func (m *SubscriptionManager) setHandler(stream string, h *streamHandler) {
+	m.hmu.Lock()
+	old := m.handlers[stream]
+	m.handlers[stream] = h
+	m.hmu.Unlock()
+	if old != nil && old.close != nil {
+		old.close()
+	}
+}
+
+func (m *SubscriptionManager) removeHandler(stream string) {
+	m.hmu.Lock()
+	h := m.handlers[stream]
+	delete(m.handlers, stream)
+	m.hmu.Unlock()
+	if h != nil && h.close != nil {
+		h.close()
+	}
+}
+
+func (m *SubscriptionManager) handler(stream string) *streamHandler {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
+	return m.handlers[stream]
+}
+
+// dispatch sends the data of the combined stream message to its handler, returns false if the stream has no handler.
+func (m *SubscriptionManager) dispatch(message []byte) bool {
+	var d struct {
+		Stream string          `json:"stream"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &d); err != nil || d.Stream == "" {
+		return false
+	}
+	h := m.handler(d.Stream)
+	if h == nil {
+		return false
+	}
+	h.handle(d.Data)
+	return true
+}
+
+// forward sends the data and events of the connection to Data(), or the handlers of the streams.
+func (m *SubscriptionManager) forward(w *pub.WsConn) {
+	defer m.wg.Done()
+	msgs, events := w.Messages(), w.Events()
+	dropping := false
+	for msgs != nil || events != nil {
+		var d interface{}
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				msgs = nil
+				continue
+			}
+			if isResponse(msg.Message) { // response of the requests by WriteRequest
+				continue
+			}
+			if m.dispatch(msg.Message) {
+				continue
+			}
+			var err error
+			if d, err = streamDataProcess(msg); err != nil {
+				m.client.Logf("SubscriptionManager streamDataProcess err: %v", err)
+				continue
+			}
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if e.Type == pub.WE_Gap { // only the streams of this connection may miss data
+				e.Streams = w.Subscriptions()
+			}
+			select { // events are not blocked, as Data() may be not read if all streams are consumed by handlers
+			case m.data <- e:
+			default:
+				m.client.Logf("SubscriptionManager drops event %v, Data() is full", e.Type)
+			}
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		select { // not blocked, the reader of the connection also reads the responses of the requests
+		case m.data <- d:
+			dropping = false
+		default:
+			if n := atomic.AddInt64(&m.dropped, 1); !dropping {
+				dropping = true
+				m.client.Logf("SubscriptionManager drops data, Data() is full, dropped %v", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package streammarket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+// Stream is a typed stream descriptor, T is the type of its events, such as KlineStream("BTCUSDT", pub.KI_Minute1) is a Stream[Kline].
+// The inputs are validated by the constructors, Err returns the error of invalid inputs.
+type Stream[T any] struct {
+	name string
+	err  error
+}
+
+// StreamName is implemented by all Stream types.
+type StreamName interface {
+	Name() string
+	Err() error
+}
+
+// Name returns the stream name to subscribe, such as "btcusdt@kline_1m".
+func (s Stream[T]) Name() string { return s.name }
+
+// Err returns the error of the invalid inputs, nil if the stream is valid.
+func (s Stream[T]) Err() error { return s.err }
+
+func (s Stream[T]) String() string { return s.name }
+
+// Names returns the names of the streams, or the first error of them.
+func Names(streams ...StreamName) ([]string, error) {
+	names := make([]string, len(streams))
+	for i, s := range streams {
+		if s.Err() != nil {
+			return nil, s.Err()
+		}
+		names[i] = s.Name()
+	}
+	return names, nil
+}
+
+var symbolRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+var klineIntervals = map[pub.KlineInterval]bool{
+	pub.KI_Minute1: true, pub.KI_Minute3: true, pub.KI_Minute5: true, pub.KI_Minute15: true, pub.KI_Minute30: true,
+	pub.KI_Hour1: true, pub.KI_Hour2: true, pub.KI_Hour4: true, pub.KI_Hour6: true, pub.KI_Hour8: true, pub.KI_Hour12: true,
+	pub.KI_Day1: true, pub.KI_Day3: true, pub.KI_Week1: true, pub.KI_Month1: true,
+}
+
+func newStream[T any](name string, err error) Stream[T] {
+	if err != nil {
+		return Stream[T]{err: fmt.Errorf("invalid stream %v: %w", name, err)}
+	}
+	return Stream[T]{name: name}
+}
+
+func symbolStream[T any](symbol, suffix string) Stream[T] {
+	if !symbolRegexp.MatchString(symbol) {
+		return newStream[T](symbol+suffix, fmt.Errorf("invalid symbol %q", symbol))
+	}
+	return newStream[T](strings.ToLower(symbol)+suffix, nil)
+}
+
+func checkInterval(interval pub.KlineInterval) error {
+	if !klineIntervals[interval] {
+		return fmt.Errorf("invalid kline interval %q", interval)
+	}
+	return nil
+}
+
+// markPriceSuffix returns "" for 3s, "@1s" for 1s.
+func markPriceSuffix(speed time.Duration) (string, error) {
+	switch speed {
+	case 0, 3 * time.Second:
+		return "", nil
+	case time.Second:
+		return "@1s", nil
+	}
+	return "", fmt.Errorf("invalid mark price update speed %v, 1s or 3s", speed)
+}
+
+// AggTradeStream is <symbol>@aggTrade.
+func AggTradeStream(symbol string) Stream[AggTrade] {
+	return symbolStream[AggTrade](symbol, "@aggTrade")
+}
+
+// TradeStream is <symbol>@trade.
+func TradeStream(symbol string) Stream[Trade] {
+	return symbolStream[Trade](symbol, "@trade")
+}
+
+// MarkPriceStream is <symbol>@markPrice or <symbol>@markPrice@1s, speed is 3s (or 0) or 1s.
+func MarkPriceStream(symbol string, speed time.Duration) Stream[MarkPriceUpdate] {
+	suffix, err := markPriceSuffix(speed)
+	if err != nil {
+		return newStream[MarkPriceUpdate](symbol+"@markPrice", err)
+	}
+	return symbolStream[MarkPriceUpdate](symbol, "@markPrice"+suffix)
+}
+
+// AllMarkPriceStream is !markPrice@arr or !markPrice@arr@1s, mark price of all symbols.
+func AllMarkPriceStream(speed time.Duration) Stream[[]MarkPriceUpdate] {
+	suffix, err := markPriceSuffix(speed)
+	return newStream[[]MarkPriceUpdate]("!markPrice@arr"+suffix, err)
+}
+
+// KlineStream is <symbol>@kline_<interval>.
+func KlineStream(symbol string, interval pub.KlineInterval) Stream[Kline] {
+	if err := checkInterval(interval); err != nil {
+		return newStream[Kline](symbol+"@kline_"+string(interval), err)
+	}
+	return symbolStream[Kline](symbol, "@kline_"+string(interval))
+}
+
+// ContinuousKlineStream is <pair>_<contractType>@continuousKline_<interval>, contractType is perpetual, current_quarter or next_quarter.
+func ContinuousKlineStream(pair string, contractType pub.ContractType, interval pub.KlineInterval) Stream[Kline] {
+	name := pair + "_" + string(contractType) + "@continuousKline_" + string(interval)
+	if err := checkInterval(interval); err != nil {
+		return newStream[Kline](name, err)
+	}
+	switch contractType {
+	case pub.CT_Perpetual, pub.CT_CurrentQuarter, pub.CT_NextQuarter:
+	default:
+		return newStream[Kline](name, fmt.Errorf("invalid contract type %q", contractType))
+	}
+	return symbolStream[Kline](pair, "_"+strings.ToLower(string(contractType))+"@continuousKline_"+string(interval))
+}
+
+// IndexPriceKlineStream is <pair>@indexPriceKline_<interval>.
+func IndexPriceKlineStream(pair string, interval pub.KlineInterval) Stream[Kline] {
+	if err := checkInterval(interval); err != nil {
+		return newStream[Kline](pair+"@indexPriceKline_"+string(interval), err)
+	}
+	return symbolStream[Kline](pair, "@indexPriceKline_"+string(interval))
+}
+
+// MarkPriceKlineStream is <symbol>@markPriceKline_<interval>.
+func MarkPriceKlineStream(symbol string, interval pub.KlineInterval) Stream[Kline] {
+	if err := checkInterval(interval); err != nil {
+		return newStream[Kline](symbol+"@markPriceKline_"+string(interval), err)
+	}
+	return symbolStream[Kline](symbol, "@markPriceKline_"+string(interval))
+}
+
+// MiniTickerStream is <symbol>@miniTicker.
+func MiniTickerStream(symbol string) Stream[MiniTicker] {
+	return symbolStream[MiniTicker](symbol, "@miniTicker")
+}
+
+// AllMarketMiniTickersStream is !miniTicker@arr, mini tickers of the symbols changed.
+func AllMarketMiniTickersStream() Stream[[]MiniTicker] {
+	return newStream[[]MiniTicker]("!miniTicker@arr", nil)
+}
+
+// TickerStream is <symbol>@ticker.
+func TickerStream(symbol string) Stream[Ticker] {
+	return symbolStream[Ticker](symbol, "@ticker")
+}
+
+// AllMarketTickersStream is !ticker@arr, tickers of the symbols changed.
+func AllMarketTickersStream() Stream[[]Ticker] {
+	return newStream[[]Ticker]("!ticker@arr", nil)
+}
+
+// BookTickerStream is <symbol>@bookTicker.
+func BookTickerStream(symbol string) Stream[BookTicker] {
+	return symbolStream[BookTicker](symbol, "@bookTicker")
+}
+
+// AllBookTickersStream is !bookTicker, book tickers of all symbols.
+func AllBookTickersStream() Stream[BookTicker] {
+	return newStream[BookTicker]("!bookTicker", nil)
+}
+
+// ForceOrderStream is <symbol>@forceOrder, the liquidation orders.
+func ForceOrderStream(symbol string) Stream[ForceOrder] {
+	return symbolStream[ForceOrder](symbol, "@forceOrder")
+}
+
+// AllForceOrdersStream is !forceOrder@arr, the liquidation orders of all symbols.
+func AllForceOrdersStream() Stream[ForceOrder] {
+	return newStream[ForceOrder]("!forceOrder@arr", nil)
+}
+
+// DepthStream is the partial book depth <symbol>@depth<levels>@<speed> if levels is 5, 10 or 20,
+// or the diff book depth <symbol>@depth@<speed> if levels is 0. speed is 250ms (or 0), 500ms or 100ms.
+func DepthStream(symbol string, levels int, speed time.Duration) Stream[DepthUpdate] {
+	name := "@depth"
+	switch levels {
+	case 0:
+	case 5, 10, 20:
+		name += fmt.Sprint(levels)
+	default:
+		return newStream[DepthUpdate](symbol+name, fmt.Errorf("invalid depth levels %v, 5, 10, 20 or 0 for diff depth", levels))
+	}
+	switch speed {
+	case 0, 250 * time.Millisecond:
+	case 500 * time.Millisecond, 100 * time.Millisecond:
+		name += fmt.Sprintf("@%vms", speed.Milliseconds())
+	default:
+		return newStream[DepthUpdate](symbol+name, fmt.Errorf("invalid depth update speed %v, 250ms, 500ms or 100ms", speed))
+	}
+	return symbolStream[DepthUpdate](symbol, name)
+}
+
+// CompositeIndexStream is <symbol>@compositeIndex.
+func CompositeIndexStream(symbol string) Stream[CompositeIndex] {
+	return symbolStream[CompositeIndex](symbol, "@compositeIndex")
+}
+
+// ContractInfoStream is !contractInfo.
+func ContractInfoStream() Stream[ContractInfo] {
+	return newStream[ContractInfo]("!contractInfo", nil)
+}
+
+// AssetIndexStream is <assetSymbol>@assetIndex, such as "ADAUSD".
+func AssetIndexStream(assetSymbol string) Stream[AssetIndexUpdate] {
+	return symbolStream[AssetIndexUpdate](assetSymbol, "@assetIndex")
+}
+
+// AllAssetIndexStream is !assetIndex@arr.
+func AllAssetIndexStream() Stream[[]AssetIndexUpdate] {
+	return newStream[[]AssetIndexUpdate]("!assetIndex@arr", nil)
+}
+
+// Handle subscribes the stream by the manager, and calls handler with the events of the stream,
+// in the goroutine of the connection, so handler should return quickly.
+// The events are not sent to m.Data(). It replaces the previous handler or channel of the stream.
+func Handle[T any](ctx context.Context, m *SubscriptionManager, s Stream[T], handler func(T)) error {
+	if s.err != nil {
+		return s.err
+	}
+	m.setHandler(s.name, &streamHandler{
+		handle: func(data json.RawMessage) {
+			var v T
+			if err := json.Unmarshal(data, &v); err != nil {
+				m.client.Logf("Handle %v unmarshal err: %v", s.name, err)
+				return
+			}
+			handler(v)
+		},
+	})
+	if err := m.Subscribe(ctx, s.name); err != nil {
+		m.removeHandler(s.name)
+		return err
+	}
+	return nil
+}
+
+// Chan subscribes the stream by the manager, and returns the channel of its events,
+// the channel is closed after the stream is unsubscribed or the manager is closed.
+// The events are not sent to m.Data(). It replaces the previous handler or channel of the stream.
+func Chan[T any](ctx context.Context, m *SubscriptionManager, s Stream[T]) (<-chan T, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	ch := make(chan T, pub.WsChanLen)
+	var mu sync.Mutex
+	closed := false
+	done := make(chan struct{})
+	var once sync.Once
+
+	m.setHandler(s.name, &streamHandler{
+		handle: func(data json.RawMessage) {
+			var v T
+			if err := json.Unmarshal(data, &v); err != nil {
+				m.client.Logf("Chan %v unmarshal err: %v", s.name, err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case ch <- v:
+			case <-done:
+			case <-m.ctx.Done():
+			}
+		},
+		close: func() {
+			once.Do(func() {
+				close(done) // stop the blocked sending
+				mu.Lock()
+				closed = true
+				close(ch)
+				mu.Unlock()
+			})
+		},
+	})
+	if err := m.Subscribe(ctx, s.name); err != nil {
+		m.removeHandler(s.name)
+		return nil, err
+	}
+	return ch, nil
+}
@@ -1,10 +1,10 @@
 package streammarket
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math/rand"
 	"strings"
 	"time"
@@ -17,7 +17,20 @@ func init() {
 	rand.New(rand.NewSource(time.Now().UnixNano()))
 }
 
-func StartSubscribe(ctx context.Context, streams []string) (*websocket.Conn, chan interface{}, error) {
+// Client subscribes market streams from the websocket url of the wrapped pub.Client.
+type Client struct {
+	*pub.Client
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c}
+}
+
+// StartSubscribe connects the streams, the channel is closed when the connection is lost.
+//
+// Deprecated: the connection is not managed, use StartManagedSubscribe or NewSubscriptionManager,
+// which reconnect and resubscribe.
+func (c *Client) StartSubscribe(ctx context.Context, streams []string) (*websocket.Conn, chan interface{}, error) {
 	var urlPath string
 	if len(streams) == 1 {
 		urlPath = "/ws/" + streams[0]
@@ -26,9 +39,9 @@ func StartSubscribe(ctx context.Context, streams []string) (*websocket.Conn, cha
 	}
 	fmt.Println("stream market urlPath:", urlPath)
 
-	conn, rawDataChan, err := pub.WsConnect(ctx, urlPath)
+	conn, rawDataChan, err := c.WsConnect(ctx, urlPath)
 	if err != nil {
-		log.Printf("StartSubscribe WsConnect err: %v", err)
+		c.Logf("StartSubscribe WsConnect err: %v", err)
 		return nil, nil, err
 	}
 
@@ -42,13 +55,13 @@ func StartSubscribe(ctx context.Context, streams []string) (*websocket.Conn, cha
 				return // return, no more read.
 			case msg := <-rawDataChan:
 				if msg.MsgType == websocket.CloseMessage { // connection closed
-					log.Printf("StartSubscribe close message: %+v", msg)
+					c.Logf("StartSubscribe close message: %+v", msg)
 					return // return, no more read.
 				}
 
 				d, err := streamDataProcess(msg)
 				if err != nil {
-					log.Printf("StartSubscribe streamDataProcess err: %v", err)
+					c.Logf("StartSubscribe streamDataProcess err: %v", err)
 				}
 				if d != nil {
 					processedDataChan <- d
@@ -60,111 +73,199 @@ func StartSubscribe(ctx context.Context, streams []string) (*websocket.Conn, cha
 	return conn, processedDataChan, nil
 }
 
-func streamDataProcess(m *pub.WsMessage) (interface{}, error) {
-	var d StreamData
-	if err := json.Unmarshal(m.Message, &d); err != nil {
-		return nil, err
+// StartManagedSubscribe subscribes the streams by a managed connection, which reconnects and resubscribes after errors,
+// and rotates before the 24 hours disconnect. The channel receives the stream data, and the pub.WsEvent of the connection,
+// WE_Gap means data may be missing. The channel is closed after ctx is done.
+// More streams can be subscribed by the returned connection.
+func (c *Client) StartManagedSubscribe(ctx context.Context, streams []string) (*pub.WsConn, chan interface{}, error) {
+	w := c.NewWsConn("/stream?streams=" + strings.Join(streams, "/"))
+	if err := w.Start(ctx); err != nil {
+		c.Logf("StartManagedSubscribe err: %v", err)
+		return nil, nil, err
 	}
-	if d.Stream == "" && d.Data == nil { // single stream data
-		if err := json.Unmarshal(m.Message, &d.Data); err != nil {
-			return nil, err
+
+	processedDataChan := make(chan interface{}, pub.WsChanLen)
+	go func() {
+		defer close(processedDataChan)
+
+		msgs, events := w.Messages(), w.Events()
+		for msgs != nil || events != nil {
+			var d interface{}
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					msgs = nil
+					continue
+				}
+				if isResponse(msg.Message) { // response of SUBSCRIBE, UNSUBSCRIBE
+					continue
+				}
+				var err error
+				if d, err = streamDataProcess(msg); err != nil {
+					c.Logf("StartManagedSubscribe streamDataProcess err: %v", err)
+					continue
+				}
+			case e, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				d = e
+			}
+			if d == nil {
+				continue
+			}
+			select {
+			case processedDataChan <- d:
+			case <-ctx.Done():
+				if msgs != nil {
+					for range msgs { // wait for the connection closed
+					}
+				}
+				return
+			}
 		}
-	}
+	}()
 
-	if d.Stream == "" && d.Data == nil {
-		return nil, fmt.Errorf("got non-stream data: %s", string(m.Message))
-	}
+	return w, processedDataChan, nil
+}
 
-	b, err := json.Marshal(d.Data)
-	if err != nil {
-		return nil, err
+// isResponse reports whether the message is the response of a request, like {"result":null,"id":1}.
+func isResponse(message []byte) bool {
+	var resp struct {
+		Id *int64 `json:"id"`
 	}
+	return json.Unmarshal(message, &resp) == nil && resp.Id != nil
+}
 
-	eventyType := d.Data["e"].(string)
-	switch eventyType {
-	case "aggTrade":
-		var t AggTrade
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
+// streamDataProcess decodes the message of a raw or combined stream to the event type, such as AggTrade,
+// or a slice of it for the array streams, such as []MarkPriceUpdate of !markPrice@arr.
+// It returns nil without error for an empty array.
+func streamDataProcess(m *pub.WsMessage) (interface{}, error) {
+	var stream string
+	data := bytes.TrimSpace(m.Message)
+	if len(data) > 0 && data[0] == '{' {
+		var d struct {
+			Stream string          `json:"stream"`
+			Data   json.RawMessage `json:"data"`
 		}
-		return t, nil
-
-	case "markPriceUpdate":
-		var t MarkPriceUpdate
-		if err := json.Unmarshal(b, &t); err != nil {
+		if err := json.Unmarshal(data, &d); err != nil {
 			return nil, err
 		}
-		return t, nil
-
-	case "kline":
-		var t Kline
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
+		if d.Stream != "" || len(d.Data) > 0 { // combined stream
+			stream, data = d.Stream, bytes.TrimSpace(d.Data)
 		}
-		return t, nil
+	}
 
-	case "miniTicker":
-		var t MiniTicker
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
-		}
-		return t, nil
+	if len(data) > 0 && data[0] == '[' {
+		return decodeEvents(data)
+	}
+	eventType, err := eventTypeOf(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w, data: %s", err, m.Message)
+	}
+	v, err := decodeEvent(eventType, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w, data: %s", err, m.Message)
+	}
+	if depth, ok := v.(DepthUpdate); ok && depth.Symbol == "" && stream != "" { // partial depth without symbol
+		depth.Symbol = strings.ToUpper(strings.Split(stream, "@")[0])
+		v = depth
+	}
+	return v, nil
+}
 
-	case "ticker":
-		var t Ticker
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
+// eventTypeOf returns the "e" of the event, or "depthUpdate" for the partial depth snapshot without "e".
+func eventTypeOf(data []byte) (string, error) {
+	var head struct {
+		EventType    json.RawMessage `json:"e"`
+		EventTime    json.RawMessage `json:"E"` // or "E" is decoded to EventType, as the keys are case-insensitive
+		LastUpdateId json.RawMessage `json:"lastUpdateId"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return "", err
+	}
+	if len(head.EventType) == 0 {
+		if len(head.LastUpdateId) > 0 {
+			return "depthUpdate", nil
 		}
-		return t, nil
+		return "", fmt.Errorf("got non-stream data")
+	}
+	var eventType string
+	if err := json.Unmarshal(head.EventType, &eventType); err != nil {
+		return "", fmt.Errorf("invalid event type: %s", head.EventType)
+	}
+	return eventType, nil
+}
 
+func decodeEvent(eventType string, data []byte) (interface{}, error) {
+	switch eventType {
+	case "aggTrade":
+		return decode[AggTrade](data)
+	case "trade":
+		return decode[Trade](data)
+	case "markPriceUpdate":
+		return decode[MarkPriceUpdate](data)
+	case "kline", "continuous_kline", "indexPriceKline", "markPriceKline":
+		return decode[Kline](data)
+	case "24hrMiniTicker", "miniTicker":
+		return decode[MiniTicker](data)
+	case "24hrTicker", "ticker":
+		return decode[Ticker](data)
 	case "bookTicker":
-		var t BookTicker
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
-		}
-		return t, nil
-
+		return decode[BookTicker](data)
 	case "forceOrder":
-		var t ForceOrder
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
-		}
-		return t, nil
-
+		return decode[ForceOrder](data)
 	case "depthUpdate":
-		var t DepthUpdate
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
-		}
-		return t, nil
-
+		return decode[DepthUpdate](data)
 	case "compositeIndex":
-		var t CompositeIndex
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
-		}
-		return t, nil
-
+		return decode[CompositeIndex](data)
 	case "contractInfo":
-		var t ContractInfo
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
-		}
-		return t, nil
-
+		return decode[ContractInfo](data)
 	case "assetIndexUpdate":
-		var t AssetIndexUpdate
-		if err := json.Unmarshal(b, &t); err != nil {
-			return nil, err
-		}
-		return t, nil
+		return decode[AssetIndexUpdate](data)
+	default:
+		return nil, fmt.Errorf("unknown event type: %s", eventType)
+	}
+}
 
+// decodeEvents decodes the array streams by the type of the first event.
+func decodeEvents(data []byte) (interface{}, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	eventType, err := eventTypeOf(list[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w, data: %s", err, data)
+	}
+	switch eventType {
+	case "markPriceUpdate":
+		return decode[[]MarkPriceUpdate](data)
+	case "24hrMiniTicker", "miniTicker":
+		return decode[[]MiniTicker](data)
+	case "24hrTicker", "ticker":
+		return decode[[]Ticker](data)
+	case "assetIndexUpdate":
+		return decode[[]AssetIndexUpdate](data)
 	default:
-		return nil, fmt.Errorf("unknown event type: %s, data: %s", eventyType, string(m.Message))
+		return nil, fmt.Errorf("unknown array event type: %s, data: %s", eventType, data)
+	}
+}
+
+func decode[T any](data []byte) (interface{}, error) {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
 	}
+	return v, nil
 }
 
 // method: SUBSCRIBE, UNSUBSCRIBE
+// The response is not read, use SubscriptionManager to wait for the responses.
 func SubUnSub(conn *websocket.Conn, streams []string, method string) error {
 	var sub SubUnsub
 	sub.Method = method
@@ -4,10 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // go test -v -run TestSubscribeSingleStream
@@ -156,3 +164,428 @@ func multiStreamDataProcess(data *pub.WsMessage) (interface{}, error) {
 
 	return nil, err
 }
+
+// go test -v -run TestStartManagedSubscribe
+func TestStartManagedSubscribe(t *testing.T) {
+	var conns int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := atomic.AddInt32(&conns, 1)
+		assert.Equal(t, "btcusdt@aggTrade/btcusdt@bookTicker", r.URL.Query().Get("streams"))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"result":null,"id":1}`))
+		for i := 0; i < 3; i++ {
+			msg := fmt.Sprintf(`{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","E":123456789,"s":"BTCUSDT","a":%d,"p":"0.001","q":"100"}}`, i)
+			conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		if n == 1 {
+			return // lost connection
+		}
+		time.Sleep(time.Second)
+	}))
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, ch, err := NewClient(pc).StartManagedSubscribe(ctx, []string{"btcusdt@aggTrade", "btcusdt@bookTicker"})
+	require.NoError(t, err)
+
+	var trades int
+	var events []pub.WsEventType
+	for trades < 6 || len(events) < 4 {
+		select {
+		case d := <-ch:
+			switch v := d.(type) {
+			case AggTrade:
+				require.Equal(t, "0.001", v.Price)
+				trades++
+			case pub.WsEvent:
+				events = append(events, v.Type)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	require.Equal(t, []pub.WsEventType{pub.WE_Connected, pub.WE_Disconnected, pub.WE_Gap, pub.WE_Connected}, events)
+	cancel()
+	for range ch {
+	}
+}
+
+// mockMarketServer handles SUBSCRIBE, UNSUBSCRIBE, LIST_SUBSCRIPTIONS, SET_PROPERTY like binance,
+// and fails the connection if messages are sent faster than 10 per second.
+type mockMarketServer struct {
+	t       *testing.T
+	mu      sync.Mutex
+	conns   int
+	tooFast bool
+}
+
+func (m *mockMarketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	m.mu.Lock()
+	m.conns++
+	m.mu.Unlock()
+
+	subs := map[string]bool{}
+	var trades []string
+	var last time.Time
+	for {
+		var req struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Id     int64           `json:"id"`
+		}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		if time.Since(last) < 100*time.Millisecond {
+			m.mu.Lock()
+			m.tooFast = true
+			m.mu.Unlock()
+		}
+		last = time.Now()
+
+		resp := map[string]interface{}{"result": nil, "id": req.Id}
+		var params []interface{}
+		json.Unmarshal(req.Params, &params)
+		switch req.Method {
+		case "SUBSCRIBE", "UNSUBSCRIBE":
+			for _, p := range params {
+				s := p.(string)
+				if !strings.Contains(s, "@") {
+					resp = map[string]interface{}{"error": map[string]interface{}{"code": 2, "msg": "Invalid request: invalid stream " + s}, "id": req.Id}
+					break
+				}
+				subs[s] = req.Method == "SUBSCRIBE"
+			}
+			if _, ok := resp["error"]; !ok && req.Method == "SUBSCRIBE" {
+				for _, p := range params { // a trade of each new stream after the response
+					trades = append(trades, fmt.Sprintf(`{"stream":"%v","data":{"e":"aggTrade","s":"BTCUSDT","p":"1.5","q":"2"}}`, p))
+				}
+			}
+		case "LIST_SUBSCRIPTIONS":
+			list := []string{}
+			for s, ok := range subs {
+				if ok {
+					list = append(list, s)
+				}
+			}
+			resp["result"] = list
+		case "SET_PROPERTY":
+		case "GET_PROPERTY":
+			resp["result"] = true
+		default:
+			resp = map[string]interface{}{"error": map[string]interface{}{"code": 1, "msg": "Invalid method"}, "id": req.Id}
+		}
+		conn.WriteJSON(resp)
+		for _, trade := range trades {
+			conn.WriteMessage(websocket.TextMessage, []byte(trade))
+		}
+		trades = trades[:0]
+	}
+}
+
+// go test -v -run TestSubscriptionManager
+func TestSubscriptionManager(t *testing.T) {
+	mock := &mockMarketServer{t: t}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewClient(pc).NewSubscriptionManager(ctx)
+	m.MaxStreams = 2
+	m.AckTimeout = time.Second
+
+	streams := SymbolStreams([]string{"BTCUSDT", "ETHUSDT", "BNBUSDT"}, "aggTrade")
+	require.Equal(t, []string{"btcusdt@aggTrade", "ethusdt@aggTrade", "bnbusdt@aggTrade"}, streams)
+	require.NoError(t, m.Subscribe(ctx, streams...))
+	require.NoError(t, m.Subscribe(ctx, "btcusdt@aggTrade", "btcusdt@bookTicker")) // 1 new stream
+	require.Equal(t, 2, m.Connections())
+	require.Equal(t, []string{"bnbusdt@aggTrade", "btcusdt@aggTrade", "btcusdt@bookTicker", "ethusdt@aggTrade"}, m.Streams())
+
+	list, err := m.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, m.Streams(), list)
+
+	// rejected by binance, not kept
+	err = m.Subscribe(ctx, "invalid")
+	var wsErr *pub.WsError
+	require.ErrorAs(t, err, &wsErr)
+	require.Equal(t, 2, wsErr.Code)
+	require.NotContains(t, m.Streams(), "invalid")
+	require.Equal(t, 2, m.Connections()) // the new connection of it is closed
+
+	require.NoError(t, m.Unsubscribe(ctx, "ethusdt@aggTrade", "btcusdt@bookTicker", "notsubscribed@aggTrade"))
+	require.Equal(t, []string{"bnbusdt@aggTrade", "btcusdt@aggTrade"}, m.Streams())
+	list, err = m.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, m.Streams(), list)
+
+	require.NoError(t, m.SetProperty(ctx, "combined", true))
+	v, err := m.GetProperty(ctx, "combined")
+	require.NoError(t, err)
+	require.Equal(t, "true", string(v))
+
+	var trades int
+	for trades < 4 { // one trade of each subscribed stream
+		d := <-m.Data()
+		if _, ok := d.(AggTrade); ok {
+			trades++
+		}
+	}
+
+	// the connection without streams is closed
+	require.NoError(t, m.Unsubscribe(ctx, "bnbusdt@aggTrade"))
+	require.Equal(t, 1, m.Connections())
+	list, err = m.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"btcusdt@aggTrade"}, list)
+
+	// concurrent calls wait for the same request
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.Subscribe(ctx, "xrpusdt@aggTrade", "adausdt@aggTrade")
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"adausdt@aggTrade", "btcusdt@aggTrade", "xrpusdt@aggTrade"}, m.Streams())
+	require.Equal(t, 2, m.Connections())
+
+	cancel()
+	for range m.Data() {
+	}
+	require.Error(t, m.Subscribe(context.Background(), "dogeusdt@aggTrade"))
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	require.False(t, mock.tooFast)
+}
+
+// go test -v -run TestSubscriptionManagerSlowConsumer
+func TestSubscriptionManagerSlowConsumer(t *testing.T) {
+	srv := httptest.NewServer(&mockMarketServer{t: t})
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewClient(pc).NewSubscriptionManager(ctx)
+	m.data = make(chan interface{}, 1) // filled by the first event, Data() is not read
+	m.AckTimeout = time.Second
+
+	// the responses are not blocked by the data, which is dropped
+	for _, s := range []string{"btcusdt@aggTrade", "ethusdt@aggTrade", "bnbusdt@aggTrade"} {
+		require.NoError(t, m.Subscribe(ctx, s))
+	}
+	require.Eventually(t, func() bool { return m.Dropped() >= 2 }, time.Second, 10*time.Millisecond)
+	cancel()
+	for range m.Data() {
+	}
+}
+
+// go test -v -run TestStreamNames
+func TestStreamNames(t *testing.T) {
+	names, err := Names(
+		AggTradeStream("BTCUSDT"),
+		TradeStream("BTCUSDT"),
+		MarkPriceStream("BTCUSDT", time.Second),
+		MarkPriceStream("btcusdt", 0),
+		AllMarkPriceStream(3*time.Second),
+		KlineStream("BTCUSDT", pub.KI_Minute1),
+		ContinuousKlineStream("BTCUSDT", pub.CT_Perpetual, pub.KI_Hour4),
+		IndexPriceKlineStream("BTCUSDT", pub.KI_Minute5),
+		MarkPriceKlineStream("BTCUSDT", pub.KI_Day1),
+		DepthStream("BTCUSDT", 0, 100*time.Millisecond),
+		DepthStream("BTCUSDT", 5, 0),
+		DepthStream("BTCUSDT", 20, 500*time.Millisecond),
+		AllMarketMiniTickersStream(),
+		BookTickerStream("ETHUSDT"),
+		AllBookTickersStream(),
+		AllForceOrdersStream(),
+		ContractInfoStream(),
+		AssetIndexStream("ADAUSD"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"btcusdt@aggTrade",
+		"btcusdt@trade",
+		"btcusdt@markPrice@1s",
+		"btcusdt@markPrice",
+		"!markPrice@arr",
+		"btcusdt@kline_1m",
+		"btcusdt_perpetual@continuousKline_4h",
+		"btcusdt@indexPriceKline_5m",
+		"btcusdt@markPriceKline_1d",
+		"btcusdt@depth@100ms",
+		"btcusdt@depth5",
+		"btcusdt@depth20@500ms",
+		"!miniTicker@arr",
+		"ethusdt@bookTicker",
+		"!bookTicker",
+		"!forceOrder@arr",
+		"!contractInfo",
+		"adausd@assetIndex",
+	}, names)
+
+	for _, s := range []StreamName{
+		AggTradeStream(""),
+		AggTradeStream("btc@usdt"),
+		KlineStream("BTCUSDT", "2m"),
+		ContinuousKlineStream("BTCUSDT", pub.CT_CurrentMonth, pub.KI_Minute1),
+		DepthStream("BTCUSDT", 15, 0),
+		DepthStream("BTCUSDT", 5, time.Second),
+		MarkPriceStream("BTCUSDT", 2*time.Second),
+	} {
+		require.Error(t, s.Err())
+		require.Empty(t, s.Name())
+	}
+	_, err = Names(AggTradeStream("BTCUSDT"), KlineStream("BTCUSDT", "2m"))
+	require.ErrorContains(t, err, "invalid kline interval")
+}
+
+// go test -v -run TestTypedStreams
+func TestTypedStreams(t *testing.T) {
+	mock := &mockMarketServer{t: t}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewClient(pc).NewSubscriptionManager(ctx)
+	m.AckTimeout = time.Second
+
+	_, err := Chan(ctx, m, KlineStream("BTCUSDT", "2m"))
+	require.Error(t, err)
+	require.Empty(t, m.Streams())
+
+	btc, err := Chan(ctx, m, AggTradeStream("BTCUSDT"))
+	require.NoError(t, err)
+	trade := <-btc
+	require.Equal(t, "1.5", trade.Price)
+
+	eth := make(chan AggTrade, 1)
+	require.NoError(t, Handle(ctx, m, AggTradeStream("ETHUSDT"), func(t AggTrade) { eth <- t }))
+	trade = <-eth
+	require.Equal(t, "2", trade.Quantity)
+
+	// the streams without handler are sent to Data()
+	require.NoError(t, m.Subscribe(ctx, "bnbusdt@aggTrade"))
+	var trades []AggTrade
+	for len(trades) == 0 {
+		if trade, ok := (<-m.Data()).(AggTrade); ok {
+			trades = append(trades, trade)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	for len(m.Data()) > 0 {
+		if trade, ok := (<-m.Data()).(AggTrade); ok {
+			trades = append(trades, trade)
+		}
+	}
+	require.Len(t, trades, 1)
+
+	// closed after unsubscribed
+	require.NoError(t, m.Unsubscribe(ctx, "btcusdt@aggTrade"))
+	_, ok := <-btc
+	require.False(t, ok)
+
+	// closed after the manager is closed
+	xrp, err := Chan(ctx, m, AggTradeStream("XRPUSDT"))
+	require.NoError(t, err)
+	<-xrp
+	cancel()
+	for range xrp {
+	}
+	for range m.Data() {
+	}
+}
+
+var streamMessages = []string{
+	`{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","E":1,"s":"BTCUSDT","a":5,"p":"1.5","q":"2","f":1,"l":2,"T":1,"m":true}}`,
+	`{"e":"trade","E":1,"T":1,"s":"BTCUSDT","t":7,"p":"1.5","q":"2","X":"MARKET","m":true}`,
+	`{"stream":"btcusdt_perpetual@continuousKline_1m","data":{"e":"continuous_kline","E":1,"ps":"BTCUSDT","ct":"PERPETUAL","k":{"t":1,"T":2,"i":"1m","o":"1","c":"2","h":"3","l":"0.5","x":false}}}`,
+	`{"e":"indexPriceKline","E":1,"ps":"BTCUSDT","k":{"t":1,"T":2,"s":"0","i":"1m","o":"1","c":"2","h":"3","l":"0.5"}}`,
+	`{"e":"markPriceKline","E":1,"ps":"BTCUSDT","k":{"t":1,"T":2,"s":"BTCUSDT","i":"1m","o":"1","c":"2","h":"3","l":"0.5"}}`,
+	`{"stream":"!markPrice@arr","data":[{"e":"markPriceUpdate","E":1,"s":"BTCUSDT","p":"100","r":"0.0001"},{"e":"markPriceUpdate","E":1,"s":"ETHUSDT","p":"10"}]}`,
+	`[{"e":"24hrTicker","E":1,"s":"BTCUSDT","c":"100"}]`,
+	`{"stream":"!miniTicker@arr","data":[{"e":"24hrMiniTicker","E":1,"s":"BTCUSDT","c":"100"}]}`,
+	`{"stream":"btcusdt@depth5@100ms","data":{"lastUpdateId":9,"E":1,"T":2,"bids":[["100","1"]],"asks":[["101","2"]]}}`,
+	`{"stream":"btcusdt@depth5","data":{"e":"depthUpdate","E":1,"T":2,"s":"BTCUSDT","U":8,"u":9,"pu":7,"b":[["100","1"]],"a":[]}}`,
+	`{"stream":"!miniTicker@arr","data":[]}`,
+}
+
+// go test -v -run TestStreamDataProcess
+func TestStreamDataProcess(t *testing.T) {
+	var got []interface{}
+	for _, msg := range streamMessages {
+		d, err := streamDataProcess(&pub.WsMessage{Message: []byte(msg)})
+		require.NoError(t, err, msg)
+		got = append(got, d)
+	}
+	require.Equal(t, "1.5", got[0].(AggTrade).Price)
+	require.Equal(t, "MARKET", got[1].(Trade).OrderType)
+	require.Equal(t, "PERPETUAL", got[2].(Kline).ContractType)
+	require.Equal(t, "indexPriceKline", got[3].(Kline).EventType)
+	require.Equal(t, "2", got[4].(Kline).K.ClosePrice)
+	require.Len(t, got[5].([]MarkPriceUpdate), 2)
+	require.Equal(t, "100", got[6].([]Ticker)[0].LastPrice)
+	require.Equal(t, "BTCUSDT", got[7].([]MiniTicker)[0].Symbol)
+	require.Nil(t, got[10])
+
+	for _, d := range got[8:10] { // snapshot and update of partial depth
+		depth := d.(DepthUpdate)
+		require.Equal(t, "depthUpdate", depth.EventType)
+		require.Equal(t, "BTCUSDT", depth.Symbol)
+		require.Equal(t, int64(9), depth.LastID)
+		require.Equal(t, int64(2), depth.TransactionTime)
+		require.Equal(t, [][]string{{"100", "1"}}, depth.Bids)
+	}
+
+	for _, msg := range []string{
+		``,
+		`null`,
+		`{"stream":"btcusdt@aggTrade","data":{"e":1}}`,
+		`{"e":{"x":1}}`,
+		`{"e":"unknown"}`,
+		`[{"e":"aggTrade"}]`,
+		`[1]`,
+		`{"result":null,"id":1}`,
+		`{"e":"aggTrade","p":1}`,
+	} {
+		_, err := streamDataProcess(&pub.WsMessage{Message: []byte(msg)})
+		require.Error(t, err, msg)
+	}
+}
+
+// go test -fuzz FuzzStreamDataProcess -run FuzzStreamDataProcess
+func FuzzStreamDataProcess(f *testing.F) {
+	for _, msg := range streamMessages {
+		f.Add([]byte(msg))
+	}
+	f.Add([]byte(`{"e":1}`))
+	f.Add([]byte(`{"stream":"x","data":[{"e":null}]}`))
+	f.Add([]byte(`{"data":{"lastUpdateId":"x"}}`))
+	f.Fuzz(func(t *testing.T, message []byte) {
+		d, err := streamDataProcess(&pub.WsMessage{Message: message})
+		if err != nil && d != nil {
+			t.Fatalf("got data %v with err %v", d, err)
+		}
+	})
+}
@@ -1,5 +1,11 @@
 package streammarket
 
+import (
+	"encoding/json"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
 type SubUnsub struct {
 	Method string   `json:"method"`
 	Params []string `json:"params"`
@@ -24,6 +30,18 @@ type AggTrade struct {
 	IsBuyer   bool   `json:"m"`
 }
 
+type Trade struct {
+	EventType string `json:"e"` // "trade",
+	EventTime int64  `json:"E"`
+	Time      int64  `json:"T"`
+	Symbol    string `json:"s"`
+	TradeID   int64  `json:"t"`
+	Price     string `json:"p"`
+	Quantity  string `json:"q"`
+	OrderType string `json:"X"` // "MARKET", "INSURANCE_FUND", "ADL", "NA"
+	IsBuyer   bool   `json:"m"`
+}
+
 type MarkPriceUpdate struct {
 	EventType            string `json:"e"` // "markPriceUpdate",
 	EventTime            int64  `json:"E"`
@@ -36,7 +54,7 @@ type MarkPriceUpdate struct {
 }
 
 type Kline struct {
-	EventType    string `json:"e"` // "kline", "continuous_kline"
+	EventType    string `json:"e"` // "kline", "continuous_kline", "indexPriceKline", "markPriceKline"
 	EventTime    int64  `json:"E"`
 	Symbol       string `json:"s"`
 	Pair         string `json:"ps"` // :"BTCUSDT",
@@ -124,14 +142,37 @@ type ForceOrder struct {
 }
 
 type DepthUpdate struct {
-	EventType string     `json:"e"` // "depthUpdate",
-	EventTime int64      `json:"E"`
-	Symbol    string     `json:"s"`
-	FirstID   int64      `json:"U"`
-	LastID    int64      `json:"u"`
-	PrevLast  int64      `json:"pu"` // Final update Id in last stream(ie `u` in last stream)
-	Bids      [][]string `json:"b"`  // []string{Price level to be updated, qty}
-	Asks      [][]string `json:"a"`  // []string{Price level to be updated, qty}
+	EventType       string     `json:"e"` // "depthUpdate",
+	EventTime       int64      `json:"E"`
+	TransactionTime int64      `json:"T"`
+	Symbol          string     `json:"s"`
+	FirstID         int64      `json:"U"`
+	LastID          int64      `json:"u"`
+	PrevLast        int64      `json:"pu"` // Final update Id in last stream(ie `u` in last stream)
+	Bids            [][]string `json:"b"`  // []string{Price level to be updated, qty}
+	Asks            [][]string `json:"a"`  // []string{Price level to be updated, qty}
+}
+
+// UnmarshalJSON also decodes the partial depth snapshot without "e", like
+// {"lastUpdateId":1,"E":2,"T":3,"bids":[["1.0","2"]],"asks":[]}, LastID is its lastUpdateId.
+func (d *DepthUpdate) UnmarshalJSON(b []byte) error {
+	type depthUpdate DepthUpdate
+	var v struct {
+		depthUpdate
+		LastUpdateId int64      `json:"lastUpdateId"`
+		SnapshotBids [][]string `json:"bids"`
+		SnapshotAsks [][]string `json:"asks"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*d = DepthUpdate(v.depthUpdate)
+	if d.EventType == "" && v.LastUpdateId != 0 {
+		d.EventType = "depthUpdate"
+		d.LastID = v.LastUpdateId
+		d.Bids, d.Asks = v.SnapshotBids, v.SnapshotAsks
+	}
+	return nil
 }
 
 type CompositeIndex struct {
@@ -162,7 +203,7 @@ type ContractInfo struct {
 		BracketFloor     int     `json:"bnf"`
 		BracketCeiling   int     `json:"bnc"`
 		MaintenanceRatio float64 `json:"mmr"`
-		CalculationField int     `json:"cf"`
+		CalculationField float64 `json:"cf"`
 		MinLeverage      int     `json:"mi"`
 		MaxLeverage      int     `json:"ma"`
 	} `json:"bks"`
@@ -182,3 +223,43 @@ type AssetIndexUpdate struct {
 	AutoBidRate   string `json:"Q"`
 	AutoAskRate   string `json:"G"`
 }
+
+// Decimal accessors of the string numbers, such as PriceDec() for Price.
+
+func (t *AggTrade) PriceDec() pub.Decimal    { return pub.D(t.Price) }
+func (t *AggTrade) QuantityDec() pub.Decimal { return pub.D(t.Quantity) }
+
+func (t *Trade) PriceDec() pub.Decimal    { return pub.D(t.Price) }
+func (t *Trade) QuantityDec() pub.Decimal { return pub.D(t.Quantity) }
+
+func (m *MarkPriceUpdate) MarkPriceDec() pub.Decimal            { return pub.D(m.MarkPrice) }
+func (m *MarkPriceUpdate) IndexPriceDec() pub.Decimal           { return pub.D(m.IndexPrice) }
+func (m *MarkPriceUpdate) EstimatedSettlePriceDec() pub.Decimal { return pub.D(m.EstimatedSettlePrice) }
+func (m *MarkPriceUpdate) FundingRateDec() pub.Decimal          { return pub.D(m.FundingRate) }
+
+func (t *MiniTicker) ClosePriceDec() pub.Decimal       { return pub.D(t.ClosePrice) }
+func (t *MiniTicker) OpenPriceDec() pub.Decimal        { return pub.D(t.OpenPrice) }
+func (t *MiniTicker) HighPriceDec() pub.Decimal        { return pub.D(t.HighPrice) }
+func (t *MiniTicker) LowPriceDec() pub.Decimal         { return pub.D(t.LowPrice) }
+func (t *MiniTicker) BaseAssetVolumeDec() pub.Decimal  { return pub.D(t.BaseAssetVolume) }
+func (t *MiniTicker) QuoteAssetVolumeDec() pub.Decimal { return pub.D(t.QuoteAssetVolume) }
+
+func (t *Ticker) PriceChangeDec() pub.Decimal      { return pub.D(t.PriceChange) }
+func (t *Ticker) LastPriceDec() pub.Decimal        { return pub.D(t.LastPrice) }
+func (t *Ticker) LastQtyDec() pub.Decimal          { return pub.D(t.LastQty) }
+func (t *Ticker) OpenPriceDec() pub.Decimal        { return pub.D(t.OpenPrice) }
+func (t *Ticker) HighPriceDec() pub.Decimal        { return pub.D(t.HighPrice) }
+func (t *Ticker) LowPriceDec() pub.Decimal         { return pub.D(t.LowPrice) }
+func (t *Ticker) BaseAssetVolumeDec() pub.Decimal  { return pub.D(t.BaseAssetVolume) }
+func (t *Ticker) QuoteAssetVolumeDec() pub.Decimal { return pub.D(t.QuoteAssetVolume) }
+
+func (t *BookTicker) BidPriceDec() pub.Decimal { return pub.D(t.BidPrice) }
+func (t *BookTicker) BidQtyDec() pub.Decimal   { return pub.D(t.BidQty) }
+func (t *BookTicker) AskPriceDec() pub.Decimal { return pub.D(t.AskPrice) }
+func (t *BookTicker) AskQtyDec() pub.Decimal   { return pub.D(t.AskQty) }
+
+// BidLevels parses the bids to decimal price levels.
+func (d *DepthUpdate) BidLevels() ([]pub.PriceLevel, error) { return pub.ParsePriceLevels(d.Bids) }
+
+// AskLevels parses the asks to decimal price levels.
+func (d *DepthUpdate) AskLevels() ([]pub.PriceLevel, error) { return pub.ParsePriceLevels(d.Asks) }
@@ -0,0 +1,33 @@
+package streamuserdata
+
+import (
+	"context"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/gorilla/websocket"
+)
+
+// The package level functions below keep the original API, they connect by pub.DefaultClient.
+
+func newKeyClient(key *pub.Key) *Client {
+	return NewClient(pub.DefaultClient.WithKey(key))
+}
+
+// Deprecated: use NewClient(pub.DefaultClient.WithKey(key)).NewSupervisor().
+func StartUserStream(ctx context.Context, key *pub.Key) (*websocket.Conn, chan interface{}, error) {
+	return newKeyClient(key).StartUserStream(ctx)
+}
+
+func GetListenKey(key *pub.Key) (string, error) {
+	return newKeyClient(key).GetListenKey(context.Background())
+}
+
+// PutListenKey updates the listen key. keep alive in 60 minutes.
+func PutListenKey(key *pub.Key) (string, error) {
+	return newKeyClient(key).PutListenKey(context.Background())
+}
+
+// DeleteListenKey deletes the listen key.
+func DeleteListenKey(key *pub.Key) error {
+	return newKeyClient(key).DeleteListenKey(context.Background())
+}
@@ -4,20 +4,33 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/billfort/binance-usdmfuture/pub"
 	"github.com/gorilla/websocket"
 )
 
-func StartUserStream(ctx context.Context, key *pub.Key) (*websocket.Conn, chan interface{}, error) {
-	if key == nil || key.ApiKey == "" || key.SecretKey == "" {
-		return nil, nil, fmt.Errorf("key is nil or api key, secret key is empty")
+// Client receives user data stream of the key in the wrapped pub.Client.
+type Client struct {
+	*pub.Client
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c}
+}
+
+// StartUserStream connects the user data stream of the key, the channel is closed when the connection is lost
+// or the listen key is expired.
+//
+// Deprecated: the connection is not managed, use NewSupervisor for a stream which reconnects and reconciles.
+func (c *Client) StartUserStream(ctx context.Context) (*websocket.Conn, chan interface{}, error) {
+	key := c.Key
+	if key == nil || key.ApiKey == "" {
+		return nil, nil, fmt.Errorf("key is nil or api key is empty")
 	}
 
 	var err error
-	listenKey, err := GetListenKey(key)
+	listenKey, err := c.GetListenKey(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -25,22 +38,21 @@ func StartUserStream(ctx context.Context, key *pub.Key) (*websocket.Conn, chan i
 		for {
 			select {
 			case <-ctx.Done():
-				log.Printf("StartUserStream break now because of context err: %v", ctx.Err())
+				c.Logf("StartUserStream break now because of context err: %v", ctx.Err())
 				return
 			case <-time.After(58 * time.Minute): // keey alive each 60 minutes
-				_, err := PutListenKey(key)
-				if err != nil {
-					log.Printf("StartUserStream PutListenKey err: %v", err)
-					return
+				_, err := c.PutListenKey(ctx)
+				if err != nil { // try again in the next round, the key is still valid
+					c.Logf("StartUserStream PutListenKey err: %v", err)
 				}
 			}
 		}
 	}()
 
 	urlPath := "/ws/" + listenKey
-	conn, rawDataChan, err := pub.WsConnect(ctx, urlPath)
+	conn, rawDataChan, err := c.WsConnect(ctx, urlPath)
 	if err != nil {
-		log.Printf("StartSubscribe WsConnect err: %v", err)
+		c.Logf("StartSubscribe WsConnect err: %v", err)
 		return nil, nil, err
 	}
 
@@ -58,13 +70,13 @@ func StartUserStream(ctx context.Context, key *pub.Key) (*websocket.Conn, chan i
 				}
 				data, err := userDataProcess(key, msg)
 				if err != nil {
-					log.Printf("StartUserStream userDataProcess err: %v, msg:%v", err, string(msg.Message))
+					c.Logf("StartUserStream userDataProcess err: %v, msg:%v", err, string(msg.Message))
 					continue
 				}
 				if data != nil {
 					if str, ok := data.(string); ok {
 						if str == "listenKeyExpired" {
-							listenKey, _ = GetListenKey(key)
+							listenKey, _ = c.GetListenKey(ctx)
 							return // exit reading, and will reconnect
 						}
 					} else {
@@ -166,14 +178,11 @@ func userDataProcess(key *pub.Key, data *pub.WsMessage) (interface{}, error) {
 	}
 }
 
-func GetListenKey(key *pub.Key) (string, error) {
-	resBody, errMsg, err := pub.PostWithSign(key, "/fapi/v1/listenKey", nil)
+func (c *Client) GetListenKey(ctx context.Context) (string, error) {
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/listenKey", nil)
 	if err != nil {
 		return "", err
 	}
-	if errMsg.Code < 0 {
-		return "", fmt.Errorf("%+v", errMsg)
-	}
 
 	var lk listenKey
 	if err := json.Unmarshal(resBody, &lk); err != nil {
@@ -184,8 +193,8 @@ func GetListenKey(key *pub.Key) (string, error) {
 }
 
 // PutListenKey updates the listen key. keep alive in 60 minutes.
-func PutListenKey(key *pub.Key) (string, error) {
-	resBody, err := pub.PutWithSign(key, "/fapi/v1/listenKey", nil)
+func (c *Client) PutListenKey(ctx context.Context) (string, error) {
+	resBody, err := c.PutWithSign(ctx, "/fapi/v1/listenKey", nil)
 	if err != nil {
 		return "", err
 	}
@@ -199,8 +208,8 @@ func PutListenKey(key *pub.Key) (string, error) {
 }
 
 // DeleteListenKey deletes the listen key.
-func DeleteListenKey(key *pub.Key) error {
-	_, err := pub.DeleteWithSign(key, "/fapi/v1/listenKey", nil)
+func (c *Client) DeleteListenKey(ctx context.Context) error {
+	_, err := c.DeleteWithSign(ctx, "/fapi/v1/listenKey", nil)
 	if err != nil {
 		return err
 	}
@@ -3,10 +3,15 @@ package streamuserdata
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,3 +41,164 @@ Loop:
 	}
 	cancel()
 }
+
+// mockUserStream serves the server time, the listen key REST api and the user data streams:
+// key1 sends an order update and listenKeyExpired, key2 sends an account update then drops the connection,
+// and sends an order update after the reconnection.
+type mockUserStream struct {
+	mu       sync.Mutex
+	key      int
+	expired  bool
+	failPuts int
+	puts     int
+	deleted  []string
+	conns    map[string]int
+}
+
+func (m *mockUserStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/fapi/v1/time" {
+		fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+		return
+	}
+	if r.URL.Path == "/fapi/v1/listenKey" {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			if m.key == 0 || m.expired {
+				m.key++
+				m.expired = false
+			}
+			fmt.Fprintf(w, `{"listenKey":"key%v"}`, m.key)
+		case http.MethodPut:
+			m.puts++
+			if m.failPuts > 0 {
+				m.failPuts--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `{"code":-1001,"msg":"Internal error"}`)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		case http.MethodDelete:
+			m.deleted = append(m.deleted, fmt.Sprintf("key%v", m.key))
+			fmt.Fprint(w, `{}`)
+		}
+		return
+	}
+
+	listenKey := strings.TrimPrefix(r.URL.Path, "/ws/")
+	m.mu.Lock()
+	m.conns[listenKey]++
+	n := m.conns[listenKey]
+	m.mu.Unlock()
+
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	send := func(msg string) { conn.WriteMessage(websocket.TextMessage, []byte(msg)) }
+	switch {
+	case listenKey == "key1":
+		send(`{"e":"ORDER_TRADE_UPDATE","E":1,"T":1,"o":{"s":"BTCUSDT","c":"c1","X":"NEW"}}`)
+		m.mu.Lock()
+		m.expired = true
+		m.mu.Unlock()
+		send(`{"e":"listenKeyExpired","E":2,"listenKey":"key1"}`)
+	case listenKey == "key2" && n == 1:
+		send(`{"e":"ACCOUNT_UPDATE","E":3,"T":3,"a":{"m":"ORDER","B":[{"a":"USDT","wb":"100"}]}}`)
+		return // dropped
+	default:
+		send(`{"e":"ORDER_TRADE_UPDATE","E":4,"T":4,"o":{"s":"BTCUSDT","c":"c2","X":"FILLED"}}`)
+	}
+	conn.ReadMessage() // until closed
+}
+
+// go test -v -run TestSupervisor
+func TestSupervisor(t *testing.T) {
+	mock := &mockUserStream{failPuts: 1, conns: map[string]int{}}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), &pub.Key{UserId: 7, ApiKey: "api", SecretKey: "secret"})
+	pc.Retry = nil
+	s := NewClient(pc).NewSupervisor()
+	s.KeepAlive = 50 * time.Millisecond
+	s.Backoff = &pub.RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	var reconciles int
+	s.Reconcile = func(ctx context.Context) (*Reconciled, error) {
+		reconciles++
+		return &Reconciled{Time: time.Now(), UserId: 7}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	data, err := s.Start(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "key1", s.ListenKey())
+
+	var orders []string
+	var accounts, reconciled, gaps int
+	for len(orders) < 2 || accounts < 1 {
+		select {
+		case d := <-data:
+			switch v := d.(type) {
+			case OrderTradeUpdate:
+				require.Equal(t, int64(7), v.UserId)
+				orders = append(orders, v.Order.ClientOrderID)
+			case AccountUpdate:
+				accounts++
+			case *Reconciled:
+				reconciled++
+			case pub.WsEvent:
+				if v.Type == pub.WE_Gap {
+					gaps++
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout, orders %v, accounts %v", orders, accounts)
+		}
+	}
+	require.Equal(t, []string{"c1", "c2"}, orders)
+	require.Equal(t, "key2", s.ListenKey())
+	require.Equal(t, 2, gaps) // after the expiration and the drop
+	require.Equal(t, 3, reconciled)
+
+	time.Sleep(200 * time.Millisecond) // keepalive, the failed one is retried
+	cancel()
+	for range data {
+	}
+	require.Equal(t, 3, reconciles)
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	require.Equal(t, []string{"key2"}, mock.deleted)
+	require.Equal(t, map[string]int{"key1": 1, "key2": 2}, mock.conns)
+	require.Equal(t, 0, mock.failPuts)
+	require.Greater(t, mock.puts, 2)
+}
+
+// go test -v -run TestSupervisorSlowConsumer
+func TestSupervisorSlowConsumer(t *testing.T) {
+	mock := &mockUserStream{conns: map[string]int{}}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), ""), &pub.Key{UserId: 7, ApiKey: "api", SecretKey: "secret"})
+	s := NewClient(pc).NewSupervisor()
+	s.KeepAlive = 20 * time.Millisecond
+	s.Reconcile = nil
+	s.data = make(chan interface{}) // nothing is read
+	ctx, cancel := context.WithCancel(context.Background())
+	data, err := s.Start(ctx)
+	require.NoError(t, err)
+
+	// the listen key is kept alive while the events wait for the consumer
+	require.Eventually(t, func() bool {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		return mock.puts >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	for range data {
+	}
+}
@@ -0,0 +1,283 @@
+package streamuserdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/account"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+const (
+	defaultKeepAlive        = 30 * time.Minute // the listen key expires in 60 minutes without keepalive
+	defaultKeepAliveRetries = 5
+	deleteListenKeyTimeout  = 10 * time.Second
+)
+
+var errListenKeyExpired = errors.New("listen key expired")
+
+// Reconciled is the REST state of the account after each connection of Supervisor,
+// the events before it may be missing, it replaces the state built from them.
+type Reconciled struct {
+	Time       time.Time // by the server clock, before the queries
+	UserId     int64
+	OpenOrders []trade.OrderResponse
+	Positions  []trade.PositionInfo
+	Balances   []account.Balance
+}
+
+// Supervisor keeps the user data stream alive until the context is done: it keeps the listen key alive with retries,
+// reconnects by pub.WsConn after the connection is lost and rotates it before 24 hours, gets a new listen key and
+// connects to it after the key is expired, reconciles by REST after each connection, and deletes the listen key at last.
+// The channel of Start receives the events of userDataProcess, *Reconciled, and pub.WsEvent of the connections.
+type Supervisor struct {
+	KeepAlive        time.Duration    // interval of PutListenKey, default 30 minutes
+	KeepAliveRetries int              // retries of a failed PutListenKey before a new listen key is used, default 5
+	Backoff          *pub.RetryPolicy // backoff of reconnection and keepalive retries, MaxRetries is not used
+	// Reconcile gets the REST state after each connection, nil to skip, default queries
+	// the open orders, positions and balances of the client.
+	Reconcile func(ctx context.Context) (*Reconciled, error)
+
+	client *Client
+	data   chan interface{}
+
+	mu        sync.Mutex
+	listenKey string
+}
+
+// NewSupervisor returns a supervisor of the user data stream of the client's key.
+func (c *Client) NewSupervisor() *Supervisor {
+	s := &Supervisor{
+		KeepAlive:        defaultKeepAlive,
+		KeepAliveRetries: defaultKeepAliveRetries,
+		Backoff:          &pub.RetryPolicy{BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second, Jitter: 0.5},
+		client:           c,
+		data:             make(chan interface{}, pub.WsChanLen),
+	}
+	s.Reconcile = s.reconcile
+	return s
+}
+
+// Start gets the listen key and connects, the first connection must succeed, then it runs until ctx is done,
+// and the channel is closed after the listen key is deleted.
+func (s *Supervisor) Start(ctx context.Context) (<-chan interface{}, error) {
+	key := s.client.Key
+	if key == nil || key.ApiKey == "" {
+		return nil, fmt.Errorf("key is nil or api key is empty")
+	}
+	conn, cancel, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go s.run(ctx, conn, cancel)
+	return s.data, nil
+}
+
+// ListenKey returns the listen key in use.
+func (s *Supervisor) ListenKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listenKey
+}
+
+// connect gets a listen key if there is no one, and starts a managed connection to its stream,
+// which reconnects after errors and rotates before binance's 24 hours disconnect.
+func (s *Supervisor) connect(ctx context.Context) (*pub.WsConn, context.CancelFunc, error) {
+	listenKey := s.ListenKey()
+	if listenKey == "" {
+		var err error
+		if listenKey, err = s.client.GetListenKey(ctx); err != nil {
+			return nil, nil, err
+		}
+		s.mu.Lock()
+		s.listenKey = listenKey
+		s.mu.Unlock()
+	}
+	connCtx, cancel := context.WithCancel(ctx)
+	conn := s.client.NewWsConn("/ws/" + listenKey)
+	conn.Backoff = s.Backoff
+	if err := conn.Start(connCtx); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return conn, cancel, nil
+}
+
+func (s *Supervisor) run(ctx context.Context, conn *pub.WsConn, cancel context.CancelFunc) {
+	defer close(s.data)
+	defer s.deleteListenKey()
+
+	for {
+		err := s.serve(ctx, conn)
+		lastMsg := conn.LastMessageTime()
+		cancel()
+		for range conn.Messages() { // wait for the connection to close
+		}
+		for range conn.Events() {
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		s.mu.Lock()
+		s.listenKey = "" // serve returns after the key is expired
+		s.mu.Unlock()
+		s.client.Logf("Supervisor user stream disconnected: %v", err)
+
+		for attempt := 0; ; attempt++ {
+			s.emit(ctx, pub.WsEvent{Type: pub.WE_Disconnected, Time: time.Now(), Err: err, Attempt: attempt})
+			if s.Backoff.Wait(ctx, attempt) != nil {
+				return
+			}
+			if conn, cancel, err = s.connect(ctx); err == nil {
+				break
+			}
+			if pub.IsInvalidListenKey(err) {
+				s.mu.Lock()
+				s.listenKey = ""
+				s.mu.Unlock()
+			}
+		}
+		s.emit(ctx, pub.WsEvent{Type: pub.WE_Gap, Time: time.Now(), GapStart: lastMsg, GapEnd: time.Now()})
+	}
+}
+
+// serve forwards the events and the connection events, and reconciles after each connection which may miss events,
+// until the listen key is expired. The listen key is kept alive in another goroutine, so it is not delayed by a slow
+// consumer of the channel.
+func (s *Supervisor) serve(ctx context.Context, conn *pub.WsConn) error {
+	keepAliveCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	keepAliveErr := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(s.KeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-keepAliveCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := s.keepAlive(keepAliveCtx); err != nil && keepAliveCtx.Err() == nil {
+				keepAliveErr <- err
+				return
+			}
+		}
+	}()
+
+	msgs, events := conn.Messages(), conn.Events()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-keepAliveErr:
+			return fmt.Errorf("%w: keepalive: %v", errListenKeyExpired, err)
+		case e, ok := <-events:
+			if !ok {
+				return fmt.Errorf("connection closed")
+			}
+			switch e.Type {
+			case pub.WE_Connected:
+				s.emit(ctx, e)
+				if !e.Rotated { // no events are missing around the rotation
+					s.reconcileAndEmit(ctx)
+				}
+			case pub.WE_Disconnected:
+				s.emit(ctx, e)
+				if e.Attempt > 0 { // the reconnection fails, such as the key is expired meanwhile
+					if _, err := s.client.PutListenKey(ctx); pub.IsInvalidListenKey(err) {
+						return fmt.Errorf("%w: %v", errListenKeyExpired, err)
+					}
+				}
+			case pub.WE_Gap:
+				s.emit(ctx, e)
+			}
+		case msg, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("connection closed")
+			}
+			data, err := userDataProcess(s.client.Key, msg)
+			if err != nil {
+				s.client.Logf("Supervisor userDataProcess err: %v, msg:%v", err, string(msg.Message))
+				continue
+			}
+			if str, ok := data.(string); ok && str == "listenKeyExpired" {
+				return errListenKeyExpired
+			}
+			s.emit(ctx, data)
+		}
+	}
+}
+
+// keepAlive puts the listen key with retries, it returns the error if the key does not exist or all retries fail.
+func (s *Supervisor) keepAlive(ctx context.Context) error {
+	var err error
+	for attempt := 0; attempt <= s.KeepAliveRetries; attempt++ {
+		if attempt > 0 {
+			if werr := s.Backoff.Wait(ctx, attempt-1); werr != nil {
+				return werr
+			}
+		}
+		if _, err = s.client.PutListenKey(ctx); err == nil || pub.IsInvalidListenKey(err) {
+			return err
+		}
+		s.client.Logf("Supervisor PutListenKey attempt %v err: %v", attempt, err)
+	}
+	return err
+}
+
+// reconcileAndEmit sends the result of Reconcile, it is retried like keepAlive.
+func (s *Supervisor) reconcileAndEmit(ctx context.Context) {
+	if s.Reconcile == nil {
+		return
+	}
+	for attempt := 0; attempt <= s.KeepAliveRetries; attempt++ { // the events are buffered meanwhile
+		if attempt > 0 && s.Backoff.Wait(ctx, attempt-1) != nil {
+			return
+		}
+		r, err := s.Reconcile(ctx)
+		if err == nil {
+			s.emit(ctx, r)
+			return
+		}
+		s.client.Logf("Supervisor reconcile attempt %v err: %v", attempt, err)
+	}
+}
+
+// reconcile queries the open orders, positions and balances.
+func (s *Supervisor) reconcile(ctx context.Context) (*Reconciled, error) {
+	tc := trade.NewClient(s.client.Client)
+	r := &Reconciled{Time: s.client.Now(ctx), UserId: s.client.Key.UserId}
+	var err error
+	if r.OpenOrders, err = tc.QueryOpenOrders(ctx, ""); err != nil {
+		return nil, err
+	}
+	if r.Positions, err = tc.GetPositionInfoV3(ctx, ""); err != nil {
+		return nil, err
+	}
+	if r.Balances, err = account.NewClient(s.client.Client).AccountBalance(ctx, "v3"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *Supervisor) deleteListenKey() {
+	if s.ListenKey() == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deleteListenKeyTimeout)
+	defer cancel()
+	if err := s.client.DeleteListenKey(ctx); err != nil {
+		s.client.Logf("Supervisor DeleteListenKey err: %v", err)
+	}
+}
+
+func (s *Supervisor) emit(ctx context.Context, d interface{}) {
+	select {
+	case s.data <- d:
+	case <-ctx.Done():
+	}
+}
@@ -1,5 +1,7 @@
 package streamuserdata
 
+import "github.com/billfort/binance-usdmfuture/pub"
+
 type listenKey struct {
 	ListenKey string `json:"listenKey"`
 }
@@ -174,3 +176,22 @@ type ConditionalOrderTriggerReject struct {
 		RejectReason string `json:"r"`
 	} `json:"or"`
 }
+
+// Decimal accessors of the string numbers, such as PriceDec() for Price.
+
+func (o *Order) OriginalQuantityDec() pub.Decimal { return pub.D(o.OriginalQuantity) }
+func (o *Order) OriginalPriceDec() pub.Decimal    { return pub.D(o.OriginalPrice) }
+func (o *Order) AveragePriceDec() pub.Decimal     { return pub.D(o.AveragePrice) }
+func (o *Order) StopPriceDec() pub.Decimal        { return pub.D(o.StopPrice) }
+func (o *Order) OrderLastFilledDec() pub.Decimal  { return pub.D(o.OrderLastFilled) }
+func (o *Order) OrderFilledDec() pub.Decimal      { return pub.D(o.OrderFilled) }
+func (o *Order) LastFilledPriceDec() pub.Decimal  { return pub.D(o.LastFilledPrice) }
+func (o *Order) CommissionDec() pub.Decimal       { return pub.D(o.Commission) }
+func (o *Order) RealizedProfitDec() pub.Decimal   { return pub.D(o.RealizedProfit) }
+func (o *Order) ActivationPriceDec() pub.Decimal  { return pub.D(o.ActivationPrice) }
+func (o *Order) CallbackRateDec() pub.Decimal     { return pub.D(o.CallbackRate) }
+
+func (t *TradeLite) QuantityDec() pub.Decimal        { return pub.D(t.Quantity) }
+func (t *TradeLite) PriceDec() pub.Decimal           { return pub.D(t.Price) }
+func (t *TradeLite) LastFilledPriceDec() pub.Decimal { return pub.D(t.LastFilledPrice) }
+func (t *TradeLite) OrderLastFilledDec() pub.Decimal { return pub.D(t.OrderLastFilled) }
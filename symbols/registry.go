@@ -0,0 +1,387 @@
+// Package symbols keeps the trading rules of the symbols from exchange info, such as tick size, step size and min notional.
+package symbols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/marketdata"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+)
+
+const defaultInterval = time.Hour
+
+var ErrUnknownSymbol = errors.New("symbols: unknown symbol")
+
+// Rules are the trading rules of a symbol, the filters of exchange info are parsed to decimals,
+// the zero values mean the filter is not set.
+type Rules struct {
+	Symbol       string
+	Pair         string
+	ContractType pub.ContractType
+	Status       pub.ContractStatus
+	BaseAsset    string
+	QuoteAsset   string
+	MarginAsset  string
+	OnboardDate  int64
+	DeliveryDate int64
+
+	PricePrecision    int // system precision, use TickSize to round the price
+	QuantityPrecision int // system precision, use StepSize to round the quantity
+
+	MinPrice pub.Decimal // PRICE_FILTER
+	MaxPrice pub.Decimal
+	TickSize pub.Decimal
+
+	MinQty   pub.Decimal // LOT_SIZE
+	MaxQty   pub.Decimal
+	StepSize pub.Decimal
+
+	MarketMinQty   pub.Decimal // MARKET_LOT_SIZE
+	MarketMaxQty   pub.Decimal
+	MarketStepSize pub.Decimal
+
+	MaxNumOrders     int         // MAX_NUM_ORDERS
+	MaxNumAlgoOrders int         // MAX_NUM_ALGO_ORDERS
+	MinNotional      pub.Decimal // MIN_NOTIONAL
+
+	MultiplierUp      pub.Decimal // PERCENT_PRICE
+	MultiplierDown    pub.Decimal
+	MultiplierDecimal int
+
+	OrderTypes      []pub.OrderType
+	TimeInForce     []pub.TimeInForce
+	TriggerProtect  pub.Decimal
+	LiquidationFee  pub.Decimal
+	MarketTakeBound pub.Decimal
+}
+
+// NewRules parses the symbol information of exchange info.
+func NewRules(s *marketdata.Symbol) (*Rules, error) {
+	r := &Rules{
+		Symbol:            s.Symbol,
+		Pair:              s.Pair,
+		ContractType:      pub.ContractType(s.ContractType),
+		Status:            pub.ContractStatus(s.Status),
+		BaseAsset:         s.BaseAsset,
+		QuoteAsset:        s.QuoteAsset,
+		MarginAsset:       s.MarginAsset,
+		OnboardDate:       s.OnboardDate,
+		DeliveryDate:      s.DeliveryDate,
+		PricePrecision:    s.PricePrecision,
+		QuantityPrecision: s.VolPrecision,
+	}
+	for _, t := range s.OrderType {
+		r.OrderTypes = append(r.OrderTypes, pub.OrderType(t))
+	}
+	for _, t := range s.TimeInForce {
+		r.TimeInForce = append(r.TimeInForce, pub.TimeInForce(t))
+	}
+
+	var err error
+	parse := func(dst *pub.Decimal, s string) {
+		if err != nil || s == "" {
+			return
+		}
+		*dst, err = pub.ParseDecimal(s)
+	}
+	parse(&r.TriggerProtect, s.TriggerProtect)
+	parse(&r.LiquidationFee, s.LiquidationFee)
+	parse(&r.MarketTakeBound, s.MarketTakeBound)
+	for _, f := range s.Filters {
+		switch f.FilterType {
+		case pub.FT_Price:
+			parse(&r.MinPrice, f.MinPrice)
+			parse(&r.MaxPrice, f.MaxPrice)
+			parse(&r.TickSize, f.TickSize)
+		case pub.FT_LotSize:
+			parse(&r.MinQty, f.MinQty)
+			parse(&r.MaxQty, f.MaxQty)
+			parse(&r.StepSize, f.StepSize)
+		case pub.FT_MarketLotSize:
+			parse(&r.MarketMinQty, f.MinQty)
+			parse(&r.MarketMaxQty, f.MaxQty)
+			parse(&r.MarketStepSize, f.StepSize)
+		case pub.FT_MaxNumOrders:
+			r.MaxNumOrders = f.Limit
+		case pub.FT_MaxNumAlgoOrders:
+			r.MaxNumAlgoOrders = f.Limit
+		case pub.FT_MinNotional:
+			parse(&r.MinNotional, f.Notional)
+		case pub.FT_PercentPrice:
+			parse(&r.MultiplierUp, f.MultiplierUp)
+			parse(&r.MultiplierDown, f.MultiplierDown)
+			if f.MultiplierDecimal != "" && err == nil {
+				r.MultiplierDecimal, err = strconv.Atoi(f.MultiplierDecimal)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("symbols: %v rules: %w", s.Symbol, err)
+	}
+	return r, nil
+}
+
+// Trading reports whether the contract status is TRADING.
+func (r *Rules) Trading() bool {
+	return r.Status == pub.CS_Trading
+}
+
+// SupportsOrderType reports whether the order type is allowed for the symbol.
+func (r *Rules) SupportsOrderType(t pub.OrderType) bool {
+	for _, ot := range r.OrderTypes {
+		if ot == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsTimeInForce reports whether the time in force is allowed for the symbol.
+func (r *Rules) SupportsTimeInForce(tif pub.TimeInForce) bool {
+	for _, t := range r.TimeInForce {
+		if t == tif {
+			return true
+		}
+	}
+	return false
+}
+
+// PriceBounds returns the PERCENT_PRICE bounds of the price by the mark price: a buy price must not be higher
+// than high, a sell price must not be lower than low, rounded inward to the tick size. They are zero if the filter is not set.
+func (r *Rules) PriceBounds(markPrice pub.Decimal) (low, high pub.Decimal) {
+	if r.MultiplierUp.IsZero() && r.MultiplierDown.IsZero() {
+		return pub.Decimal{}, pub.Decimal{}
+	}
+	low, high = markPrice.Mul(r.MultiplierDown), markPrice.Mul(r.MultiplierUp)
+	if r.TickSize.IsPositive() { // inside the bounds
+		low, high = low.RoundToStep(r.TickSize, pub.RM_Ceil), high.RoundToStep(r.TickSize, pub.RM_Floor)
+	}
+	return low, high
+}
+
+// Registry keeps the rules of all symbols, it loads exchange info once, and refreshes it by Start or Refresh,
+// the contract status is updated by the !contractInfo stream with Watch. It is safe for concurrent use.
+// The returned *Rules are replaced on refresh and never modified, they must not be modified by the callers.
+type Registry struct {
+	Interval time.Duration // refresh interval of Start, default 1 hour
+
+	client  *marketdata.Client
+	loadMu  sync.Mutex // one load at a time
+	mu      sync.RWMutex
+	rules   map[string]*Rules
+	updated time.Time
+
+	refreshing int32                // a refresh of Watch is running
+	unknown    map[string]time.Time // the unknown symbols of Watch by the time of their refresh
+}
+
+func NewRegistry(c *pub.Client) *Registry {
+	return &Registry{Interval: defaultInterval, client: marketdata.NewClient(c)}
+}
+
+// Load loads exchange info if it is not loaded yet.
+func (r *Registry) Load(ctx context.Context) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	if r.Loaded() {
+		return nil
+	}
+	return r.load(ctx)
+}
+
+// Refresh loads exchange info again.
+func (r *Registry) Refresh(ctx context.Context) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	return r.load(ctx)
+}
+
+func (r *Registry) load(ctx context.Context) error {
+	ei, err := r.client.ExchangeInfo(ctx)
+	if err != nil {
+		return err
+	}
+	return r.Set(ei)
+}
+
+// Set replaces the rules by the exchange info, such as a cached one.
+func (r *Registry) Set(ei *marketdata.ExchInfo) error {
+	rules := make(map[string]*Rules, len(ei.Symbols))
+	for i := range ei.Symbols {
+		sr, err := NewRules(&ei.Symbols[i])
+		if err != nil {
+			return err
+		}
+		rules[sr.Symbol] = sr
+	}
+	r.mu.Lock()
+	r.rules = rules
+	r.updated = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Start loads exchange info, then refreshes it every Interval until ctx is done, the refresh errors are logged.
+func (r *Registry) Start(ctx context.Context) error {
+	if err := r.Load(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.Refresh(ctx); err != nil {
+					r.client.Logf("symbols Refresh err: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Watch subscribes the !contractInfo stream by the manager, the status of the symbols is updated by the events,
+// and exchange info is refreshed when an unknown symbol is listed, at most once per Interval for each symbol
+// which is not in exchange info yet.
+func (r *Registry) Watch(ctx context.Context, m *streammarket.SubscriptionManager) error {
+	return streammarket.Handle(ctx, m, streammarket.ContractInfoStream(), func(e streammarket.ContractInfo) {
+		r.onContractInfo(ctx, &e)
+	})
+}
+
+func (r *Registry) onContractInfo(ctx context.Context, e *streammarket.ContractInfo) {
+	if r.ApplyContractInfo(e) || !atomic.CompareAndSwapInt32(&r.refreshing, 0, 1) {
+		return
+	}
+	if !r.refreshFor(e.Symbol) {
+		atomic.StoreInt32(&r.refreshing, 0)
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&r.refreshing, 0)
+		if err := r.Refresh(ctx); err != nil {
+			r.client.Logf("symbols Refresh for %v err: %v", e.Symbol, err)
+		}
+	}()
+}
+
+// refreshFor reports whether exchange info is refreshed for the unknown symbol, false if it was within Interval.
+func (r *Registry) refreshFor(symbol string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if t, ok := r.unknown[symbol]; ok && now.Sub(t) < r.Interval {
+		return false
+	}
+	if r.unknown == nil {
+		r.unknown = map[string]time.Time{}
+	}
+	r.unknown[symbol] = now
+	return true
+}
+
+// ApplyContractInfo updates the status, contract type and dates of the symbol by the event,
+// it returns false if the symbol is unknown.
+func (r *Registry) ApplyContractInfo(e *streammarket.ContractInfo) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.rules[e.Symbol]
+	if old == nil {
+		return false
+	}
+	delete(r.unknown, e.Symbol)
+	sr := *old
+	sr.Status = pub.ContractStatus(e.Status)
+	if e.ContractType != "" {
+		sr.ContractType = pub.ContractType(e.ContractType)
+	}
+	if e.DeliveryTime != 0 {
+		sr.DeliveryDate = e.DeliveryTime
+	}
+	if e.OnboardTime != 0 {
+		sr.OnboardDate = e.OnboardTime
+	}
+	r.rules[e.Symbol] = &sr
+	return true
+}
+
+// Loaded reports whether exchange info is loaded.
+func (r *Registry) Loaded() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rules != nil
+}
+
+// UpdatedAt returns the time of the last load.
+func (r *Registry) UpdatedAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.updated
+}
+
+// Rules returns the rules of the symbol, or ErrUnknownSymbol.
+func (r *Registry) Rules(symbol string) (*Rules, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sr := r.rules[strings.ToUpper(symbol)]
+	if sr == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSymbol, symbol)
+	}
+	return sr, nil
+}
+
+// Symbols returns the sorted symbols, of the status if it is not empty.
+func (r *Registry) Symbols(status pub.ContractStatus) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	symbols := make([]string, 0, len(r.rules))
+	for s, sr := range r.rules {
+		if status == "" || sr.Status == status {
+			symbols = append(symbols, s)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// TickSize returns the tick size of the symbol.
+func (r *Registry) TickSize(symbol string) (pub.Decimal, error) {
+	sr, err := r.Rules(symbol)
+	if err != nil {
+		return pub.Decimal{}, err
+	}
+	return sr.TickSize, nil
+}
+
+// StepSize returns the step size of the symbol, of MARKET_LOT_SIZE if market is true.
+func (r *Registry) StepSize(symbol string, market bool) (pub.Decimal, error) {
+	sr, err := r.Rules(symbol)
+	if err != nil {
+		return pub.Decimal{}, err
+	}
+	if market && sr.MarketStepSize.IsPositive() {
+		return sr.MarketStepSize, nil
+	}
+	return sr.StepSize, nil
+}
+
+// Status returns the contract status of the symbol.
+func (r *Registry) Status(symbol string) (pub.ContractStatus, error) {
+	sr, err := r.Rules(symbol)
+	if err != nil {
+		return "", err
+	}
+	return sr.Status, nil
+}
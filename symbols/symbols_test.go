@@ -0,0 +1,218 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/marketdata"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/streammarket"
+	"github.com/billfort/binance-usdmfuture/trade"
+	"github.com/stretchr/testify/require"
+)
+
+// exchangeInfo is a part of /fapi/v1/exchangeInfo.
+const exchangeInfo = `{"timezone":"UTC","serverTime":1,"rateLimits":[],"assets":[{"asset":"USDT","marginAvailable":true}],
+"symbols":[{"symbol":"BTCUSDT","pair":"BTCUSDT","contractType":"PERPETUAL","deliveryDate":4133404800000,"onboardDate":1569398400000,
+"status":"TRADING","baseAsset":"BTC","quoteAsset":"USDT","marginAsset":"USDT","pricePrecision":2,"quantityPrecision":3,
+"triggerProtect":"0.0500","liquidationFee":"0.012500","marketTakeBound":"0.05",
+"filters":[{"minPrice":"556.80","maxPrice":"4529764","filterType":"PRICE_FILTER","tickSize":"0.10"},
+{"stepSize":"0.001","filterType":"LOT_SIZE","maxQty":"1000","minQty":"0.001"},
+{"stepSize":"0.001","filterType":"MARKET_LOT_SIZE","maxQty":"120","minQty":"0.001"},
+{"limit":200,"filterType":"MAX_NUM_ORDERS"},{"limit":10,"filterType":"MAX_NUM_ALGO_ORDERS"},
+{"notional":"100","filterType":"MIN_NOTIONAL"},
+{"multiplierDown":"0.9500","multiplierUp":"1.0500","multiplierDecimal":"4","filterType":"PERCENT_PRICE"}],
+"orderTypes":["LIMIT","MARKET","STOP","STOP_MARKET","TAKE_PROFIT","TAKE_PROFIT_MARKET","TRAILING_STOP_MARKET"],
+"timeInForce":["GTC","IOC","FOK","GTX","GTD"]},
+{"symbol":"ETHUSDT_250328","pair":"ETHUSDT","contractType":"CURRENT_QUARTER","status":"PENDING_TRADING",
+"filters":[{"minPrice":"50","maxPrice":"300000","filterType":"PRICE_FILTER","tickSize":"0.01"}],"orderTypes":["LIMIT"],"timeInForce":["GTC"]}]}`
+
+func newMockRegistry(t *testing.T) (*Registry, *int32) {
+	var loads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&loads, 1)
+		fmt.Fprint(w, exchangeInfo)
+	}))
+	t.Cleanup(srv.Close)
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "ws://127.0.0.1:1", ""), nil)
+	return NewRegistry(pc), &loads
+}
+
+// go test -v -run TestRegistry
+func TestRegistry(t *testing.T) {
+	r, loads := newMockRegistry(t)
+	ctx := context.Background()
+	_, err := r.Rules("BTCUSDT")
+	require.ErrorIs(t, err, ErrUnknownSymbol)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, r.Load(ctx))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(loads)) // loaded once
+
+	sr, err := r.Rules("btcusdt")
+	require.NoError(t, err)
+	require.True(t, sr.Trading())
+	require.Equal(t, pub.CT_Perpetual, sr.ContractType)
+	require.Equal(t, "0.1", sr.TickSize.String())
+	require.Equal(t, "556.8", sr.MinPrice.String())
+	require.Equal(t, "0.001", sr.StepSize.String())
+	require.Equal(t, "1000", sr.MaxQty.String())
+	require.Equal(t, "120", sr.MarketMaxQty.String())
+	require.Equal(t, "100", sr.MinNotional.String())
+	require.Equal(t, 200, sr.MaxNumOrders)
+	require.Equal(t, 10, sr.MaxNumAlgoOrders)
+	require.Equal(t, 4, sr.MultiplierDecimal)
+	require.True(t, sr.SupportsOrderType(pub.OT_TrailingStopMarket))
+	require.True(t, sr.SupportsTimeInForce(pub.TIF_GTC))
+
+	low, high := sr.PriceBounds(pub.D("60000.33"))
+	require.Equal(t, "57000.4", low.String())  // 57000.3135 up to the tick
+	require.Equal(t, "63000.3", high.String()) // 63000.3465 down to the tick
+
+	step, err := r.StepSize("BTCUSDT", true)
+	require.NoError(t, err)
+	require.Equal(t, "0.001", step.String())
+	tick, err := r.TickSize("ETHUSDT_250328")
+	require.NoError(t, err)
+	require.Equal(t, "0.01", tick.String())
+	eth, err := r.Rules("ETHUSDT_250328")
+	require.NoError(t, err)
+	require.False(t, eth.SupportsOrderType(pub.OT_Market))
+	low, high = eth.PriceBounds(pub.D("3000"))
+	require.True(t, low.IsZero() && high.IsZero())
+
+	require.Equal(t, []string{"BTCUSDT", "ETHUSDT_250328"}, r.Symbols(""))
+	require.Equal(t, []string{"ETHUSDT_250328"}, r.Symbols(pub.CS_PendingTrading))
+
+	// contract info events
+	require.True(t, r.ApplyContractInfo(&streammarket.ContractInfo{Symbol: "ETHUSDT_250328", Status: "TRADING", DeliveryTime: 1743148800000}))
+	status, err := r.Status("ETHUSDT_250328")
+	require.NoError(t, err)
+	require.Equal(t, pub.CS_Trading, status)
+	require.Equal(t, pub.CS_PendingTrading, eth.Status) // the returned rules are not modified
+	require.False(t, r.ApplyContractInfo(&streammarket.ContractInfo{Symbol: "NEWUSDT", Status: "TRADING"}))
+
+	require.NoError(t, r.Refresh(ctx))
+	require.Equal(t, int32(2), atomic.LoadInt32(loads))
+	status, _ = r.Status("ETHUSDT_250328")
+	require.Equal(t, pub.CS_PendingTrading, status)
+
+	// an unknown symbol of Watch refreshes once per Interval
+	for i := 0; i < 5; i++ {
+		r.onContractInfo(ctx, &streammarket.ContractInfo{Symbol: "NEWUSDT", Status: "PENDING_TRADING"})
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&r.refreshing) == 0 }, time.Second, time.Millisecond)
+	}
+	require.Equal(t, int32(3), atomic.LoadInt32(loads))
+	r.onContractInfo(ctx, &streammarket.ContractInfo{Symbol: "BTCUSDT", Status: "TRADING"})
+	r.onContractInfo(ctx, &streammarket.ContractInfo{Symbol: "NEWUSDC", Status: "PENDING_TRADING"})
+	require.Eventually(t, func() bool { return atomic.LoadInt32(loads) == 4 }, time.Second, time.Millisecond)
+}
+
+func testRules(t *testing.T) *Registry {
+	var ei marketdata.ExchInfo
+	require.NoError(t, json.Unmarshal([]byte(exchangeInfo), &ei))
+	r := NewRegistry(pub.NewClient(nil))
+	require.NoError(t, r.Set(&ei))
+	return r
+}
+
+// go test -v -run TestNormalize
+func TestNormalize(t *testing.T) {
+	r := testRules(t)
+	st := &OrderState{MarkPrice: pub.D("60000")}
+
+	buy := &trade.OrderParam{Symbol: "btcusdt", Side: pub.OS_Buy, Type: pub.OT_Limit, TimeInForce: pub.TIF_GTC, Price: "59999.97", Quantity: "0.0119"}
+	err := r.Validate(buy, st)
+	es, ok := AsValidationErrors(err)
+	require.True(t, ok)
+	require.True(t, es.Has(pub.EC_InvalidTickSize))
+	require.True(t, es.Has(pub.EC_InvalidStepSize))
+
+	op, err := r.Normalize(buy, st)
+	require.NoError(t, err)
+	require.Equal(t, "BTCUSDT", op.Symbol)
+	require.Equal(t, "59999.9", op.Price) // buy down
+	require.Equal(t, "0.011", op.Quantity)
+	require.Equal(t, "59999.97", buy.Price) // not changed
+	require.NoError(t, r.Validate(op, st))
+
+	sell := *buy
+	sell.Side = pub.OS_Sell
+	op, err = r.Normalize(&sell, st)
+	require.NoError(t, err)
+	require.Equal(t, "60000", op.Price) // sell up
+
+	stop := &trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Sell, Type: pub.OT_StopMarket, StopPrice: "58000.04", ClosePosition: pub.Bool(true)}
+	op, err = r.Normalize(stop, st)
+	require.NoError(t, err)
+	require.Equal(t, "58000", op.StopPrice)
+}
+
+// go test -v -run TestValidate
+func TestValidate(t *testing.T) {
+	r := testRules(t)
+	st := &OrderState{MarkPrice: pub.D("60000"), OpenOrders: 10}
+	limit := func(side pub.OrderSide, price, qty string) *trade.OrderParam {
+		return &trade.OrderParam{Symbol: "BTCUSDT", Side: side, Type: pub.OT_Limit, TimeInForce: pub.TIF_GTC, Price: price, Quantity: qty}
+	}
+	fields := func(err error) map[string]int {
+		es, ok := AsValidationErrors(err)
+		require.True(t, ok, "%v", err)
+		m := map[string]int{}
+		for _, e := range es {
+			m[e.Field] = e.Code
+		}
+		return m
+	}
+
+	require.NoError(t, r.Validate(limit(pub.OS_Buy, "60000", "0.002"), st))
+	cases := []struct {
+		op       *trade.OrderParam
+		st       *OrderState
+		expected map[string]int
+	}{
+		{limit(pub.OS_Buy, "60000", "0.001"), st, map[string]int{"quantity": pub.EC_MinNotional}},
+		{limit(pub.OS_Buy, "63000.4", "0.01"), st, map[string]int{"price": pub.EC_PriceHigherThanMultiplierUp}},
+		{limit(pub.OS_Sell, "56999.9", "0.01"), st, map[string]int{"price": pub.EC_PriceLowerThanMultiplierDown}},
+		{limit(pub.OS_Buy, "500", "2000"), nil, map[string]int{"price": pub.EC_PriceLessThanMinPrice, "quantity": pub.EC_QtyGreaterThanMaxQty}},
+		{limit(pub.OS_Buy, "60000", "0.01"), &OrderState{OpenOrders: 200}, map[string]int{"": pub.EC_MaxOpenOrderExceeded}},
+		{limit("", "", "abc"), nil, map[string]int{"side": pub.EC_InvalidSide, "price": pub.EC_MandatoryParamMissing, "quantity": pub.EC_InvalidParameter}},
+		{&trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Limit, Price: "60000", Quantity: "0.01", GoodTillDate: 1},
+			nil, map[string]int{"timeInForce": pub.EC_MandatoryParamMissing, "goodTillDate": pub.EC_ParamNotRequired}},
+		{&trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Price: "60000", Quantity: "130"},
+			st, map[string]int{"price": pub.EC_ParamNotRequired, "quantity": pub.EC_QtyGreaterThanMaxQty}}, // MARKET_LOT_SIZE
+		{&trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Sell, Type: pub.OT_TakeProfitMarket, StopPrice: "61000", Quantity: "0.01", ClosePosition: pub.Bool(true)},
+			st, map[string]int{"quantity": pub.EC_ParamNotRequired}},
+		{&trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Sell, Type: pub.OT_TrailingStopMarket, Quantity: "0.01", CallbackRate: "20"},
+			st, map[string]int{"callbackRate": pub.EC_InvalidParameter}},
+		{&trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Limit, TimeInForce: pub.TIF_GTC, PriceMatch: pub.PM_Opponent, Price: "60000", Quantity: "0.01"},
+			st, map[string]int{"price": pub.EC_ParamNotRequired}},
+		{&trade.OrderParam{Symbol: "ETHUSDT_250328", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "1"},
+			nil, map[string]int{"type": pub.EC_InvalidOrderType, "symbol": pub.EC_NoTradingWindow}},
+	}
+	for i, c := range cases {
+		require.Equal(t, c.expected, fields(r.Validate(c.op, c.st)), "case %v", i)
+	}
+
+	// reduce only orders are not checked by MIN_NOTIONAL
+	reduce := limit(pub.OS_Sell, "60000", "0.001")
+	reduce.ReduceOnly = pub.Bool(true)
+	require.NoError(t, r.Validate(reduce, st))
+
+	_, err := r.Normalize(&trade.OrderParam{Symbol: "XYZUSDT"}, nil)
+	require.ErrorIs(t, err, ErrUnknownSymbol)
+}
@@ -0,0 +1,320 @@
+package symbols
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+// ValidationError is a problem of an order found before it is sent.
+type ValidationError struct {
+	Symbol string
+	Field  string // json name of the OrderParam field, such as "price", or "" for the order
+	Code   int    // binance error code the order would get, such as pub.EC_MinNotional
+	Msg    string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("symbols: %v order: %v, code %v", e.Symbol, e.Msg, e.Code)
+	}
+	return fmt.Sprintf("symbols: %v %v: %v, code %v", e.Symbol, e.Field, e.Msg, e.Code)
+}
+
+// ValidationErrors are all problems of an order.
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Has reports whether there is an error of the binance code.
+func (es ValidationErrors) Has(code int) bool {
+	for _, e := range es {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// AsValidationErrors returns the ValidationErrors in the err chain.
+func AsValidationErrors(err error) (ValidationErrors, bool) {
+	var es ValidationErrors
+	if errors.As(err, &es) {
+		return es, true
+	}
+	return nil, false
+}
+
+// OrderState is the state for the checks which need it, the zero values skip them.
+type OrderState struct {
+	MarkPrice      pub.Decimal // for PERCENT_PRICE, and the notional of the orders without price
+	OpenOrders     int         // open orders of the symbol, for MAX_NUM_ORDERS
+	OpenAlgoOrders int         // open conditional orders of the symbol, for MAX_NUM_ALGO_ORDERS
+}
+
+// Validate checks the order by the rules without changing it, the prices and quantities must be multiples of
+// the tick size and the step size.
+func (r *Rules) Validate(op *trade.OrderParam, st *OrderState) error {
+	p := *op
+	return r.check(&p, st, false)
+}
+
+// Normalize returns a copy of the order with the prices and quantities rounded to the rules, and checks it.
+// The price of a buy order is rounded down and the price of a sell order is rounded up, so the order is never
+// more aggressive than asked. The stop and activation prices are rounded to the nearest tick.
+// The quantity is rounded down, and the quantity of a MARKET order by MARKET_LOT_SIZE.
+func (r *Rules) Normalize(op *trade.OrderParam, st *OrderState) (*trade.OrderParam, error) {
+	p := *op
+	if err := r.check(&p, st, true); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+type orderCheck struct {
+	op    *trade.OrderParam
+	round bool
+	errs  ValidationErrors
+}
+
+func (c *orderCheck) fail(field string, code int, format string, args ...interface{}) {
+	c.errs = append(c.errs, &ValidationError{Symbol: c.op.Symbol, Field: field, Code: code, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (c *orderCheck) required(field, value string) {
+	if value == "" {
+		c.fail(field, pub.EC_MandatoryParamMissing, "required for %v", c.op.Type)
+	}
+}
+
+func (c *orderCheck) notAllowed(field string, sent bool) {
+	if sent {
+		c.fail(field, pub.EC_ParamNotRequired, "not allowed for %v", c.op.Type)
+	}
+}
+
+// decimal parses the field, and rounds it to step by mode or checks it is a multiple of step.
+func (c *orderCheck) decimal(field string, value *string, step pub.Decimal, mode pub.RoundingMode, code int) (pub.Decimal, bool) {
+	if *value == "" {
+		return pub.Decimal{}, false
+	}
+	d, err := pub.ParseDecimal(*value)
+	if err != nil {
+		c.fail(field, pub.EC_InvalidParameter, "invalid number %q", *value)
+		return pub.Decimal{}, false
+	}
+	if !d.IsPositive() {
+		c.fail(field, pub.EC_InvalidParameter, "%v is not positive", *value)
+		return pub.Decimal{}, false
+	}
+	if step.IsPositive() && !d.IsMultipleOf(step) {
+		if !c.round {
+			c.fail(field, code, "%v is not a multiple of %v", *value, step)
+			return pub.Decimal{}, false
+		}
+		d = d.RoundToStep(step, mode)
+		*value = d.String()
+	}
+	return d, true
+}
+
+func (r *Rules) check(op *trade.OrderParam, st *OrderState, round bool) error {
+	if st == nil {
+		st = &OrderState{}
+	}
+	c := &orderCheck{op: op, round: round}
+	if !strings.EqualFold(op.Symbol, r.Symbol) {
+		c.fail("symbol", pub.EC_BadSymbol, "rules of %v", r.Symbol)
+		return c.errs
+	}
+	op.Symbol = r.Symbol
+	if !r.Trading() {
+		c.fail("symbol", pub.EC_NoTradingWindow, "contract status %v", r.Status)
+	}
+	if op.Side != pub.OS_Buy && op.Side != pub.OS_Sell {
+		c.fail("side", pub.EC_InvalidSide, "invalid side %q", op.Side)
+	}
+	if !r.SupportsOrderType(op.Type) {
+		c.fail("type", pub.EC_InvalidOrderType, "order type %q is not supported", op.Type)
+		return c.errs
+	}
+	r.checkParams(c)
+
+	// prices, buy down and sell up
+	priceMode := pub.RM_Floor
+	if op.Side == pub.OS_Sell {
+		priceMode = pub.RM_Ceil
+	}
+	price, hasPrice := c.decimal("price", &op.Price, r.TickSize, priceMode, pub.EC_InvalidTickSize)
+	stopPrice, hasStop := c.decimal("stopPrice", &op.StopPrice, r.TickSize, pub.RM_HalfUp, pub.EC_InvalidTickSize)
+	actPrice, hasAct := c.decimal("activationPrice", &op.ActivationPrice, r.TickSize, pub.RM_HalfUp, pub.EC_InvalidTickSize)
+	for _, p := range []struct {
+		field string
+		d     pub.Decimal
+		ok    bool
+	}{{"price", price, hasPrice}, {"stopPrice", stopPrice, hasStop}, {"activationPrice", actPrice, hasAct}} {
+		if !p.ok {
+			continue
+		}
+		if r.MinPrice.IsPositive() && p.d.LessThan(r.MinPrice) {
+			c.fail(p.field, pub.EC_PriceLessThanMinPrice, "%v is less than min price %v", p.d, r.MinPrice)
+		}
+		if r.MaxPrice.IsPositive() && p.d.GreaterThan(r.MaxPrice) {
+			c.fail(p.field, pub.EC_PriceGreaterThanMaxPrice, "%v is greater than max price %v", p.d, r.MaxPrice)
+		}
+	}
+	if hasPrice && st.MarkPrice.IsPositive() {
+		low, high := r.PriceBounds(st.MarkPrice)
+		if op.Side == pub.OS_Buy && high.IsPositive() && price.GreaterThan(high) {
+			c.fail("price", pub.EC_PriceHigherThanMultiplierUp, "%v is higher than %v of mark price %v", price, high, st.MarkPrice)
+		}
+		if op.Side == pub.OS_Sell && low.IsPositive() && price.LessThan(low) {
+			c.fail("price", pub.EC_PriceLowerThanMultiplierDown, "%v is lower than %v of mark price %v", price, low, st.MarkPrice)
+		}
+	}
+
+	// quantity
+	minQty, maxQty, stepSize := r.MinQty, r.MaxQty, r.StepSize
+	if op.Type == pub.OT_Market && r.MarketStepSize.IsPositive() {
+		minQty, maxQty, stepSize = r.MarketMinQty, r.MarketMaxQty, r.MarketStepSize
+	}
+	qty, hasQty := c.decimal("quantity", &op.Quantity, stepSize, pub.RM_Down, pub.EC_InvalidStepSize)
+	if hasQty {
+		if qty.IsZero() || (minQty.IsPositive() && qty.LessThan(minQty)) {
+			c.fail("quantity", pub.EC_QtyLessThanMinQty, "%v is less than min quantity %v", qty, minQty)
+		}
+		if maxQty.IsPositive() && qty.GreaterThan(maxQty) {
+			c.fail("quantity", pub.EC_QtyGreaterThanMaxQty, "%v is greater than max quantity %v", qty, maxQty)
+		}
+	}
+
+	// notional, the reduce only orders are not checked
+	notionalPrice := price
+	if !hasPrice {
+		notionalPrice = st.MarkPrice
+	}
+	reduceOnly := op.ReduceOnly != nil && *op.ReduceOnly
+	if hasQty && !reduceOnly && r.MinNotional.IsPositive() && notionalPrice.IsPositive() {
+		if notional := qty.Mul(notionalPrice); notional.LessThan(r.MinNotional) {
+			c.fail("quantity", pub.EC_MinNotional, "notional %v is less than min notional %v", notional, r.MinNotional)
+		}
+	}
+
+	// open orders
+	if isAlgoOrder(op.Type) {
+		if r.MaxNumAlgoOrders > 0 && st.OpenAlgoOrders >= r.MaxNumAlgoOrders {
+			c.fail("", pub.EC_MaxOpenOrderExceeded, "%v open conditional orders, max %v", st.OpenAlgoOrders, r.MaxNumAlgoOrders)
+		}
+	} else if r.MaxNumOrders > 0 && st.OpenOrders >= r.MaxNumOrders {
+		c.fail("", pub.EC_MaxOpenOrderExceeded, "%v open orders, max %v", st.OpenOrders, r.MaxNumOrders)
+	}
+
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+// checkParams checks the required and not allowed parameters of the order type and time in force.
+func (r *Rules) checkParams(c *orderCheck) {
+	op := c.op
+	closePosition := op.ClosePosition != nil && *op.ClosePosition
+	switch op.Type {
+	case pub.OT_Limit:
+		c.required("timeInForce", string(op.TimeInForce))
+		c.required("quantity", op.Quantity)
+		if op.PriceMatch == "" {
+			c.required("price", op.Price)
+		}
+	case pub.OT_Market:
+		c.required("quantity", op.Quantity)
+		c.notAllowed("price", op.Price != "")
+		c.notAllowed("timeInForce", op.TimeInForce != "")
+	case pub.OT_Stop, pub.OT_TakeProfit:
+		c.required("quantity", op.Quantity)
+		c.required("stopPrice", op.StopPrice)
+		if op.PriceMatch == "" {
+			c.required("price", op.Price)
+		}
+	case pub.OT_StopMarket, pub.OT_TakeProfitMarket:
+		c.required("stopPrice", op.StopPrice)
+		if !closePosition {
+			c.required("quantity", op.Quantity)
+		}
+		c.notAllowed("price", op.Price != "")
+	case pub.OT_TrailingStopMarket:
+		c.required("quantity", op.Quantity)
+		c.required("callbackRate", op.CallbackRate)
+		c.notAllowed("price", op.Price != "")
+		if op.CallbackRate != "" {
+			if rate, err := pub.ParseDecimal(op.CallbackRate); err != nil || rate.LessThan(pub.D("0.1")) || rate.GreaterThan(pub.NewDecimalFromInt(10)) {
+				c.fail("callbackRate", pub.EC_InvalidParameter, "%q is not in [0.1, 10]", op.CallbackRate)
+			}
+		}
+	}
+	if op.Type != pub.OT_TrailingStopMarket {
+		c.notAllowed("callbackRate", op.CallbackRate != "")
+		c.notAllowed("activationPrice", op.ActivationPrice != "")
+	}
+	if op.Type != pub.OT_StopMarket && op.Type != pub.OT_TakeProfitMarket {
+		c.notAllowed("closePosition", closePosition)
+	} else if closePosition {
+		c.notAllowed("quantity", op.Quantity != "")
+		c.notAllowed("reduceOnly", op.ReduceOnly != nil)
+	}
+	if op.PriceMatch != "" {
+		c.notAllowed("price", op.Price != "")
+		if op.Type != pub.OT_Limit && op.Type != pub.OT_Stop && op.Type != pub.OT_TakeProfit {
+			c.notAllowed("priceMatch", true)
+		}
+	}
+	if op.PositionSide == pub.PS_Long || op.PositionSide == pub.PS_Short {
+		c.notAllowed("reduceOnly", op.ReduceOnly != nil) // hedge mode
+	}
+
+	if op.TimeInForce != "" && !r.SupportsTimeInForce(op.TimeInForce) {
+		c.fail("timeInForce", pub.EC_InvalidTif, "time in force %q is not supported", op.TimeInForce)
+	}
+	if op.TimeInForce == pub.TIF_GTD {
+		if op.GoodTillDate == 0 {
+			c.fail("goodTillDate", pub.EC_MandatoryParamMissing, "required for GTD")
+		}
+	} else if op.GoodTillDate != 0 {
+		c.fail("goodTillDate", pub.EC_ParamNotRequired, "only for GTD")
+	}
+}
+
+func isAlgoOrder(t pub.OrderType) bool {
+	switch t {
+	case pub.OT_Stop, pub.OT_StopMarket, pub.OT_TakeProfit, pub.OT_TakeProfitMarket, pub.OT_TrailingStopMarket:
+		return true
+	}
+	return false
+}
+
+// Validate checks the order by the rules of its symbol, see Rules.Validate.
+func (r *Registry) Validate(op *trade.OrderParam, st *OrderState) error {
+	sr, err := r.Rules(op.Symbol)
+	if err != nil {
+		return err
+	}
+	return sr.Validate(op, st)
+}
+
+// Normalize rounds and checks the order by the rules of its symbol, see Rules.Normalize.
+func (r *Registry) Normalize(op *trade.OrderParam, st *OrderState) (*trade.OrderParam, error) {
+	sr, err := r.Rules(op.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	return sr.Normalize(op, st)
+}
@@ -0,0 +1,133 @@
+package trade
+
+import (
+	"context"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+)
+
+// The package level functions below keep the original API, they send requests by pub.DefaultClient.
+
+func newKeyClient(key *pub.Key) *Client {
+	return NewClient(pub.DefaultClient.WithKey(key))
+}
+
+// Send in a new order.
+func NewOrder(key *pub.Key, op *OrderParam) (*OrderResponse, error) {
+	return newKeyClient(key).NewOrder(context.Background(), op)
+}
+
+// Testing order request, this order will not be submitted to matching engine
+func TestOrder(key *pub.Key, op *OrderParam) (*OrderResponse, error) {
+	return newKeyClient(key).TestOrder(context.Background(), op)
+}
+
+// Place Multiple Orders
+func BatchOrders(key *pub.Key, ops []OrderParam) ([]OrderResponse, error) {
+	return newKeyClient(key).BatchOrders(context.Background(), ops)
+}
+
+// Order modify function, currently only LIMIT order modification is supported.
+func ModifyOrder(key *pub.Key, mp *ModifyParam) (*OrderResponse, error) {
+	return newKeyClient(key).ModifyOrder(context.Background(), mp)
+}
+
+// Modify Multiple Orders
+func ModifyBatchOrders(key *pub.Key, mps []ModifyParam) ([]OrderResponse, error) {
+	return newKeyClient(key).ModifyBatchOrders(context.Background(), mps)
+}
+
+// Cancel an active order.
+func CancelOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId string) (*OrderResponse, error) {
+	return newKeyClient(key).CancelOrder(context.Background(), symbol, orderId, origClientOrderId)
+}
+
+// Cancel Multiple Orders
+func CancelBatchOrders(key *pub.Key, symbol string, orderIdList []int64, origClientOrderIdList []string) ([]OrderResponse, error) {
+	return newKeyClient(key).CancelBatchOrders(context.Background(), symbol, orderIdList, origClientOrderIdList)
+}
+
+// Cancel All Open Orders
+func CancelAllOpenOrders(key *pub.Key, symbol string) error {
+	return newKeyClient(key).CancelAllOpenOrders(context.Background(), symbol)
+}
+
+// Cancel all open orders of the specified symbol at the end of the specified countdown.
+func CountdownCancleAll(key *pub.Key, symbol string, countdownTime int64) error {
+	return newKeyClient(key).CountdownCancleAll(context.Background(), symbol, countdownTime)
+}
+
+// Check an order's status.
+func QueryOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId string) (*OrderResponse, error) {
+	return newKeyClient(key).QueryOrder(context.Background(), symbol, orderId, origClientOrderId)
+}
+
+// Get all account orders; active, canceled, or filled.
+func QueryAllOrders(key *pub.Key, p *AllOrdersParam) ([]OrderResponse, error) {
+	return newKeyClient(key).QueryAllOrders(context.Background(), p)
+}
+
+// Get all open orders on a symbol.
+func QueryOpenOrders(key *pub.Key, symbol string) ([]OrderResponse, error) {
+	return newKeyClient(key).QueryOpenOrders(context.Background(), symbol)
+}
+
+// Query open order
+func QueryOpenOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId string) (*OrderResponse, error) {
+	return newKeyClient(key).QueryOpenOrder(context.Background(), symbol, orderId, origClientOrderId)
+}
+
+// Query user's Force Orders
+func QueryForceOrders(key *pub.Key, p *ForceOrdersParam) ([]OrderResponse, error) {
+	return newKeyClient(key).QueryForceOrders(context.Background(), p)
+}
+
+// Get trades for a specific account and symbol.
+func QueryUserTrades(key *pub.Key, p *UserTradesParam) ([]tradeInfo, error) {
+	return newKeyClient(key).QueryUserTrades(context.Background(), p)
+}
+
+// Change symbol level margin type
+func SetMarginType(key *pub.Key, symbol string, marginType pub.MarginType) error {
+	return newKeyClient(key).SetMarginType(context.Background(), symbol, marginType)
+}
+
+// Change user's position mode (Hedge Mode or One-way Mode ) on EVERY symbol
+func SetPositionMode(key *pub.Key, dualSidePosition bool) error {
+	return newKeyClient(key).SetPositionMode(context.Background(), dualSidePosition)
+}
+
+// Change user's initial leverage of specific symbol market.
+func SetLeverage(key *pub.Key, symbol string, leverage int) (*leverageInfo, error) {
+	return newKeyClient(key).SetLeverage(context.Background(), symbol, leverage)
+}
+
+// Change user's Multi-Assets mode (Multi-Assets Mode or Single-Asset Mode) on Every symbol
+func SetMarginAssetMode(key *pub.Key, symbol string, multiAssetMargin bool) error {
+	return newKeyClient(key).SetMarginAssetMode(context.Background(), symbol, multiAssetMargin)
+}
+
+// Modify Isolated Position Margin
+func ModifyPositionMargin(key *pub.Key, symbol string, positionSide pub.PositionSide, amount string, type_ int) error {
+	return newKeyClient(key).ModifyPositionMargin(context.Background(), symbol, positionSide, amount, type_)
+}
+
+// Get current position information.
+func GetPositionInfoV2(key *pub.Key, symbol string) ([]PositionInfo, error) {
+	return newKeyClient(key).GetPositionInfoV2(context.Background(), symbol)
+}
+
+// Get current position information(only symbol that has position or open orders will be returned).
+func GetPositionInfoV3(key *pub.Key, symbol string) ([]PositionInfo, error) {
+	return newKeyClient(key).GetPositionInfoV3(context.Background(), symbol)
+}
+
+// Position ADL Quantile Estimation
+func AdlQuantile(key *pub.Key, symbol string) ([]adlQuantile, error) {
+	return newKeyClient(key).AdlQuantile(context.Background(), symbol)
+}
+
+// Get Position Margin Change History
+func GetPositionMarginHistory(key *pub.Key, p *PositionMarginHistoryParam) ([]positionMarginHist, error) {
+	return newKeyClient(key).GetPositionMarginHistory(context.Background(), p)
+}
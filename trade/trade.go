@@ -1,23 +1,81 @@
 package trade
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 
 	"github.com/billfort/binance-usdmfuture/pub"
 )
 
+// Client sends trade requests with the settings and key of the wrapped pub.Client.
+type Client struct {
+	*pub.Client
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c}
+}
+
 // Send in a new order.
+// A random NewClientOrderId is set if it is empty, if the status of the order is unknown because of a transient error,
+// the order is queried by NewClientOrderId with backoff before it is sent again by c.Retry, so it is never submitted twice.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api
-func NewOrder(key *pub.Key, op *OrderParam) (*orderResponse, error) {
-	var resp orderResponse
-	params := pub.StructToMap(op)
-	resBody, errMsg, err := pub.PostWithSign(key, "/fapi/v1/order", params)
+func (c *Client) NewOrder(ctx context.Context, op *OrderParam) (*OrderResponse, error) {
+	if err := c.CheckOrderGate(ctx); err != nil {
+		return nil, err
+	}
+	p := *op
+	if p.NewClientOrderId == "" {
+		p.NewClientOrderId = pub.NewClientOrderId()
+	}
+
+	resp, err := c.newOrder(ctx, &p)
+	for attempt := 0; c.Retry.ShouldRetry(ctx, err, attempt); attempt++ {
+		c.Logf("trade.NewOrder %v %v retry %v, err: %v", p.Symbol, p.NewClientOrderId, attempt+1, err)
+		if c.Retry.Wait(ctx, attempt) != nil {
+			break
+		}
+		order, qerr := c.queryUnknown(ctx, p.Symbol, p.NewClientOrderId)
+		if qerr == nil { // the order was accepted
+			return order, nil
+		}
+		if !pub.IsNoSuchOrder(qerr) { // still unknown, query again in next attempt
+			err = qerr
+			continue
+		}
+		resp, err = c.newOrder(ctx, &p)
+		if pub.IsDuplicateOrder(err) { // accepted after all the queries
+			return c.QueryOrder(ctx, p.Symbol, 0, p.NewClientOrderId)
+		}
+	}
+	return resp, err
+}
+
+// queryUnknown queries the order of unknown status by its clientOrderId. The order may still reach the matching engine
+// after -1006 or -1007, so it is queried again with the backoff of c.Retry before -2013 is returned.
+func (c *Client) queryUnknown(ctx context.Context, symbol, clientOrderId string) (*OrderResponse, error) {
+	for attempt := 0; ; attempt++ {
+		order, err := c.QueryOrder(ctx, symbol, 0, clientOrderId)
+		if !pub.IsNoSuchOrder(err) || c.Retry == nil || attempt >= c.Retry.MaxRetries {
+			return order, err
+		}
+		if werr := c.Retry.Wait(ctx, attempt); werr != nil {
+			return nil, werr
+		}
+	}
+}
+
+func (c *Client) newOrder(ctx context.Context, op *OrderParam) (*OrderResponse, error) {
+	params, err := pub.EncodeParams(op)
 	if err != nil {
 		return nil, err
 	}
-	if errMsg.Code != 0 {
-		return nil, fmt.Errorf("%+v", errMsg)
+	var resp OrderResponse
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/order", params)
+	if err != nil {
+		return nil, err
 	}
 
 	err = json.Unmarshal(resBody, &resp)
@@ -30,18 +88,18 @@ func NewOrder(key *pub.Key, op *OrderParam) (*orderResponse, error) {
 
 // Testing order request, this order will not be submitted to matching engine
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/New-Order-Test
-func TestOrder(key *pub.Key, op *OrderParam) (*orderResponse, error) {
-	params := pub.StructToMap(op)
-
-	resBody, errMsg, err := pub.PostWithSign(key, "/fapi/v1/order/test", params)
+func (c *Client) TestOrder(ctx context.Context, op *OrderParam) (*OrderResponse, error) {
+	params, err := pub.EncodeParams(op)
 	if err != nil {
 		return nil, err
 	}
-	if errMsg.Code != 0 {
-		return nil, fmt.Errorf("%+v", errMsg)
+
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/order/test", params)
+	if err != nil {
+		return nil, err
 	}
 
-	var resp orderResponse
+	var resp OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -51,28 +109,126 @@ func TestOrder(key *pub.Key, op *OrderParam) (*orderResponse, error) {
 }
 
 // Place Multiple Orders
+// Like NewOrder, the orders without NewClientOrderId get random ones. If the batch fails with a transient error, or
+// some of its orders are -1006 or -1007, these orders are reconciled by queryUnknown before retry, and only the ones
+// not found are sent again. An order which is still unknown after the retries keeps its error code in the response.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Place-Multiple-Orders
-func BatchOrders(key *pub.Key, ops []OrderParam) ([]orderResponse, error) {
-	b, err := json.Marshal(ops)
-	if err != nil {
-		return nil, err
+func (c *Client) BatchOrders(ctx context.Context, ops []OrderParam) ([]OrderResponse, error) {
+	if err := c.CheckOrderGate(ctx); err != nil {
+		return nil, err
+	}
+	ops = append([]OrderParam(nil), ops...)
+	for i := range ops {
+		if ops[i].NewClientOrderId == "" {
+			ops[i].NewClientOrderId = pub.NewClientOrderId()
+		}
+	}
+
+	resp, err := c.batchOrders(ctx, ops)
+	var unknown []int // index of the orders of unknown status
+	if err == nil {
+		unknown = unknownOrders(resp, nil)
+	} else if pub.IsTransient(err) {
+		resp = make([]OrderResponse, len(ops))
+		for i := range ops {
+			unknown = append(unknown, i)
+		}
+	} else {
+		return nil, err
+	}
+	if err == nil && len(unknown) > 0 {
+		err = resp[unknown[0]].Err()
+	}
+
+	for attempt := 0; len(unknown) > 0 && c.Retry.ShouldRetry(ctx, err, attempt); attempt++ {
+		c.Logf("trade.BatchOrders retry %v for %v orders, err: %v", attempt+1, len(unknown), err)
+		if c.Retry.Wait(ctx, attempt) != nil {
+			break
+		}
+		err = nil
+		var still, missing []int
+		for _, i := range unknown {
+			if err != nil { // query the rest in next attempt
+				still = append(still, i)
+				continue
+			}
+			order, qerr := c.queryUnknown(ctx, ops[i].Symbol, ops[i].NewClientOrderId)
+			switch {
+			case qerr == nil: // the order was accepted
+				resp[i] = *order
+			case pub.IsNoSuchOrder(qerr):
+				missing = append(missing, i)
+			default: // still unknown
+				err = qerr
+				still = append(still, i)
+			}
+		}
+
+		if len(missing) > 0 {
+			retryOps := make([]OrderParam, len(missing))
+			for j, i := range missing {
+				retryOps[j] = ops[i]
+			}
+			retryResp, rerr := c.batchOrders(ctx, retryOps)
+			if rerr != nil {
+				if !pub.IsTransient(rerr) {
+					return resp, rerr
+				}
+				err = rerr
+				still = append(still, missing...)
+			} else {
+				for j, i := range missing {
+					if j >= len(retryResp) {
+						still = append(still, i)
+						continue
+					}
+					resp[i] = retryResp[j]
+					if pub.IsDuplicateOrder(resp[i].Err()) { // accepted after all the queries
+						if order, qerr := c.QueryOrder(ctx, ops[i].Symbol, 0, ops[i].NewClientOrderId); qerr == nil {
+							resp[i] = *order
+						}
+					}
+				}
+				still = unknownOrders(resp, still)
+			}
+		}
+		slices.Sort(still)
+		unknown = still
+		if err == nil && len(unknown) > 0 {
+			err = resp[unknown[0]].Err()
+		}
+	}
+
+	for _, i := range unknown {
+		if resp[i].Code == 0 { // no response of the order
+			return resp, err
+		}
 	}
-	batchParams := struct {
-		BatchOrders string `json:"batchOrders"`
-	}{
-		BatchOrders: string(b),
+	return resp, nil
+}
+
+// unknownOrders appends the index of the orders of unknown status in resp to the list, which are not in it.
+func unknownOrders(resp []OrderResponse, list []int) []int {
+	for i := range resp {
+		if pub.IsUnknownStatus(resp[i].Err()) && !slices.Contains(list, i) {
+			list = append(list, i)
+		}
 	}
-	params := pub.StructToMap(&batchParams)
+	return list
+}
 
-	resBody, errMsg, err := pub.PostWithSign(key, "/fapi/v1/batchOrders", params)
+func (c *Client) batchOrders(ctx context.Context, ops []OrderParam) ([]OrderResponse, error) {
+	params, err := batchParams(ops)
 	if err != nil {
 		return nil, err
 	}
-	if errMsg.Code != 0 {
-		return nil, fmt.Errorf("%+v", errMsg)
+
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/batchOrders", params)
+	if err != nil {
+		return nil, err
 	}
 
-	var resp []orderResponse
+	var resp []OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -84,15 +240,18 @@ func BatchOrders(key *pub.Key, ops []OrderParam) ([]orderResponse, error) {
 // Order modify function, currently only LIMIT order modification is supported.
 // modified orders will be reordered in the match queue
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Modify-Order
-func ModifyOrder(key *pub.Key, mp *modifyParam) (*orderResponse, error) {
-	params := pub.StructToMap(mp)
+func (c *Client) ModifyOrder(ctx context.Context, mp *ModifyParam) (*OrderResponse, error) {
+	params, err := pub.EncodeParams(mp)
+	if err != nil {
+		return nil, err
+	}
 
-	resBody, err := pub.PutWithSign(key, "/fapi/v1/order", params)
+	resBody, err := c.PutWithSign(ctx, "/fapi/v1/order", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp orderResponse
+	var resp OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -103,24 +262,18 @@ func ModifyOrder(key *pub.Key, mp *modifyParam) (*orderResponse, error) {
 
 // Modify Multiple Orders
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Modify-Multiple-Orders
-func ModifyBatchOrders(key *pub.Key, mps []modifyParam) ([]orderResponse, error) {
-	b, err := json.Marshal(mps)
+func (c *Client) ModifyBatchOrders(ctx context.Context, mps []ModifyParam) ([]OrderResponse, error) {
+	params, err := batchParams(mps)
 	if err != nil {
 		return nil, err
 	}
-	batchParams := struct {
-		BatchOrders string `json:"batchOrders"`
-	}{
-		BatchOrders: string(b),
-	}
-	params := pub.StructToMap(&batchParams)
 
-	resBody, err := pub.PutWithSign(key, "/fapi/v1/batchOrders", params)
+	resBody, err := c.PutWithSign(ctx, "/fapi/v1/batchOrders", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []orderResponse
+	var resp []OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -131,19 +284,23 @@ func ModifyBatchOrders(key *pub.Key, mps []modifyParam) ([]orderResponse, error)
 
 // Cancel an active order.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Cancel-Order
-func CancelOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId string) (*orderResponse, error) {
+func (c *Client) CancelOrder(ctx context.Context, symbol string, orderId int64, origClientOrderId string) (*OrderResponse, error) {
 	params := map[string]interface{}{
-		"symbol":            symbol,
-		"orderId":           orderId,
-		"origClientOrderId": origClientOrderId,
+		"symbol": symbol,
+	}
+	if orderId != 0 { // either orderId or origClientOrderId must be sent
+		params["orderId"] = orderId
+	}
+	if origClientOrderId != "" {
+		params["origClientOrderId"] = origClientOrderId
 	}
 
-	resBody, err := pub.DeleteWithSign(key, "/fapi/v1/order", params)
+	resBody, err := c.DeleteWithSign(ctx, "/fapi/v1/order", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp orderResponse
+	var resp OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -154,19 +311,19 @@ func CancelOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId s
 
 // Cancel Multiple Orders
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Cancel-Multiple-Orders
-func CancelBatchOrders(key *pub.Key, symbol string, orderIdList []int64, origClientOrderIdList []string) ([]orderResponse, error) {
+func (c *Client) CancelBatchOrders(ctx context.Context, symbol string, orderIdList []int64, origClientOrderIdList []string) ([]OrderResponse, error) {
 	params := map[string]interface{}{
 		"symbol":                symbol,
 		"orderIdList":           orderIdList,
 		"origClientOrderIdList": origClientOrderIdList,
 	}
 
-	resBody, err := pub.DeleteWithSign(key, "/fapi/v1/batchOrders", params)
+	resBody, err := c.DeleteWithSign(ctx, "/fapi/v1/batchOrders", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []orderResponse
+	var resp []OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -177,12 +334,12 @@ func CancelBatchOrders(key *pub.Key, symbol string, orderIdList []int64, origCli
 
 // Cancel All Open Orders
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Cancel-All-Open-Orders
-func CancelAllOpenOrders(key *pub.Key, symbol string) error {
+func (c *Client) CancelAllOpenOrders(ctx context.Context, symbol string) error {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
 
-	resBody, err := pub.DeleteWithSign(key, "/fapi/v1/allOpenOrders", params)
+	resBody, err := c.DeleteWithSign(ctx, "/fapi/v1/allOpenOrders", params)
 	if err != nil {
 		return err
 	}
@@ -202,13 +359,13 @@ func CancelAllOpenOrders(key *pub.Key, symbol string) error {
 // Cancel all open orders of the specified symbol at the end of the specified countdown.
 // The endpoint should be called repeatedly as heartbeats so that the existing countdown time can be canceled and replaced by a new one.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Auto-Cancel-All-Open-Orders
-func CountdownCancleAll(key *pub.Key, symbol string, countdownTime int64) error {
+func (c *Client) CountdownCancleAll(ctx context.Context, symbol string, countdownTime int64) error {
 	params := map[string]interface{}{
 		"symbol":        symbol,
 		"countdownTime": countdownTime,
 	}
 
-	resBody, err := pub.DeleteWithSign(key, "/fapi/v1/countdownCancelAll", params)
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/countdownCancelAll", params)
 	if err != nil {
 		return err
 	}
@@ -227,19 +384,23 @@ func CountdownCancleAll(key *pub.Key, symbol string, countdownTime int64) error
 
 // Check an order's status.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Query-Order
-func QueryOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId string) (*orderResponse, error) {
+func (c *Client) QueryOrder(ctx context.Context, symbol string, orderId int64, origClientOrderId string) (*OrderResponse, error) {
 	params := map[string]interface{}{
-		"symbol":            symbol,
-		"orderId":           orderId,
-		"origClientOrderId": origClientOrderId,
+		"symbol": symbol,
+	}
+	if orderId != 0 { // either orderId or origClientOrderId must be sent
+		params["orderId"] = orderId
+	}
+	if origClientOrderId != "" {
+		params["origClientOrderId"] = origClientOrderId
 	}
 
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/order", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/order", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp orderResponse
+	var resp OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -250,21 +411,18 @@ func QueryOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId st
 
 // Get all account orders; active, canceled, or filled.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/All-Orders
-func QueryAllOrders(key *pub.Key, symbol string, orderId int64, startTime int64, endTime int64, limit int) ([]orderResponse, error) {
-	params := map[string]interface{}{
-		"symbol":    symbol,
-		"orderId":   orderId,
-		"startTime": startTime,
-		"endTime":   endTime,
-		"limit":     limit,
+func (c *Client) QueryAllOrders(ctx context.Context, p *AllOrdersParam) ([]OrderResponse, error) {
+	params, err := pub.EncodeParams(p)
+	if err != nil {
+		return nil, err
 	}
 
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/allOrders", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/allOrders", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []orderResponse
+	var resp []OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -275,17 +433,18 @@ func QueryAllOrders(key *pub.Key, symbol string, orderId int64, startTime int64,
 
 // Get all open orders on a symbol.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Current-All-Open-Orders
-func QueryOpenOrders(key *pub.Key, symbol string) ([]orderResponse, error) {
-	params := map[string]interface{}{
-		"symbol": symbol,
+func (c *Client) QueryOpenOrders(ctx context.Context, symbol string) ([]OrderResponse, error) {
+	params := map[string]interface{}{}
+	if symbol != "" { // all symbols if empty
+		params["symbol"] = symbol
 	}
 
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/openOrders", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/openOrders", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []orderResponse
+	var resp []OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -296,19 +455,23 @@ func QueryOpenOrders(key *pub.Key, symbol string) ([]orderResponse, error) {
 
 // Query open order
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Query-Current-Open-Order
-func QueryOpenOrder(key *pub.Key, symbol string, orderId int64, origClientOrderId string) (*orderResponse, error) {
+func (c *Client) QueryOpenOrder(ctx context.Context, symbol string, orderId int64, origClientOrderId string) (*OrderResponse, error) {
 	params := map[string]interface{}{
-		"symbol":            symbol,
-		"orderId":           orderId,
-		"origClientOrderId": origClientOrderId,
+		"symbol": symbol,
+	}
+	if orderId != 0 { // either orderId or origClientOrderId must be sent
+		params["orderId"] = orderId
+	}
+	if origClientOrderId != "" {
+		params["origClientOrderId"] = origClientOrderId
 	}
 
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/openOrder", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/openOrder", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp orderResponse
+	var resp OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -319,21 +482,18 @@ func QueryOpenOrder(key *pub.Key, symbol string, orderId int64, origClientOrderI
 
 // Query user's Force Orders
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Users-Force-Orders
-func QueryForceOrders(key *pub.Key, symbol string, autoCloseType string, startTime int64, endTime int64, limit int) ([]orderResponse, error) {
-	params := map[string]interface{}{
-		"symbol":        symbol,
-		"autoCloseType": autoCloseType,
-		"startTime":     startTime,
-		"endTime":       endTime,
-		"limit":         limit,
+func (c *Client) QueryForceOrders(ctx context.Context, p *ForceOrdersParam) ([]OrderResponse, error) {
+	params, err := pub.EncodeParams(p)
+	if err != nil {
+		return nil, err
 	}
 
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/forceOrders", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/forceOrders", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []orderResponse
+	var resp []OrderResponse
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -344,17 +504,13 @@ func QueryForceOrders(key *pub.Key, symbol string, autoCloseType string, startTi
 
 // Get trades for a specific account and symbol.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Account-Trade-List
-func QueryUserTrades(key *pub.Key, symbol string, orderId int64, startTime, endTime, fromId int64, limit int) ([]tradeInfo, error) {
-	params := map[string]interface{}{
-		"symbol":    symbol,
-		"orderId":   orderId,
-		"startTime": startTime,
-		"endTime":   endTime,
-		"fromId":    fromId,
-		"limit":     limit,
+func (c *Client) QueryUserTrades(ctx context.Context, p *UserTradesParam) ([]tradeInfo, error) {
+	params, err := pub.EncodeParams(p)
+	if err != nil {
+		return nil, err
 	}
 
-	resBody, err := pub.GetWithSign(key, "/fapi/v1/userTrades", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/userTrades", params)
 	if err != nil {
 		return nil, err
 	}
@@ -370,19 +526,16 @@ func QueryUserTrades(key *pub.Key, symbol string, orderId int64, startTime, endT
 
 // Change symbol level margin type
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Change-Margin-Type
-func SetMarginType(key *pub.Key, symbol string, marginType pub.MarginType) error {
+func (c *Client) SetMarginType(ctx context.Context, symbol string, marginType pub.MarginType) error {
 	params := map[string]interface{}{
 		"symbol":     symbol,
 		"marginType": marginType,
 	}
 
-	_, errMsg, err := pub.PostWithSign(key, "/fapi/v1/marginType", params)
+	_, err := c.PostWithSign(ctx, "/fapi/v1/marginType", params)
 	if err != nil {
 		return err
 	}
-	if errMsg.Code < 0 {
-		return fmt.Errorf("%+v", errMsg)
-	}
 
 	return nil
 }
@@ -390,37 +543,31 @@ func SetMarginType(key *pub.Key, symbol string, marginType pub.MarginType) error
 // Change user's position mode (Hedge Mode or One-way Mode ) on EVERY symbol
 // dualSidePosition: "true": Enable Hedge Mode, "false": one-way mode
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Change-Position-Mode
-func SetPositionMode(key *pub.Key, dualSidePosition bool) error {
+func (c *Client) SetPositionMode(ctx context.Context, dualSidePosition bool) error {
 	params := map[string]interface{}{
 		"dualSidePosition": dualSidePosition,
 	}
 
-	_, errMsg, err := pub.PostWithSign(key, "/fapi/v1/positionSide/dual", params)
+	_, err := c.PostWithSign(ctx, "/fapi/v1/positionSide/dual", params)
 	if err != nil {
 		return err
 	}
-	if errMsg.Code < 0 {
-		return fmt.Errorf("%+v", errMsg)
-	}
 
 	return nil
 }
 
 // Change user's initial leverage of specific symbol market.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Change-Initial-Leverage
-func SetLeverage(key *pub.Key, symbol string, leverage int) (*leverageInfo, error) {
+func (c *Client) SetLeverage(ctx context.Context, symbol string, leverage int) (*leverageInfo, error) {
 	params := map[string]interface{}{
 		"symbol":   symbol,
 		"leverage": leverage,
 	}
 
-	resBody, errMsg, err := pub.PostWithSign(key, "/fapi/v1/leverage", params)
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/leverage", params)
 	if err != nil {
 		return nil, err
 	}
-	if errMsg.Code < 0 {
-		return nil, fmt.Errorf("%+v", errMsg)
-	}
 
 	var resp leverageInfo
 	err = json.Unmarshal(resBody, &resp)
@@ -434,19 +581,16 @@ func SetLeverage(key *pub.Key, symbol string, leverage int) (*leverageInfo, erro
 // Change user's Multi-Assets mode (Multi-Assets Mode or Single-Asset Mode) on Every symbol
 // multiAssetMargin: true: Multi-asset mode, false: Single-asset mode
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Change-Multi-Assets-Mode
-func SetMarginAssetMode(key *pub.Key, symbol string, multiAssetMargin bool) error {
+func (c *Client) SetMarginAssetMode(ctx context.Context, symbol string, multiAssetMargin bool) error {
 	params := map[string]interface{}{
 		"symbol":           symbol,
 		"multiAssetMargin": multiAssetMargin,
 	}
 
-	_, errMsg, err := pub.PostWithSign(key, "/fapi/v1/multiAssetsMargin", params)
+	_, err := c.PostWithSign(ctx, "/fapi/v1/multiAssetsMargin", params)
 	if err != nil {
 		return err
 	}
-	if errMsg.Code < 0 {
-		return fmt.Errorf("%+v", errMsg)
-	}
 
 	return nil
 }
@@ -454,8 +598,7 @@ func SetMarginAssetMode(key *pub.Key, symbol string, multiAssetMargin bool) erro
 // Modify Isolated Position Margin
 // type_: 1: Add position margin, 2: Reduce position margin
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Modify-Isolated-Position-Margin
-func ModifyPositionMargin(key *pub.Key, symbol string, positionSide pub.PositionSide, amount string,
-	type_ int) error {
+func (c *Client) ModifyPositionMargin(ctx context.Context, symbol string, positionSide pub.PositionSide, amount string, type_ int) error {
 	params := map[string]interface{}{
 		"symbol":       symbol,
 		"positionSide": positionSide,
@@ -463,13 +606,10 @@ func ModifyPositionMargin(key *pub.Key, symbol string, positionSide pub.Position
 		"type":         type_,
 	}
 
-	_, errMsg, err := pub.PostWithSign(key, "/fapi/v1/positionMargin", params)
+	resBody, err := c.PostWithSign(ctx, "/fapi/v1/positionMargin", params)
 	if err != nil {
 		return err
 	}
-	if errMsg.Code < 0 {
-		return fmt.Errorf("%+v", errMsg)
-	}
 
 	var resp = struct {
 		Code   int     `json:"code"`
@@ -477,7 +617,7 @@ func ModifyPositionMargin(key *pub.Key, symbol string, positionSide pub.Position
 		Amount float64 `json:"amount"`
 		Type   int     `json:"type"`
 	}{}
-	err = json.Unmarshal([]byte(errMsg.Msg), &resp)
+	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return err
 	}
@@ -487,17 +627,18 @@ func ModifyPositionMargin(key *pub.Key, symbol string, positionSide pub.Position
 
 // Get current position information.
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Position-Information-V2
-func GetPositionInfoV2(symbol string) ([]positionInfo, error) {
-	params := map[string]interface{}{
-		"symbol": symbol,
+func (c *Client) GetPositionInfoV2(ctx context.Context, symbol string) ([]PositionInfo, error) {
+	params := map[string]interface{}{}
+	if symbol != "" { // all symbols if empty
+		params["symbol"] = symbol
 	}
 
-	resBody, err := pub.GetWithSign(nil, "/fapi/v2/positionRisk", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v2/positionRisk", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []positionInfo
+	var resp []PositionInfo
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -508,17 +649,18 @@ func GetPositionInfoV2(symbol string) ([]positionInfo, error) {
 
 // Get current position information(only symbol that has position or open orders will be returned).
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Position-Information-V3
-func GetPositionInfoV3(symbol string) ([]positionInfo, error) {
-	params := map[string]interface{}{
-		"symbol": symbol,
+func (c *Client) GetPositionInfoV3(ctx context.Context, symbol string) ([]PositionInfo, error) {
+	params := map[string]interface{}{}
+	if symbol != "" { // all symbols if empty
+		params["symbol"] = symbol
 	}
 
-	resBody, err := pub.GetWithSign(nil, "/fapi/v2/positionRisk", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v3/positionRisk", params)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []positionInfo
+	var resp []PositionInfo
 	err = json.Unmarshal(resBody, &resp)
 	if err != nil {
 		return nil, err
@@ -529,12 +671,12 @@ func GetPositionInfoV3(symbol string) ([]positionInfo, error) {
 
 // Position ADL Quantile Estimation
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Position-ADL-Quantile-Estimation
-func AdlQuantile(symbol string) ([]adlQuantile, error) {
+func (c *Client) AdlQuantile(ctx context.Context, symbol string) ([]adlQuantile, error) {
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
 
-	resBody, err := pub.GetWithSign(nil, "/fapi/v1/adlQuantile", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/adlQuantile", params)
 	if err != nil {
 		return nil, err
 	}
@@ -549,18 +691,14 @@ func AdlQuantile(symbol string) ([]adlQuantile, error) {
 }
 
 // Get Position Margin Change History
-// type_, 1: Add position margin，2: Reduce position margin
 // https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/rest-api/Get-Position-Margin-Change-History
-func GetPositionMarginHistory(symbol string, type_ int, startTime, endTime int64, limit int) ([]positionMarginHist, error) {
-	params := map[string]interface{}{
-		"symbol":    symbol,
-		"type":      type_,
-		"startTime": startTime,
-		"endTime":   endTime,
-		"limit":     limit,
+func (c *Client) GetPositionMarginHistory(ctx context.Context, p *PositionMarginHistoryParam) ([]positionMarginHist, error) {
+	params, err := pub.EncodeParams(p)
+	if err != nil {
+		return nil, err
 	}
 
-	resBody, err := pub.GetWithSign(nil, "/fapi/v1/positionMargin/history", params)
+	resBody, err := c.GetWithSign(ctx, "/fapi/v1/positionMargin/history", params)
 	if err != nil {
 		return nil, err
 	}
@@ -573,3 +711,21 @@ func GetPositionMarginHistory(symbol string, type_ int, startTime, endTime int64
 
 	return resp, nil
 }
+
+// batchParams encodes the orders to the JSON list of batchOrders, the values are strings like the single order.
+func batchParams[T any](orders []T) (pub.ParamData, error) {
+	list := make([]pub.ParamData, len(orders))
+	for i := range orders {
+		params, err := pub.EncodeParams(&orders[i])
+		if err != nil {
+			return nil, err
+		}
+		delete(params, "recvWindow") // recvWindow of the batch request is used
+		list[i] = params
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	return pub.ParamData{"batchOrders": string(b)}, nil
+}
@@ -1,12 +1,18 @@
 package trade
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/stretchr/testify/require"
 )
 
 // go test -v -run TestTestOrder
@@ -18,7 +24,7 @@ func TestTestOrder(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    *args
-		want    *orderResponse
+		want    *OrderResponse
 		wantErr bool
 	}{
 		{
@@ -42,7 +48,7 @@ func TestTestOrder(t *testing.T) {
 					Timestamp:        0,
 				},
 			},
-			&orderResponse{},
+			&OrderResponse{},
 			false,
 		},
 	}
@@ -147,3 +153,212 @@ func TestBatchOrders(t *testing.T) {
 		})
 	}
 }
+
+// go test -v -run TestNewOrderReconcile
+func TestNewOrderReconcile(t *testing.T) {
+	var mu sync.Mutex
+	orders := map[string]bool{} // client order id of accepted orders
+	var posts int
+	lostResponse := true // the first order is accepted, but its response is lost
+	late := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		q := r.URL.Query()
+		switch r.Method {
+		case http.MethodPost:
+			posts++
+			if posts == 1 {
+				orders[q.Get("newClientOrderId")] = lostResponse
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"code":-1007,"msg":"Timeout waiting for response from backend server. Send status unknown; execution status unknown."}`))
+				return
+			}
+			if late { // the first one reached the matching engine after the queries
+				orders[q.Get("newClientOrderId")] = true
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-4116,"msg":"ClientOrderId is duplicated."}`))
+				return
+			}
+			orders[q.Get("newClientOrderId")] = true
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": posts, "clientOrderId": q.Get("newClientOrderId")})
+		case http.MethodGet:
+			id := q.Get("origClientOrderId")
+			if !orders[id] {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-2013,"msg":"Order does not exist."}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 1, "clientOrderId": id, "status": "NEW"})
+		}
+	}))
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "", ""), &pub.Key{ApiKey: "api-key", SecretKey: "secret"})
+	pc.Retry = &pub.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}
+	c := NewClient(pc)
+	op := &OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "0.01"}
+
+	// accepted, found by the query
+	resp, err := c.NewOrder(context.Background(), op)
+	require.NoError(t, err)
+	require.Equal(t, 1, posts)
+	require.Equal(t, pub.OrderStatus("NEW"), resp.Status)
+	require.NotEmpty(t, resp.ClientOrderId)
+	require.Empty(t, op.NewClientOrderId) // the param of caller is not changed
+
+	// not accepted, sent again with the same client order id
+	posts, lostResponse = 0, false
+	op.NewClientOrderId = "my-order-1"
+	resp, err = c.NewOrder(context.Background(), op)
+	require.NoError(t, err)
+	require.Equal(t, 2, posts)
+	require.Equal(t, int64(2), resp.OrderId)
+	require.Equal(t, "my-order-1", resp.ClientOrderId)
+
+	// not found by the queries, but the resend is a duplicate
+	posts, late = 0, true
+	op.NewClientOrderId = "my-order-2"
+	resp, err = c.NewOrder(context.Background(), op)
+	require.NoError(t, err)
+	require.Equal(t, 2, posts)
+	require.Equal(t, int64(1), resp.OrderId)
+	require.Equal(t, "my-order-2", resp.ClientOrderId)
+}
+
+// go test -v -run TestBatchOrdersReconcile
+func TestBatchOrdersReconcile(t *testing.T) {
+	var mu sync.Mutex
+	queries := map[string]int{}
+	var batches [][]string // client order ids of each batch
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		q := r.URL.Query()
+		switch r.Method {
+		case http.MethodPost:
+			var list []map[string]string
+			json.Unmarshal([]byte(q.Get("batchOrders")), &list)
+			var ids []string
+			var resp []map[string]interface{}
+			for _, o := range list {
+				id := o["newClientOrderId"]
+				ids = append(ids, id)
+				if len(batches) == 0 && id != "a" { // b is accepted later, c is lost
+					resp = append(resp, map[string]interface{}{"code": -1007, "msg": "Timeout waiting for response from backend server."})
+				} else {
+					resp = append(resp, map[string]interface{}{"orderId": len(batches)*10 + len(ids), "clientOrderId": id, "status": "NEW"})
+				}
+			}
+			batches = append(batches, ids)
+			json.NewEncoder(w).Encode(resp)
+		case http.MethodGet:
+			id := q.Get("origClientOrderId")
+			queries[id]++
+			if id != "b" || queries[id] < 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-2013,"msg":"Order does not exist."}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 2, "clientOrderId": id, "status": "NEW"})
+		}
+	}))
+	defer srv.Close()
+
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, "", ""), &pub.Key{ApiKey: "api-key", SecretKey: "secret"})
+	pc.Retry = &pub.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}
+	ops := []OrderParam{
+		{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "0.01", NewClientOrderId: "a"},
+		{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "0.01", NewClientOrderId: "b"},
+		{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "0.01", NewClientOrderId: "c"},
+	}
+	resp, err := NewClient(pc).BatchOrders(context.Background(), ops)
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"a", "b", "c"}, {"c"}}, batches)
+	require.Len(t, resp, 3)
+	for i, o := range resp {
+		require.NoError(t, o.Err())
+		require.Equal(t, ops[i].NewClientOrderId, o.ClientOrderId)
+	}
+	require.Equal(t, int64(2), resp[1].OrderId)
+	require.Equal(t, 4, queries["c"]) // queried with backoff before it is sent again
+}
+
+// go test -v -run TestEncodeOrderParams
+func TestEncodeOrderParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		param interface{}
+		want  string
+	}{
+		{
+			"limit",
+			&OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, PositionSide: pub.PS_Long, Type: pub.OT_Limit, TimeInForce: pub.TIF_GTC,
+				Quantity: "0.01", Price: "30000.1", NewClientOrderId: "my-order-1", Timestamp: 1700000000000},
+			"newClientOrderId=my-order-1&positionSide=LONG&price=30000.1&quantity=0.01&side=BUY&symbol=BTCUSDT&timeInForce=GTC&type=LIMIT",
+		},
+		{
+			"reduce only false",
+			&OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Sell, Type: pub.OT_Market, Quantity: "0.01", ReduceOnly: pub.Bool(false), PriceProtect: pub.Bool(true)},
+			"priceProtect=true&quantity=0.01&reduceOnly=false&side=SELL&symbol=BTCUSDT&type=MARKET",
+		},
+		{
+			"close position",
+			&OrderParam{Symbol: "ETHUSDT", Side: pub.OS_Sell, Type: pub.OT_StopMarket, StopPrice: "1800", ClosePosition: pub.Bool(true),
+				WorkingType: pub.WT_MarkPrice, GoodTillDate: 1700000000000, RecvWindow: 3000},
+			"closePosition=true&goodTillDate=1700000000000&recvWindow=3000&side=SELL&stopPrice=1800&symbol=ETHUSDT&type=STOP_MARKET&workingType=MARK_PRICE",
+		},
+		{
+			"modify",
+			&ModifyParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Quantity: "0.02", Price: "30001", OrderId: 123},
+			"orderId=123&price=30001&quantity=0.02&side=BUY&symbol=BTCUSDT",
+		},
+		{
+			"all orders",
+			&AllOrdersParam{Symbol: "BTCUSDT", StartTime: 1700000000000},
+			"startTime=1700000000000&symbol=BTCUSDT",
+		},
+		{
+			"force orders of all symbols",
+			&ForceOrdersParam{AutoCloseType: "LIQUIDATION", Limit: 100},
+			"autoCloseType=LIQUIDATION&limit=100",
+		},
+		{
+			"user trades",
+			&UserTradesParam{Symbol: "BTCUSDT", FromId: 42},
+			"fromId=42&symbol=BTCUSDT",
+		},
+		{
+			"position margin history",
+			&PositionMarginHistoryParam{Symbol: "BTCUSDT"},
+			"symbol=BTCUSDT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pub.EncodeParamsQuery(tt.param)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	params, err := batchParams([]OrderParam{
+		{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "0.01", RecvWindow: 3000},
+		{Symbol: "BTCUSDT", Side: pub.OS_Sell, Type: pub.OT_Limit, TimeInForce: pub.TIF_GTC, Quantity: "0.01", Price: "40000", ReduceOnly: pub.Bool(true)},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `[{"quantity":"0.01","side":"BUY","symbol":"BTCUSDT","type":"MARKET"},`+
+		`{"price":"40000","quantity":"0.01","reduceOnly":"true","side":"SELL","symbol":"BTCUSDT","timeInForce":"GTC","type":"LIMIT"}]`,
+		params["batchOrders"])
+}
+
+// go test -v -run TestOrderResponseDecimal
+func TestOrderResponseDecimal(t *testing.T) {
+	var resp OrderResponse
+	err := json.Unmarshal([]byte(`{"orderId":22542179,"price":"0.10000","origQty":"10","executedQty":"3.3","avgPrice":"0.09990","cumQuote":"0.32967"}`), &resp)
+	require.NoError(t, err)
+	require.Equal(t, "0.1", resp.PriceDec().String())
+	left := resp.OrigQtyDec().Sub(resp.ExecutedQtyDec())
+	require.Equal(t, "6.7", left.String())
+	require.Equal(t, "0.32967", resp.ExecutedQtyDec().Mul(resp.AvgPriceDec()).String())
+}
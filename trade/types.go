@@ -2,31 +2,32 @@ package trade
 
 import "github.com/billfort/binance-usdmfuture/pub"
 
+// OrderParam is the parameters of new order, the optional parameters are omitted if they are empty.
 type OrderParam struct {
-	Symbol              string
-	Side                pub.OrderSide
-	PositionSide        pub.PositionSide
-	Type                pub.OrderType
-	TimeInForce         pub.TimeInForce
-	Quantity            string
-	ReduceOnly          string
-	Price               string
-	NewClientOrderId    string
-	StopPrice           string
-	ClosePosition       string // true, false. Close-All, used with STOP_MARKET and TAKE_PROFIT_MARKET
-	ActivationPrice     string
-	CallbackRate        string
-	WorkingType         pub.WorkingType
-	PriceProtect        string           // "TRUE", "FALSE", default "FALSE",
-	NewOrderRespType    pub.ResponseType // "ACK", "RESULT", default "ACK"
-	PriceMatch          pub.PriceMatch
-	SelfTradePrevention pub.StpMode
-	GoodTillDate        int64
-	RecvWindow          int64
-	Timestamp           int64
+	Symbol              string           `json:"symbol"`
+	Side                pub.OrderSide    `json:"side"`
+	PositionSide        pub.PositionSide `json:"positionSide,omitempty"`
+	Type                pub.OrderType    `json:"type"`
+	TimeInForce         pub.TimeInForce  `json:"timeInForce,omitempty"`
+	Quantity            string           `json:"quantity,omitempty"`
+	ReduceOnly          *bool            `json:"reduceOnly,omitempty"` // pub.Bool(true), cannot be sent in Hedge Mode
+	Price               string           `json:"price,omitempty"`
+	NewClientOrderId    string           `json:"newClientOrderId,omitempty"`
+	StopPrice           string           `json:"stopPrice,omitempty"`
+	ClosePosition       *bool            `json:"closePosition,omitempty"` // Close-All, used with STOP_MARKET and TAKE_PROFIT_MARKET
+	ActivationPrice     string           `json:"activationPrice,omitempty"`
+	CallbackRate        string           `json:"callbackRate,omitempty"`
+	WorkingType         pub.WorkingType  `json:"workingType,omitempty"`
+	PriceProtect        *bool            `json:"priceProtect,omitempty"`     // default false
+	NewOrderRespType    pub.ResponseType `json:"newOrderRespType,omitempty"` // "ACK", "RESULT", default "ACK"
+	PriceMatch          pub.PriceMatch   `json:"priceMatch,omitempty"`
+	SelfTradePrevention pub.StpMode      `json:"selfTradePreventionMode,omitempty"`
+	GoodTillDate        int64            `json:"goodTillDate,omitempty"`
+	RecvWindow          int64            `json:"recvWindow,omitempty"`
+	Timestamp           int64            `json:"-"` // set by the client
 }
 
-type orderResponse struct {
+type OrderResponse struct {
 	ClientOrderId       string           `json:"clientOrderId"`
 	CumQty              string           `json:"cumQty"`
 	CumQuote            string           `json:"cumQuote"`
@@ -58,16 +59,54 @@ type orderResponse struct {
 	Msg  string `json:"msg"`
 }
 
-type modifyParam struct {
+// ModifyParam is the parameters of modify order, either OrderId or OrigClientOrderId must be sent.
+type ModifyParam struct {
 	Symbol            string         `json:"symbol"`
 	Side              pub.OrderSide  `json:"side"`
 	Quantity          string         `json:"quantity"`
-	Price             string         `json:"price"`
-	OrderId           int64          `json:"orderId"`
-	OrigClientOrderId string         `json:"origClientOrderId"`
-	PriceMatch        pub.PriceMatch `json:"priceMatch"`
-	RecvWindow        int64          `json:"recvWindow"`
-	Timestamp         int64          `json:"timestamp"`
+	Price             string         `json:"price,omitempty"`
+	OrderId           int64          `json:"orderId,omitempty"`
+	OrigClientOrderId string         `json:"origClientOrderId,omitempty"`
+	PriceMatch        pub.PriceMatch `json:"priceMatch,omitempty"`
+	RecvWindow        int64          `json:"recvWindow,omitempty"`
+	Timestamp         int64          `json:"-"` // set by the client
+}
+
+// AllOrdersParam is the parameters of QueryAllOrders, the zero values are not sent.
+type AllOrdersParam struct {
+	Symbol    string `json:"symbol"`
+	OrderId   int64  `json:"orderId,omitempty"` // the orders >= orderId, else the most recent ones
+	StartTime int64  `json:"startTime,omitempty"`
+	EndTime   int64  `json:"endTime,omitempty"`
+	Limit     int    `json:"limit,omitempty"` // default 500, max 1000
+}
+
+// ForceOrdersParam is the parameters of QueryForceOrders, the zero values are not sent.
+type ForceOrdersParam struct {
+	Symbol        string `json:"symbol,omitempty"`        // all symbols if empty
+	AutoCloseType string `json:"autoCloseType,omitempty"` // "LIQUIDATION", "ADL", both if empty
+	StartTime     int64  `json:"startTime,omitempty"`
+	EndTime       int64  `json:"endTime,omitempty"`
+	Limit         int    `json:"limit,omitempty"` // default 50, max 100
+}
+
+// UserTradesParam is the parameters of QueryUserTrades, the zero values are not sent.
+type UserTradesParam struct {
+	Symbol    string `json:"symbol"`
+	OrderId   int64  `json:"orderId,omitempty"` // used with Symbol only
+	StartTime int64  `json:"startTime,omitempty"`
+	EndTime   int64  `json:"endTime,omitempty"`
+	FromId    int64  `json:"fromId,omitempty"` // the trades >= fromId, cannot be sent with StartTime and EndTime
+	Limit     int    `json:"limit,omitempty"`  // default 500, max 1000
+}
+
+// PositionMarginHistoryParam is the parameters of GetPositionMarginHistory, the zero values are not sent.
+type PositionMarginHistoryParam struct {
+	Symbol    string `json:"symbol"`
+	Type      int    `json:"type,omitempty"` // 1: add position margin, 2: reduce position margin, both if 0
+	StartTime int64  `json:"startTime,omitempty"`
+	EndTime   int64  `json:"endTime,omitempty"`
+	Limit     int    `json:"limit,omitempty"` // default 500
 }
 
 type tradeInfo struct {
@@ -93,7 +132,7 @@ type leverageInfo struct {
 	MaxNotionalValue string `json:"maxNotionalValue"`
 }
 
-type positionInfo struct {
+type PositionInfo struct {
 	Symbol                 string `json:"symbol"`
 	PositionSide           string `json:"positionSide"`
 	PositionAmt            string `json:"positionAmt"`
@@ -138,3 +177,40 @@ type positionMarginHist struct {
 	Time         int64  `json:"time"`
 	PositionSide string `json:"positionSide"`
 }
+
+// Err returns the *pub.APIError of an order which failed in a batch, such as {"code":-1007,...}, or nil.
+func (o *OrderResponse) Err() error {
+	if o.Code >= 0 {
+		return nil
+	}
+	return &pub.APIError{Code: o.Code, Msg: o.Msg}
+}
+
+// Decimal accessors of the string numbers, such as PriceDec() for Price.
+
+func (o *OrderResponse) ExecutedQtyDec() pub.Decimal   { return pub.D(o.ExecutedQty) }
+func (o *OrderResponse) AvgPriceDec() pub.Decimal      { return pub.D(o.AvgPrice) }
+func (o *OrderResponse) OrigQtyDec() pub.Decimal       { return pub.D(o.OrigQty) }
+func (o *OrderResponse) PriceDec() pub.Decimal         { return pub.D(o.Price) }
+func (o *OrderResponse) StopPriceDec() pub.Decimal     { return pub.D(o.StopPrice) }
+func (o *OrderResponse) CumQtyDec() pub.Decimal        { return pub.D(o.CumQty) }
+func (o *OrderResponse) CumQuoteDec() pub.Decimal      { return pub.D(o.CumQuote) }
+func (o *OrderResponse) ActivatePriceDec() pub.Decimal { return pub.D(o.ActivatePrice) }
+func (o *OrderResponse) PriceRateDec() pub.Decimal     { return pub.D(o.PriceRate) }
+
+func (t *tradeInfo) PriceDec() pub.Decimal       { return pub.D(t.Price) }
+func (t *tradeInfo) QtyDec() pub.Decimal         { return pub.D(t.Qty) }
+func (t *tradeInfo) QuoteQtyDec() pub.Decimal    { return pub.D(t.QuoteQty) }
+func (t *tradeInfo) CommissionDec() pub.Decimal  { return pub.D(t.Commission) }
+func (t *tradeInfo) RealizedPnlDec() pub.Decimal { return pub.D(t.RealizedPnl) }
+
+func (p *PositionInfo) PositionAmtDec() pub.Decimal      { return pub.D(p.PositionAmt) }
+func (p *PositionInfo) EntryPriceDec() pub.Decimal       { return pub.D(p.EntryPrice) }
+func (p *PositionInfo) BreakEvenPriceDec() pub.Decimal   { return pub.D(p.BreakEvenPrice) }
+func (p *PositionInfo) MarkPriceDec() pub.Decimal        { return pub.D(p.MarkPrice) }
+func (p *PositionInfo) UnRealizedProfitDec() pub.Decimal { return pub.D(p.UnRealizedProfit) }
+func (p *PositionInfo) LiquidationPriceDec() pub.Decimal { return pub.D(p.LiquidationPrice) }
+func (p *PositionInfo) IsolatedMarginDec() pub.Decimal   { return pub.D(p.IsolatedMargin) }
+func (p *PositionInfo) NotionalDec() pub.Decimal         { return pub.D(p.Notional) }
+func (p *PositionInfo) InitialMarginDec() pub.Decimal    { return pub.D(p.InitialMargin) }
+func (p *PositionInfo) MaintMarginDec() pub.Decimal      { return pub.D(p.MaintMargin) }
@@ -0,0 +1,354 @@
+// Package wsapi sends the trade and account requests by the websocket api of binance,
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/websocket-api-general-info
+package wsapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/account"
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Client sends the requests of the websocket api on one managed connection, the responses are matched by the request id.
+// The signed requests carry apiKey and signature, unless the session is logged on by an Ed25519 key.
+type Client struct {
+	*pub.Client
+	Timeout time.Duration // timeout of each request, default 10 seconds
+
+	mu       sync.Mutex
+	conn     *pub.WsConn
+	ctx      context.Context
+	session  bool  // Logon is called, log on again after reconnection
+	logonGen int64 // generation of the connection logged on, a new connection is not logged on
+}
+
+func NewClient(c *pub.Client) *Client {
+	return &Client{Client: c, Timeout: defaultTimeout}
+}
+
+// SessionStatus is the result of session.logon, session.status and session.logout.
+type SessionStatus struct {
+	ApiKey           string `json:"apiKey"` // empty if not logged on
+	AuthorizedSince  int64  `json:"authorizedSince"`
+	ConnectedSince   int64  `json:"connectedSince"`
+	ReturnRateLimits bool   `json:"returnRateLimits"`
+	ServerTime       int64  `json:"serverTime"`
+}
+
+// Start connects to the websocket api, the connection is kept until ctx is done.
+// The session is logged on if the key is Ed25519, the only key type supported by session.logon.
+func (c *Client) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.conn != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("wsapi: already started")
+	}
+	conn := c.NewWsApiConn()
+	c.conn, c.ctx = conn, ctx
+	c.mu.Unlock()
+
+	if err := conn.Start(ctx); err != nil {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		return err
+	}
+	go c.watch(conn)
+	if c.Key != nil && c.Key.KeyType == pub.KT_Ed25519 {
+		if _, err := c.Logon(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watch logs on again after reconnection, and drops the messages which are not responses.
+// The new connection is not logged on by its generation, before the event is handled.
+func (c *Client) watch(conn *pub.WsConn) {
+	go func() {
+		for m := range conn.Messages() {
+			c.Logf("wsapi unexpected message: %v", string(m.Message))
+		}
+	}()
+	first := true // the first connection is logged on by Start
+	for e := range conn.Events() {
+		if e.Type != pub.WE_Connected { // a new connection, including the rotated one
+			continue
+		}
+		if first {
+			first = false
+			continue
+		}
+		c.mu.Lock()
+		session, ctx := c.session, c.ctx
+		c.mu.Unlock()
+		if session {
+			go func() {
+				if _, err := c.logon(ctx); err != nil {
+					c.Logf("wsapi logon again err: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+// LoggedOn reports whether the current connection is logged on, the signed requests are not signed one by one then.
+func (c *Client) LoggedOn() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil && c.logonGen == c.conn.Generation()
+}
+
+// Request sends the request and returns its result, it fails after c.Timeout.
+// The signed requests get timestamp and recvWindow, and apiKey and signature if the session is not logged on.
+// The error response is returned as *pub.APIError, Method is "WS" and Endpoint is the method of the request.
+func (c *Client) Request(ctx context.Context, method string, params pub.ParamData, signed bool) (json.RawMessage, error) {
+	result, _, err := c.request(ctx, method, params, signed)
+	return result, err
+}
+
+// request sends the request on the connection whose logon state it is signed by, and returns the generation of
+// the connection. It is signed again if the connection is changed before it is sent.
+func (c *Client) request(ctx context.Context, method string, params pub.ParamData, signed bool) (json.RawMessage, int64, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return nil, 0, fmt.Errorf("wsapi %v: not started", method)
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		gen := conn.Generation()
+		p := params
+		if signed {
+			c.mu.Lock()
+			loggedOn := c.logonGen == gen
+			c.mu.Unlock()
+			var err error
+			if p, err = c.sign(ctx, params, !loggedOn); err != nil {
+				return nil, 0, fmt.Errorf("wsapi %v: %w", method, err)
+			}
+		}
+
+		var v interface{}
+		if len(p) > 0 {
+			v = p
+		}
+		result, err := conn.RequestOn(ctx, gen, method, v)
+		if errors.Is(err, pub.ErrWsConnChanged) && attempt < 2 {
+			continue
+		}
+		var wsErr *pub.WsError
+		if errors.As(err, &wsErr) {
+			return nil, gen, &pub.APIError{StatusCode: wsErr.Status, Code: wsErr.Code, Msg: wsErr.Msg, Method: "WS", Endpoint: method}
+		}
+		return result, gen, err
+	}
+}
+
+// sign copies the params with timestamp and recvWindow, and apiKey and signature if withSignature.
+func (c *Client) sign(ctx context.Context, params pub.ParamData, withSignature bool) (pub.ParamData, error) {
+	if c.Key == nil {
+		return nil, fmt.Errorf("key is nil")
+	}
+	p := make(pub.ParamData, len(params)+4)
+	for k, v := range params {
+		p[k] = v
+	}
+	if _, ok := p["recvWindow"]; !ok && c.RecvWindow > 0 {
+		p["recvWindow"] = c.RecvWindow
+	}
+	p["timestamp"] = c.Timestamp(ctx)
+	if !withSignature {
+		return p, nil
+	}
+	p["apiKey"] = c.Key.ApiKey
+	_, signature, err := c.Key.SignParams(p, true)
+	if err != nil {
+		return nil, err
+	}
+	p["signature"] = signature
+	return p, nil
+}
+
+// Logon authenticates the connection by session.logon with an Ed25519 key, the signed requests are not signed
+// one by one after it, and the session is logged on again after reconnection.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/websocket-api-general-info#log-in-with-api-key-signed
+func (c *Client) Logon(ctx context.Context) (*SessionStatus, error) {
+	if c.Key == nil || c.Key.KeyType != pub.KT_Ed25519 {
+		return nil, fmt.Errorf("wsapi session.logon: only Ed25519 key is supported")
+	}
+	c.mu.Lock()
+	c.session = true
+	c.mu.Unlock()
+	return c.logon(ctx)
+}
+
+func (c *Client) logon(ctx context.Context) (*SessionStatus, error) {
+	params, err := c.sign(ctx, nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("wsapi session.logon: %w", err)
+	}
+	result, gen, err := c.request(ctx, "session.logon", params, false)
+	if err != nil {
+		return nil, err
+	}
+	var s SessionStatus
+	if err := json.Unmarshal(result, &s); err != nil {
+		return nil, fmt.Errorf("wsapi session.logon: %w", err)
+	}
+	c.mu.Lock()
+	c.logonGen = gen
+	c.mu.Unlock()
+	return &s, nil
+}
+
+// Logout forgets the key of the session, the signed requests are signed one by one after it.
+func (c *Client) Logout(ctx context.Context) (*SessionStatus, error) {
+	c.mu.Lock()
+	c.session = false
+	c.mu.Unlock()
+	var s SessionStatus
+	if err := c.do(ctx, "session.logout", nil, false, &s); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.logonGen = 0
+	c.mu.Unlock()
+	return &s, nil
+}
+
+// SessionStatus queries the status of the session.
+func (c *Client) SessionStatus(ctx context.Context) (*SessionStatus, error) {
+	var s SessionStatus
+	if err := c.do(ctx, "session.status", nil, false, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// do sends the request and decodes its result to v.
+func (c *Client) do(ctx context.Context, method string, params pub.ParamData, signed bool, v interface{}) error {
+	result, err := c.Request(ctx, method, params, signed)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(result, v); err != nil {
+		return fmt.Errorf("wsapi %v: %w", method, err)
+	}
+	return nil
+}
+
+// PlaceOrder sends a new order by order.place, a random NewClientOrderId is set if it is empty.
+// It is not retried, if the status is unknown, query the order by NewClientOrderId.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/websocket-api
+func (c *Client) PlaceOrder(ctx context.Context, op *trade.OrderParam) (*trade.OrderResponse, error) {
+	if err := c.CheckOrderGate(ctx); err != nil {
+		return nil, err
+	}
+	p := *op
+	if p.NewClientOrderId == "" {
+		p.NewClientOrderId = pub.NewClientOrderId()
+	}
+	params, err := pub.EncodeParams(&p)
+	if err != nil {
+		return nil, err
+	}
+	var resp trade.OrderResponse
+	if err := c.do(ctx, "order.place", params, true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ModifyOrder modifies a LIMIT order by order.modify.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/websocket-api/Modify-Order
+func (c *Client) ModifyOrder(ctx context.Context, mp *trade.ModifyParam) (*trade.OrderResponse, error) {
+	params, err := pub.EncodeParams(mp)
+	if err != nil {
+		return nil, err
+	}
+	var resp trade.OrderResponse
+	if err := c.do(ctx, "order.modify", params, true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelOrder cancels an order by order.cancel, either orderId or origClientOrderId must be sent.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/websocket-api/Cancel-Order
+func (c *Client) CancelOrder(ctx context.Context, symbol string, orderId int64, origClientOrderId string) (*trade.OrderResponse, error) {
+	var resp trade.OrderResponse
+	if err := c.do(ctx, "order.cancel", orderParams(symbol, orderId, origClientOrderId), true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// QueryOrder queries an order by order.status, either orderId or origClientOrderId must be sent.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/websocket-api/Query-Order
+func (c *Client) QueryOrder(ctx context.Context, symbol string, orderId int64, origClientOrderId string) (*trade.OrderResponse, error) {
+	var resp trade.OrderResponse
+	if err := c.do(ctx, "order.status", orderParams(symbol, orderId, origClientOrderId), true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func orderParams(symbol string, orderId int64, origClientOrderId string) pub.ParamData {
+	params := pub.ParamData{"symbol": symbol}
+	if orderId != 0 {
+		params["orderId"] = orderId
+	}
+	if origClientOrderId != "" {
+		params["origClientOrderId"] = origClientOrderId
+	}
+	return params
+}
+
+// Positions queries the positions by v2/account.position, all symbols if symbol is empty.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/trade/websocket-api/Position-Info-V2
+func (c *Client) Positions(ctx context.Context, symbol string) ([]trade.PositionInfo, error) {
+	params := pub.ParamData{}
+	if symbol != "" {
+		params["symbol"] = symbol
+	}
+	var resp []trade.PositionInfo
+	if err := c.do(ctx, "v2/account.position", params, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// AccountBalance queries the balances by v2/account.balance.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/account/websocket-api/Futures-Account-Balance-V2
+func (c *Client) AccountBalance(ctx context.Context) ([]account.Balance, error) {
+	var resp []account.Balance
+	if err := c.do(ctx, "v2/account.balance", nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// AccountInfo queries the account by v2/account.status.
+// https://developers.binance.com/docs/derivatives/usds-margined-futures/account/websocket-api/Account-Information-V2
+func (c *Client) AccountInfo(ctx context.Context) (*account.Info, error) {
+	var resp account.Info
+	if err := c.do(ctx, "v2/account.status", nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,308 @@
+package wsapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/billfort/binance-usdmfuture/pub"
+	"github.com/billfort/binance-usdmfuture/trade"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// mockWsApi serves /ws-fapi/v1, the signed requests are verified by the HMAC secret or the Ed25519 key of session.logon.
+// order.cancel fails with -2011, order.status of "SLOW" is never answered, session.status of a logged on session drops the connection.
+type mockWsApi struct {
+	secret     string
+	pubKey     ed25519.PublicKey
+	logonDelay time.Duration // of the responses of session.logon after the first one
+
+	mu       sync.Mutex
+	logons   int
+	unsigned []string // methods of the signed requests sent without signature
+	errs     []string
+}
+
+type mockRequest struct {
+	Id     int64                  `json:"id"`
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+func (m *mockWsApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ws-fapi/v1" {
+		http.NotFound(w, r)
+		return
+	}
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var wmu sync.Mutex
+	reply := func(id int64, status int, result interface{}, errMsg *pub.WsError) {
+		resp := map[string]interface{}{"id": id, "status": status}
+		if errMsg != nil {
+			resp["error"] = errMsg
+		} else {
+			resp["result"] = result
+		}
+		b, _ := json.Marshal(resp)
+		wmu.Lock()
+		conn.WriteMessage(websocket.TextMessage, b)
+		wmu.Unlock()
+	}
+
+	loggedOn := false
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req mockRequest
+		d := json.NewDecoder(bytes.NewReader(msg))
+		d.UseNumber() // keep the numbers as sent for the signature
+		if err := d.Decode(&req); err != nil {
+			m.fail("decode %v: %v", string(msg), err)
+			continue
+		}
+
+		switch req.Method {
+		case "session.logon":
+			if !m.verify(req.Params, true) {
+				reply(req.Id, 401, nil, &pub.WsError{Code: -1022, Msg: "Signature for this request is not valid."})
+				continue
+			}
+			loggedOn = true
+			m.mu.Lock()
+			m.logons++
+			delay := m.logonDelay
+			if m.logons == 1 {
+				delay = 0
+			}
+			m.mu.Unlock()
+			go func(id int64, apiKey interface{}) {
+				time.Sleep(delay)
+				reply(id, 200, map[string]interface{}{"apiKey": apiKey, "authorizedSince": 1, "connectedSince": 1, "serverTime": 2}, nil)
+			}(req.Id, req.Params["apiKey"])
+			continue
+		case "session.logout":
+			loggedOn = false
+			reply(req.Id, 200, map[string]interface{}{"apiKey": nil, "connectedSince": 1, "serverTime": 2}, nil)
+			continue
+		case "session.status":
+			if loggedOn {
+				return // dropped, to test the logon after reconnection
+			}
+			reply(req.Id, 200, map[string]interface{}{"apiKey": nil, "connectedSince": 1, "serverTime": 2}, nil)
+			continue
+		}
+
+		if _, ok := req.Params["signature"]; ok {
+			if !m.verify(req.Params, false) {
+				reply(req.Id, 400, nil, &pub.WsError{Code: -1022, Msg: "Signature for this request is not valid."})
+				continue
+			}
+		} else {
+			m.mu.Lock()
+			m.unsigned = append(m.unsigned, req.Method)
+			m.mu.Unlock()
+			if !loggedOn {
+				reply(req.Id, 401, nil, &pub.WsError{Code: -1002, Msg: "You are not authorized to execute this request."})
+				continue
+			}
+		}
+		if req.Params["timestamp"] == nil {
+			m.fail("%v without timestamp", req.Method)
+		}
+
+		go func(req mockRequest) { // answer out of order
+			n, _ := rand.Int(rand.Reader, big.NewInt(20))
+			time.Sleep(time.Duration(n.Int64()) * time.Millisecond)
+			switch req.Method {
+			case "order.place":
+				reply(req.Id, 200, map[string]interface{}{
+					"orderId": 1, "symbol": req.Params["symbol"], "status": "NEW",
+					"clientOrderId": req.Params["newClientOrderId"], "price": req.Params["price"], "origQty": req.Params["quantity"],
+				}, nil)
+			case "order.cancel":
+				reply(req.Id, 400, nil, &pub.WsError{Code: pub.EC_CancelRejected, Msg: "Unknown order sent."})
+			case "order.status":
+				if req.Params["symbol"] == "SLOW" {
+					return
+				}
+				reply(req.Id, 400, nil, &pub.WsError{Code: pub.EC_NoSuchOrder, Msg: "Order does not exist."})
+			case "v2/account.position":
+				reply(req.Id, 200, []map[string]interface{}{{"symbol": req.Params["symbol"], "positionSide": "BOTH", "positionAmt": "0.010"}}, nil)
+			case "v2/account.balance":
+				reply(req.Id, 200, []map[string]interface{}{{"asset": "USDT", "balance": "100.0"}}, nil)
+			default:
+				reply(req.Id, 400, nil, &pub.WsError{Code: -1000, Msg: "unknown method " + req.Method})
+			}
+		}(req)
+	}
+}
+
+// verify checks the signature of the params sorted by name, by the Ed25519 key if ed, else by the HMAC secret.
+func (m *mockWsApi) verify(params map[string]interface{}, ed bool) bool {
+	p := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if k != "signature" {
+			p[k] = v
+		}
+	}
+	payload := pub.EncodeQueryString(p, true)
+	sig, _ := params["signature"].(string)
+	if ed {
+		b, err := base64.StdEncoding.DecodeString(sig)
+		return err == nil && ed25519.Verify(m.pubKey, []byte(payload), b)
+	}
+	expected, _ := pub.NewHmacSigner(m.secret).Sign(payload)
+	return sig != "" && sig == expected
+}
+
+func (m *mockWsApi) fail(format string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errs = append(m.errs, fmt.Sprintf(format, args...))
+}
+
+func newMockClient(t *testing.T, mock *mockWsApi, key *pub.Key) *Client {
+	srv := httptest.NewServer(mock)
+	t.Cleanup(srv.Close)
+	wsUrl := "ws" + strings.TrimPrefix(srv.URL, "http")
+	pc := pub.NewEnvClient(pub.CustomEnv("mock", srv.URL, srv.URL, wsUrl, wsUrl+"/ws-fapi/v1"), key)
+	return NewClient(pc)
+}
+
+// go test -v -run TestRequests
+func TestRequests(t *testing.T) {
+	mock := &mockWsApi{secret: "secret"}
+	c := newMockClient(t, mock, &pub.Key{ApiKey: "api", SecretKey: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, c.Start(ctx))
+	require.False(t, c.LoggedOn())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			op := &trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Limit, TimeInForce: pub.TIF_GTC,
+				Quantity: "0.001", Price: fmt.Sprint(50000 + i), NewClientOrderId: fmt.Sprint("c", i)}
+			resp, err := c.PlaceOrder(ctx, op)
+			require.NoError(t, err)
+			require.Equal(t, op.NewClientOrderId, resp.ClientOrderId) // matched by id
+			require.Equal(t, op.Price, resp.Price)
+		}(i)
+	}
+	wg.Wait()
+
+	resp, err := c.PlaceOrder(ctx, &trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Sell, Type: pub.OT_Market, Quantity: "0.001"})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.ClientOrderId)
+
+	_, err = c.CancelOrder(ctx, "BTCUSDT", 123, "")
+	e, ok := pub.AsAPIError(err)
+	require.True(t, ok)
+	require.Equal(t, pub.EC_CancelRejected, e.Code)
+	require.Equal(t, 400, e.StatusCode)
+	require.Equal(t, "order.cancel", e.Endpoint)
+
+	_, err = c.QueryOrder(ctx, "BTCUSDT", 0, "c1")
+	require.True(t, pub.IsNoSuchOrder(err))
+
+	c.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err = c.QueryOrder(ctx, "SLOW", 1, "")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	c.Timeout = defaultTimeout
+
+	positions, err := c.Positions(ctx, "BTCUSDT")
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.Equal(t, "0.010", positions[0].PositionAmt)
+
+	balances, err := c.AccountBalance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "USDT", balances[0].Asset)
+
+	_, err = c.Logon(ctx)
+	require.Error(t, err) // HMAC key
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	require.Empty(t, mock.errs)
+	require.Empty(t, mock.unsigned)
+}
+
+// go test -v -run TestLogon
+func TestLogon(t *testing.T) {
+	pubKey, pk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(pk)
+	require.NoError(t, err)
+	key, err := pub.NewEd25519Key("api", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	require.NoError(t, err)
+
+	mock := &mockWsApi{pubKey: pubKey}
+	c := newMockClient(t, mock, key)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, c.Start(ctx))
+	require.True(t, c.LoggedOn())
+
+	resp, err := c.PlaceOrder(ctx, &trade.OrderParam{Symbol: "BTCUSDT", Side: pub.OS_Buy, Type: pub.OT_Market, Quantity: "0.001"})
+	require.NoError(t, err)
+	require.Equal(t, "BTCUSDT", resp.Symbol)
+
+	mock.mu.Lock()
+	mock.logonDelay = 500 * time.Millisecond
+	mock.mu.Unlock()
+	_, err = c.SessionStatus(ctx) // dropped by the mock
+	require.Error(t, err)
+	// the new connection is not logged on until its logon is answered, the requests are signed one by one
+	require.Eventually(t, func() bool { return c.conn.Generation() == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.False(t, c.LoggedOn())
+	_, err = c.Positions(ctx, "")
+	e, ok := pub.AsAPIError(err)
+	require.True(t, ok)
+	require.Equal(t, -1022, e.Code) // the mock verifies HMAC only
+	require.Eventually(t, func() bool {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		return mock.logons == 2 && c.LoggedOn()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = c.Positions(ctx, "")
+	require.NoError(t, err)
+
+	s, err := c.Logout(ctx)
+	require.NoError(t, err)
+	require.Empty(t, s.ApiKey)
+	require.False(t, c.LoggedOn())
+	_, err = c.Positions(ctx, "") // signed by the request
+	require.Error(t, err)         // the mock verifies HMAC only
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	require.Empty(t, mock.errs)
+	require.Equal(t, []string{"order.place", "v2/account.position"}, mock.unsigned)
+}